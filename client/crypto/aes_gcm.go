@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // hàm sinh AES Key
@@ -26,86 +27,47 @@ func GenerateAESKey() ([]byte, error) {
 	return key, nil
 }
 
-// Hàm mã hóa file
+// Hàm mã hóa file (theo từng chunk, không đọc hết file vào RAM)
 func EncryptFile(inputFile string, outputFile string, key []byte) error {
-	// đọc toàn bộ input file
-	plaintext, err := os.ReadFile(inputFile)
+	in, err := os.Open(inputFile)
 	if err != nil {
 		return fmt.Errorf("lỗi đọc file đầu vào: %w", err)
 	}
+	defer in.Close()
 
-	// tạo block cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return fmt.Errorf("lỗi tạo block cipher: %w", err)
-	}
-
-	// aesGCM hỗ trợ mã hóa
-	aesGCM, err := cipher.NewGCM(block)
-	if err != nil {
-		return fmt.Errorf("lỗi tạo GCM: %w", err)
-	}
-
-	// tạo nonce
-	nonce := make([]byte, aesGCM.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
-		return fmt.Errorf("lỗi tạo nonce: %w", err)
-	}
-
-	// thực hiện mã hóa
-	ciphertext := aesGCM.Seal(nonce, nonce, plaintext, nil)
-
-	// trả kết quả
-	err = os.WriteFile(outputFile, ciphertext, 0644)
-	if err != nil {
-		return fmt.Errorf("lỗi ghi file đầu ra: %w", err)
-	}
-
-	return nil
-
+	return writeFileFrom(outputFile, func(w io.Writer) error {
+		return EncryptStream(w, in, key)
+	})
 }
 
 // hàm giải mã file
 func DecryptedByAESKey(key []byte, inputFile string, outputFile string) error {
-	// đọc toàn bộ input file
-	ciphertext, err := os.ReadFile(inputFile)
+	in, err := os.Open(inputFile)
 	if err != nil {
 		return fmt.Errorf("lỗi đọc file mã hóa: %w", err)
 	}
+	defer in.Close()
 
-	// tạo block cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return fmt.Errorf("lỗi tạo block cipher: %w", err)
-	}
+	return writeFileFrom(outputFile, func(w io.Writer) error {
+		return DecryptStream(w, in, key)
+	})
+}
 
-	// aesGCM hỗ trợ mã hóa
-	aesGCM, err := cipher.NewGCM(block)
+// Ghi file đầu ra bằng hàm write, xóa file nếu có lỗi để không để lại dữ liệu dở dang
+func writeFileFrom(outputFile string, write func(w io.Writer) error) error {
+	out, err := os.OpenFile(outputFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return fmt.Errorf("lỗi tạo GCM: %w", err)
-	}
-
-	// kiểm tra kích thước file có hợp lệ không
-	nonceSize := aesGCM.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return fmt.Errorf("dữ liệu quá ngắn, không đúng định dạng")
+		return fmt.Errorf("lỗi tạo file đầu ra: %w", err)
 	}
 
-	// tách nonce
-	nonce, actualCiphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-
-	// giải mã
-	plaintext, err := aesGCM.Open(nil, nonce, actualCiphertext, nil)
-	if err != nil {
-		return fmt.Errorf("giải mã thất bại (sai khóa hoặc file bị sửa đổi): %w", err)
+	err = write(out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
 	}
-
-	// trả kết quả
-	err = os.WriteFile(outputFile, plaintext, 0644)
 	if err != nil {
-		return fmt.Errorf("lỗi ghi file giải mã: %w", err)
+		os.Remove(outputFile)
+		return err
 	}
-
 	return nil
 }
 
@@ -141,42 +103,75 @@ func ConvertStringToBinary(base64String string, outputPath string) error {
 	return nil
 }
 
-// Mã file
-func PrepareFileForUpload(filePath string, password string) (string, string, error) {
-
+// Sinh AES Key cho note mới, trả về (AES Key, AES Key đã mã hóa bằng password)
+func NewNoteKey(password string) ([]byte, string, error) {
 	// sinh AES Key ngẫu nhiên (32 bytes)
 	aesKey, err := GenerateAESKey()
 	if err != nil {
-		return "", "", fmt.Errorf("lỗi sinh khóa AES: %v", err)
+		return nil, "", fmt.Errorf("lỗi sinh khóa AES: %v", err)
 	}
 
-	// mã hóa File
-	tempEncryptedPath := filePath + ".enc_temp"
+	// mã hóa AES Key bằng Password
+	encryptedAESKey, err := EncryptByPassword(hex.EncodeToString(aesKey), password)
+	if err != nil {
+		return nil, "", fmt.Errorf("lỗi mã hóa khóa AES: %v", err)
+	}
+	return aesKey, encryptedAESKey, nil
+}
 
-	// đảm bảo xóa file tạm này khi hàm chạy xong
-	defer os.Remove(tempEncryptedPath)
+// Mã file
+// File được mã hóa theo luồng rồi đưa thẳng qua bộ mã hóa Base64, không tạo file tạm trên đĩa
+func PrepareFileForUpload(filePath string, password string) (string, string, error) {
 
-	err = EncryptFile(filePath, tempEncryptedPath, aesKey)
+	aesKey, encryptedAESKey, err := NewNoteKey(password)
 	if err != nil {
-		return "", "", fmt.Errorf("lỗi mã hóa file: %v", err)
+		return "", "", err
 	}
 
-	// chuyển File đã mã hóa sang Base64
-	cipherTextBase64, err := ConvertBinaryToString(tempEncryptedPath)
+	in, err := os.Open(filePath)
 	if err != nil {
+		return "", "", fmt.Errorf("lỗi đọc file đầu vào: %v", err)
+	}
+	defer in.Close()
+
+	// mã hóa File -> Base64
+	var cipherText strings.Builder
+	b64 := base64.NewEncoder(base64.StdEncoding, &cipherText)
+	if err := EncryptStream(b64, in, aesKey); err != nil {
+		return "", "", fmt.Errorf("lỗi mã hóa file: %v", err)
+	}
+	if err := b64.Close(); err != nil {
 		return "", "", fmt.Errorf("lỗi chuyển đổi file sang base64: %v", err)
 	}
 
-	// mã hóa AES Key bằng Password
-	aesKeyHex := hex.EncodeToString(aesKey)
+	// trả về kết quả
+	return cipherText.String(), encryptedAESKey, nil
+}
 
-	encryptedAESKey, err := EncryptByPassword(aesKeyHex, password)
+// Mở file và trả về luồng ciphertext (binary) để gửi thẳng lên server
+// File được mã hóa dần trong lúc đọc, đóng reader sẽ dừng việc mã hóa
+func EncryptFileReader(filePath string, key []byte) (io.ReadCloser, error) {
+	prefix, err := NewStreamPrefix()
 	if err != nil {
-		return "", "", fmt.Errorf("lỗi mã hóa khóa AES: %v", err)
+		return nil, err
 	}
+	return EncryptFileReaderWithPrefix(filePath, key, prefix)
+}
 
-	// trả về kết quả
-	return cipherTextBase64, encryptedAESKey, nil
+// Giống EncryptFileReader nhưng dùng nonce prefix cho trước (xem EncryptStreamWithPrefix)
+func EncryptFileReaderWithPrefix(filePath string, key, prefix []byte) (io.ReadCloser, error) {
+	in, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi đọc file đầu vào: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := EncryptStreamWithPrefix(pw, in, key, prefix)
+		in.Close()
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
 }
 
 // giải mã file
@@ -189,18 +184,11 @@ func RestoreFileFromNote(cipherTextBase64, decryptedAESKeyHex, outputFilePath st
 		return fmt.Errorf("lỗi định dạng khóa AES (không phải Hex hợp lệ): %v", err)
 	}
 
-	// chuyển chuỗi Base64 thành File Mã Hóa
-	tempEncryptedPath := outputFilePath + ".enc_temp"
-	defer os.Remove(tempEncryptedPath)
-
-	// base64 String -> byte[]
-	err = ConvertStringToBinary(cipherTextBase64, tempEncryptedPath)
-	if err != nil {
-		return fmt.Errorf("lỗi chuyển đổi Base64 sang file tạm: %v", err)
-	}
-
-	// giải mã
-	err = DecryptedByAESKey(aesKey, tempEncryptedPath, outputFilePath)
+	// base64 String -> giải mã theo luồng -> file đầu ra
+	cipherText := base64.NewDecoder(base64.StdEncoding, strings.NewReader(cipherTextBase64))
+	err = writeFileFrom(outputFilePath, func(w io.Writer) error {
+		return DecryptStream(w, cipherText, aesKey)
+	})
 	if err != nil {
 		return fmt.Errorf("lỗi giải mã file (kiểm tra lại Key hoặc độ toàn vẹn file): %v", err)
 	}
@@ -209,6 +197,25 @@ func RestoreFileFromNote(cipherTextBase64, decryptedAESKeyHex, outputFilePath st
 	return nil
 }
 
+// giải mã luồng ciphertext (binary) tải từ server ra file
+// expectedDigest khác rỗng: kiểm tra hash ciphertext khớp với hash đã được ký, không khớp thì xóa file đầu ra
+func RestoreFileFromReader(cipherText io.Reader, aesKey []byte, expectedDigest, outputFilePath string) error {
+	digest := NewCipherDigest()
+	err := writeFileFrom(outputFilePath, func(w io.Writer) error {
+		if err := DecryptStream(w, io.TeeReader(cipherText, digest), aesKey); err != nil {
+			return err
+		}
+		if expectedDigest != "" && digest.Hex() != expectedDigest {
+			return ErrCipherDigest
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("lỗi giải mã file (kiểm tra lại Key hoặc độ toàn vẹn file): %w", err)
+	}
+	return nil
+}
+
 // Hỗ trợ test AES trên RAM
 
 // Xử lý mã hóa và giải mã AES-GCM tối ưu trên RAM
@@ -7,9 +7,11 @@ import (
 )
 
 // Khai báo biến toàn cục để lưu giá trị P sau khi parse
+// Q = (P-1)/2 là bậc của nhóm con sinh bởi G (P là safe prime)
 var (
 	G = big.NewInt(2)
 	P *big.Int
+	Q *big.Int
 )
 
 // P_HEX: Số nguyên tố 2048-bit chuẩn (RFC 3526 Group 14)
@@ -29,6 +31,7 @@ const P_HEX = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
 func init() {
 	P = new(big.Int)
 	P.SetString(P_HEX, 16)
+	Q = new(big.Int).Rsh(P, 1)
 }
 
 // GenerateKeyPair tạo Private Key và Public Key
@@ -66,8 +69,29 @@ func ComputeSharedSecret(myPrivKey *big.Int, peerPubKeyHex string) (*big.Int, er
 		return nil, fmt.Errorf("peerPubKey is not string")
 	}
 
+	if err := ValidateDHPublicKey(peerPubKey); err != nil {
+		return nil, err
+	}
+
 	// K = (peerPubKey ^ privateKey) mod P
 	sharedSecret := new(big.Int).Exp(peerPubKey, myPrivKey, P)
 
 	return sharedSecret, nil
 }
+
+// Kiểm tra public key của đối phương trước khi tính K
+// Khóa 0, 1, P-1 hoặc nằm ngoài nhóm con bậc Q khiến K rơi vào vài giá trị đoán được
+func ValidateDHPublicKey(pub *big.Int) error {
+	one := big.NewInt(1)
+	pMinusOne := new(big.Int).Sub(P, one)
+
+	// Phải thỏa 1 < pub < P-1
+	if pub.Cmp(one) <= 0 || pub.Cmp(pMinusOne) >= 0 {
+		return fmt.Errorf("public key DH nằm ngoài khoảng hợp lệ")
+	}
+	// Phải thuộc nhóm con bậc Q: pub^Q mod P = 1
+	if new(big.Int).Exp(pub, Q, P).Cmp(one) != 0 {
+		return fmt.Errorf("public key DH không thuộc nhóm con hợp lệ")
+	}
+	return nil
+}
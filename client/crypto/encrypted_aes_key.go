@@ -20,13 +20,25 @@ func deriveKeyFromK(sharedK *big.Int) []byte {
 	return hash[:]
 }
 
-// Mã hóa AES key bằng khóa phiên K
+// Mã hóa AES key bằng khóa phiên K (cách cũ: SHA-256(K))
 // Output:
 //   - String Hex: Dạng "Nonce + Ciphertext"
 func EncryptAESKeyWithSharedK(aesKeyRaw []byte, sharedK *big.Int) (string, error) {
 	// Tạo wrappingKey từ khóa phiên K chung
-	wrappingKey := deriveKeyFromK(sharedK)
+	return WrapAESKey(aesKeyRaw, deriveKeyFromK(sharedK))
+}
+
+// Giải mã EncryptedAESKey bằng K (cách cũ: SHA-256(K))
+// Output:
+//   - []byte: Khóa AES gốc dùng để giải mã ghi chú
+func DecryptAESKeyWithSharedK(encryptedHex string, sharedK *big.Int) ([]byte, error) {
+	return UnwrapAESKey(encryptedHex, deriveKeyFromK(sharedK))
+}
 
+// Mã hóa AES key bằng wrappingKey (32 bytes) đã dẫn xuất từ khóa chung
+// Output:
+//   - String Hex: Dạng "Nonce + Ciphertext"
+func WrapAESKey(aesKeyRaw []byte, wrappingKey []byte) (string, error) {
 	// Tạo Block Cipher
 	block, err := aes.NewCipher(wrappingKey)
 	if err != nil {
@@ -52,19 +64,14 @@ func EncryptAESKeyWithSharedK(aesKeyRaw []byte, sharedK *big.Int) (string, error
 	return hex.EncodeToString(encryptedBytes), nil
 }
 
-// Giải mã EncryptedAESKey bằng K
-// Output:
-//   - []byte: Khóa AES gốc dùng để giải mã ghi chú
-func DecryptAESKeyWithSharedK(encryptedHex string, sharedK *big.Int) ([]byte, error) {
+// Giải mã AES key đã bọc bằng wrappingKey
+func UnwrapAESKey(encryptedHex string, wrappingKey []byte) ([]byte, error) {
 	// Decode Hex sang byte
 	data, err := hex.DecodeString(encryptedHex)
 	if err != nil {
 		return nil, fmt.Errorf("chuỗi mã hóa không phải hex hợp lệ: %v", err)
 	}
 
-	// Tạo wrapping key từ K
-	wrappingKey := deriveKeyFromK(sharedK)
-
 	block, err := aes.NewCipher(wrappingKey)
 	if err != nil {
 		return nil, err
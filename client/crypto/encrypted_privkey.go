@@ -96,3 +96,13 @@ func DecryptByPassword(encryptedHex string, password string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// 4. Hàm bọc lại dữ liệu (Private Key, khóa AES của note) khi đổi mật khẩu
+// Giải mã bằng mật khẩu cũ rồi mã hóa lại bằng mật khẩu mới (salt, nonce mới)
+func RewrapByPassword(encryptedHex string, oldPassword string, newPassword string) (string, error) {
+	plaintext, err := DecryptByPassword(encryptedHex, oldPassword)
+	if err != nil {
+		return "", err
+	}
+	return EncryptByPassword(plaintext, newPassword)
+}
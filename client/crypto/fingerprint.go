@@ -0,0 +1,72 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Fingerprint của 1 public key: SHA-256("loại khóa:public key"), lấy 16 byte đầu
+// In thành 8 nhóm 4 ký tự hex để đọc cho nhau qua điện thoại
+func Fingerprint(keyType, pubKeyHex string) string {
+	if keyType == "" {
+		keyType = KeyTypeDH
+	}
+	sum := sha256.Sum256([]byte(keyType + ":" + strings.ToLower(pubKeyHex)))
+	h := strings.ToUpper(hex.EncodeToString(sum[:16]))
+
+	groups := make([]string, 0, 8)
+	for i := 0; i < len(h); i += 4 {
+		groups = append(groups, h[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
+
+// Safety number của 1 cặp user: 12 nhóm 5 chữ số
+// Không phụ thuộc ai tính trước (2 bên được sắp theo username) nên 2 người phải thấy cùng 1 số
+func SafetyNumber(userA, fingerprintA, userB, fingerprintB string) string {
+	if userA > userB {
+		userA, fingerprintA, userB, fingerprintB = userB, fingerprintB, userA, fingerprintA
+	}
+	input := fmt.Sprintf("%d:%s|%s|%d:%s|%s", len(userA), userA, fingerprintA, len(userB), userB, fingerprintB)
+	sum := sha512.Sum512([]byte(input))
+
+	groups := make([]string, 0, 12)
+	for i := 0; i < 12; i++ {
+		// Mỗi nhóm lấy 5 byte -> số nguyên -> 5 chữ số
+		chunk := make([]byte, 8)
+		copy(chunk[3:], sum[i*5:i*5+5])
+		groups = append(groups, fmt.Sprintf("%05d", binary.BigEndian.Uint64(chunk)%100000))
+	}
+	return strings.Join(groups, " ")
+}
+
+// Tính public key từ private key (hex) để lấy fingerprint của chính mình
+// mà không phải tin public key do server trả về
+func PublicKeyFromPrivate(keyType, privKeyHex string) (string, error) {
+	switch keyType {
+	case KeyTypeX25519:
+		privBytes, err := hex.DecodeString(privKeyHex)
+		if err != nil {
+			return "", err
+		}
+		priv, err := ecdh.X25519().NewPrivateKey(privBytes)
+		if err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(priv.PublicKey().Bytes()), nil
+
+	case KeyTypeDH, "":
+		priv, ok := new(big.Int).SetString(privKeyHex, 16)
+		if !ok {
+			return "", fmt.Errorf("private key DH không phải hex hợp lệ")
+		}
+		return new(big.Int).Exp(G, priv, P).Text(16), nil
+	}
+	return "", fmt.Errorf("loại khóa không được hỗ trợ: %q", keyType)
+}
@@ -0,0 +1,84 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Cách dẫn xuất khóa bọc AES key của link công khai (khớp với server)
+const (
+	KeySchemeLink         = "link-hkdf"     // HKDF từ bí mật trong #fragment
+	KeySchemeLinkPassword = "link-argon2id" // Argon2id(mật khẩu, bí mật trong #fragment), sau đó HKDF
+)
+
+// Độ dài bí mật của link (bytes)
+const linkSecretSize = 32
+
+// Tham số Argon2id cho mật khẩu của link (RFC 9106, cấu hình khuyến nghị thứ 2: 64 MiB)
+const (
+	linkArgonTime    = 3
+	linkArgonMemory  = 64 * 1024 // KiB
+	linkArgonThreads = 4
+)
+
+// Sinh bí mật ngẫu nhiên cho link công khai, mã hóa base64url (không padding) để đặt sau dấu # của link
+// Trình duyệt và HTTP client không gửi phần #fragment lên server
+func GenerateLinkSecret() (string, error) {
+	secret := make([]byte, linkSecretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("lỗi sinh bí mật của link: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Dẫn xuất khóa bọc AES key (32 bytes) từ bí mật của link, gắn với note ID
+// nên server không đổi được link sang note khác mà vẫn mở được khóa
+func DeriveLinkKey(secret, noteID string) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(secret)
+	if err != nil || len(raw) != linkSecretSize {
+		return nil, fmt.Errorf("bí mật của link không hợp lệ")
+	}
+	info := fmt.Sprintf("note-sharing/%s|%d:%s", KeySchemeLink, len(noteID), noteID)
+	return hkdf.Key(sha256.New, raw, nil, info, 32)
+}
+
+// Bí mật của link có mật khẩu: Argon2id với mật khẩu và bí mật trong #fragment làm salt
+// Có link mà không có mật khẩu (hoặc ngược lại) đều không dẫn xuất được khóa
+func ProtectLinkSecret(secret, passphrase string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(secret)
+	if err != nil || len(raw) != linkSecretSize {
+		return "", fmt.Errorf("bí mật của link không hợp lệ")
+	}
+	derived := argon2.IDKey([]byte(passphrase), raw, linkArgonTime, linkArgonMemory, linkArgonThreads, linkSecretSize)
+	return base64.RawURLEncoding.EncodeToString(derived), nil
+}
+
+// Access token (hex) gửi kèm header X-Link-Token khi mở link có mật khẩu
+// Dẫn xuất từ bí mật đã qua Argon2id, tách biệt với khóa bọc AES key nên server không mở được khóa từ token
+func LinkAccessToken(secret string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(secret)
+	if err != nil || len(raw) != linkSecretSize {
+		return "", fmt.Errorf("bí mật của link không hợp lệ")
+	}
+	token, err := hkdf.Key(sha256.New, raw, nil, "note-sharing/link-access", 32)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Verifier server lưu để kiểm tra access token: SHA-256 (hex) của token
+func LinkAccessVerifier(token string) (string, error) {
+	raw, err := hex.DecodeString(token)
+	if err != nil {
+		return "", fmt.Errorf("access token không phải hex hợp lệ")
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,168 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+/*
+	Kiểm tra bằng chứng của key transparency log phía client (RFC 9162, mục 2.1.3 - 2.1.4)
+	Client không cần tải cả log: chỉ cần hash lá, vài hash anh em (proof) và gốc cây đã được ký
+*/
+
+var (
+	ErrInclusionProof   = errors.New("inclusion proof không hợp lệ")
+	ErrConsistencyProof = errors.New("consistency proof không hợp lệ")
+	ErrTreeHeadSig      = errors.New("chữ ký tree head không hợp lệ")
+)
+
+// Dữ liệu 1 lá của key log, phải giống hệt cách server dựng
+// Entry có khóa ký dùng định dạng v2
+func KeyLogLeafData(username, keyType, pubKey, legacyPubKey, signingPubKey string, timestamp int64) []byte {
+	v1 := fmt.Sprintf("%d:%s|%d:%s|%d:%s|%d:%s|%d",
+		len(username), username,
+		len(keyType), keyType,
+		len(pubKey), pubKey,
+		len(legacyPubKey), legacyPubKey,
+		timestamp)
+	if signingPubKey == "" {
+		return []byte("v1|" + v1)
+	}
+	return []byte(fmt.Sprintf("v2|%s|%d:%s", v1, len(signingPubKey), signingPubKey))
+}
+
+func MerkleLeafHash(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0x00}, data...))
+	return sum[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, 0x01)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
+
+// Kiểm tra lá leafHash ở vị trí index nằm trong cây treeSize lá có gốc root
+func VerifyInclusion(index, treeSize int64, leafHash []byte, proof [][]byte, root []byte) error {
+	if index < 0 || index >= treeSize {
+		return ErrInclusionProof
+	}
+
+	fn, sn := index, treeSize-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return ErrInclusionProof
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(r, root) {
+		return ErrInclusionProof
+	}
+	return nil
+}
+
+// Kiểm tra cây first lá (gốc firstRoot) là tiền tố của cây second lá (gốc secondRoot)
+func VerifyConsistency(first, second int64, firstRoot, secondRoot []byte, proof [][]byte) error {
+	if first < 0 || second < first {
+		return ErrConsistencyProof
+	}
+	if first == second {
+		if len(proof) != 0 || !bytes.Equal(firstRoot, secondRoot) {
+			return ErrConsistencyProof
+		}
+		return nil
+	}
+	// Cây rỗng là tiền tố của mọi cây
+	if first == 0 {
+		if len(proof) != 0 {
+			return ErrConsistencyProof
+		}
+		return nil
+	}
+	if len(proof) == 0 {
+		return ErrConsistencyProof
+	}
+
+	// first là lũy thừa của 2 thì cây cũ là 1 cây con hoàn chỉnh, proof không chứa gốc của nó
+	if first&(first-1) == 0 {
+		proof = append([][]byte{firstRoot}, proof...)
+	}
+
+	fn, sn := first-1, second-1
+	for fn&1 == 1 {
+		fn >>= 1
+		sn >>= 1
+	}
+
+	fr, sr := proof[0], proof[0]
+	for _, c := range proof[1:] {
+		if sn == 0 {
+			return ErrConsistencyProof
+		}
+		if fn&1 == 1 || fn == sn {
+			fr = merkleNodeHash(c, fr)
+			sr = merkleNodeHash(c, sr)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			sr = merkleNodeHash(sr, c)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 || !bytes.Equal(fr, firstRoot) || !bytes.Equal(sr, secondRoot) {
+		return ErrConsistencyProof
+	}
+	return nil
+}
+
+// Kiểm tra chữ ký Ed25519 của server trên tree head
+func VerifyTreeHead(logPubKeyHex string, treeSize int64, rootHashHex string, timestamp int64, signatureB64 string) error {
+	pub, err := hex.DecodeString(logPubKeyHex)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return ErrTreeHeadSig
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return ErrTreeHeadSig
+	}
+	msg := fmt.Sprintf("note-sharing-keylog-v1\n%d\n%s\n%d", treeSize, rootHashHex, timestamp)
+	if !ed25519.Verify(ed25519.PublicKey(pub), []byte(msg), sig) {
+		return ErrTreeHeadSig
+	}
+	return nil
+}
+
+// Giải mã danh sách hash dạng hex
+func DecodeHashes(hexes []string) ([][]byte, error) {
+	out := make([][]byte, len(hexes))
+	for i, h := range hexes {
+		b, err := hex.DecodeString(h)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("hash không hợp lệ: %q", h)
+		}
+		out[i] = b
+	}
+	return out, nil
+}
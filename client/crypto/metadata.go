@@ -0,0 +1,73 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"note_sharing_application/client/models"
+)
+
+// Metadata của note (tên file, tiêu đề, MIME type...) được mã hóa AES-GCM bằng chính khóa AES của note
+// AAD riêng để server không thể đưa metadata ra làm nội dung note (cùng khóa) hay ngược lại
+// Định dạng: Base64([nonce (12)][ciphertext + tag])
+var metadataAAD = []byte("note-metadata-v1")
+
+var ErrMetadataCorrupted = errors.New("không giải mã được metadata (sai khóa hoặc dữ liệu bị sửa đổi)")
+
+// Mã hóa metadata bằng khóa AES của note
+func EncryptNoteMetadata(meta models.NoteMetadata, key []byte) (string, error) {
+	plaintext, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	aesGCM, err := newMetadataGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("lỗi tạo nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aesGCM.Seal(nonce, nonce, plaintext, metadataAAD)), nil
+}
+
+// Giải mã metadata tạo bởi EncryptNoteMetadata
+func DecryptNoteMetadata(encrypted string, key []byte) (models.NoteMetadata, error) {
+	var meta models.NoteMetadata
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return meta, ErrMetadataCorrupted
+	}
+	aesGCM, err := newMetadataGCM(key)
+	if err != nil {
+		return meta, err
+	}
+	if len(data) < aesGCM.NonceSize() {
+		return meta, ErrMetadataCorrupted
+	}
+
+	plaintext, err := aesGCM.Open(nil, data[:aesGCM.NonceSize()], data[aesGCM.NonceSize():], metadataAAD)
+	if err != nil {
+		return meta, ErrMetadataCorrupted
+	}
+	if err := json.Unmarshal(plaintext, &meta); err != nil {
+		return meta, ErrMetadataCorrupted
+	}
+	return meta, nil
+}
+
+func newMetadataGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo block cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+/*
+	Chữ ký Ed25519 trên share
+	Mỗi user có 1 cặp khóa ký riêng (tách khỏi khóa trao đổi X25519/DH)
+	Người gửi ký (người gửi, người nhận, note, hash ciphertext, khóa đã bọc, key scheme, hạn dùng)
+	-> người nhận biết chắc share do đúng người gửi tạo và không bị server sửa
+*/
+
+var (
+	ErrShareSignature = errors.New("chữ ký của người gửi không hợp lệ")
+	// Nội dung tải về khác với nội dung người gửi đã ký
+	ErrCipherDigest = errors.New("nội dung không khớp với hash đã được ký")
+)
+
+// Sinh cặp khóa ký Ed25519, trả về (private key hex (seed), public key hex)
+func GenerateSigningKeyPair() (string, string, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(priv.Seed()), hex.EncodeToString(pub), nil
+}
+
+// Hash của ciphertext được ký: SHA-256 (hex) của ciphertext ở dạng Base64 chuẩn
+func CipherTextDigest(cipherTextBase64 string) string {
+	sum := sha256.Sum256([]byte(cipherTextBase64))
+	return hex.EncodeToString(sum[:])
+}
+
+// Thay cho cipherDigest khi ký share luôn theo phiên bản mới nhất của note
+const ShareDigestLatest = "latest"
+
+// Nội dung được ký của 1 share, phải giống hệt cách server dựng
+// cipherDigest là kết quả của CipherTextDigest (hoặc ShareDigestLatest)
+func ShareSignatureMessage(sender, receiver, noteID, cipherDigest, wrappedKey, keyScheme string, expiresAt int64) []byte {
+	return []byte(fmt.Sprintf("note-sharing-share-v1\n%d:%s|%d:%s|%d:%s|%s|%d:%s|%d:%s|%d",
+		len(sender), sender,
+		len(receiver), receiver,
+		len(noteID), noteID,
+		cipherDigest,
+		len(wrappedKey), wrappedKey,
+		len(keyScheme), keyScheme,
+		expiresAt))
+}
+
+// Ký message bằng private key (seed hex), trả về chữ ký base64
+func SignMessage(privSeedHex string, message []byte) (string, error) {
+	seed, err := hex.DecodeString(privSeedHex)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return "", errors.New("private key ký không hợp lệ")
+	}
+	sig := ed25519.Sign(ed25519.NewKeyFromSeed(seed), message)
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Kiểm tra chữ ký base64 bằng public key ký (hex)
+func VerifySignature(pubHex, signatureB64 string, message []byte) error {
+	pub, err := hex.DecodeString(pubHex)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return ErrShareSignature
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), message, sig) {
+		return ErrShareSignature
+	}
+	return nil
+}
+
+// Tính CipherTextDigest theo luồng khi chỉ có ciphertext dạng binary (tải qua endpoint binary)
+type CipherDigest struct {
+	h   hash.Hash
+	enc io.WriteCloser
+}
+
+func NewCipherDigest() *CipherDigest {
+	h := sha256.New()
+	return &CipherDigest{h: h, enc: base64.NewEncoder(base64.StdEncoding, h)}
+}
+
+// Ghi thêm ciphertext (binary)
+func (d *CipherDigest) Write(p []byte) (int, error) {
+	return d.enc.Write(p)
+}
+
+// Hash (hex) của toàn bộ ciphertext đã ghi, gọi 1 lần sau khi ghi xong
+func (d *CipherDigest) Hex() string {
+	d.enc.Close()
+	return hex.EncodeToString(d.h.Sum(nil))
+}
@@ -0,0 +1,225 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Định dạng mã hóa theo luồng (STREAM, Hoang-Reyhanitabar-Rogaway-Vizár) cho file lớn:
+//
+//	Header: magic "NSAE" (4) | version (1) | chunk size (4, big endian) | nonce prefix (7)
+//	Sau đó là các chunk: AES-GCM(plaintext chunk), mỗi chunk dài chunk size + 16 byte tag (chunk cuối có thể ngắn hơn)
+//
+// Nonce của chunk i = nonce prefix (7) | i (4, big endian) | cờ chunk cuối (1)
+// Header được đưa vào AAD của mọi chunk. Cắt bớt, đổi thứ tự, hay nối thêm chunk đều làm giải mã thất bại.
+// Chỉ giữ 1 chunk trên RAM nên mã hóa / giải mã file nhiều GB với bộ nhớ cố định.
+const (
+	StreamChunkSize = 64 * 1024
+
+	streamVersion      = 1
+	streamNoncePrefix  = 7
+	streamHeaderSize   = 4 + 1 + 4 + streamNoncePrefix
+	streamMaxChunkSize = 16 * 1024 * 1024
+)
+
+var streamMagic = []byte("NSAE")
+
+var (
+	ErrStreamTruncated = errors.New("dữ liệu mã hóa bị cắt cụt")
+	ErrStreamCorrupted = errors.New("giải mã thất bại (sai khóa hoặc dữ liệu bị sửa đổi)")
+)
+
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefix:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// EncryptStream mã hóa src theo từng chunk và ghi ra dst
+func EncryptStream(dst io.Writer, src io.Reader, key []byte) error {
+	prefix, err := NewStreamPrefix()
+	if err != nil {
+		return err
+	}
+	return EncryptStreamWithPrefix(dst, src, key, prefix)
+}
+
+// Nonce prefix ngẫu nhiên cho EncryptStreamWithPrefix
+func NewStreamPrefix() ([]byte, error) {
+	prefix := make([]byte, streamNoncePrefix)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("lỗi tạo nonce: %w", err)
+	}
+	return prefix, nil
+}
+
+// EncryptStreamWithPrefix giống EncryptStream nhưng dùng nonce prefix cho trước:
+// cùng khóa, prefix và plaintext thì ra đúng ciphertext cũ (dùng khi tiếp tục upload bị gián đoạn)
+// ! Mỗi prefix chỉ được dùng cho 1 plaintext duy nhất với cùng khóa
+func EncryptStreamWithPrefix(dst io.Writer, src io.Reader, key, prefix []byte) error {
+	if len(prefix) != streamNoncePrefix {
+		return fmt.Errorf("nonce prefix phải dài %d byte", streamNoncePrefix)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo block cipher: %w", err)
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo GCM: %w", err)
+	}
+
+	// Header
+	header := make([]byte, streamHeaderSize)
+	copy(header, streamMagic)
+	header[4] = streamVersion
+	binary.BigEndian.PutUint32(header[5:9], StreamChunkSize)
+	copy(header[9:], prefix)
+	if _, err := dst.Write(header); err != nil {
+		return err
+	}
+
+	br := bufio.NewReaderSize(src, StreamChunkSize)
+	buf := make([]byte, StreamChunkSize)
+	out := make([]byte, 0, StreamChunkSize+aesGCM.Overhead())
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, buf)
+		last := false
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			last = true
+		case err != nil:
+			return fmt.Errorf("lỗi đọc dữ liệu: %w", err)
+		default:
+			// Chunk đầy: xem còn dữ liệu phía sau không để đánh dấu chunk cuối
+			if _, perr := br.Peek(1); perr == io.EOF {
+				last = true
+			} else if perr != nil {
+				return fmt.Errorf("lỗi đọc dữ liệu: %w", perr)
+			}
+		}
+
+		if !last && counter == math.MaxUint32 {
+			return errors.New("dữ liệu quá lớn để mã hóa")
+		}
+
+		out = aesGCM.Seal(out[:0], streamNonce(prefix, counter, last), buf[:n], header)
+		if _, err := dst.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// Kích thước dữ liệu EncryptStream tạo ra từ plaintext dài plainSize byte
+func EncryptedSize(plainSize int64) int64 {
+	chunks := (plainSize + StreamChunkSize - 1) / StreamChunkSize
+	if chunks == 0 {
+		// Plaintext rỗng vẫn có 1 chunk (chỉ có tag)
+		chunks = 1
+	}
+	return streamHeaderSize + plainSize + chunks*16
+}
+
+// DecryptStream giải mã dữ liệu tạo bởi EncryptStream và ghi plaintext ra dst
+// Dữ liệu định dạng cũ ([nonce][ciphertext], 1 nonce cho cả file) vẫn giải mã được nhưng phải đọc hết vào RAM
+// ! Khi trả lỗi, dst có thể đã nhận 1 phần plaintext (các chunk đã xác thực): người gọi phải bỏ kết quả
+func DecryptStream(dst io.Writer, src io.Reader, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo block cipher: %w", err)
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo GCM: %w", err)
+	}
+
+	header := make([]byte, streamHeaderSize)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("lỗi đọc dữ liệu: %w", err)
+	}
+	if n < streamHeaderSize || !bytes.Equal(header[:4], streamMagic) {
+		return decryptLegacy(dst, io.MultiReader(bytes.NewReader(header[:n]), src), key)
+	}
+
+	if header[4] != streamVersion {
+		return fmt.Errorf("phiên bản định dạng mã hóa không hỗ trợ: %d", header[4])
+	}
+	chunkSize := binary.BigEndian.Uint32(header[5:9])
+	if chunkSize == 0 || chunkSize > streamMaxChunkSize {
+		return ErrStreamCorrupted
+	}
+	prefix := header[9:]
+
+	br := bufio.NewReaderSize(src, int(chunkSize)+aesGCM.Overhead())
+	buf := make([]byte, int(chunkSize)+aesGCM.Overhead())
+	out := make([]byte, 0, chunkSize)
+
+	for counter := uint32(0); ; counter++ {
+		n, err := io.ReadFull(br, buf)
+		last := false
+		switch {
+		case err == io.EOF:
+			// Hết dữ liệu mà chưa gặp chunk cuối
+			return ErrStreamTruncated
+		case err == io.ErrUnexpectedEOF:
+			last = true
+		case err != nil:
+			return fmt.Errorf("lỗi đọc dữ liệu: %w", err)
+		default:
+			if _, perr := br.Peek(1); perr == io.EOF {
+				last = true
+			} else if perr != nil {
+				return fmt.Errorf("lỗi đọc dữ liệu: %w", perr)
+			}
+		}
+
+		if n < aesGCM.Overhead() {
+			return ErrStreamTruncated
+		}
+
+		out, err = aesGCM.Open(out[:0], streamNonce(prefix, counter, last), buf[:n], header)
+		if err != nil {
+			return ErrStreamCorrupted
+		}
+		if _, err := dst.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return ErrStreamCorrupted
+		}
+	}
+}
+
+// Note lưu trước khi có định dạng stream
+func decryptLegacy(dst io.Writer, src io.Reader, key []byte) error {
+	ciphertext, err := io.ReadAll(src)
+	if err != nil {
+		return fmt.Errorf("lỗi đọc dữ liệu: %w", err)
+	}
+	plaintext, err := DecryptBytes(ciphertext, key)
+	if err != nil {
+		return ErrStreamCorrupted
+	}
+	_, err = dst.Write(plaintext)
+	return err
+}
@@ -0,0 +1,97 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+)
+
+// Loại khóa trao đổi của user (khớp với server)
+const (
+	KeyTypeDH     = "dh-group14"
+	KeyTypeX25519 = "x25519"
+)
+
+// Cách dẫn xuất khóa bọc AES key của 1 share (lưu cùng share trên server)
+const (
+	KeySchemeLegacyDH = ""            // SHA-256(K), K từ DH group 14 (share cũ)
+	KeySchemeDHHKDF   = "dh-hkdf"     // HKDF từ K của DH group 14
+	KeySchemeX25519   = "x25519-hkdf" // HKDF từ X25519
+)
+
+// Sinh cặp khóa X25519, trả về (private key hex, public key hex)
+func GenerateX25519KeyPair() (string, string, error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(priv.Bytes()), hex.EncodeToString(priv.PublicKey().Bytes()), nil
+}
+
+// Tính bí mật chung X25519
+// Từ chối public key sai độ dài và các điểm bậc thấp (bí mật chung toàn số 0)
+func computeX25519Secret(myPrivHex, peerPubHex string) ([]byte, error) {
+	privBytes, err := hex.DecodeString(myPrivHex)
+	if err != nil {
+		return nil, fmt.Errorf("private key X25519 không phải hex hợp lệ")
+	}
+	pubBytes, err := hex.DecodeString(peerPubHex)
+	if err != nil {
+		return nil, fmt.Errorf("public key X25519 không phải hex hợp lệ")
+	}
+
+	priv, err := ecdh.X25519().NewPrivateKey(privBytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := ecdh.X25519().NewPublicKey(pubBytes)
+	if err != nil {
+		return nil, fmt.Errorf("public key X25519 không hợp lệ: %v", err)
+	}
+
+	secret, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, fmt.Errorf("public key X25519 không hợp lệ: %v", err)
+	}
+	return secret, nil
+}
+
+// HKDF-SHA256 từ bí mật chung, info gắn với scheme và username 2 bên
+// Người gửi đứng trước nên khóa của chiều A->B khác chiều B->A
+func hkdfShareKey(secret []byte, scheme, sender, receiver string) ([]byte, error) {
+	info := fmt.Sprintf("note-sharing/%s|%d:%s|%d:%s", scheme, len(sender), sender, len(receiver), receiver)
+	return hkdf.Key(sha256.New, secret, nil, info, 32)
+}
+
+// Dẫn xuất khóa bọc AES key (32 bytes) cho share giữa sender và receiver
+// myPrivHex/peerPubHex phải cùng loại với scheme (X25519 hoặc DH group 14)
+func DeriveShareKey(scheme, myPrivHex, peerPubHex, sender, receiver string) ([]byte, error) {
+	switch scheme {
+	case KeySchemeX25519:
+		secret, err := computeX25519Secret(myPrivHex, peerPubHex)
+		if err != nil {
+			return nil, err
+		}
+		return hkdfShareKey(secret, scheme, sender, receiver)
+
+	case KeySchemeDHHKDF, KeySchemeLegacyDH:
+		myPriv, ok := new(big.Int).SetString(myPrivHex, 16)
+		if !ok {
+			return nil, fmt.Errorf("private key DH không phải hex hợp lệ")
+		}
+		sharedK, err := ComputeSharedSecret(myPriv, peerPubHex)
+		if err != nil {
+			return nil, err
+		}
+		if scheme == KeySchemeLegacyDH {
+			return deriveKeyFromK(sharedK), nil
+		}
+		// Độ dài cố định (bằng P) để không phụ thuộc số byte 0 ở đầu K
+		return hkdfShareKey(sharedK.FillBytes(make([]byte, (P.BitLen()+7)/8)), scheme, sender, receiver)
+	}
+	return nil, fmt.Errorf("key scheme không được hỗ trợ: %q", scheme)
+}
@@ -4,11 +4,17 @@ import (
 	"bufio"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"math/big"
+	"io"
+	"mime"
+	"net/http"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"note_sharing_application/client/crypto"
 	"note_sharing_application/client/models"
@@ -16,23 +22,70 @@ import (
 )
 
 // Struct để lưu thông tin phiên làm việc
+// KeyType rỗng (file session cũ) nghĩa là khóa DH
 type Session struct {
 	Username            string `json:"username"`
 	Token               string `json:"token"`
+	RefreshToken        string `json:"refresh_token"`
 	EncryptedPrivateKey string `json:"encrypted_private_key"`
+	KeyType             string `json:"key_type"`
+	// Private key DH cũ, chỉ có sau khi đã nâng cấp lên X25519
+	EncryptedLegacyPrivateKey string `json:"encrypted_legacy_private_key,omitempty"`
+	// Private key ký Ed25519 (seed), dùng để ký các share gửi đi
+	EncryptedSigningPrivateKey string `json:"encrypted_signing_private_key,omitempty"`
+}
+
+// Private key X25519 đã mã hóa (rỗng nếu chưa nâng cấp)
+func (s Session) encryptedX25519Key() string {
+	if s.KeyType == crypto.KeyTypeX25519 {
+		return s.EncryptedPrivateKey
+	}
+	return ""
+}
+
+// Private key DH đã mã hóa: khóa hiện tại, hoặc khóa cũ nếu đã nâng cấp
+func (s Session) encryptedDHKey() string {
+	if s.KeyType == crypto.KeyTypeX25519 {
+		return s.EncryptedLegacyPrivateKey
+	}
+	return s.EncryptedPrivateKey
 }
 
 func printHelp() {
 	fmt.Println("\n------------------------ ỨNG DỤNG CHIA SẺ GHI CHÚ BẢO MẬT (CLI) -------------------------------")
 	fmt.Println("1. Đăng ký:		go run main.go register -u <user> -p <pass>")
 	fmt.Println("2. Đăng nhập:  	go run main.go login -u <user> -p <pass>")
-	fmt.Println("3. Liệt kê file cá nhân:            go run main.go listOwnedFile -u <current username>")
-	fmt.Println("4. Liệt kê file được chia sẻ:       go run main.go listSharedFile -u <current username>")
-	fmt.Println("5. Lưu file mã hóa lên server:      go run main.go save -f <path> -u <current username>")
-	fmt.Println("6. Gửi file (Chia sẻ):              go run main.go send -note <id> -t <receiver> [-exp 1h] [-max 1] -u <current username>")
-	fmt.Println("7. Xóa file gốc:                    go run main.go deleteFile -id <id> -u <current username>")
+	fmt.Println("3. Liệt kê file cá nhân:            go run main.go listOwnedFile [-limit <n> -page <n> -desc] -u <current username>")
+	fmt.Println("4. Liệt kê file được chia sẻ:       go run main.go listSharedFile [-limit <n> -page <n> -sort created|expires -desc -sender <username> -state active] -u <current username>")
+	fmt.Println("5. Lưu file mã hóa lên server:      go run main.go save -f <path> [-title <tiêu đề>] -u <current username>")
+	fmt.Println("6. Gửi file (Chia sẻ):              go run main.go send -note <id> -t <receiver>[,<receiver>|<file.txt>...] [-exp 1h] [-max 1] [-rev <n> | -follow] -u <current username>")
+	fmt.Println("7. Xóa file gốc (vào thùng rác):    go run main.go deleteFile -id <id> -u <current username>")
 	fmt.Println("8. Hủy chia sẻ:                     go run main.go cancelSharingURL -id <id> -u <current username>")
-	fmt.Println("9. Đọc ghi chú được chia sẻ:        go run main.go readSharedNote -url <url> -sender <sender_name> -u <current username> -o <output_file>")
+	fmt.Println("9. Đọc ghi chú được chia sẻ:        go run main.go readSharedNote -url <url> -u <current username> -o <output_file>")
+	fmt.Println("10. Đăng xuất:                      go run main.go logout -u <current username> [-all]")
+	fmt.Println("11. Đổi mật khẩu:                   go run main.go changePassword -u <current username>")
+	fmt.Println("12. Xác minh khóa người liên lạc:   go run main.go verify -contact <username> -u <current username>")
+	fmt.Println("13. Tin tưởng khóa người liên lạc:  go run main.go trust -contact <username> [-fp <fingerprint>] -u <current username>")
+	fmt.Println("14. Tải và giải mã file của mình:   go run main.go get -id <id> [-o <output_file>] [-rev <n>] -u <current username>")
+	fmt.Println("15. Cập nhật nội dung file:         go run main.go update -id <id> -f <path> [-title <tiêu đề>] -u <current username>")
+	fmt.Println("16. Xem các phiên bản của file:     go run main.go revisions -id <id> -u <current username>")
+	fmt.Println("17. Khôi phục phiên bản cũ:         go run main.go restoreRevision -id <id> -rev <n> -u <current username>")
+	fmt.Println("18. Xem thùng rác:                  go run main.go listTrash -u <current username>")
+	fmt.Println("19. Khôi phục file đã xóa:          go run main.go restore -id <id> -u <current username>")
+	fmt.Println("20. Xóa vĩnh viễn file trong thùng rác: go run main.go purge -id <id> -u <current username>")
+	fmt.Println("21. Xem đã chia sẻ file cho ai:     go run main.go listShares -id <id> -u <current username>")
+	fmt.Println("22. Thu hồi chia sẻ của 1 người:    go run main.go revoke -share <url_id> -u <current username>")
+	fmt.Println("23. Tạo nhóm:                       go run main.go groupCreate -name <tên nhóm> -u <current username>")
+	fmt.Println("24. Xem các nhóm của mình:          go run main.go groups -u <current username>")
+	fmt.Println("25. Thêm thành viên nhóm:           go run main.go groupAdd -group <id> -member <username> [-role admin|member] -u <current username>")
+	fmt.Println("26. Đổi vai trò thành viên:         go run main.go groupRole -group <id> -member <username> -role admin|member -u <current username>")
+	fmt.Println("27. Xóa thành viên (xoay khóa):     go run main.go groupRemove -group <id> -member <username> -u <current username>")
+	fmt.Println("28. Chia sẻ file cho nhóm:          go run main.go groupShare -group <id> -note <id> -u <current username>")
+	fmt.Println("29. Xem file của nhóm:              go run main.go groupNotes -group <id> -u <current username>")
+	fmt.Println("30. Đọc file của nhóm:              go run main.go groupRead -group <id> -note <id> [-o <output_file>] -u <current username>")
+	fmt.Println("31. Gỡ file khỏi nhóm:              go run main.go groupUnshare -group <id> -note <id> -u <current username>")
+	fmt.Println("32. Tạo link công khai:             go run main.go shareLink -note <id> [-exp 24h] [-max 1] [-rev <n> | -follow] [-pass [-attempts 5]] -u <current username>")
+	fmt.Println("33. Mở link công khai:              go run main.go fetchLink -url <link> [-o <output_file>]")
 }
 
 func main() {
@@ -58,33 +111,104 @@ func main() {
 
 	case "listOwnedFile":
 		cmd := flag.NewFlagSet("listOwnedFile", flag.ExitOnError)
+		limit := cmd.Int("limit", 20, "Số file mỗi trang (0: tất cả)")
+		page := cmd.Int("page", 1, "Trang cần xem (bắt đầu từ 1)")
+		desc := cmd.Bool("desc", false, "File mới tạo trước")
 		user := cmd.String("u", "", "Current username")
 		cmd.Parse(os.Args[2:])
-		handleListOwnedFile(*user)
+		handleListOwnedFile(models.ListQuery{Limit: *limit, Desc: *desc}, *page, *user)
 
 	case "listSharedFile":
 		cmd := flag.NewFlagSet("listSharedFile", flag.ExitOnError)
+		limit := cmd.Int("limit", 20, "Số chia sẻ mỗi trang (0: tất cả)")
+		page := cmd.Int("page", 1, "Trang cần xem (bắt đầu từ 1)")
+		sortBy := cmd.String("sort", "created", "Sắp xếp theo thời điểm tạo (created) hoặc hết hạn (expires)")
+		desc := cmd.Bool("desc", false, "Sắp xếp giảm dần")
+		sender := cmd.String("sender", "", "Chỉ xem chia sẻ từ người gửi này")
+		state := cmd.String("state", "", "Chỉ xem chia sẻ còn hạn và còn lượt xem (active)")
 		user := cmd.String("u", "", "Current username")
 		cmd.Parse(os.Args[2:])
-		handleListSharedFile(*user)
+		handleListSharedFile(models.ListQuery{Limit: *limit, Sort: *sortBy, Desc: *desc, Sender: *sender, State: *state}, *page, *user)
 
 	case "save":
 		cmd := flag.NewFlagSet("save", flag.ExitOnError)
 		filePath := cmd.String("f", "", "File path")
 		// Thêm cờ -u để biết ai đang save
+		title := cmd.String("title", "", "Tiêu đề (mặc định là tên file)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleSaveFile(*filePath, *title, *user)
+
+	case "get":
+		// Cú pháp: get -id <note_id> [-o <path>] -u <me>
+		cmd := flag.NewFlagSet("get", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú cần tải")
+		outFile := cmd.String("o", "", "File hoặc thư mục lưu kết quả (mặc định: tên file gốc trong thư mục hiện tại)")
+		revision := cmd.Int("rev", 0, "Phiên bản cần tải (mặc định: mới nhất)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleGetFile(*noteID, *outFile, *revision, *user)
+
+	case "update":
+		// Cú pháp: update -id <note_id> -f <path> [-title <tiêu đề>] -u <me>
+		cmd := flag.NewFlagSet("update", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú cần cập nhật")
+		filePath := cmd.String("f", "", "File chứa nội dung mới")
+		title := cmd.String("title", "", "Tiêu đề mới (mặc định giữ tiêu đề cũ)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleUpdateFile(*noteID, *filePath, *title, *user)
+
+	case "revisions":
+		// Cú pháp: revisions -id <note_id> -u <me>
+		cmd := flag.NewFlagSet("revisions", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleListRevisions(*noteID, *user)
+
+	case "restoreRevision":
+		// Cú pháp: restoreRevision -id <note_id> -rev <n> -u <me>
+		cmd := flag.NewFlagSet("restoreRevision", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú")
+		revision := cmd.Int("rev", 0, "Phiên bản cần khôi phục")
 		user := cmd.String("u", "", "Current username")
 		cmd.Parse(os.Args[2:])
-		handleSaveFile(*filePath, *user)
+		handleRestoreRevision(*noteID, *revision, *user)
+
+	case "listTrash":
+		cmd := flag.NewFlagSet("listTrash", flag.ExitOnError)
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleListTrash(*user)
+
+	case "restore":
+		// Cú pháp: restore -id <note_id> -u <me>
+		cmd := flag.NewFlagSet("restore", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú trong thùng rác")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleRestoreFile(*noteID, *user)
+
+	case "purge":
+		// Cú pháp: purge -id <note_id> -u <me>
+		cmd := flag.NewFlagSet("purge", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú trong thùng rác")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handlePurgeFile(*noteID, *user)
 
 	case "send":
 		cmd := flag.NewFlagSet("send", flag.ExitOnError)
 		noteID := cmd.String("note", "", "Note ID")
-		receiver := cmd.String("t", "", "Receiver")
+		receiver := cmd.String("t", "", "Người nhận, nhiều người cách nhau bởi dấu phẩy hoặc file .txt (mỗi dòng 1 username)")
 		expiresIn := cmd.String("exp", "24h", "Expire")
 		maxAccess := cmd.Int("max", 1, "Max Access")
+		revision := cmd.Int("rev", 0, "Phiên bản được chia sẻ (mặc định: phiên bản hiện tại)")
+		followLatest := cmd.Bool("follow", false, "Người nhận luôn đọc được phiên bản mới nhất")
 		user := cmd.String("u", "", "Current username")
 		cmd.Parse(os.Args[2:])
-		handleSendFile(*noteID, *receiver, *expiresIn, *maxAccess, *user)
+		handleSendFile(*noteID, *receiver, *expiresIn, *maxAccess, *revision, *followLatest, *user)
 
 	case "deleteFile":
 		// Cú pháp: deleteFile -id <note_id>
@@ -102,17 +226,156 @@ func main() {
 		cmd.Parse(os.Args[2:])
 		handleCancelSharing(*noteID, *user)
 
+	case "listShares":
+		// Cú pháp: listShares -id <note_id> -u <me>
+		cmd := flag.NewFlagSet("listShares", flag.ExitOnError)
+		noteID := cmd.String("id", "", "ID của ghi chú")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleListShares(*noteID, *user)
+
+	case "revoke":
+		// Cú pháp: revoke -share <url_id> -u <me>
+		cmd := flag.NewFlagSet("revoke", flag.ExitOnError)
+		shareID := cmd.String("share", "", "ID của share (lấy từ listShares)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleRevokeShare(*shareID, *user)
+
 	case "readSharedNote":
-		// Cú pháp: readSharedNote -url <url> -sender <sender> -o <path> -u <me>
+		// Cú pháp: readSharedNote -url <url> -o <path> -u <me>
+		// Người gửi lấy từ share và được xác nhận bằng chữ ký
 		cmd := flag.NewFlagSet("readSharedNote", flag.ExitOnError)
 
 		url := cmd.String("url", "", "URL chia sẻ (Lấy từ listSharedFile)")
-		sender := cmd.String("sender", "", "Username người gửi (Lấy từ listSharedFile)")
 		outFile := cmd.String("o", "", "Đường dẫn file để lưu kết quả giải mã")
 		user := cmd.String("u", "", "Username của bạn")
 
 		cmd.Parse(os.Args[2:])
-		handleReadSharedNote(*url, *sender, *outFile, *user)
+		handleReadSharedNote(*url, *outFile, *user)
+
+	case "shareLink":
+		// Cú pháp: shareLink -note <note_id> [-exp 24h] [-max 1] [-rev <n> | -follow] -u <me>
+		cmd := flag.NewFlagSet("shareLink", flag.ExitOnError)
+		noteID := cmd.String("note", "", "Note ID")
+		expiresIn := cmd.String("exp", "24h", "Expire")
+		maxAccess := cmd.Int("max", 1, "Max Access")
+		revision := cmd.Int("rev", 0, "Phiên bản được chia sẻ (mặc định: phiên bản hiện tại)")
+		followLatest := cmd.Bool("follow", false, "Người mở link luôn đọc được phiên bản mới nhất")
+		withPassword := cmd.Bool("pass", false, "Đặt mật khẩu cho link (gửi mật khẩu qua kênh khác với link)")
+		maxAttempts := cmd.Int("attempts", 0, "Số lần nhập sai mật khẩu tối đa trước khi link bị xóa (mặc định của server: 5)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleShareLink(*noteID, *expiresIn, *maxAccess, *revision, *followLatest, *withPassword, *maxAttempts, *user)
+
+	case "fetchLink":
+		// Cú pháp: fetchLink -url <link> [-o <path>] (không cần đăng nhập)
+		cmd := flag.NewFlagSet("fetchLink", flag.ExitOnError)
+		link := cmd.String("url", "", "Link công khai (kèm phần #...)")
+		outFile := cmd.String("o", "", "File hoặc thư mục lưu kết quả (mặc định: tên file gốc)")
+		cmd.Parse(os.Args[2:])
+		handleFetchLink(*link, *outFile)
+
+	case "logout":
+		// Cú pháp: logout -u <me> [-all]
+		cmd := flag.NewFlagSet("logout", flag.ExitOnError)
+		user := cmd.String("u", "", "Current username")
+		all := cmd.Bool("all", false, "Đăng xuất khỏi mọi thiết bị")
+		cmd.Parse(os.Args[2:])
+		handleLogout(*user, *all)
+
+	case "changePassword":
+		// Cú pháp: changePassword -u <me>
+		cmd := flag.NewFlagSet("changePassword", flag.ExitOnError)
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleChangePassword(*user)
+
+	case "verify":
+		// Cú pháp: verify -contact <bob> -u <me>
+		cmd := flag.NewFlagSet("verify", flag.ExitOnError)
+		contact := cmd.String("contact", "", "Username người liên lạc")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleVerify(*contact, *user)
+
+	case "trust":
+		// Cú pháp: trust -contact <bob> [-fp <fingerprint>] -u <me>
+		cmd := flag.NewFlagSet("trust", flag.ExitOnError)
+		contact := cmd.String("contact", "", "Username người liên lạc")
+		fingerprint := cmd.String("fp", "", "Fingerprint đã nhận qua kênh khác (gặp mặt, điện thoại)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleTrust(*contact, *fingerprint, *user)
+
+	case "groupCreate":
+		// Cú pháp: groupCreate -name <tên nhóm> -u <me>
+		cmd := flag.NewFlagSet("groupCreate", flag.ExitOnError)
+		name := cmd.String("name", "", "Tên nhóm")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleGroupCreate(*name, *user)
+
+	case "groups":
+		cmd := flag.NewFlagSet("groups", flag.ExitOnError)
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleListGroups(*user)
+
+	case "groupAdd", "groupRole":
+		// Cú pháp: groupAdd -group <id> -member <bob> [-role admin|member] -u <me>
+		//          groupRole -group <id> -member <bob> -role admin|member -u <me>
+		cmd := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+		groupID := cmd.String("group", "", "ID của nhóm")
+		member := cmd.String("member", "", "Username thành viên")
+		role := cmd.String("role", "", "Vai trò: admin hoặc member (mặc định member)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		if os.Args[1] == "groupAdd" {
+			handleGroupAdd(*groupID, *member, *role, *user)
+		} else {
+			handleGroupRole(*groupID, *member, *role, *user)
+		}
+
+	case "groupRemove":
+		// Cú pháp: groupRemove -group <id> -member <bob> -u <me>
+		cmd := flag.NewFlagSet("groupRemove", flag.ExitOnError)
+		groupID := cmd.String("group", "", "ID của nhóm")
+		member := cmd.String("member", "", "Username thành viên cần xóa")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleGroupRemove(*groupID, *member, *user)
+
+	case "groupShare", "groupUnshare":
+		// Cú pháp: groupShare -group <id> -note <note_id> -u <me>
+		cmd := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+		groupID := cmd.String("group", "", "ID của nhóm")
+		noteID := cmd.String("note", "", "ID của ghi chú")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		if os.Args[1] == "groupShare" {
+			handleGroupShare(*groupID, *noteID, *user)
+		} else {
+			handleGroupUnshare(*groupID, *noteID, *user)
+		}
+
+	case "groupNotes":
+		// Cú pháp: groupNotes -group <id> -u <me>
+		cmd := flag.NewFlagSet("groupNotes", flag.ExitOnError)
+		groupID := cmd.String("group", "", "ID của nhóm")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleGroupNotes(*groupID, *user)
+
+	case "groupRead":
+		// Cú pháp: groupRead -group <id> -note <note_id> [-o <path>] -u <me>
+		cmd := flag.NewFlagSet("groupRead", flag.ExitOnError)
+		groupID := cmd.String("group", "", "ID của nhóm")
+		noteID := cmd.String("note", "", "ID của ghi chú")
+		outFile := cmd.String("o", "", "File hoặc thư mục lưu kết quả (mặc định: tên file gốc trong thư mục hiện tại)")
+		user := cmd.String("u", "", "Current username")
+		cmd.Parse(os.Args[2:])
+		handleGroupRead(*groupID, *noteID, *outFile, *user)
 
 	default:
 		printHelp()
@@ -128,16 +391,12 @@ func handleRegister(user, pass string) {
 		return
 	}
 
-	fmt.Println("Đang sinh cặp khóa Diffie-Hellman...")
-	privKey, pubKey, err := crypto.GenerateKeyPair()
+	fmt.Println("Đang sinh cặp khóa X25519...")
+	privKeyHex, pubKeyHex, err := crypto.GenerateX25519KeyPair()
 	if err != nil {
-		fmt.Println("Lỗi: Không thể sinh khóa Diffie-Hellman:", err)
+		fmt.Println("Lỗi: Không thể sinh khóa X25519:", err)
 		return
 	}
-
-	// Chuyển sang Hex để gửi và mã hóa
-	privKeyHex := privKey.Text(16)
-	pubKeyHex := pubKey.Text(16)
 	fmt.Printf("Public Key sinh ra: %s...\n", pubKeyHex[:10])
 
 	fmt.Println("Đang mã hóa Private Key bằng Password...")
@@ -147,8 +406,20 @@ func handleRegister(user, pass string) {
 		return
 	}
 
+	fmt.Println("Đang sinh khóa ký Ed25519...")
+	signingPrivHex, signingPubHex, err := crypto.GenerateSigningKeyPair()
+	if err != nil {
+		fmt.Println("Lỗi: Không thể sinh khóa ký:", err)
+		return
+	}
+	encryptedSigningKey, err := crypto.EncryptByPassword(signingPrivHex, pass)
+	if err != nil {
+		fmt.Println("Lỗi: Không thể mã hóa khóa ký:", err)
+		return
+	}
+
 	fmt.Println("Đang gọi API Đăng ký...")
-	err = services.Register(user, pass, pubKeyHex, encryptedPrivKey)
+	err = services.Register(user, pass, pubKeyHex, crypto.KeyTypeX25519, encryptedPrivKey, signingPubHex, encryptedSigningKey)
 	if err != nil {
 		fmt.Println("Lỗi: Đăng ký thất bại:", err)
 		return
@@ -165,23 +436,260 @@ func handleLogin(user, pass string) {
 	}
 
 	fmt.Println("Đang gọi API Đăng nhập...")
-	token, encryptedPrivKey, err := services.Login(user, pass)
+	result, err := services.Login(user, pass)
 	if err != nil {
 		fmt.Println("Lỗi: Đăng nhập thất bại:", err)
 		return
 	}
 	fmt.Println("Đăng nhập thành công.")
 
-	// Lưu Token và EncryptedPrivateKey vào file
-	saveSession(Session{
-		Username:            user,
-		Token:               token,
-		EncryptedPrivateKey: encryptedPrivKey,
-	})
+	session := Session{
+		Username:                   user,
+		Token:                      result.Token,
+		RefreshToken:               result.RefreshToken,
+		EncryptedPrivateKey:        result.EncryptedPrivateKey,
+		KeyType:                    result.KeyType,
+		EncryptedLegacyPrivateKey:  result.EncryptedLegacyPrivateKey,
+		EncryptedSigningPrivateKey: result.EncryptedSigningKey,
+	}
+
+	// Tài khoản cũ còn dùng khóa DH -> tự nâng cấp lên X25519 (cần mật khẩu nên làm lúc đăng nhập)
+	if session.KeyType != crypto.KeyTypeX25519 {
+		if err := upgradeToX25519(&session, pass); err != nil {
+			fmt.Println("Cảnh báo: Không thể nâng cấp khóa lên X25519, tiếp tục dùng khóa DH:", err)
+		}
+	}
+	// Tài khoản tạo trước khi có chữ ký share -> sinh khóa ký
+	if session.EncryptedSigningPrivateKey == "" {
+		if err := addSigningKey(&session, pass); err != nil {
+			fmt.Println("Cảnh báo: Không thể tạo khóa ký, các share gửi đi sẽ không có chữ ký:", err)
+		}
+	}
+
+	// Lưu Token, RefreshToken và các private key đã mã hóa vào file
+	saveSession(session)
 	fmt.Println("Đã lưu phiên làm việc.")
 }
 
-func handleListOwnedFile(username string) {
+// Sinh khóa X25519 mới và đăng ký lên server, khóa DH hiện tại trở thành khóa cũ
+// Các share cũ (bọc bằng khóa DH) vẫn đọc được nhờ khóa cũ
+func upgradeToX25519(session *Session, password string) error {
+	fmt.Println("Tài khoản đang dùng khóa DH cũ, đang nâng cấp lên X25519...")
+
+	// Thử giải mã khóa DH để chắc chắn mật khẩu đúng trước khi đổi
+	if _, err := crypto.DecryptByPassword(session.EncryptedPrivateKey, password); err != nil {
+		return err
+	}
+
+	privKeyHex, pubKeyHex, err := crypto.GenerateX25519KeyPair()
+	if err != nil {
+		return err
+	}
+	encryptedPrivKey, err := crypto.EncryptByPassword(privKeyHex, password)
+	if err != nil {
+		return err
+	}
+
+	services.UseSession(session.Token, session.RefreshToken, func(accessToken, refreshToken string) {
+		session.Token = accessToken
+		session.RefreshToken = refreshToken
+	})
+	if err := services.UpgradeKey(session.Token, password, pubKeyHex, encryptedPrivKey); err != nil {
+		return err
+	}
+
+	session.EncryptedLegacyPrivateKey = session.EncryptedPrivateKey
+	session.EncryptedPrivateKey = encryptedPrivKey
+	session.KeyType = crypto.KeyTypeX25519
+	fmt.Println("Đã nâng cấp khóa lên X25519.")
+	return nil
+}
+
+// Sinh khóa ký Ed25519 và đăng ký lên server (ghi vào key log)
+func addSigningKey(session *Session, password string) error {
+	fmt.Println("Tài khoản chưa có khóa ký, đang tạo khóa ký Ed25519...")
+
+	privHex, pubHex, err := crypto.GenerateSigningKeyPair()
+	if err != nil {
+		return err
+	}
+	encryptedSigningKey, err := crypto.EncryptByPassword(privHex, password)
+	if err != nil {
+		return err
+	}
+
+	services.UseSession(session.Token, session.RefreshToken, func(accessToken, refreshToken string) {
+		session.Token = accessToken
+		session.RefreshToken = refreshToken
+	})
+	if err := services.SetSigningKey(session.Token, password, pubHex, encryptedSigningKey); err != nil {
+		return err
+	}
+
+	session.EncryptedSigningPrivateKey = encryptedSigningKey
+	fmt.Println("Đã tạo khóa ký.")
+	return nil
+}
+
+// Chọn cách dẫn xuất khóa share với đối phương
+// Cả 2 có X25519 -> x25519-hkdf; nếu không thì dùng khóa DH của cả 2 với HKDF
+// Trả về (scheme, private key của mình đã mã hóa, public key của đối phương)
+func negotiateShareScheme(session Session, peer services.UserPublicKeyResponse) (string, string, string, error) {
+	if session.encryptedX25519Key() != "" && peer.X25519Key() != "" {
+		return crypto.KeySchemeX25519, session.encryptedX25519Key(), peer.X25519Key(), nil
+	}
+	if session.encryptedDHKey() != "" && peer.DHKey() != "" {
+		return crypto.KeySchemeDHHKDF, session.encryptedDHKey(), peer.DHKey(), nil
+	}
+	return "", "", "", fmt.Errorf("không có loại khóa chung với %s (một bên cần đăng nhập lại để nâng cấp khóa)", peer.Username)
+}
+
+// Chọn khóa của mình và của đối phương đúng với scheme của share
+func keysForScheme(session Session, peer services.UserPublicKeyResponse, scheme string) (string, string, error) {
+	var myKey, peerKey string
+	if scheme == crypto.KeySchemeX25519 {
+		myKey, peerKey = session.encryptedX25519Key(), peer.X25519Key()
+	} else {
+		myKey, peerKey = session.encryptedDHKey(), peer.DHKey()
+	}
+	if myKey == "" || peerKey == "" {
+		return "", "", fmt.Errorf("không tìm thấy khóa phù hợp với key scheme %q", scheme)
+	}
+	return myKey, peerKey, nil
+}
+
+// Mở khóa AES của share: tính khóa chung từ private key của mình (giải mã bằng password) và public key của sender
+func unwrapShareKey(session Session, username, password string, senderKeys services.UserPublicKeyResponse, sender, scheme, wrappedKey string) ([]byte, error) {
+	// Share cũ dùng khóa DH, share mới dùng X25519: chọn theo key scheme lưu trong share
+	myEncryptedPrivKey, senderPubKeyHex, err := keysForScheme(session, senderKeys, scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	// Giải mã Private Key
+	myPrivKeyHex, err := crypto.DecryptByPassword(myEncryptedPrivKey, password)
+	if err != nil {
+		return nil, fmt.Errorf("sai mật khẩu hoặc lỗi Private Key: %v", err)
+	}
+
+	wrappingKey, err := crypto.DeriveShareKey(scheme, myPrivKeyHex, senderPubKeyHex, sender, username)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tính toán khóa chung: %v", err)
+	}
+
+	// Giải mã AES Key bằng khóa chung
+	aesKey, err := crypto.UnwrapAESKey(wrappedKey, wrappingKey)
+	if err != nil {
+		return nil, fmt.Errorf("giải mã khóa thất bại (có thể sai sender hoặc dữ liệu bị lỗi): %v", err)
+	}
+	return aesKey, nil
+}
+
+// Metadata của file cần lưu: tên file, tiêu đề (mặc định là tên file), MIME type, kích thước, thời điểm tạo
+func describeFile(path, title string, info os.FileInfo) models.NoteMetadata {
+	name := filepath.Base(path)
+	if title == "" {
+		title = name
+	}
+
+	// Đoán MIME type theo phần mở rộng, không được thì theo 512 byte đầu
+	mimeType := mime.TypeByExtension(filepath.Ext(name))
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+		if f, err := os.Open(path); err == nil {
+			head := make([]byte, 512)
+			n, _ := io.ReadFull(f, head)
+			f.Close()
+			mimeType = http.DetectContentType(head[:n])
+		}
+	}
+
+	return models.NoteMetadata{
+		Filename:  name,
+		Title:     title,
+		MimeType:  mimeType,
+		Size:      info.Size(),
+		CreatedAt: time.Now(),
+	}
+}
+
+// Chọn file đầu ra: -o là file thì dùng luôn, rỗng hoặc là thư mục thì dùng tên file gốc trong metadata
+func outputPath(outFile, encryptedMetadata string, aesKey []byte) (string, error) {
+	dir := ""
+	if outFile != "" {
+		info, err := os.Stat(outFile)
+		if err != nil || !info.IsDir() {
+			return outFile, nil
+		}
+		dir = outFile
+	}
+
+	if encryptedMetadata == "" {
+		return "", errors.New("note không có tên file gốc, hãy chỉ định file đầu ra: -o <path>")
+	}
+	meta, err := crypto.DecryptNoteMetadata(encryptedMetadata, aesKey)
+	if err != nil {
+		return "", err
+	}
+
+	// Tên file do người tạo note đặt: chỉ lấy phần tên, không cho ghi ra ngoài thư mục đích
+	name := filepath.Base(filepath.Clean("/" + strings.ReplaceAll(meta.Filename, "\\", "/")))
+	if name == "/" || name == "." || name == ".." {
+		return "", errors.New("tên file gốc không hợp lệ, hãy chỉ định file đầu ra: -o <path>")
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// 1 dòng mô tả note trong danh sách (metadata đã giải mã)
+func formatNoteMetadata(meta models.NoteMetadata) string {
+	return fmt.Sprintf("%s | %s | %s | %s | %s",
+		meta.Title, meta.Filename, meta.MimeType, formatSize(meta.Size), meta.CreatedAt.Local().Format("2006-01-02 15:04"))
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Lấy trang thứ page (bắt đầu từ 1) bằng cách đi theo cursor từ trang đầu
+// Trả về kèm cờ còn trang sau hay không
+func fetchPage[T any](query models.ListQuery, page int, fetch func(models.ListQuery) ([]T, string, error)) ([]T, bool, error) {
+	if page < 1 || (page > 1 && query.Limit <= 0) {
+		return nil, false, fmt.Errorf("-page phải từ 1 trở lên và cần -limit lớn hơn 0")
+	}
+	for i := 1; ; i++ {
+		items, next, err := fetch(query)
+		if err != nil {
+			return nil, false, err
+		}
+		if i == page {
+			return items, next != "", nil
+		}
+		if next == "" {
+			return nil, false, fmt.Errorf("chỉ có %d trang", i)
+		}
+		query.After = next
+	}
+}
+
+// Dòng cuối danh sách: vị trí trang và cách xem trang sau
+func printPageFooter(page int, hasMore bool) {
+	if hasMore {
+		fmt.Printf("(Trang %d, xem tiếp với -page %d)\n", page, page+1)
+	} else if page > 1 {
+		fmt.Printf("(Trang %d, trang cuối)\n", page)
+	}
+}
+
+func handleListOwnedFile(query models.ListQuery, page int, username string) {
 	if username == "" {
 		fmt.Println("Vui lòng chỉ định user: -u <username>")
 		return
@@ -193,23 +701,47 @@ func handleListOwnedFile(username string) {
 		return
 	}
 
-	notes, err := services.GetOwnedNotes(session.Token)
+	notes, hasMore, err := fetchPage(query, page, func(q models.ListQuery) ([]models.Note, string, error) {
+		return services.GetOwnedNotesPage(session.Token, q)
+	})
 	if err != nil {
 		fmt.Printf("Lỗi: Không thể lấy danh sách file: %v\n", err)
 		return
 	}
 
-	fmt.Println("\n--- DANH SÁCH FILE CỦA BẠN ---")
 	if len(notes) == 0 {
+		fmt.Println("\n--- DANH SÁCH FILE CỦA BẠN ---")
 		fmt.Println("(Trống)")
 		return
 	}
+
+	// Tên file, tiêu đề... được mã hóa bằng khóa của từng note (khóa này bọc bằng password)
+	password := promptPassword("Nhập mật khẩu để xem tên file: ")
+
+	fmt.Println("\n--- DANH SÁCH FILE CỦA BẠN ---")
 	for _, n := range notes {
-		fmt.Printf("- Note ID: %s\n", n.ID)
+		fmt.Printf("- Note ID: %s | v%d | %s\n", n.ID, n.Revision, ownedNoteLabel(n, password))
+	}
+	printPageFooter(page, hasMore)
+}
+
+func ownedNoteLabel(n models.Note, password string) string {
+	if n.EncryptedMetadata == "" {
+		return "(không có metadata)"
 	}
+	aesKeyHex, err := crypto.DecryptByPassword(n.EncryptedAesKey, password)
+	if err != nil {
+		return "(sai mật khẩu, không giải mã được metadata)"
+	}
+	aesKey, _ := hex.DecodeString(aesKeyHex)
+	meta, err := crypto.DecryptNoteMetadata(n.EncryptedMetadata, aesKey)
+	if err != nil {
+		return "(metadata bị lỗi)"
+	}
+	return formatNoteMetadata(meta)
 }
 
-func handleListSharedFile(username string) {
+func handleListSharedFile(query models.ListQuery, page int, username string) {
 	if username == "" {
 		fmt.Println("Vui lòng chỉ định user: -u <username>")
 		return
@@ -221,24 +753,63 @@ func handleListSharedFile(username string) {
 		return
 	}
 
-	urls, err := services.GetReceivedURLs(session.Token)
+	urls, hasMore, err := fetchPage(query, page, func(q models.ListQuery) ([]models.Url, string, error) {
+		return services.GetReceivedURLsPage(session.Token, q)
+	})
 	if err != nil {
 		fmt.Printf("Lỗi: Không thể lấy danh sách chia sẻ: %v\n", err)
 		return
 	}
 
-	fmt.Println("\n--- DANH SÁCH ĐƯỢC CHIA SẺ VỚI BẠN ---")
 	if len(urls) == 0 {
+		fmt.Println("\n--- DANH SÁCH ĐƯỢC CHIA SẺ VỚI BẠN ---")
 		fmt.Println("(Trống)")
 		return
 	}
-	for _, u := range urls {
-		fmt.Printf("- URL: %s | Từ: %s | Note ID: %s | Hết hạn: %v\n",
-			u.ID, u.SenderID, u.NoteID, u.ExpiresAt)
+
+	// Metadata mã hóa bằng khóa AES của note: phải mở khóa share (không tính lượt xem)
+	password := promptPassword("Nhập mật khẩu để xem tên file: ")
+	senders := make(map[string]*services.UserPublicKeyResponse)
+	labels := make([]string, len(urls))
+	for i, u := range urls {
+		if u.EncryptedMetadata == "" {
+			labels[i] = "(không có metadata)"
+			continue
+		}
+		// Khóa của sender phải qua kiểm tra known keys và key log như khi đọc share
+		key, seen := senders[u.SenderID]
+		if !seen {
+			if k, ok := fetchTrustedKey(username, u.SenderID); ok {
+				key = &k
+			}
+			senders[u.SenderID] = key
+		}
+		if key == nil {
+			labels[i] = "(không xác minh được khóa của người gửi)"
+			continue
+		}
+		aesKey, err := unwrapShareKey(session, username, password, *key, u.SenderID, u.KeyScheme, u.SharedEncryptedAESKey)
+		if err != nil {
+			labels[i] = "(không mở được khóa share)"
+			continue
+		}
+		meta, err := crypto.DecryptNoteMetadata(u.EncryptedMetadata, aesKey)
+		if err != nil {
+			labels[i] = "(metadata bị lỗi)"
+			continue
+		}
+		labels[i] = formatNoteMetadata(meta)
+	}
+
+	fmt.Println("\n--- DANH SÁCH ĐƯỢC CHIA SẺ VỚI BẠN ---")
+	for i, u := range urls {
+		fmt.Printf("- URL: %s | Từ: %s | Note ID: %s | %s | Hết hạn: %v\n",
+			u.ID, u.SenderID, u.NoteID, labels[i], u.ExpiresAt)
 	}
+	printPageFooter(page, hasMore)
 }
 
-func handleSaveFile(filePath, username string) {
+func handleSaveFile(filePath, title, username string) {
 	if filePath == "" {
 		fmt.Println("Vui lòng nhập đường dẫn file: -f <path>")
 		return
@@ -254,250 +825,1790 @@ func handleSaveFile(filePath, username string) {
 		return
 	}
 
-	// Cần mật khẩu để mã hóa AES Key
-	password := promptPassword("Nhập mật khẩu để mã hóa khóa file: ")
-
-	fmt.Println("Đang xử lý mã hóa file...")
-	// Sử dụng crypto package để mã hóa file và bọc khóa AES bằng password
-	cipherTextBase64, encryptedAESKey, err := crypto.PrepareFileForUpload(filePath, password)
+	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		fmt.Printf("Lỗi mã hóa local: %v\n", err)
+		fmt.Println("Lỗi đường dẫn file:", err)
 		return
 	}
-	// Upload lên server
-	noteID, err := services.CreateNote(session.Token, cipherTextBase64, encryptedAESKey)
+	info, err := os.Stat(absPath)
 	if err != nil {
-		fmt.Printf("Lỗi upload lên server: %v\n", err)
+		fmt.Println("Lỗi đọc file:", err)
 		return
 	}
 
-	fmt.Printf("Lưu thành công! Note ID: %s\n", noteID)
-}
+	// Cần mật khẩu để mã hóa AES Key (hoặc giải mã lại khi tiếp tục upload dở)
+	password := promptPassword("Nhập mật khẩu để mã hóa khóa file: ")
 
-// Logic:
-// B1. Lấy EncryptedAESKeyByPass của Note  -> Giải mã bằng Pass.
-// B2. Lấy PubKey của Receiver -> Tính Shared Secret K (Diffie-Hellman).
-// B3. Mã hóa AES Key bằng K -> Gửi lên Server tạo URL.
-func handleSendFile(noteID, receiver, expiresIn string, maxAccess int, username string) {
-	if noteID == "" || receiver == "" {
-		fmt.Println("Thiếu thông tin. Cần: -note <id> -t <receiver>")
+	// Lần save trước của file này bị gián đoạn thì gửi tiếp
+	journal, err := services.LoadUploadJournal(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
 		return
 	}
+	var upload models.UploadSession
+	var aesKey, prefix []byte
+	entry, resuming := journal[absPath]
+	if resuming {
+		upload, aesKey, prefix, resuming, err = resumeUpload(session.Token, username, absPath, entry, info, password)
+		if err != nil {
+			// Lỗi tạm thời (mất kết nối, sai mật khẩu): giữ nguyên journal để lần sau gửi tiếp
+			fmt.Println("Lỗi:", err)
+			return
+		}
+	}
 
-	if username == "" {
-		fmt.Println("Vui lòng chỉ định user: -u <username>")
-		return
+	if !resuming {
+		// Sinh AES Key cho note và bọc bằng password
+		var encryptedAESKey string
+		aesKey, encryptedAESKey, err = crypto.NewNoteKey(password)
+		if err == nil {
+			prefix, err = crypto.NewStreamPrefix()
+		}
+		if err != nil {
+			fmt.Printf("Lỗi mã hóa local: %v\n", err)
+			return
+		}
+
+		// Hash nội dung ghi vào journal: lần sau chỉ gửi tiếp nếu file đúng là nội dung này
+		contentHash, err := services.HashUploadFile(absPath)
+		if err != nil {
+			fmt.Println("Lỗi đọc file:", err)
+			return
+		}
+
+		// Tên file, tiêu đề, MIME type... mã hóa cùng khóa với nội dung
+		encryptedMetadata, err := crypto.EncryptNoteMetadata(describeFile(absPath, title, info), aesKey)
+		if err != nil {
+			fmt.Printf("Lỗi mã hóa local: %v\n", err)
+			return
+		}
+
+		// Tạo note (chỉ metadata) rồi mở phiên upload cho nội dung
+		noteID, err := services.CreateNote(session.Token, "", encryptedAESKey, encryptedMetadata)
+		if err != nil {
+			fmt.Printf("Lỗi upload lên server: %v\n", err)
+			return
+		}
+		upload, err = services.CreateUploadSession(session.Token, noteID, crypto.EncryptedSize(info.Size()), services.UploadChunkSize)
+		if err != nil {
+			fmt.Printf("Lỗi upload lên server: %v\n", err)
+			discardNote(session.Token, noteID)
+			return
+		}
+
+		entry = services.UploadJournalEntry{
+			NoteID:      noteID,
+			UploadID:    upload.ID,
+			NoncePrefix: hex.EncodeToString(prefix),
+			FileSize:    info.Size(),
+			ModTime:     info.ModTime(),
+			ContentHash: contentHash,
+			StartedAt:   time.Now(),
+		}
+		if err := services.SetUploadJournalEntry(username, absPath, &entry); err != nil {
+			fmt.Println("Cảnh báo: không ghi được upload journal, nếu bị gián đoạn sẽ phải tải lại từ đầu:", err)
+		}
 	}
 
-	session, err := loadSession(username)
+	// Mã hóa lại từ đầu (cùng khóa và nonce prefix nên ra đúng ciphertext cũ), chỉ gửi các chunk server chưa nhận
+	fmt.Println("Đang mã hóa và tải file lên...")
+	ciphertext, err := crypto.EncryptFileReaderWithPrefix(absPath, aesKey, prefix)
 	if err != nil {
 		fmt.Println("Lỗi:", err)
 		return
 	}
-	// Nhập mật khẩu để giải mã EncryptedPrivKey và EncryptedAESKey
-	password := promptPassword("Nhập mật khẩu xác thực: ")
-
-	// Tìm Note để lấy EncryptedAesKey được mã bằng password
-	myNotes, err := services.GetOwnedNotes(session.Token)
+	digest := crypto.NewCipherDigest()
+	err = services.UploadChunks(session.Token, upload, io.TeeReader(ciphertext, digest), func(done, total int) {
+		fmt.Printf("\r  %d/%d chunk", done, total)
+	})
+	ciphertext.Close()
+	fmt.Println()
 	if err != nil {
-		fmt.Println("Lỗi lấy danh sách note:", err)
-		return
-	}
-	var targetNote *models.Note
-	for _, n := range myNotes {
-		if n.ID == noteID {
-			targetNote = &n
-			break
-		}
-	}
-	if targetNote == nil {
-		fmt.Println("Không tìm thấy Note ID này trong danh sách sở hữu của bạn.")
+		fmt.Printf("Tải lên bị gián đoạn: %v\n", err)
+		fmt.Println("Chạy lại lệnh save với file này để tải tiếp phần còn lại.")
 		return
 	}
 
-	aesKeyRawHex, err := crypto.DecryptByPassword(targetNote.EncryptedAesKey, password)
+	note, err := services.CommitUpload(session.Token, upload.ID)
 	if err != nil {
-		fmt.Println("Sai mật khẩu hoặc dữ liệu lỗi:", err)
+		fmt.Printf("Lỗi hoàn tất upload: %v\n", err)
 		return
 	}
-	aesKeyBytes, _ := hex.DecodeString(aesKeyRawHex)
+	_ = services.SetUploadJournalEntry(username, absPath, nil)
 
-	// Diffie-Hellman
-	// Giải mã EncryptedPrivKey bằng password
-	fmt.Println("Đang giải mã Private Key DH của bạn...")
-	myPrivKeyHex, err := crypto.DecryptByPassword(session.EncryptedPrivateKey, password)
-	if err != nil {
-		fmt.Println("Lỗi giải mã Private Key:", err)
+	// Nội dung server ghép lại phải đúng ciphertext đã mã hóa
+	if note.CipherDigest != digest.Hex() {
+		fmt.Println("Lỗi: nội dung trên server không khớp với file đã mã hóa, note bị xóa. Hãy save lại.")
+		discardNote(session.Token, entry.NoteID)
 		return
 	}
-	myPrivKeyBig := new(big.Int)
-	myPrivKeyBig.SetString(myPrivKeyHex, 16)
 
-	// Lấy Pubkey của Receiver từ Server
-	fmt.Printf("Đang lấy Public Key của %s...\n", receiver)
-	receiverPubKeyHex, err := services.GetUserPublicKey(receiver)
+	fmt.Printf("Lưu thành công! Note ID: %s\n", entry.NoteID)
+}
+
+// Lấy lại phiên upload dở, khóa AES và nonce prefix của lần save trước
+// Trả về ok = false nếu phải tải lại từ đầu (file đã đổi, phiên hết hạn...), khi đó note và mục journal cũ bị bỏ
+func resumeUpload(token, username, absPath string, entry services.UploadJournalEntry, info os.FileInfo, password string) (models.UploadSession, []byte, []byte, bool, error) {
+	discard := func(reason string) (models.UploadSession, []byte, []byte, bool, error) {
+		fmt.Printf("Không tiếp tục được lần tải lên trước (%s), tải lại từ đầu.\n", reason)
+		discardNote(token, entry.NoteID)
+		_ = services.SetUploadJournalEntry(username, absPath, nil)
+		return models.UploadSession{}, nil, nil, false, nil
+	}
+
+	if !entry.Matches(absPath, info) {
+		return discard("file đã thay đổi")
+	}
+	upload, err := services.GetUploadStatus(token, entry.UploadID)
+	if errors.Is(err, services.ErrUploadNotFound) {
+		return discard("phiên upload đã hết hạn")
+	}
 	if err != nil {
-		fmt.Println("Lỗi lấy key người nhận (có thể user không tồn tại):", err)
-		return
+		return models.UploadSession{}, nil, nil, false, err
+	}
+	prefix, err := hex.DecodeString(entry.NoncePrefix)
+	if err != nil {
+		return discard("upload journal bị lỗi")
 	}
 
-	// Tính khóa chung K
-	sharedK, err := crypto.ComputeSharedSecret(myPrivKeyBig, receiverPubKeyHex)
+	// Khóa AES của note nằm trên server, bọc bằng password
+	notes, err := services.GetOwnedNotes(token)
 	if err != nil {
-		fmt.Println("Lỗi tính khóa chung:", err)
+		return models.UploadSession{}, nil, nil, false, err
+	}
+	for _, n := range notes {
+		if n.ID != entry.NoteID {
+			continue
+		}
+		aesKeyHex, err := crypto.DecryptByPassword(n.EncryptedAesKey, password)
+		if err != nil {
+			return models.UploadSession{}, nil, nil, false, fmt.Errorf("sai mật khẩu hoặc dữ liệu lỗi: %v", err)
+		}
+		aesKey, err := hex.DecodeString(aesKeyHex)
+		if err != nil {
+			return discard("khóa AES không hợp lệ")
+		}
+		fmt.Printf("Tiếp tục tải lên note %s...\n", entry.NoteID)
+		return upload, aesKey, prefix, true, nil
+	}
+	return discard("note không còn tồn tại")
+}
+
+// Tải note của mình về: giải mã EncryptedAesKey bằng password rồi giải mã dần nội dung ra file
+// Không có -o (hoặc -o là thư mục) thì lưu với tên file gốc trong metadata
+// revision > 0: tải phiên bản cũ thay vì phiên bản mới nhất
+func handleGetFile(noteID, outFile string, revision int, username string) {
+	if noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -u <me>")
 		return
 	}
 
-	// Mã hóa AES Key bằng Shared K
-	sharedEncryptedAESKey, err := crypto.EncryptAESKeyWithSharedK(aesKeyBytes, sharedK)
+	session, err := loadSession(username)
 	if err != nil {
-		fmt.Println("Lỗi mã hóa khóa chia sẻ:", err)
+		fmt.Println("Lỗi:", err)
 		return
 	}
 
-	// Gọi API tạo Share URL
-	fmt.Println("Đang gửi yêu cầu chia sẻ lên server...")
-	err = services.CreateNoteUrl(noteID, session.Token, sharedEncryptedAESKey, expiresIn, receiver, maxAccess, username)
+	note, err := services.GetNote(session.Token, noteID)
 	if err != nil {
-		fmt.Println("Chia sẻ thất bại:", err)
+		fmt.Println("Lỗi lấy ghi chú:", err)
 		return
 	}
 
-	fmt.Println("Chia sẻ thành công! Người nhận có thể thấy trong danh sách của họ.")
+	password := promptPassword("Nhập mật khẩu để giải mã khóa file: ")
+	aesKeyHex, err := crypto.DecryptByPassword(note.EncryptedAesKey, password)
+	if err != nil {
+		fmt.Println("Sai mật khẩu hoặc dữ liệu lỗi:", err)
+		return
+	}
+	aesKey, err := hex.DecodeString(aesKeyHex)
+	if err != nil {
+		fmt.Println("Khóa AES không hợp lệ:", err)
+		return
+	}
+
+	// Phiên bản cũ có metadata và hash nội dung riêng
+	open := func() (io.ReadCloser, error) { return services.OpenNoteContent(session.Token, noteID) }
+	if revision > 0 && revision != note.Revision {
+		rev, err := findRevision(session.Token, noteID, revision)
+		if err != nil {
+			fmt.Println("Lỗi:", err)
+			return
+		}
+		note.EncryptedMetadata, note.CipherDigest = rev.EncryptedMetadata, rev.CipherDigest
+		open = func() (io.ReadCloser, error) { return services.OpenRevisionContent(session.Token, noteID, revision) }
+	}
+
+	outFile, err = outputPath(outFile, note.EncryptedMetadata, aesKey)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	fmt.Println("Đang tải và giải mã nội dung ghi chú...")
+	content, err := open()
+	if err != nil {
+		fmt.Printf("Lỗi tải dữ liệu: %v\n", err)
+		return
+	}
+	defer content.Close()
+
+	// Nội dung phải khớp hash server lưu lúc upload (phát hiện dữ liệu hỏng khi lưu / truyền)
+	if err := crypto.RestoreFileFromReader(content, aesKey, note.CipherDigest, outFile); err != nil {
+		fmt.Println("Lỗi giải mã file:", err)
+		return
+	}
+
+	fmt.Printf("Đã giải mã thành công!\nNội dung được lưu tại: %s\n", outFile)
+}
+
+// Tìm phiên bản revision trong danh sách phiên bản của note
+func findRevision(token, noteID string, revision int) (models.NoteRevision, error) {
+	revisions, err := services.ListRevisions(token, noteID)
+	if err != nil {
+		return models.NoteRevision{}, err
+	}
+	for _, r := range revisions {
+		if r.Revision == revision {
+			return r, nil
+		}
+	}
+	return models.NoteRevision{}, fmt.Errorf("note không có phiên bản %d", revision)
+}
+
+// Mã hóa nội dung mới bằng khóa AES cũ của note và gửi lên thành phiên bản mới
+// Share đang theo phiên bản mới nhất (-follow) đọc được ngay, share ghim phiên bản cũ không đổi
+func handleUpdateFile(noteID, filePath, title, username string) {
+	if noteID == "" || filePath == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -f <path> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		fmt.Println("Lỗi đường dẫn file:", err)
+		return
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		fmt.Println("Lỗi đọc file:", err)
+		return
+	}
+
+	note, err := services.GetNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Lỗi lấy ghi chú:", err)
+		return
+	}
+
+	password := promptPassword("Nhập mật khẩu để giải mã khóa file: ")
+	aesKeyHex, err := crypto.DecryptByPassword(note.EncryptedAesKey, password)
+	if err != nil {
+		fmt.Println("Sai mật khẩu hoặc dữ liệu lỗi:", err)
+		return
+	}
+	aesKey, err := hex.DecodeString(aesKeyHex)
+	if err != nil {
+		fmt.Println("Khóa AES không hợp lệ:", err)
+		return
+	}
+
+	// Không có -title thì giữ tiêu đề của phiên bản trước
+	if title == "" && note.EncryptedMetadata != "" {
+		if old, err := crypto.DecryptNoteMetadata(note.EncryptedMetadata, aesKey); err == nil {
+			title = old.Title
+		}
+	}
+	encryptedMetadata, err := crypto.EncryptNoteMetadata(describeFile(absPath, title, info), aesKey)
+	if err != nil {
+		fmt.Printf("Lỗi mã hóa local: %v\n", err)
+		return
+	}
+
+	// Mỗi lần mở luồng dùng nonce prefix mới, hash tính lại theo luồng được gửi
+	fmt.Println("Đang mã hóa và tải nội dung mới lên...")
+	var digest *crypto.CipherDigest
+	updated, err := services.UpdateNote(session.Token, noteID, note.Revision, encryptedMetadata, func() (io.ReadCloser, error) {
+		ciphertext, err := crypto.EncryptFileReader(absPath, aesKey)
+		if err != nil {
+			return nil, err
+		}
+		digest = crypto.NewCipherDigest()
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(ciphertext, digest), ciphertext}, nil
+	})
+	if errors.Is(err, services.ErrRevisionConflict) {
+		fmt.Println("Note vừa được cập nhật từ nơi khác, hãy chạy lại lệnh update.")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Lỗi cập nhật: %v\n", err)
+		return
+	}
+
+	// Nội dung server lưu phải đúng ciphertext đã gửi, sai thì quay lại phiên bản trước
+	if updated.CipherDigest != digest.Hex() {
+		fmt.Println("Lỗi: nội dung trên server không khớp với file đã mã hóa, đang khôi phục phiên bản trước...")
+		if _, err := services.RestoreRevision(session.Token, noteID, note.Revision); err != nil {
+			fmt.Println("Khôi phục thất bại:", err)
+		}
+		return
+	}
+
+	fmt.Printf("Cập nhật thành công! Phiên bản hiện tại: %d\n", updated.Revision)
+}
+
+// Liệt kê các phiên bản của note (cũ trước)
+func handleListRevisions(noteID, username string) {
+	if noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	note, err := services.GetNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Lỗi lấy ghi chú:", err)
+		return
+	}
+	revisions, err := services.ListRevisions(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Lỗi lấy danh sách phiên bản:", err)
+		return
+	}
+
+	fmt.Printf("\n--- CÁC PHIÊN BẢN CỦA NOTE %s ---\n", noteID)
+	if len(revisions) == 0 {
+		fmt.Println("(Trống)")
+		return
+	}
+
+	password := promptPassword("Nhập mật khẩu để xem tên file: ")
+	for _, r := range revisions {
+		// Mỗi phiên bản có metadata riêng, giải mã giống danh sách note
+		n := note
+		n.EncryptedMetadata = r.EncryptedMetadata
+		current := ""
+		if r.Revision == note.Revision {
+			current = " (hiện tại)"
+		}
+		fmt.Printf("- v%d%s | %s | %s\n", r.Revision, current, r.CreatedAt.Local().Format("2006-01-02 15:04"), ownedNoteLabel(n, password))
+	}
+}
+
+// Khôi phục phiên bản cũ: nội dung của nó trở thành phiên bản mới nhất, các phiên bản khác vẫn giữ
+func handleRestoreRevision(noteID string, revision int, username string) {
+	if noteID == "" || revision <= 0 || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -rev <n> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	note, err := services.RestoreRevision(session.Token, noteID, revision)
+	if err != nil {
+		fmt.Println("Khôi phục thất bại:", err)
+		return
+	}
+	fmt.Printf("Đã khôi phục phiên bản %d thành phiên bản %d.\n", revision, note.Revision)
+}
+
+// Logic:
+// B1. Lấy EncryptedAESKeyByPass của Note  -> Giải mã bằng Pass.
+// B2. Lấy PubKey của Receiver -> Thỏa thuận loại khóa -> Tính khóa chung (X25519 hoặc Diffie-Hellman).
+// B3. Mã hóa AES Key bằng khóa chung -> Gửi lên Server tạo URL (kèm key scheme).
+// revision > 0: chia sẻ phiên bản đó, followLatest: người nhận luôn đọc phiên bản mới nhất
+// Danh sách người nhận của -t: cách nhau bởi dấu phẩy, mục kết thúc bằng .txt là file chứa mỗi dòng 1 username
+// (bỏ qua dòng trống và dòng bắt đầu bằng #). Người nhận trùng chỉ giữ 1 lần
+func parseRecipients(list string) ([]string, error) {
+	var receivers []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.HasPrefix(name, "#") || seen[name] {
+			return
+		}
+		seen[name] = true
+		receivers = append(receivers, name)
+	}
+
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if !strings.HasSuffix(item, ".txt") {
+			add(item)
+			continue
+		}
+		data, err := os.ReadFile(item)
+		if err != nil {
+			return nil, fmt.Errorf("không đọc được danh sách người nhận %s: %v", item, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			add(line)
+		}
+	}
+	if len(receivers) == 0 {
+		return nil, fmt.Errorf("chưa có người nhận nào")
+	}
+	return receivers, nil
+}
+
+// Chia sẻ note cho 1 hoặc nhiều người nhận: mật khẩu, khóa AES của note, khóa ký chỉ giải mã 1 lần,
+// khóa AES được bọc riêng cho từng người rồi gửi tất cả trong 1 request
+func handleSendFile(noteID, receiverList, expiresIn string, maxAccess, revision int, followLatest bool, username string) {
+	if noteID == "" || receiverList == "" {
+		fmt.Println("Thiếu thông tin. Cần: -note <id> -t <receiver>[,<receiver>|<file.txt>...]")
+		return
+	}
+	if followLatest && revision != 0 {
+		fmt.Println("Chỉ dùng 1 trong 2: -rev <n> hoặc -follow")
+		return
+	}
+
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+
+	receivers, err := parseRecipients(receiverList)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Hạn dùng tính ở client để nằm trong nội dung được ký
+	duration, err := time.ParseDuration(expiresIn)
+	if err != nil || duration <= 0 {
+		fmt.Println("Định dạng thời gian sai (vd: 1h, 30m)")
+		return
+	}
+	expiresAt := time.Now().Add(duration).Unix()
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	// Nhập mật khẩu để giải mã EncryptedPrivKey và EncryptedAESKey
+	password := promptPassword("Nhập mật khẩu xác thực: ")
+
+	// Lấy Note để lấy EncryptedAesKey được mã bằng password
+	targetNote, err := services.GetNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Không tìm thấy Note ID này trong danh sách sở hữu của bạn:", err)
+		return
+	}
+
+	aesKeyRawHex, err := crypto.DecryptByPassword(targetNote.EncryptedAesKey, password)
+	if err != nil {
+		fmt.Println("Sai mật khẩu hoặc dữ liệu lỗi:", err)
+		return
+	}
+	aesKeyBytes, _ := hex.DecodeString(aesKeyRawHex)
+
+	// Ký hash nội dung của phiên bản được chia sẻ, hoặc "latest" nếu share theo phiên bản mới nhất
+	signingPrivHex := ""
+	cipherDigest := targetNote.CipherDigest
+	if session.EncryptedSigningPrivateKey != "" {
+		signingPrivHex, err = crypto.DecryptByPassword(session.EncryptedSigningPrivateKey, password)
+		if err != nil {
+			fmt.Println("Lỗi giải mã khóa ký:", err)
+			return
+		}
+		switch {
+		case followLatest:
+			cipherDigest = crypto.ShareDigestLatest
+		case revision > 0 && revision != targetNote.Revision:
+			rev, err := findRevision(session.Token, noteID, revision)
+			if err != nil {
+				fmt.Println("Lỗi:", err)
+				return
+			}
+			cipherDigest = rev.CipherDigest
+		}
+	} else {
+		fmt.Println("Cảnh báo: tài khoản chưa có khóa ký (hãy đăng nhập lại), share sẽ không có chữ ký.")
+	}
+
+	req := models.CreateSharesRequest{
+		ExpiresIn:    expiresIn,
+		ExpiresAt:    expiresAt,
+		MaxAccess:    maxAccess,
+		Revision:     revision,
+		FollowLatest: followLatest,
+	}
+	// Private key đã giải mã theo khóa đã mã hóa (DH / X25519), mỗi loại chỉ giải mã 1 lần
+	privKeys := make(map[string]string)
+	failed := 0
+	for _, receiver := range receivers {
+		share, err := wrapShareFor(session, username, password, receiver, aesKeyBytes, privKeys)
+		if err == nil && signingPrivHex != "" {
+			msg := crypto.ShareSignatureMessage(username, receiver, noteID, cipherDigest, share.SharedEncryptedAESKey, share.KeyScheme, expiresAt)
+			share.Signature, err = crypto.SignMessage(signingPrivHex, msg)
+		}
+		if err != nil {
+			fmt.Printf("✗ %s: %v\n", receiver, err)
+			failed++
+			continue
+		}
+		req.Shares = append(req.Shares, share)
+	}
+	if len(req.Shares) == 0 {
+		fmt.Println("Không có người nhận nào để chia sẻ.")
+		return
+	}
+
+	// Gọi API tạo share cho tất cả người nhận
+	fmt.Printf("Đang gửi yêu cầu chia sẻ cho %d người nhận lên server...\n", len(req.Shares))
+	results, err := services.CreateNoteShares(session.Token, noteID, req)
+	if err != nil {
+		fmt.Println("Chia sẻ thất bại:", err)
+		return
+	}
+
+	for _, r := range results {
+		if r.Status == http.StatusCreated {
+			fmt.Printf("✓ %s: đã chia sẻ (share %s)\n", r.Receiver, r.UrlID)
+		} else {
+			fmt.Printf("✗ %s: %s (%d)\n", r.Receiver, r.Error, r.Status)
+			failed++
+		}
+	}
+	if failed == 0 {
+		fmt.Println("Chia sẻ thành công! Người nhận có thể thấy trong danh sách của họ.")
+	} else {
+		fmt.Printf("Đã chia sẻ cho %d/%d người nhận.\n", len(receivers)-failed, len(receivers))
+	}
+}
+
+// Bọc khóa AES của note cho receiver bằng khóa chung (khóa của receiver phải qua kiểm tra known keys và key log)
+func wrapShareFor(session Session, username, password, receiver string, aesKey []byte, privKeys map[string]string) (models.ShareRecipient, error) {
+	fmt.Printf("Đang lấy Public Key của %s...\n", receiver)
+	receiverKeys, ok := fetchTrustedKey(username, receiver)
+	if !ok {
+		return models.ShareRecipient{}, fmt.Errorf("không dùng được khóa của người nhận")
+	}
+
+	sharedEncryptedAESKey, scheme, err := wrapKeyFor(session, username, password, receiverKeys, receiver, aesKey, privKeys)
+	if err != nil {
+		return models.ShareRecipient{}, err
+	}
+	return models.ShareRecipient{Receiver: receiver, SharedEncryptedAESKey: sharedEncryptedAESKey, KeyScheme: scheme}, nil
+}
+
+// Bọc key cho peer bằng khóa chung, trả về (key đã bọc, scheme)
+// privKeys: private key đã giải mã theo khóa đã mã hóa (DH / X25519), mỗi loại chỉ giải mã 1 lần
+func wrapKeyFor(session Session, username, password string, peerKeys services.UserPublicKeyResponse, peer string, key []byte, privKeys map[string]string) (string, string, error) {
+	// Thỏa thuận loại khóa (X25519 nếu cả 2 đã nâng cấp)
+	scheme, myEncryptedPrivKey, peerPubKeyHex, err := negotiateShareScheme(session, peerKeys)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Giải mã private key bằng password
+	myPrivKeyHex, ok := privKeys[myEncryptedPrivKey]
+	if !ok {
+		myPrivKeyHex, err = crypto.DecryptByPassword(myEncryptedPrivKey, password)
+		if err != nil {
+			return "", "", fmt.Errorf("lỗi giải mã Private Key: %v", err)
+		}
+		privKeys[myEncryptedPrivKey] = myPrivKeyHex
+	}
+
+	// Dẫn xuất khóa bọc từ khóa chung, gắn với username 2 bên
+	wrappingKey, err := crypto.DeriveShareKey(scheme, myPrivKeyHex, peerPubKeyHex, username, peer)
+	if err != nil {
+		return "", "", fmt.Errorf("lỗi tính khóa chung: %v", err)
+	}
+
+	// Mã hóa key bằng khóa chung
+	wrapped, err := crypto.WrapAESKey(key, wrappingKey)
+	if err != nil {
+		return "", "", fmt.Errorf("lỗi mã hóa khóa chia sẻ: %v", err)
+	}
+	return wrapped, scheme, nil
+}
+
+func handleDeleteFile(noteID, username string) {
+	if noteID == "" {
+		fmt.Println("Thiếu Note ID: -id <id>")
+		return
+	}
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	err = services.DeleteNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Xóa thất bại:", err)
+		return
+	}
+	fmt.Println("Đã chuyển ghi chú vào thùng rác, các chia sẻ tạm ngưng. Khôi phục bằng lệnh restore.")
+}
+
+// Xóa hẳn note dở dang do chính CLI tạo (save lỗi), không để lại trong thùng rác
+func discardNote(token, noteID string) {
+	if err := services.DeleteNote(token, noteID); err == nil {
+		_ = services.PurgeNote(token, noteID)
+	}
+}
+
+func handleListTrash(username string) {
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	notes, err := services.GetTrash(session.Token)
+	if err != nil {
+		fmt.Printf("Lỗi: Không thể lấy thùng rác: %v\n", err)
+		return
+	}
+
+	fmt.Println("\n--- THÙNG RÁC ---")
+	if len(notes) == 0 {
+		fmt.Println("(Trống)")
+		return
+	}
+
+	password := promptPassword("Nhập mật khẩu để xem tên file: ")
+	for _, n := range notes {
+		fmt.Printf("- Note ID: %s | %s | xóa hẳn lúc %s\n", n.ID, ownedNoteLabel(n, password), n.PurgeAt.Local().Format("2006-01-02 15:04"))
+	}
+}
+
+func handleRestoreFile(noteID, username string) {
+	if noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	if err := services.RestoreNote(session.Token, noteID); err != nil {
+		fmt.Println("Khôi phục thất bại:", err)
+		return
+	}
+	fmt.Println("Đã khôi phục ghi chú, các chia sẻ còn hạn hoạt động lại.")
+}
+
+func handlePurgeFile(noteID, username string) {
+	if noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	if promptPassword("Ghi chú và mọi chia sẻ sẽ bị xóa vĩnh viễn. Tiếp tục? (yes/no): ") != "yes" {
+		fmt.Println("Đã hủy.")
+		return
+	}
+	if err := services.PurgeNote(session.Token, noteID); err != nil {
+		fmt.Println("Xóa thất bại:", err)
+		return
+	}
+	fmt.Println("Đã xóa ghi chú vĩnh viễn.")
+}
+
+func handleCancelSharing(noteID, username string) {
+	if noteID == "" {
+		fmt.Println("Thiếu Note ID: -id <id>")
+		return
+	}
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Lưu ý: Hàm services.DeleteSharedNote cần ID của Note để xóa tất cả share liên quan
+	err = services.DeleteSharedNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Hủy chia sẻ thất bại:", err)
+		return
+	}
+	fmt.Println("Đã hủy chia sẻ ghi chú này.")
+}
+
+func handleListShares(noteID, username string) {
+	if noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -id <note_id> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	shares, err := services.ListNoteShares(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Lỗi: Không thể lấy danh sách chia sẻ:", err)
+		return
+	}
+
+	fmt.Printf("\n--- ĐÃ CHIA SẺ NOTE %s ---\n", noteID)
+	if len(shares) == 0 {
+		fmt.Println("(Chưa chia sẻ cho ai)")
+		return
+	}
+	for _, s := range shares {
+		revision := fmt.Sprintf("v%d", s.Revision)
+		if s.FollowLatest {
+			revision = "luôn bản mới nhất"
+		}
+		receiver := s.Receiver
+		switch {
+		case s.Protected:
+			receiver = fmt.Sprintf("(link có mật khẩu, sai %d/%d lần)", s.FailedAttempts, s.MaxAttempts)
+		case s.Public:
+			receiver = "(link công khai)"
+		}
+		fmt.Printf("- Share: %s | Người nhận: %s | Đã xem: %d/%d | %s | Hết hạn: %v\n",
+			s.ID, receiver, s.Accessed, s.MaxAccess, revision, s.ExpiresAt.Local().Format("2006-01-02 15:04"))
+	}
+	fmt.Println("Thu hồi 1 người nhận: go run main.go revoke -share <share> -u", username)
+}
+
+func handleRevokeShare(shareID, username string) {
+	if shareID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -share <url_id> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Chấp nhận cả link đầy đủ (localhost:8080/note/<url_id>)
+	shareID = path.Base(shareID)
+	if err := services.RevokeShare(session.Token, shareID); err != nil {
+		fmt.Println("Thu hồi thất bại:", err)
+		return
+	}
+	fmt.Println("Đã thu hồi chia sẻ.")
+}
+
+// Tạo link công khai: khóa AES của note bọc bằng khóa dẫn xuất từ bí mật ngẫu nhiên,
+// bí mật chỉ nằm trong #fragment của link nên server không giải mã được
+// Link có mật khẩu: bí mật dùng để dẫn xuất khóa = Argon2id(mật khẩu, bí mật trong #fragment),
+// server chỉ lưu verifier của access token để đếm số lần nhập sai
+func handleShareLink(noteID, expiresIn string, maxAccess, revision int, followLatest, withPassword bool, maxAttempts int, username string) {
+	if noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -note <id> -u <me>")
+		return
+	}
+	if followLatest && revision != 0 {
+		fmt.Println("Chỉ dùng 1 trong 2: -rev <n> hoặc -follow")
+		return
+	}
+	if maxAttempts != 0 && !withPassword {
+		fmt.Println("-attempts chỉ dùng cùng -pass")
+		return
+	}
+	duration, err := time.ParseDuration(expiresIn)
+	if err != nil || duration <= 0 {
+		fmt.Println("Định dạng thời gian sai (vd: 1h, 30m)")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	password := promptPassword("Nhập mật khẩu xác thực: ")
+
+	targetNote, err := services.GetNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Không tìm thấy Note ID này trong danh sách sở hữu của bạn:", err)
+		return
+	}
+	aesKeyRawHex, err := crypto.DecryptByPassword(targetNote.EncryptedAesKey, password)
+	if err != nil {
+		fmt.Println("Sai mật khẩu hoặc dữ liệu lỗi:", err)
+		return
+	}
+	aesKeyBytes, _ := hex.DecodeString(aesKeyRawHex)
+
+	secret, err := crypto.GenerateLinkSecret()
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	req := models.CreateLinkRequest{
+		ExpiresAt:    time.Now().Add(duration).Unix(),
+		MaxAccess:    maxAccess,
+		Revision:     revision,
+		FollowLatest: followLatest,
+		MaxAttempts:  maxAttempts,
+	}
+
+	keySecret := secret
+	if withPassword {
+		passphrase := promptPassword("Đặt mật khẩu cho link: ")
+		if passphrase == "" || passphrase != promptPassword("Nhập lại mật khẩu của link: ") {
+			fmt.Println("Mật khẩu trống hoặc không khớp.")
+			return
+		}
+		var token string
+		keySecret, token, err = protectedLinkSecret(secret, passphrase)
+		if err != nil {
+			fmt.Println("Lỗi:", err)
+			return
+		}
+		if req.AccessVerifier, err = crypto.LinkAccessVerifier(token); err != nil {
+			fmt.Println("Lỗi:", err)
+			return
+		}
+	}
+
+	linkKey, err := crypto.DeriveLinkKey(keySecret, noteID)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	if req.SharedEncryptedAESKey, err = crypto.WrapAESKey(aesKeyBytes, linkKey); err != nil {
+		fmt.Println("Lỗi bọc khóa:", err)
+		return
+	}
+
+	urlID, err := services.CreateNoteLink(session.Token, noteID, req)
+	if err != nil {
+		fmt.Println("Tạo link thất bại:", err)
+		return
+	}
+
+	if withPassword {
+		fmt.Println("Đã tạo link có mật khẩu (gửi mật khẩu qua kênh khác với link):")
+	} else {
+		fmt.Println("Đã tạo link công khai (ai có link đều đọc được, hãy gửi qua kênh an toàn):")
+	}
+	fmt.Println(services.FormatLink(urlID, secret))
+	fmt.Printf("Thu hồi: go run main.go revoke -share %s -u %s\n", urlID, username)
+}
+
+// Bí mật dùng để dẫn xuất khóa của link có mật khẩu và access token tương ứng
+func protectedLinkSecret(secret, passphrase string) (string, string, error) {
+	fmt.Println("Đang dẫn xuất khóa từ mật khẩu (Argon2id)...")
+	keySecret, err := crypto.ProtectLinkSecret(secret, passphrase)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := crypto.LinkAccessToken(keySecret)
+	return keySecret, token, err
+}
+
+// Mở link công khai, không cần đăng nhập: khóa AES được mở bằng bí mật trong #fragment của link
+// Link có mật khẩu thì hỏi mật khẩu khi server yêu cầu
+func handleFetchLink(link, outFile string) {
+	if link == "" {
+		fmt.Println("Thiếu thông tin. Cần: -url <link> [-o <path>]")
+		return
+	}
+
+	base, urlID, secret, err := services.ParseLink(link)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Link có mật khẩu: server trả về 401, mỗi mật khẩu sai tính 1 lần thử trên server
+	keySecret, token, scheme := secret, "", crypto.KeySchemeLink
+	meta, err := services.GetLinkMeta(base, urlID, "")
+	for errors.Is(err, services.ErrLinkPasswordRequired) || errors.Is(err, services.ErrLinkWrongPassword) {
+		if errors.Is(err, services.ErrLinkWrongPassword) {
+			fmt.Println(err)
+		}
+		keySecret, token, err = protectedLinkSecret(secret, promptPassword("Nhập mật khẩu của link: "))
+		if err != nil {
+			break
+		}
+		scheme = crypto.KeySchemeLinkPassword
+		meta, err = services.GetLinkMeta(base, urlID, token)
+	}
+	if err != nil {
+		fmt.Printf("Lỗi tải dữ liệu: %v\n", err)
+		return
+	}
+	if meta.KeyScheme != scheme {
+		fmt.Println("Lỗi: server trả về khóa không khớp với loại link")
+		return
+	}
+
+	linkKey, err := crypto.DeriveLinkKey(keySecret, meta.NoteID)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	aesKeyBytes, err := crypto.UnwrapAESKey(meta.EncryptedKey, linkKey)
+	if err != nil {
+		fmt.Println("Không mở được khóa của link (link sai hoặc dữ liệu bị sửa đổi):", err)
+		return
+	}
+
+	outFile, err = outputPath(outFile, meta.EncryptedMetadata, aesKeyBytes)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Tải nội dung (tính 1 lượt xem), nội dung phải khớp hash server báo cho phiên bản của link
+	fmt.Printf("Đang tải file %s chia sẻ...\n", meta.Sender)
+	content, err := services.OpenLinkContent(base, urlID, token)
+	if err != nil {
+		fmt.Printf("Lỗi tải dữ liệu: %v\n", err)
+		return
+	}
+	defer content.Close()
+
+	if err := crypto.RestoreFileFromReader(content, aesKeyBytes, meta.CipherDigest, outFile); err != nil {
+		fmt.Println("Lỗi giải mã file:", err)
+		return
+	}
+	fmt.Printf("Đã giải mã thành công!\nNội dung được lưu tại: %s\n", outFile)
+}
+
+// Logic:
+// B1. Tải CipherText và EncryptedKey (bọc bởi K) từ Server.
+// B2. Lấy PubKey của Sender -> Kiểm tra chữ ký của Sender trên share.
+// B3. Tính khóa chung theo key scheme của share, giải mã lấy AES Key gốc.
+// B4. Dùng AES Key giải mã CipherText -> Ghi ra file.
+func handleReadSharedNote(url, outFile, username string) {
+	// Kiểm tra đầu vào
+	if url == "" || outFile == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -url <url> -o <path> -u <me>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi session:", err)
+		return
+	}
+
+	parts := strings.Split(url, "/")
+	if len(parts) == 0 {
+		fmt.Println("URL trả về rỗng hoặc sai định dạng")
+	}
+	urlID := parts[len(parts)-1] // Lấy phần tử cuối cùng
+
+	// Nhập mật khẩu để giải mã EncryptedPrivKey
+	password := promptPassword("Nhập mật khẩu của BẠN để giải mã: ")
+
+	// Lấy metadata của share (chưa tính lượt xem), nội dung chỉ tải sau khi kiểm tra chữ ký
+	noteData, err := services.GetSharedNoteMeta(urlID, session.Token)
+	if err != nil {
+		fmt.Printf("Lỗi tải dữ liệu: %v\n", err)
+		return
+	}
+
+	sender := noteData.Sender
+
+	// Lấy Public Key của Sender (đối chiếu với khóa đã ghi nhớ)
+	senderKeys, ok := fetchTrustedKey(username, sender)
+	if !ok {
+		return
+	}
+
+	// Kiểm tra chữ ký trước khi giải mã: chứng minh share do đúng sender tạo cho mình
+	if noteData.Signature != "" {
+		// Share theo phiên bản mới nhất: người gửi ký "latest" thay cho hash của 1 phiên bản cụ thể
+		signedDigest := noteData.CipherDigest
+		if noteData.FollowLatest {
+			signedDigest = crypto.ShareDigestLatest
+		}
+		msg := crypto.ShareSignatureMessage(sender, username, noteData.NoteID, signedDigest,
+			noteData.EncryptedKey, noteData.KeyScheme, noteData.ExpiresAt)
+		if err := crypto.VerifySignature(senderKeys.SigningPublicKey, noteData.Signature, msg); err != nil {
+			fmt.Printf("CẢNH BÁO: chữ ký của %s trên share này không hợp lệ, có thể share đã bị giả mạo hoặc sửa đổi. Đã dừng.\n", sender)
+			return
+		}
+		fmt.Printf("Chữ ký của %s hợp lệ.\n", sender)
+		if noteData.FollowLatest {
+			fmt.Printf("Share theo phiên bản mới nhất của note (hiện tại: phiên bản %d).\n", noteData.Revision)
+		}
+	} else {
+		// Share tạo bởi client cũ (chưa có khóa ký)
+		fmt.Printf("Cảnh báo: share này không có chữ ký, không xác nhận được %s là người gửi.\n", sender)
+		if promptPassword("Vẫn tiếp tục giải mã? (yes/no): ") != "yes" {
+			fmt.Println("Đã hủy.")
+			return
+		}
+	}
+
+	fmt.Println("Đang tính toán khóa chung (Shared Secret)...")
+
+	aesKeyBytes, err := unwrapShareKey(session, username, password, senderKeys, sender, noteData.KeyScheme, noteData.EncryptedKey)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Tải nội dung (tính 1 lượt xem) và giải mã dần ra file
+	// Share có chữ ký: nội dung phải khớp hash đã ký (share theo phiên bản mới nhất: hash server báo), nếu không file đầu ra bị xóa
+	fmt.Println("Đang tải và giải mã nội dung ghi chú...")
+	content, err := services.OpenSharedNoteContent(urlID, session.Token)
+	if err != nil {
+		fmt.Printf("Lỗi tải dữ liệu: %v\n", err)
+		return
+	}
+	defer content.Close()
+
+	expectedDigest := ""
+	if noteData.Signature != "" {
+		expectedDigest = noteData.CipherDigest
+	}
+	err = crypto.RestoreFileFromReader(content, aesKeyBytes, expectedDigest, outFile)
+	if err != nil {
+		fmt.Println("Lỗi giải mã file:", err)
+		return
+	}
+
+	fmt.Printf("Đã giải mã thành công!\nNội dung được lưu tại: %s\n", outFile)
+}
+
+// --- NHÓM ---
+
+// Public key của chính mình tính từ private key (không tin khóa server trả về), dùng khi khóa nhóm bọc cho chính mình
+func ownPublicKeys(session Session, password string) (services.UserPublicKeyResponse, error) {
+	keys := services.UserPublicKeyResponse{Username: session.Username, KeyType: session.KeyType}
+	keyType := session.KeyType
+	if keyType == "" {
+		keyType = crypto.KeyTypeDH
+	}
+
+	privKeyHex, err := crypto.DecryptByPassword(session.EncryptedPrivateKey, password)
+	if err != nil {
+		return keys, fmt.Errorf("sai mật khẩu hoặc lỗi Private Key: %v", err)
+	}
+	if keys.PublicKey, err = crypto.PublicKeyFromPrivate(keyType, privKeyHex); err != nil {
+		return keys, err
+	}
+
+	if session.EncryptedLegacyPrivateKey != "" {
+		legacyPrivHex, err := crypto.DecryptByPassword(session.EncryptedLegacyPrivateKey, password)
+		if err != nil {
+			return keys, fmt.Errorf("lỗi giải mã khóa DH cũ: %v", err)
+		}
+		if keys.LegacyPublicKey, err = crypto.PublicKeyFromPrivate(crypto.KeyTypeDH, legacyPrivHex); err != nil {
+			return keys, err
+		}
+	}
+	return keys, nil
+}
+
+// Khóa của thành viên nhóm: của mình thì tính từ private key, của người khác thì qua known keys và key log
+func groupPeerKeys(session Session, username, password, peer string) (services.UserPublicKeyResponse, error) {
+	if peer == username {
+		return ownPublicKeys(session, password)
+	}
+	keys, ok := fetchTrustedKey(username, peer)
+	if !ok {
+		return keys, fmt.Errorf("không dùng được khóa của %s", peer)
+	}
+	return keys, nil
+}
+
+// Bọc khóa nhóm cho member bằng khóa chung giữa mình và member
+func wrapGroupKeyFor(session Session, username, password, member string, groupKey []byte, privKeys map[string]string) (models.GroupKey, error) {
+	memberKeys, err := groupPeerKeys(session, username, password, member)
+	if err != nil {
+		return models.GroupKey{}, err
+	}
+	wrapped, scheme, err := wrapKeyFor(session, username, password, memberKeys, member, groupKey, privKeys)
+	if err != nil {
+		return models.GroupKey{}, err
+	}
+	return models.GroupKey{Username: member, WrappedKey: wrapped, KeyScheme: scheme}, nil
+}
+
+// Mở khóa nhóm (phiên bản hiện tại) bọc cho mình bằng khóa chung với người đã bọc
+func openGroupKey(session Session, username, password string, group models.Group) ([]byte, error) {
+	wrapperKeys, err := groupPeerKeys(session, username, password, group.Key.WrappedBy)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapShareKey(session, username, password, wrapperKeys, group.Key.WrappedBy, group.Key.KeyScheme, group.Key.WrappedKey)
+}
+
+// Mở khóa AES của note trong nhóm bằng khóa nhóm
+func openGroupNoteKey(group models.Group, groupKey []byte, note models.GroupNote) ([]byte, error) {
+	if note.KeyVersion != group.KeyVersion {
+		return nil, fmt.Errorf("note được bọc bằng khóa nhóm cũ (phiên bản %d), hãy nhờ %s chia sẻ lại", note.KeyVersion, note.Sender)
+	}
+	return crypto.UnwrapAESKey(note.EncryptedAESKey, groupKey)
+}
+
+// Tải nhóm và mở khóa nhóm, lỗi thì in ra và trả về false
+func loadGroupKey(session Session, username, password, groupID string) (models.Group, []byte, bool) {
+	group, err := services.GetGroup(session.Token, groupID)
+	if err != nil {
+		fmt.Println("Lỗi tải nhóm:", err)
+		return group, nil, false
+	}
+	groupKey, err := openGroupKey(session, username, password, group)
+	if err != nil {
+		fmt.Println("Lỗi mở khóa nhóm:", err)
+		return group, nil, false
+	}
+	return group, groupKey, true
+}
+
+// Tạo nhóm: sinh khóa nhóm mới và bọc cho chính mình
+func handleGroupCreate(name, username string) {
+	if name == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -name <tên nhóm> -u <me>")
+		return
+	}
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	password := promptPassword("Nhập mật khẩu xác thực: ")
+
+	groupKey, err := crypto.GenerateAESKey()
+	if err != nil {
+		fmt.Println("Lỗi sinh khóa nhóm:", err)
+		return
+	}
+	key, err := wrapGroupKeyFor(session, username, password, username, groupKey, make(map[string]string))
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	groupID, err := services.CreateGroup(session.Token, models.CreateGroupRequest{Name: name, WrappedKey: key.WrappedKey, KeyScheme: key.KeyScheme})
+	if err != nil {
+		fmt.Println("Tạo nhóm thất bại:", err)
+		return
+	}
+	fmt.Printf("Đã tạo nhóm %q. Group ID: %s\n", name, groupID)
 }
 
-func handleDeleteFile(noteID, username string) {
-	if noteID == "" {
-		fmt.Println("Thiếu Note ID: -id <id>")
+func handleListGroups(username string) {
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	groups, err := services.ListGroups(session.Token)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
 		return
 	}
-	if username == "" {
-		fmt.Println("Vui lòng chỉ định user: -u <username>")
+	if len(groups) == 0 {
+		fmt.Println("Bạn chưa tham gia nhóm nào.")
 		return
 	}
+	for _, g := range groups {
+		members := make([]string, 0, len(g.Members))
+		for _, m := range g.Members {
+			members = append(members, fmt.Sprintf("%s (%s)", m.Username, m.Role))
+		}
+		fmt.Printf("[%s] %s | vai trò: %s | khóa nhóm phiên bản %d\n", g.ID, g.Name, g.Key.Role, g.KeyVersion)
+		fmt.Printf("    Thành viên: %s\n", strings.Join(members, ", "))
+	}
+}
 
+// Thêm thành viên: bọc khóa nhóm hiện tại cho thành viên mới, thành viên mới đọc được cả các note đã chia sẻ trước đó
+func handleGroupAdd(groupID, member, role, username string) {
+	if groupID == "" || member == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -member <username> [-role admin|member] -u <me>")
+		return
+	}
 	session, err := loadSession(username)
 	if err != nil {
 		fmt.Println("Lỗi:", err)
 		return
 	}
+	password := promptPassword("Nhập mật khẩu xác thực: ")
 
-	err = services.DeleteNote(session.Token, noteID)
+	group, groupKey, ok := loadGroupKey(session, username, password, groupID)
+	if !ok {
+		return
+	}
+	fmt.Printf("Đang lấy Public Key của %s...\n", member)
+	key, err := wrapGroupKeyFor(session, username, password, member, groupKey, make(map[string]string))
 	if err != nil {
-		fmt.Println("Xóa thất bại:", err)
+		fmt.Println("Lỗi:", err)
 		return
 	}
-	fmt.Println("Đã xóa ghi chú vĩnh viễn.")
+
+	err = services.AddGroupMember(session.Token, groupID, models.AddGroupMemberRequest{
+		Username:   member,
+		Role:       role,
+		WrappedKey: key.WrappedKey,
+		KeyScheme:  key.KeyScheme,
+		KeyVersion: group.KeyVersion,
+	})
+	if err != nil {
+		fmt.Println("Thêm thành viên thất bại:", err)
+		return
+	}
+	fmt.Printf("Đã thêm %s vào nhóm %s.\n", member, group.Name)
 }
 
-func handleCancelSharing(noteID, username string) {
-	if noteID == "" {
-		fmt.Println("Thiếu Note ID: -id <id>")
+func handleGroupRole(groupID, member, role, username string) {
+	if groupID == "" || member == "" || role == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -member <username> -role admin|member -u <me>")
 		return
 	}
-	if username == "" {
-		fmt.Println("Vui lòng chỉ định user: -u <username>")
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	if err := services.SetGroupMemberRole(session.Token, groupID, member, role); err != nil {
+		fmt.Println("Đổi vai trò thất bại:", err)
 		return
 	}
+	fmt.Printf("%s giờ là %s của nhóm.\n", member, role)
+}
 
+// Xóa thành viên và xoay khóa nhóm: sinh khóa mới, bọc cho mọi thành viên còn lại
+// và bọc lại khóa của mọi note trong nhóm, người bị xóa giữ khóa cũ cũng không dùng được nữa
+func handleGroupRemove(groupID, member, username string) {
+	if groupID == "" || member == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -member <username> -u <me>")
+		return
+	}
 	session, err := loadSession(username)
 	if err != nil {
 		fmt.Println("Lỗi:", err)
 		return
 	}
+	password := promptPassword("Nhập mật khẩu xác thực: ")
 
-	// Lưu ý: Hàm services.DeleteSharedNote cần ID của Note để xóa tất cả share liên quan
-	err = services.DeleteSharedNote(session.Token, noteID)
+	group, oldKey, ok := loadGroupKey(session, username, password, groupID)
+	if !ok {
+		return
+	}
+	notes, err := services.ListGroupNotes(session.Token, groupID)
 	if err != nil {
-		fmt.Println("Hủy chia sẻ thất bại:", err)
+		fmt.Println("Lỗi tải danh sách note của nhóm:", err)
 		return
 	}
-	fmt.Println("Đã hủy chia sẻ ghi chú này.")
+
+	newKey, err := crypto.GenerateAESKey()
+	if err != nil {
+		fmt.Println("Lỗi sinh khóa nhóm:", err)
+		return
+	}
+	req := models.RemoveGroupMemberRequest{KeyVersion: group.KeyVersion}
+
+	// Khóa của mọi note (kể cả note đang trong thùng rác) bọc lại bằng khóa mới
+	for _, n := range notes {
+		noteKey, err := openGroupNoteKey(group, oldKey, n)
+		if err != nil {
+			fmt.Printf("Lỗi mở khóa note %s: %v\n", n.NoteID, err)
+			return
+		}
+		wrapped, err := crypto.WrapAESKey(noteKey, newKey)
+		if err != nil {
+			fmt.Println("Lỗi bọc lại khóa note:", err)
+			return
+		}
+		req.Shares = append(req.Shares, models.GroupShareKey{ShareID: n.ShareID, EncryptedAESKey: wrapped})
+	}
+
+	// Khóa mới cho từng thành viên còn lại: thiếu 1 người là dừng, không xoay khóa dở dang
+	privKeys := make(map[string]string)
+	for _, m := range group.Members {
+		if m.Username == member {
+			continue
+		}
+		key, err := wrapGroupKeyFor(session, username, password, m.Username, newKey, privKeys)
+		if err != nil {
+			fmt.Printf("Lỗi bọc khóa nhóm mới cho %s: %v\n", m.Username, err)
+			return
+		}
+		req.Members = append(req.Members, key)
+	}
+
+	keyVersion, err := services.RemoveGroupMember(session.Token, groupID, member, req)
+	if err != nil {
+		fmt.Println("Xóa thành viên thất bại:", err)
+		return
+	}
+	fmt.Printf("Đã xóa %s khỏi nhóm %s. Khóa nhóm đã được xoay (phiên bản %d), %d note đã được bọc lại.\n", member, group.Name, keyVersion, len(req.Shares))
 }
 
-// Logic:
-// B1. Tải CipherText và EncryptedKey (bọc bởi K) từ Server.
-// B2. Lấy PubKey của Sender -> Tính Shared Secret K.
-// B3. Dùng K giải mã lấy AES Key gốc.
-// B4. Dùng AES Key giải mã CipherText -> Ghi ra file.
-func handleReadSharedNote(url, sender, outFile, username string) {
-	// Kiểm tra đầu vào
-	if url == "" || sender == "" || outFile == "" || username == "" {
-		fmt.Println("Thiếu thông tin. Cần: -url <url> -sender <name> -o <path> -u <me>")
+// Chia sẻ note của mình cho nhóm: khóa AES của note bọc bằng khóa nhóm
+func handleGroupShare(groupID, noteID, username string) {
+	if groupID == "" || noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -note <id> -u <me>")
+		return
+	}
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	password := promptPassword("Nhập mật khẩu xác thực: ")
+
+	note, err := services.GetNote(session.Token, noteID)
+	if err != nil {
+		fmt.Println("Không tìm thấy Note ID này trong danh sách sở hữu của bạn:", err)
+		return
+	}
+	aesKeyHex, err := crypto.DecryptByPassword(note.EncryptedAesKey, password)
+	if err != nil {
+		fmt.Println("Sai mật khẩu hoặc dữ liệu lỗi:", err)
+		return
+	}
+	aesKey, _ := hex.DecodeString(aesKeyHex)
+
+	group, groupKey, ok := loadGroupKey(session, username, password, groupID)
+	if !ok {
+		return
+	}
+	wrapped, err := crypto.WrapAESKey(aesKey, groupKey)
+	if err != nil {
+		fmt.Println("Lỗi bọc khóa note:", err)
+		return
+	}
+
+	if _, err := services.ShareNoteToGroup(session.Token, groupID, noteID, models.ShareToGroupRequest{EncryptedAESKey: wrapped, KeyVersion: group.KeyVersion}); err != nil {
+		fmt.Println("Chia sẻ cho nhóm thất bại:", err)
 		return
 	}
+	fmt.Printf("Đã chia sẻ note cho nhóm %s. Mọi thành viên (kể cả thành viên mới) đều đọc được phiên bản mới nhất.\n", group.Name)
+}
 
+func handleGroupNotes(groupID, username string) {
+	if groupID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -u <me>")
+		return
+	}
 	session, err := loadSession(username)
 	if err != nil {
-		fmt.Println("Lỗi session:", err)
+		fmt.Println("Lỗi:", err)
 		return
 	}
 
-	parts := strings.Split(url, "/")
-	if len(parts) == 0 {
-		fmt.Println("URL trả về rỗng hoặc sai định dạng")
+	notes, err := services.ListGroupNotes(session.Token, groupID)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	if len(notes) == 0 {
+		fmt.Println("Nhóm chưa có note nào.")
+		return
 	}
-	urlID := parts[len(parts)-1] // Lấy phần tử cuối cùng
 
-	// Nhập mật khẩu để giải mã EncryptedPrivKey
+	// Mở khóa nhóm để đọc tên file, tiêu đề
+	password := promptPassword("Nhập mật khẩu để xem tên file (bỏ trống để bỏ qua): ")
+	var group models.Group
+	var groupKey []byte
+	if password != "" {
+		var ok bool
+		if group, groupKey, ok = loadGroupKey(session, username, password, groupID); !ok {
+			groupKey = nil
+		}
+	}
+
+	for _, n := range notes {
+		label := ""
+		switch {
+		case n.Suspended:
+			label = "(note đang trong thùng rác, tạm ngưng)"
+		case groupKey != nil && n.EncryptedMetadata != "":
+			noteKey, err := openGroupNoteKey(group, groupKey, n)
+			if err != nil {
+				label = fmt.Sprintf("(%v)", err)
+				break
+			}
+			meta, err := crypto.DecryptNoteMetadata(n.EncryptedMetadata, noteKey)
+			if err != nil {
+				label = "(không đọc được metadata)"
+				break
+			}
+			label = formatNoteMetadata(meta)
+		}
+		fmt.Printf("[%s] từ %s | phiên bản %d %s\n", n.NoteID, n.Sender, n.Revision, label)
+	}
+}
+
+// Đọc note của nhóm: mở khóa nhóm, mở khóa note rồi tải và giải mã nội dung
+func handleGroupRead(groupID, noteID, outFile, username string) {
+	if groupID == "" || noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -note <id> [-o <path>] -u <me>")
+		return
+	}
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
 	password := promptPassword("Nhập mật khẩu của BẠN để giải mã: ")
 
-	// Gọi API lấy ciphertext
-	fmt.Println("Đang tải dữ liệu từ server...")
-	noteData, err := services.ReadNoteWithURL(urlID, session.Token)
+	group, groupKey, ok := loadGroupKey(session, username, password, groupID)
+	if !ok {
+		return
+	}
+	notes, err := services.ListGroupNotes(session.Token, groupID)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+	var note *models.GroupNote
+	for i := range notes {
+		if notes[i].NoteID == noteID {
+			note = &notes[i]
+		}
+	}
+	if note == nil || note.Suspended {
+		fmt.Println("Note không có trong nhóm hoặc đang tạm ngưng.")
+		return
+	}
+
+	noteKey, err := openGroupNoteKey(group, groupKey, *note)
+	if err != nil {
+		fmt.Println("Lỗi mở khóa note:", err)
+		return
+	}
+	outFile, err = outputPath(outFile, note.EncryptedMetadata, noteKey)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	fmt.Println("Đang tải và giải mã nội dung ghi chú...")
+	content, err := services.OpenGroupNoteContent(session.Token, groupID, noteID)
 	if err != nil {
 		fmt.Printf("Lỗi tải dữ liệu: %v\n", err)
 		return
 	}
+	defer content.Close()
 
-	// Diffie-Hellman
-	fmt.Println("Đang tính toán khóa chung (Shared Secret)...")
+	// Khóa note chỉ thành viên nhóm mở được và nội dung mã hóa AES-GCM nên server không sửa được nội dung
+	if err := crypto.RestoreFileFromReader(content, noteKey, "", outFile); err != nil {
+		fmt.Println("Lỗi giải mã file:", err)
+		return
+	}
+	fmt.Printf("Đã giải mã thành công!\nNội dung được lưu tại: %s\n", outFile)
+}
 
-	// Giải mã Private Key
-	myPrivKeyHex, err := crypto.DecryptByPassword(session.EncryptedPrivateKey, password)
+func handleGroupUnshare(groupID, noteID, username string) {
+	if groupID == "" || noteID == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -group <id> -note <id> -u <me>")
+		return
+	}
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	if err := services.UnshareNoteFromGroup(session.Token, groupID, noteID); err != nil {
+		fmt.Println("Gỡ note khỏi nhóm thất bại:", err)
+		return
+	}
+	fmt.Println("Đã gỡ note khỏi nhóm.")
+}
+
+// Thu hồi token trên server rồi xóa file session local
+// Dùng -all khi mất máy đang giữ file session: đăng nhập ở máy khác rồi logout -all
+func handleLogout(username string, all bool) {
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	// Lỗi server không chặn việc xóa session local
+	if err := services.Logout(session.Token, session.RefreshToken, all); err != nil {
+		fmt.Println("Cảnh báo: Không thể thu hồi token trên server:", err)
+	} else if all {
+		fmt.Println("Đã thu hồi mọi phiên đăng nhập trên mọi thiết bị.")
+	} else {
+		fmt.Println("Đã thu hồi phiên đăng nhập trên server.")
+	}
+
+	if err := deleteSession(username); err != nil {
+		fmt.Println("Lỗi xóa file session:", err)
+		return
+	}
+	fmt.Println("Đăng xuất thành công.")
+}
+
+// Logic:
+// B1. Giải mã Private Key và khóa AES của từng note bằng mật khẩu cũ (trên máy local).
+// B2. Bọc lại tất cả bằng mật khẩu mới.
+// B3. Gửi lên server, server đổi tất cả trong 1 transaction.
+// Các share URL đã gửi bọc bằng khóa chung K nên không bị ảnh hưởng
+func handleChangePassword(username string) {
+	if username == "" {
+		fmt.Println("Vui lòng chỉ định user: -u <username>")
+		return
+	}
+
+	session, err := loadSession(username)
+	if err != nil {
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	oldPassword := promptPassword("Nhập mật khẩu hiện tại: ")
+	newPassword := promptPassword("Nhập mật khẩu mới: ")
+	if newPassword == "" {
+		fmt.Println("Mật khẩu mới không được để trống.")
+		return
+	}
+	if promptPassword("Nhập lại mật khẩu mới: ") != newPassword {
+		fmt.Println("Mật khẩu nhập lại không khớp.")
+		return
+	}
+
+	fmt.Println("Đang bọc lại Private Key...")
+	newEncryptedPrivKey, err := crypto.RewrapByPassword(session.EncryptedPrivateKey, oldPassword, newPassword)
 	if err != nil {
 		fmt.Println("Sai mật khẩu hoặc lỗi Private Key:", err)
 		return
 	}
-	myPrivKeyBig := new(big.Int)
-	myPrivKeyBig.SetString(myPrivKeyHex, 16)
 
-	// Lấy Public Key của Sender
-	senderPubKeyHex, err := services.GetUserPublicKey(sender)
+	// Khóa DH cũ (nếu đã nâng cấp lên X25519) cũng được bọc bằng mật khẩu
+	newEncryptedLegacyPrivKey := ""
+	if session.EncryptedLegacyPrivateKey != "" {
+		newEncryptedLegacyPrivKey, err = crypto.RewrapByPassword(session.EncryptedLegacyPrivateKey, oldPassword, newPassword)
+		if err != nil {
+			fmt.Println("Lỗi bọc lại Private Key DH cũ:", err)
+			return
+		}
+	}
+
+	// Khóa ký cũng được bọc bằng mật khẩu
+	newEncryptedSigningKey := ""
+	if session.EncryptedSigningPrivateKey != "" {
+		newEncryptedSigningKey, err = crypto.RewrapByPassword(session.EncryptedSigningPrivateKey, oldPassword, newPassword)
+		if err != nil {
+			fmt.Println("Lỗi bọc lại khóa ký:", err)
+			return
+		}
+	}
+
+	myNotes, err := services.GetOwnedNotes(session.Token)
+	if err != nil {
+		fmt.Println("Lỗi lấy danh sách note:", err)
+		return
+	}
+	// Note trong thùng rác vẫn phải bọc lại khóa để còn khôi phục được
+	trashed, err := services.GetTrash(session.Token)
+	if err != nil {
+		fmt.Println("Lỗi lấy thùng rác:", err)
+		return
+	}
+	myNotes = append(myNotes, trashed...)
+
+	fmt.Printf("Đang bọc lại khóa của %d ghi chú...\n", len(myNotes))
+	noteKeys := make([]models.NoteKeyUpdate, 0, len(myNotes))
+	for _, n := range myNotes {
+		newKey, err := crypto.RewrapByPassword(n.EncryptedAesKey, oldPassword, newPassword)
+		if err != nil {
+			fmt.Printf("Lỗi giải mã khóa của note %s: %v\n", n.ID, err)
+			return
+		}
+		noteKeys = append(noteKeys, models.NoteKeyUpdate{NoteID: n.ID, EncryptedAesKey: newKey})
+	}
+
+	fmt.Println("Đang gửi yêu cầu đổi mật khẩu lên server...")
+	result, err := services.ChangePassword(session.Token, oldPassword, newPassword, newEncryptedPrivKey, newEncryptedLegacyPrivKey, newEncryptedSigningKey, noteKeys)
 	if err != nil {
-		fmt.Printf("Lỗi lấy Public Key của %s: %v\n", sender, err)
+		fmt.Println("Đổi mật khẩu thất bại:", err)
 		return
 	}
 
-	// Tính K
-	sharedK, err := crypto.ComputeSharedSecret(myPrivKeyBig, senderPubKeyHex)
+	// Các phiên cũ đã bị thu hồi, lưu lại token mới và Private Key đã bọc lại
+	session.Token = result.Token
+	session.RefreshToken = result.RefreshToken
+	session.EncryptedPrivateKey = newEncryptedPrivKey
+	session.EncryptedLegacyPrivateKey = newEncryptedLegacyPrivKey
+	session.EncryptedSigningPrivateKey = newEncryptedSigningKey
+	saveSession(session)
+	fmt.Println("Đổi mật khẩu thành công. Các thiết bị khác cần đăng nhập lại.")
+}
+
+// Lấy public key của contact và đối chiếu với khóa đã ghi nhớ
+// Khóa bị đổi -> cảnh báo và từ chối, người dùng phải xác minh rồi chạy trust
+func fetchTrustedKey(username, contact string) (services.UserPublicKeyResponse, bool) {
+	key, pin, status, err := services.GetTrustedPublicKey(username, contact)
+	if errors.Is(err, services.ErrPinnedKeyChanged) {
+		fmt.Println("\n!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+		fmt.Printf("CẢNH BÁO: PUBLIC KEY CỦA '%s' ĐÃ THAY ĐỔI!\n", contact)
+		fmt.Println("Server có thể đang tráo khóa để đọc trộm ghi chú của bạn.")
+		fmt.Printf("Khóa đã ghi nhớ: %s\n", pin.Fingerprint)
+		fmt.Printf("Khóa server gửi: %s\n", key.Fingerprint())
+		fmt.Println("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
+		fmt.Printf("Đã dừng. Hãy hỏi trực tiếp %s fingerprint của họ, nếu khớp thì chạy:\n", contact)
+		fmt.Printf("  go run main.go trust -contact %s -fp \"<fingerprint>\" -u %s\n", contact, username)
+		return key, false
+	}
+	if errors.Is(err, services.ErrKeyNotInLog) || errors.Is(err, services.ErrLogKeyChanged) ||
+		errors.Is(err, services.ErrLogInconsistent) || errors.Is(err, crypto.ErrInclusionProof) ||
+		errors.Is(err, crypto.ErrTreeHeadSig) {
+		fmt.Printf("CẢNH BÁO: không xác minh được khóa của '%s' qua key transparency log: %v\n", contact, err)
+		fmt.Println("Server có thể đang đưa khóa khác cho riêng bạn. Đã dừng.")
+		return key, false
+	}
 	if err != nil {
-		fmt.Println("Lỗi tính toán Diffie-Hellman:", err)
+		fmt.Printf("Lỗi lấy Public Key của %s: %v\n", contact, err)
+		return key, false
+	}
+
+	switch status {
+	case services.PinNew:
+		fmt.Printf("Lần đầu liên lạc với %s, đã ghi nhớ khóa. Fingerprint: %s\n", contact, pin.Fingerprint)
+		fmt.Printf("Hãy xác minh bằng: go run main.go verify -contact %s -u %s\n", contact, username)
+	case services.PinUpgraded:
+		fmt.Printf("Lưu ý: %s đã nâng cấp khóa lên X25519. Fingerprint mới: %s\n", contact, pin.Fingerprint)
+	case services.PinSigningKeyAdded:
+		fmt.Printf("Lưu ý: %s vừa tạo khóa ký, đã ghi nhớ.\n", contact)
+	}
+	if !pin.Verified {
+		fmt.Printf("(Khóa của %s chưa được xác minh)\n", contact)
+	}
+	return key, true
+}
+
+// In fingerprint của 2 bên và safety number để so sánh qua kênh khác
+// Khóa của mình được tính từ private key, không dùng khóa server trả về
+func handleVerify(contact, username string) {
+	if contact == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -contact <username> -u <me>")
 		return
 	}
 
-	// Giải mã AES Key bằng K
-	fmt.Println("Đang giải mã khóa AES...")
-	fmt.Println(sender)
-	aesKeyBytes, err := crypto.DecryptAESKeyWithSharedK(noteData.EncryptedKey, sharedK)
+	session, err := loadSession(username)
 	if err != nil {
-		fmt.Println("Giải mã khóa thất bại (Có thể sai Sender hoặc Token bị lỗi):", err)
+		fmt.Println("Lỗi:", err)
+		return
+	}
+
+	contactKey, ok := fetchTrustedKey(username, contact)
+	if !ok {
 		return
 	}
 
-	// Giải mã nội dung file bằng AES Key vừa tìm được
-	fmt.Println("Đang giải mã nội dung ghi chú...")
+	password := promptPassword("Nhập mật khẩu của BẠN để tính fingerprint: ")
+	myPrivKeyHex, err := crypto.DecryptByPassword(session.EncryptedPrivateKey, password)
+	if err != nil {
+		fmt.Println("Sai mật khẩu hoặc lỗi Private Key:", err)
+		return
+	}
+	myKeyType := session.KeyType
+	if myKeyType == "" {
+		myKeyType = crypto.KeyTypeDH
+	}
+	myPubKeyHex, err := crypto.PublicKeyFromPrivate(myKeyType, myPrivKeyHex)
+	if err != nil {
+		fmt.Println("Lỗi tính public key:", err)
+		return
+	}
+	myFingerprint := crypto.Fingerprint(myKeyType, myPubKeyHex)
+
+	fmt.Println("\n--- XÁC MINH KHÓA ---")
+	fmt.Printf("Fingerprint của bạn (%s):  %s\n", username, myFingerprint)
+	fmt.Printf("Fingerprint của %s:  %s\n", contact, contactKey.Fingerprint())
+	fmt.Printf("Safety number:\n  %s\n", crypto.SafetyNumber(username, myFingerprint, contact, contactKey.Fingerprint()))
+	fmt.Println("\nSo sánh safety number với người kia (gặp mặt hoặc gọi điện).")
+	fmt.Printf("Nếu khớp, chạy: go run main.go trust -contact %s -u %s\n", contact, username)
+}
 
-	// Chuyển lại AES Key sang Hex string để tái sử dụng hàm RestoreFileFromNote cũ
-	aesKeyHex := hex.EncodeToString(aesKeyBytes)
+// Ghi nhớ khóa hiện tại của contact và đánh dấu đã xác minh
+// Dùng sau khi verify khớp, hoặc khi khóa đổi hợp lệ (người kia cài lại máy, ...)
+func handleTrust(contact, fingerprint, username string) {
+	if contact == "" || username == "" {
+		fmt.Println("Thiếu thông tin. Cần: -contact <username> -u <me>")
+		return
+	}
 
-	err = crypto.RestoreFileFromNote(noteData.EncryptedContent, aesKeyHex, outFile)
+	key, err := services.GetUserPublicKey(contact)
 	if err != nil {
-		fmt.Println("Lỗi giải mã file:", err)
+		fmt.Printf("Lỗi lấy Public Key của %s: %v\n", contact, err)
+		return
+	}
+	if err := services.VerifyKeyInLog(username, key); err != nil {
+		fmt.Printf("Khóa của %s không qua được kiểm tra key log: %v\n", contact, err)
 		return
 	}
 
-	fmt.Printf("Đã giải mã thành công!\nNội dung được lưu tại: %s\n", outFile)
+	fmt.Printf("Fingerprint hiện tại của %s: %s\n", contact, key.Fingerprint())
+	if fingerprint != "" {
+		// So sánh không phân biệt hoa thường và khoảng trắng
+		normalize := func(s string) string { return strings.ToUpper(strings.ReplaceAll(s, " ", "")) }
+		if normalize(fingerprint) != normalize(key.Fingerprint()) {
+			fmt.Println("Fingerprint KHÔNG khớp! Không ghi nhớ khóa này.")
+			return
+		}
+	} else if promptPassword("Bạn đã xác minh fingerprint này qua kênh khác? (yes/no): ") != "yes" {
+		fmt.Println("Đã hủy.")
+		return
+	}
+
+	if err := services.TrustPublicKey(username, contact, key); err != nil {
+		fmt.Println("Lỗi lưu khóa:", err)
+		return
+	}
+	fmt.Printf("Đã ghi nhớ và xác minh khóa của %s.\n", contact)
 }
 
 // --- HÀM PHỤ TRỢ (Session) ---
@@ -513,10 +2624,20 @@ func getSessionFilename(username string) string {
 func saveSession(s Session) {
 	filename := getSessionFilename(s.Username)
 	data, _ := json.Marshal(s)
-	os.WriteFile(filename, data, 0644)
+	// Chỉ chủ file được đọc vì file chứa refresh token
+	os.WriteFile(filename, data, 0600)
 	fmt.Printf("💾 Đã lưu phiên làm việc của '%s' vào file: %s\n", s.Username, filename)
 }
 
+func deleteSession(username string) error {
+	filename := getSessionFilename(username)
+	if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	fmt.Printf("🗑️ Đã xóa file phiên làm việc: %s\n", filename)
+	return nil
+}
+
 func loadSession(username string) (Session, error) {
 	filename := getSessionFilename(username)
 	data, err := os.ReadFile(filename)
@@ -528,6 +2649,13 @@ func loadSession(username string) (Session, error) {
 	if err := json.Unmarshal(data, &s); err != nil {
 		return Session{}, fmt.Errorf("file session lỗi")
 	}
+
+	// Khi access token hết hạn, services tự làm mới và gọi lại hàm này để lưu token mới
+	services.UseSession(s.Token, s.RefreshToken, func(accessToken, refreshToken string) {
+		s.Token = accessToken
+		s.RefreshToken = refreshToken
+		saveSession(s)
+	})
 	return s, nil
 }
 func promptPassword(label string) string {
@@ -0,0 +1,81 @@
+package models
+
+// Vai trò trong nhóm
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
+// Nhóm mình là thành viên (GET /groups, GET /groups/:group_id)
+type Group struct {
+	ID         string        `json:"group_id"`
+	Name       string        `json:"name"`
+	KeyVersion int           `json:"key_version"`
+	Members    []GroupMember `json:"members"`
+	// Khóa nhóm (phiên bản KeyVersion) bọc cho mình bằng khóa chung với WrappedBy
+	Key GroupKey `json:"key"`
+}
+
+type GroupMember struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Khóa nhóm đã bọc cho 1 thành viên
+type GroupKey struct {
+	Username   string `json:"username"`
+	Role       string `json:"role,omitempty"`
+	WrappedKey string `json:"wrapped_key"`
+	WrappedBy  string `json:"wrapped_by,omitempty"`
+	KeyScheme  string `json:"key_scheme"`
+}
+
+// POST /groups
+type CreateGroupRequest struct {
+	Name       string `json:"name"`
+	WrappedKey string `json:"wrapped_key"`
+	KeyScheme  string `json:"key_scheme"`
+}
+
+// POST /groups/:group_id/members
+type AddGroupMemberRequest struct {
+	Username   string `json:"username"`
+	Role       string `json:"role,omitempty"`
+	WrappedKey string `json:"wrapped_key"`
+	KeyScheme  string `json:"key_scheme"`
+	KeyVersion int    `json:"key_version"`
+}
+
+// DELETE /groups/:group_id/members/:username: khóa nhóm mới cho mọi thành viên còn lại
+// và khóa của mọi note trong nhóm bọc lại bằng khóa mới. KeyVersion là phiên bản khóa cũ
+type RemoveGroupMemberRequest struct {
+	KeyVersion int             `json:"key_version"`
+	Members    []GroupKey      `json:"members"`
+	Shares     []GroupShareKey `json:"shares"`
+}
+
+type GroupShareKey struct {
+	ShareID         string `json:"share_id"`
+	EncryptedAESKey string `json:"encrypted_aes_key"`
+}
+
+// POST /groups/:group_id/notes/:note_id
+type ShareToGroupRequest struct {
+	EncryptedAESKey string `json:"encrypted_aes_key"`
+	KeyVersion      int    `json:"key_version"`
+}
+
+// Note chia sẻ cho nhóm (GET /groups/:group_id/notes)
+// Khóa AES của note bọc bằng khóa nhóm phiên bản KeyVersion, metadata mã hóa bằng khóa AES của note
+type GroupNote struct {
+	ShareID           string `json:"share_id"`
+	NoteID            string `json:"note_id"`
+	Sender            string `json:"sender"`
+	EncryptedAESKey   string `json:"encrypted_aes_key"`
+	KeyVersion        int    `json:"key_version"`
+	EncryptedMetadata string `json:"encrypted_metadata,omitempty"`
+	Revision          int    `json:"revision,omitempty"`
+	// Note đang trong thùng rác: chưa đọc được nhưng khóa vẫn phải bọc lại khi xoay khóa nhóm
+	Suspended bool `json:"suspended,omitempty"`
+}
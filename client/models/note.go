@@ -1,14 +1,57 @@
 package models
 
+import "time"
+
 type Note struct {
 	ID              string `json:"note_id"`
 	CipherText      string `json:"cipher_text"`
 	EncryptedAesKey string `json:"encrypted_aes_key"`
 	OwnerID         string `json:"owner_id"`
+	CipherDigest    string `json:"cipher_digest"`
+	Size            int64  `json:"size"`
+	// NoteMetadata đã mã hóa bằng khóa AES của note (rỗng với note tạo trước khi có metadata)
+	EncryptedMetadata string `json:"encrypted_metadata,omitempty"`
+	// Phiên bản hiện tại của nội dung và thời điểm tạo phiên bản đó
+	Revision  int       `json:"revision"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Chỉ có với note trong thùng rác: lúc bị xóa và lúc server sẽ xóa hẳn
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time `json:"purge_at,omitempty"`
+}
+
+// 1 phiên bản nội dung của note (GET /notes/:note_id/revisions), mọi phiên bản dùng chung khóa AES của note
+type NoteRevision struct {
+	Revision          int       `json:"revision"`
+	Size              int64     `json:"size"`
+	CipherDigest      string    `json:"cipher_digest"`
+	EncryptedMetadata string    `json:"encrypted_metadata,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// Thông tin file gốc, mã hóa cùng khóa với nội dung nên server không đọc được
+type NoteMetadata struct {
+	Filename  string    `json:"filename"`
+	Title     string    `json:"title"`
+	MimeType  string    `json:"mime_type"`
+	Size      int64     `json:"size"` // kích thước plaintext (byte)
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type NoteData struct {
-	EncryptedContent string `json:"cipher_text"`
+	EncryptedContent string `json:"cipher_text,omitempty"`
 	EncryptedKey     string `json:"encrypted_aes_key_by_K"`
 	Sender           string `json:"sender"`
+	KeyScheme        string `json:"key_scheme"`
+	// Các trường được người gửi ký cùng chữ ký (rỗng với share do client cũ tạo)
+	Receiver  string `json:"receiver"`
+	NoteID    string `json:"note_id"`
+	ExpiresAt int64  `json:"expires_at"`
+	Signature string `json:"signature"`
+	// SHA-256 (hex) của ciphertext, dùng kiểm tra chữ ký trước khi tải nội dung
+	CipherDigest string `json:"cipher_digest"`
+	// Phiên bản share trỏ tới; follow_latest: share luôn theo phiên bản mới nhất (chữ ký dùng "latest" thay cho hash)
+	Revision     int  `json:"revision"`
+	FollowLatest bool `json:"follow_latest"`
+	// Chỉ dùng khi tạo note
+	EncryptedMetadata string `json:"encrypted_metadata,omitempty"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+)
+
+// Tham số của các API liệt kê (GET /notes/owned, GET /notes/received)
+type ListQuery struct {
+	Limit  int    // 0: lấy hết
+	After  string // cursor của trang trước (header X-Next-Cursor)
+	Sort   string // created | expires (expires chỉ dùng cho share)
+	Desc   bool
+	Sender string // chỉ dùng cho share nhận được
+	State  string // active, chỉ dùng cho share nhận được
+}
+
+// Query string (kèm dấu ?), rỗng nếu không có tham số nào
+func (q ListQuery) Encode() string {
+	v := url.Values{}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.After != "" {
+		v.Set("after", q.After)
+	}
+	if q.Sort != "" {
+		v.Set("sort", q.Sort)
+	}
+	if q.Desc {
+		v.Set("order", "desc")
+	}
+	if q.Sender != "" {
+		v.Set("sender", q.Sender)
+	}
+	if q.State != "" {
+		v.Set("state", q.State)
+	}
+	if len(v) == 0 {
+		return ""
+	}
+	return "?" + v.Encode()
+}
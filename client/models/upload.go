@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Phiên upload nội dung note theo từng chunk (GET /uploads/:upload_id)
+type UploadSession struct {
+	ID         string    `json:"upload_id"`
+	NoteID     string    `json:"note_id"`
+	TotalSize  int64     `json:"total_size"`
+	ChunkSize  int64     `json:"chunk_size"`
+	ChunkCount int       `json:"chunk_count"`
+	Received   [][2]int  `json:"received"` // các đoạn [chunk đầu, chunk cuối] server đã nhận
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Kích thước đúng của chunk index
+func (u UploadSession) ChunkLength(index int) int64 {
+	if index == u.ChunkCount-1 {
+		return u.TotalSize - int64(index)*u.ChunkSize
+	}
+	return u.ChunkSize
+}
+
+// Server đã nhận chunk index chưa
+func (u UploadSession) HasChunk(index int) bool {
+	for _, r := range u.Received {
+		if index >= r[0] && index <= r[1] {
+			return true
+		}
+	}
+	return false
+}
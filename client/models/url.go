@@ -10,6 +10,50 @@ type Metadata struct {
 	MaxAccess             int    `json:"max_access"` // int (Server yêu cầu số)
 	Receiver              string `json:"receiver"`
 	Sender                string `json:"sender"`
+	KeyScheme             string `json:"key_scheme"`
+	ExpiresAt             int64  `json:"expires_at"` // Unix giây, nằm trong nội dung được ký
+	Signature             string `json:"signature"`
+	Revision              int    `json:"revision,omitempty"` // 0: phiên bản hiện tại
+	FollowLatest          bool   `json:"follow_latest,omitempty"`
+}
+
+// Chia sẻ note cho nhiều người nhận trong 1 request (POST /notes/:note_id/shares)
+type CreateSharesRequest struct {
+	ExpiresIn    string           `json:"expires_in,omitempty"`
+	ExpiresAt    int64            `json:"expires_at"` // Unix giây, nằm trong nội dung được ký
+	MaxAccess    int              `json:"max_access"`
+	Revision     int              `json:"revision,omitempty"` // 0: phiên bản hiện tại
+	FollowLatest bool             `json:"follow_latest,omitempty"`
+	Shares       []ShareRecipient `json:"shares"`
+}
+
+// Khóa AES đã bọc riêng cho 1 người nhận và chữ ký share tương ứng
+type ShareRecipient struct {
+	Receiver              string `json:"receiver"`
+	SharedEncryptedAESKey string `json:"shared_encrypted_aes_key"`
+	KeyScheme             string `json:"key_scheme"`
+	Signature             string `json:"signature"`
+}
+
+// Tạo link công khai (POST /notes/:note_id/links), khóa AES bọc bằng khóa dẫn xuất từ bí mật của link
+type CreateLinkRequest struct {
+	SharedEncryptedAESKey string `json:"shared_encrypted_aes_key"`
+	ExpiresIn             string `json:"expires_in,omitempty"`
+	ExpiresAt             int64  `json:"expires_at,omitempty"`
+	MaxAccess             int    `json:"max_access"`
+	Revision              int    `json:"revision,omitempty"` // 0: phiên bản hiện tại
+	FollowLatest          bool   `json:"follow_latest,omitempty"`
+	// Link có mật khẩu: SHA-256 (hex) của access token và số lần nhập sai tối đa (0: mặc định của server)
+	AccessVerifier string `json:"access_verifier,omitempty"`
+	MaxAttempts    int    `json:"max_attempts,omitempty"`
+}
+
+// Kết quả của từng người nhận, Status là mã HTTP (201: đã tạo share)
+type ShareResult struct {
+	Receiver string `json:"receiver"`
+	Status   int    `json:"status"`
+	UrlID    string `json:"url_id,omitempty"`
+	Error    string `json:"error,omitempty"`
 }
 
 // Url đại diện cho thông tin đường dẫn chia sẻ
@@ -20,4 +64,25 @@ type Url struct {
 	ReceiverID string    `json:"receiver"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	MaxAccess  int       `json:"max_access"`
+	// Dùng để mở khóa AES của share và đọc metadata của note (không tính lượt xem)
+	SharedEncryptedAESKey string `json:"shared_encrypted_aes_key"`
+	KeyScheme             string `json:"key_scheme"`
+	EncryptedMetadata     string `json:"encrypted_metadata,omitempty"`
+}
+
+// Một share đã gửi cho note (GET /notes/:note_id/shares)
+type SentShare struct {
+	ID           string    `json:"url_id"`
+	Receiver     string    `json:"receiver"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxAccess    int       `json:"max_access"`
+	Accessed     int       `json:"accessed"`
+	Revision     int       `json:"revision"`
+	FollowLatest bool      `json:"follow_latest,omitempty"`
+	Public       bool      `json:"public,omitempty"` // link công khai (không có người nhận)
+	// Link có mật khẩu: số lần nhập sai đã dùng và tối đa
+	Protected      bool `json:"protected,omitempty"`
+	FailedAttempts int  `json:"failed_attempts,omitempty"`
+	MaxAttempts    int  `json:"max_attempts,omitempty"`
 }
@@ -11,19 +11,71 @@ type User struct {
 type RegisterRequest struct {
 	Username            string `json:"username"`
 	Password            string `json:"password"`
+	KeyID               string `json:"key_id"`
 	PublicKey           string `json:"public_key"`
+	PublicKeyType       string `json:"public_key_type"`
 	EncryptedPrivateKey string `json:"encrypted_privKey"`
+	SigningPublicKey    string `json:"signing_public_key"`
+	EncryptedSigningKey string `json:"encrypted_signing_privKey"`
 }
 
 // Request gửi lên khi Đăng Nhập
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	KeyID    string `json:"key_id"`
 }
 
 type LoginResponse struct {
 	Message             string `json:"message"`
 	Token               string `json:"token"`
+	RefreshToken        string `json:"refresh_token"`
 	EncryptedPrivateKey string `json:"encrypted_privKey"`
+	// Loại khóa hiện tại, "dh-group14" thì client tự nâng cấp lên X25519
+	KeyType                   string `json:"pubKey_type"`
+	EncryptedLegacyPrivateKey string `json:"encrypted_legacy_privKey"`
+	// Rỗng nghĩa là tài khoản chưa có khóa ký, client tự sinh và gửi lên
+	EncryptedSigningKey string `json:"encrypted_signing_privKey"`
 	Error               string `json:"error,omitempty"`
 }
+
+// Request gửi lên khi làm mới access token
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Khóa AES của 1 note sau khi bọc lại bằng mật khẩu mới
+type NoteKeyUpdate struct {
+	NoteID          string `json:"note_id"`
+	EncryptedAesKey string `json:"encrypted_aes_key"`
+}
+
+// Request gửi lên khi đổi mật khẩu
+type ChangePasswordRequest struct {
+	OldPassword         string `json:"old_password"`
+	NewPassword         string `json:"new_password"`
+	KeyID               string `json:"key_id"`
+	EncryptedPrivateKey string `json:"encrypted_privKey"`
+	// Khóa DH cũ (nếu đã nâng cấp lên X25519) cũng phải bọc lại
+	EncryptedLegacyPrivateKey string `json:"encrypted_legacy_privKey"`
+	// Khóa ký (nếu có) cũng phải bọc lại
+	EncryptedSigningKey string          `json:"encrypted_signing_privKey"`
+	NoteKeys            []NoteKeyUpdate `json:"note_keys"`
+}
+
+// Request gửi lên khi nâng cấp khóa DH lên X25519
+type UpgradeKeyRequest struct {
+	Password            string `json:"password"`
+	KeyID               string `json:"key_id"`
+	PublicKey           string `json:"public_key"`
+	PublicKeyType       string `json:"public_key_type"`
+	EncryptedPrivateKey string `json:"encrypted_privKey"`
+}
+
+// Request gửi lên khi thêm khóa ký cho tài khoản cũ
+type SigningKeyRequest struct {
+	Password            string `json:"password"`
+	KeyID               string `json:"key_id"`
+	SigningPublicKey    string `json:"signing_public_key"`
+	EncryptedSigningKey string `json:"encrypted_signing_privKey"`
+}
@@ -13,49 +13,74 @@ import (
 var BaseURL = "http://localhost:8080"
 
 // Struct nhận server public key RSA
+// KeyID được gửi lại kèm password đã mã hóa để server chọn đúng khóa
 type PublicKeyResponse struct {
 	ServerPublicKeyRSA string `json:"server-public-key-rsa"`
+	KeyID              string `json:"key_id"`
 }
 
 // Struct nhận client public key
+// KeyType rỗng (server cũ) nghĩa là khóa DH
 type UserPublicKeyResponse struct {
-	Username  string `json:"username"`
-	PublicKey string `json:"public_key"`
+	Username        string `json:"username"`
+	PublicKey       string `json:"public_key"`
+	KeyType         string `json:"key_type"`
+	LegacyPublicKey string `json:"legacy_public_key"`
+	// Khóa Ed25519 dùng để kiểm tra chữ ký share (rỗng nếu user chưa có khóa ký)
+	SigningPublicKey string `json:"signing_public_key"`
+	// Vị trí của khóa trong key transparency log (-1: chưa có)
+	LogIndex int64 `json:"log_index"`
+}
+
+// Public key X25519 của user (rỗng nếu user chưa nâng cấp)
+func (r UserPublicKeyResponse) X25519Key() string {
+	if r.KeyType == crypto.KeyTypeX25519 {
+		return r.PublicKey
+	}
+	return ""
+}
+
+// Public key DH của user: khóa hiện tại, hoặc khóa cũ nếu đã nâng cấp lên X25519
+func (r UserPublicKeyResponse) DHKey() string {
+	if r.KeyType == crypto.KeyTypeX25519 {
+		return r.LegacyPublicKey
+	}
+	return r.PublicKey
 }
 
 // --------------------- AUTH GROUP ---------------------
 // URL = BaseURL + /auth
 
-func GetServerPublicKeyRSA() (string, error) {
+func GetServerPublicKeyRSA() (PublicKeyResponse, error) {
+	var keyRes PublicKeyResponse
 	url := BaseURL + "/auth/server-public-key-rsa"
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", fmt.Errorf("Cant get server public key rsa: %v", err)
+		return keyRes, fmt.Errorf("Cant get server public key rsa: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Error get server public key rsa: %d", resp.StatusCode)
+		return keyRes, fmt.Errorf("Error get server public key rsa: %d", resp.StatusCode)
 	}
 
 	body, _ := io.ReadAll(resp.Body)
-	var keyRes PublicKeyResponse
 	if err := json.Unmarshal(body, &keyRes); err != nil {
-		return "", fmt.Errorf("Error read JSON: %v", err)
+		return keyRes, fmt.Errorf("Error read JSON: %v", err)
 	}
 
-	return keyRes.ServerPublicKeyRSA, nil
+	return keyRes, nil
 }
 
-func Register(username, password, pubKeyStr, EncryptedPrivateKey string) error {
+func Register(username, password, pubKeyStr, pubKeyType, EncryptedPrivateKey, signingPubKey, encryptedSigningPrivKey string) error {
 	serverRSAPubKey, err := GetServerPublicKeyRSA()
 	if err != nil {
 		return err
 	}
 
 	// Mã hóa password thô bằng RSA để gửi lên Server qua http
-	encryptedPassword, err := crypto.EncryptPasswordWithServerKey(password, serverRSAPubKey)
+	encryptedPassword, err := crypto.EncryptPasswordWithServerKey(password, serverRSAPubKey.ServerPublicKeyRSA)
 	if err != nil {
 		return fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
 	}
@@ -63,8 +88,12 @@ func Register(username, password, pubKeyStr, EncryptedPrivateKey string) error {
 	reqBody := models.RegisterRequest{
 		Username:            username,
 		Password:            encryptedPassword,
+		KeyID:               serverRSAPubKey.KeyID,
 		PublicKey:           pubKeyStr,
+		PublicKeyType:       pubKeyType,
 		EncryptedPrivateKey: EncryptedPrivateKey,
+		SigningPublicKey:    signingPubKey,
+		EncryptedSigningKey: encryptedSigningPrivKey,
 	}
 
 	jsonData, _ := json.Marshal(reqBody)
@@ -82,26 +111,49 @@ func Register(username, password, pubKeyStr, EncryptedPrivateKey string) error {
 	return nil
 }
 
-func Login(username, password string) (string, string, error) {
+func Login(username, password string) (models.LoginResponse, error) {
+	var result models.LoginResponse
+
 	serverRSAPubKey, err := GetServerPublicKeyRSA()
 	if err != nil {
-		return "", "", err
+		return result, err
 	}
 
 	// Mã hóa password thô bằng RSA để gửi lên server thông qua http
-	encryptedPassword, err := crypto.EncryptPasswordWithServerKey(password, serverRSAPubKey)
+	encryptedPassword, err := crypto.EncryptPasswordWithServerKey(password, serverRSAPubKey.ServerPublicKeyRSA)
 	if err != nil {
-		return "", "", fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
+		return result, fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
 	}
 
 	reqBody := models.LoginRequest{
 		Username: username,
 		Password: encryptedPassword,
+		KeyID:    serverRSAPubKey.KeyID,
 	}
 
 	jsonData, _ := json.Marshal(reqBody)
 
 	resp, err := http.Post(BaseURL+"/auth/login", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &result)
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("Đăng nhập không thành công: %s", result.Error)
+	}
+	return result, nil
+}
+
+// Đổi refresh token lấy cặp (access token, refresh token) mới
+// Refresh token cũ không dùng lại được nữa
+func RefreshToken(refreshToken string) (string, string, error) {
+	jsonData, _ := json.Marshal(models.RefreshRequest{RefreshToken: refreshToken})
+
+	resp, err := http.Post(BaseURL+"/auth/refresh", "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", "", err
 	}
@@ -112,30 +164,185 @@ func Login(username, password string) (string, string, error) {
 	json.Unmarshal(body, &result)
 
 	if resp.StatusCode != http.StatusOK {
-		return "", "", fmt.Errorf("Đăng nhập không thành công: %s", result.Error)
+		return "", "", fmt.Errorf("Làm mới phiên không thành công: %s", result.Error)
 	}
-	return result.Token, result.EncryptedPrivateKey, nil
+	return result.Token, result.RefreshToken, nil
 }
 
-func GetUserPublicKey(targetUsername string) (string, error) {
+func GetUserPublicKey(targetUsername string) (UserPublicKeyResponse, error) {
+	var res UserPublicKeyResponse
 	url := fmt.Sprintf("%s/auth/users/%s/pubkey", BaseURL, targetUsername)
 
 	resp, err := http.Get(url)
 	if err != nil {
-		return "", fmt.Errorf("Error connected: %v", err)
+		return res, fmt.Errorf("Error connected: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode == 404 {
-		return "", fmt.Errorf("User '%s' is not exist", targetUsername)
+		return res, fmt.Errorf("User '%s' is not exist", targetUsername)
 	}
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("Error Server: %d", resp.StatusCode)
+		return res, fmt.Errorf("Error Server: %d", resp.StatusCode)
 	}
 
+	// Server cũ không trả về log_index -> coi như chưa có trong log
+	res.LogIndex = -1
 	body, _ := io.ReadAll(resp.Body)
-	var res UserPublicKeyResponse
 	json.Unmarshal(body, &res)
 
-	return res.PublicKey, nil
+	return res, nil
+}
+
+// Đăng xuất trên server
+// all = false: thu hồi phiên hiện tại (access token + refresh token)
+// all = true:  thu hồi mọi phiên của user trên mọi thiết bị
+func Logout(token, refreshToken string, all bool) error {
+	apiURL := BaseURL + "/auth/logout"
+	if all {
+		apiURL = BaseURL + "/auth/logout-all"
+	}
+
+	jsonData, _ := json.Marshal(models.RefreshRequest{RefreshToken: refreshToken})
+	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Đổi mật khẩu: gửi mật khẩu cũ/mới (mã hóa RSA), private key và khóa các note đã bọc lại bằng mật khẩu mới
+// Server thu hồi mọi phiên cũ và trả về cặp token mới
+func ChangePassword(token, oldPassword, newPassword, encryptedPrivKey, encryptedLegacyPrivKey, encryptedSigningPrivKey string, noteKeys []models.NoteKeyUpdate) (models.LoginResponse, error) {
+	var result models.LoginResponse
+
+	serverRSAPubKey, err := GetServerPublicKeyRSA()
+	if err != nil {
+		return result, err
+	}
+
+	encryptedOld, err := crypto.EncryptPasswordWithServerKey(oldPassword, serverRSAPubKey.ServerPublicKeyRSA)
+	if err != nil {
+		return result, fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
+	}
+	encryptedNew, err := crypto.EncryptPasswordWithServerKey(newPassword, serverRSAPubKey.ServerPublicKeyRSA)
+	if err != nil {
+		return result, fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
+	}
+
+	jsonData, _ := json.Marshal(models.ChangePasswordRequest{
+		OldPassword:               encryptedOld,
+		NewPassword:               encryptedNew,
+		KeyID:                     serverRSAPubKey.KeyID,
+		EncryptedPrivateKey:       encryptedPrivKey,
+		EncryptedLegacyPrivateKey: encryptedLegacyPrivKey,
+		EncryptedSigningKey:       encryptedSigningPrivKey,
+		NoteKeys:                  noteKeys,
+	})
+	req, err := http.NewRequest("POST", BaseURL+"/auth/change-password", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return result, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return result, fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, &result)
+
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, result.Error)
+	}
+	return result, nil
+}
+
+// Nâng cấp khóa trao đổi lên X25519 (khóa DH hiện tại được server giữ lại làm khóa cũ)
+func UpgradeKey(token, password, pubKeyHex, encryptedPrivKey string) error {
+	serverRSAPubKey, err := GetServerPublicKeyRSA()
+	if err != nil {
+		return err
+	}
+
+	encryptedPassword, err := crypto.EncryptPasswordWithServerKey(password, serverRSAPubKey.ServerPublicKeyRSA)
+	if err != nil {
+		return fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
+	}
+
+	jsonData, _ := json.Marshal(models.UpgradeKeyRequest{
+		Password:            encryptedPassword,
+		KeyID:               serverRSAPubKey.KeyID,
+		PublicKey:           pubKeyHex,
+		PublicKeyType:       crypto.KeyTypeX25519,
+		EncryptedPrivateKey: encryptedPrivKey,
+	})
+	req, err := http.NewRequest("POST", BaseURL+"/auth/upgrade-key", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Gửi khóa ký Ed25519 lên server cho tài khoản tạo trước khi có chữ ký share
+func SetSigningKey(token, password, signingPubKey, encryptedSigningPrivKey string) error {
+	serverRSAPubKey, err := GetServerPublicKeyRSA()
+	if err != nil {
+		return err
+	}
+
+	encryptedPassword, err := crypto.EncryptPasswordWithServerKey(password, serverRSAPubKey.ServerPublicKeyRSA)
+	if err != nil {
+		return fmt.Errorf("Lỗi: Không thể mã hóa mật khẩu bằng Server Public Key RSA: %v", err)
+	}
+
+	jsonData, _ := json.Marshal(models.SigningKeyRequest{
+		Password:            encryptedPassword,
+		KeyID:               serverRSAPubKey.KeyID,
+		SigningPublicKey:    signingPubKey,
+		EncryptedSigningKey: encryptedSigningPrivKey,
+	})
+	req, err := http.NewRequest("POST", BaseURL+"/auth/signing-key", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
+	}
+	return nil
 }
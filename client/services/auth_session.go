@@ -0,0 +1,111 @@
+package services
+
+import (
+	"net/http"
+	"sync"
+)
+
+/*
+	Tự động làm mới access token
+	Access token chỉ sống 15 phút. Khi một API trả về 401, services sẽ:
+	  1. Gọi /auth/refresh bằng refresh token của phiên hiện tại
+	  2. Báo token mới cho main (qua onRefresh) để lưu lại file session
+	  3. Gửi lại request ban đầu với token mới (chỉ thử lại 1 lần)
+	Người dùng không cần đăng nhập lại cho tới khi refresh token hết hạn hoặc bị thu hồi
+*/
+
+type authSession struct {
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	// Các access token cũ đã được thay thế trong lần chạy này
+	superseded map[string]bool
+	onRefresh  func(accessToken, refreshToken string)
+}
+
+var session authSession
+
+// Đăng ký phiên đăng nhập hiện tại để services tự làm mới token khi nhận 401
+func UseSession(accessToken, refreshToken string, onRefresh func(accessToken, refreshToken string)) {
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	session.accessToken = accessToken
+	session.refreshToken = refreshToken
+	session.superseded = make(map[string]bool)
+	session.onRefresh = onRefresh
+}
+
+// Nếu token truyền vào đã bị thay bởi token mới thì dùng token mới
+func (s *authSession) current(token string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.superseded[token] {
+		return s.accessToken
+	}
+	return token
+}
+
+// Làm mới token, trả về access token mới
+// Nếu một request khác đã làm mới trước đó thì dùng luôn kết quả đó
+func (s *authSession) refresh(expiredToken string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.refreshToken == "" {
+		return "", false
+	}
+	if s.superseded[expiredToken] {
+		return s.accessToken, true
+	}
+
+	accessToken, refreshToken, err := RefreshToken(s.refreshToken)
+	if err != nil {
+		return "", false
+	}
+
+	s.superseded[expiredToken] = true
+	s.superseded[s.accessToken] = true
+	s.accessToken = accessToken
+	s.refreshToken = refreshToken
+	if s.onRefresh != nil {
+		s.onRefresh(accessToken, refreshToken)
+	}
+	return accessToken, true
+}
+
+// Gửi request kèm token xác thực, tự làm mới token và gửi lại nếu nhận 401
+func doWithAuth(req *http.Request, token string) (*http.Response, error) {
+	token = session.current(token)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// Chỉ gửi lại được khi body có thể đọc lại (bytes.Buffer, bytes.Reader, strings.Reader hoặc không có body)
+	if req.Body != nil && req.GetBody == nil {
+		return resp, nil
+	}
+
+	newToken, ok := session.refresh(token)
+	if !ok {
+		// Không làm mới được -> trả về 401 ban đầu cho hàm gọi tự xử lý
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", "Bearer "+newToken)
+	return client.Do(retry)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"note_sharing_application/client/models"
+)
+
+// --------------------- GROUPS ---------------------
+// URL = BaseURL + /groups
+
+// Gửi body dạng JSON, kết quả (nếu có) giải mã vào out
+func doGroupRequest(method, apiURL, token string, body interface{}, status int, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("lỗi đóng gói JSON: %v", err)
+		}
+		reader = bytes.NewBuffer(jsonBody)
+	}
+
+	req, err := http.NewRequest(method, apiURL, reader)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return doUploadRequest(req, token, status, out)
+}
+
+func groupURL(groupID string) string {
+	return fmt.Sprintf("%s/groups/%s", BaseURL, url.PathEscape(groupID))
+}
+
+// Tạo nhóm, wrappedKey là khóa nhóm bọc cho chính mình
+func CreateGroup(token string, req models.CreateGroupRequest) (string, error) {
+	var res struct {
+		GroupID string `json:"group_id"`
+	}
+	err := doGroupRequest("POST", BaseURL+"/groups", token, req, http.StatusCreated, &res)
+	return res.GroupID, err
+}
+
+// Các nhóm mình là thành viên
+func ListGroups(token string) ([]models.Group, error) {
+	var groups []models.Group
+	err := doGroupRequest("GET", BaseURL+"/groups", token, nil, http.StatusOK, &groups)
+	return groups, err
+}
+
+func GetGroup(token, groupID string) (models.Group, error) {
+	var group models.Group
+	err := doGroupRequest("GET", groupURL(groupID), token, nil, http.StatusOK, &group)
+	return group, err
+}
+
+func AddGroupMember(token, groupID string, req models.AddGroupMemberRequest) error {
+	return doGroupRequest("POST", groupURL(groupID)+"/members", token, req, http.StatusOK, nil)
+}
+
+func SetGroupMemberRole(token, groupID, username, role string) error {
+	body := map[string]string{"role": role}
+	return doGroupRequest("PUT", groupURL(groupID)+"/members/"+url.PathEscape(username), token, body, http.StatusOK, nil)
+}
+
+// Xóa thành viên và xoay khóa nhóm, trả về phiên bản khóa mới
+func RemoveGroupMember(token, groupID, username string, req models.RemoveGroupMemberRequest) (int, error) {
+	var res struct {
+		KeyVersion int `json:"key_version"`
+	}
+	err := doGroupRequest("DELETE", groupURL(groupID)+"/members/"+url.PathEscape(username), token, req, http.StatusOK, &res)
+	return res.KeyVersion, err
+}
+
+// Các note đã chia sẻ cho nhóm
+func ListGroupNotes(token, groupID string) ([]models.GroupNote, error) {
+	var notes []models.GroupNote
+	err := doGroupRequest("GET", groupURL(groupID)+"/notes", token, nil, http.StatusOK, &notes)
+	return notes, err
+}
+
+// Chia sẻ note của mình cho nhóm, trả về ID của share
+func ShareNoteToGroup(token, groupID, noteID string, req models.ShareToGroupRequest) (string, error) {
+	var res struct {
+		ShareID string `json:"share_id"`
+	}
+	err := doGroupRequest("POST", groupURL(groupID)+"/notes/"+url.PathEscape(noteID), token, req, http.StatusCreated, &res)
+	return res.ShareID, err
+}
+
+func UnshareNoteFromGroup(token, groupID, noteID string) error {
+	return doGroupRequest("DELETE", groupURL(groupID)+"/notes/"+url.PathEscape(noteID), token, nil, http.StatusOK, nil)
+}
+
+// mở luồng nội dung đã mã hóa (binary) của note trong nhóm; người gọi phải Close
+func OpenGroupNoteContent(token, groupID, noteID string) (io.ReadCloser, error) {
+	return openContent(groupURL(groupID)+"/notes/"+url.PathEscape(noteID)+"/content", token)
+}
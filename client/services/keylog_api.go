@@ -0,0 +1,212 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"note_sharing_application/client/crypto"
+)
+
+/*
+	Kiểm tra khóa của người khác với key transparency log trước khi dùng
+	  1. Ghi nhớ public key ký log của server ở lần đầu (Trust On First Use)
+	  2. Lấy Signed Tree Head mới nhất, kiểm tra chữ ký
+	  3. Kiểm tra log mới là phần mở rộng của tree head đã thấy lần trước (consistency proof)
+	  4. Kiểm tra khóa nhận được đúng là entry log_index trong cây (inclusion proof)
+	Trạng thái (khóa log + tree head đã thấy) lưu trong keylog_<username>.json cạnh known keys
+*/
+
+var (
+	ErrKeyNotInLog     = errors.New("public key không có trong key transparency log")
+	ErrLogKeyChanged   = errors.New("khóa ký key log của server đã thay đổi")
+	ErrLogInconsistent = errors.New("key log không nhất quán với tree head đã thấy trước đó")
+)
+
+type SignedTreeHead struct {
+	TreeSize  int64  `json:"tree_size"`
+	RootHash  string `json:"root_hash"`
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+type KeyLogEntry struct {
+	Index           int64  `json:"index"`
+	Username        string `json:"username"`
+	KeyType         string `json:"key_type"`
+	PublicKey       string `json:"public_key"`
+	LegacyPublicKey string `json:"legacy_public_key"`
+	// Khóa ký Ed25519 (rỗng với entry cũ)
+	SigningPublicKey string `json:"signing_public_key"`
+	Timestamp        int64  `json:"timestamp"`
+}
+
+type logProofResponse struct {
+	Proof []string `json:"proof"`
+}
+
+// Trạng thái key log đã kiểm tra của 1 user
+type keyLogState struct {
+	LogPublicKey string         `json:"log_public_key"`
+	TreeHead     SignedTreeHead `json:"tree_head"`
+}
+
+func keyLogFile(owner string) string {
+	return filepath.Join(KnownKeysDir, fmt.Sprintf("keylog_%s.json", owner))
+}
+
+func loadKeyLogState(owner string) (keyLogState, error) {
+	var state keyLogState
+	data, err := os.ReadFile(keyLogFile(owner))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("file key log bị lỗi: %v", err)
+	}
+	return state, nil
+}
+
+func saveKeyLogState(owner string, state keyLogState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(keyLogFile(owner), data, 0600)
+}
+
+// GET BaseURL + path, decode JSON vào out
+func getLogJSON(path string, out interface{}) error {
+	resp, err := http.Get(BaseURL + path)
+	if err != nil {
+		return fmt.Errorf("Error connected: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("Error key log %s: %d - %s", path, resp.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("Error read JSON: %v", err)
+	}
+	return nil
+}
+
+func GetLogPublicKey() (string, error) {
+	var res struct {
+		PublicKey string `json:"public_key"`
+	}
+	err := getLogJSON("/log/public-key", &res)
+	return res.PublicKey, err
+}
+
+func GetSignedTreeHead() (SignedTreeHead, error) {
+	var sth SignedTreeHead
+	err := getLogJSON("/log/sth", &sth)
+	return sth, err
+}
+
+func GetLogEntry(index int64) (KeyLogEntry, error) {
+	var entry KeyLogEntry
+	err := getLogJSON(fmt.Sprintf("/log/entries/%d", index), &entry)
+	return entry, err
+}
+
+func GetInclusionProof(index, treeSize int64) ([][]byte, error) {
+	var res logProofResponse
+	if err := getLogJSON(fmt.Sprintf("/log/proof/inclusion?index=%d&tree_size=%d", index, treeSize), &res); err != nil {
+		return nil, err
+	}
+	return crypto.DecodeHashes(res.Proof)
+}
+
+func GetConsistencyProof(first, second int64) ([][]byte, error) {
+	var res logProofResponse
+	if err := getLogJSON(fmt.Sprintf("/log/proof/consistency?first=%d&second=%d", first, second), &res); err != nil {
+		return nil, err
+	}
+	return crypto.DecodeHashes(res.Proof)
+}
+
+// Kiểm tra khóa key (lấy từ server) nằm trong key log, theo góc nhìn của owner
+func VerifyKeyInLog(owner string, key UserPublicKeyResponse) error {
+	if key.LogIndex < 0 {
+		return fmt.Errorf("%w: %s", ErrKeyNotInLog, key.Username)
+	}
+
+	state, err := loadKeyLogState(owner)
+	if err != nil {
+		return err
+	}
+
+	// 1. Khóa ký log
+	logPubKey, err := GetLogPublicKey()
+	if err != nil {
+		return err
+	}
+	if state.LogPublicKey != "" && state.LogPublicKey != logPubKey {
+		return ErrLogKeyChanged
+	}
+
+	// 2. Tree head mới nhất
+	sth, err := GetSignedTreeHead()
+	if err != nil {
+		return err
+	}
+	if err := crypto.VerifyTreeHead(logPubKey, sth.TreeSize, sth.RootHash, sth.Timestamp, sth.Signature); err != nil {
+		return err
+	}
+	root, err := hex.DecodeString(sth.RootHash)
+	if err != nil {
+		return crypto.ErrTreeHeadSig
+	}
+
+	// 3. Log chỉ được dài thêm so với lần trước
+	old := state.TreeHead
+	if old.TreeSize > 0 {
+		if sth.TreeSize < old.TreeSize {
+			return ErrLogInconsistent
+		}
+		oldRoot, err := hex.DecodeString(old.RootHash)
+		if err != nil {
+			return ErrLogInconsistent
+		}
+		proof, err := GetConsistencyProof(old.TreeSize, sth.TreeSize)
+		if err != nil {
+			return err
+		}
+		if err := crypto.VerifyConsistency(old.TreeSize, sth.TreeSize, oldRoot, root, proof); err != nil {
+			return fmt.Errorf("%w: %v", ErrLogInconsistent, err)
+		}
+	}
+
+	// 4. Entry log_index đúng là khóa nhận được và nằm trong cây
+	entry, err := GetLogEntry(key.LogIndex)
+	if err != nil {
+		return err
+	}
+	if entry.Username != key.Username || entry.KeyType != keyTypeOf(key) ||
+		entry.PublicKey != key.PublicKey || entry.LegacyPublicKey != key.LegacyPublicKey ||
+		entry.SigningPublicKey != key.SigningPublicKey {
+		return fmt.Errorf("%w: %s", ErrKeyNotInLog, key.Username)
+	}
+	proof, err := GetInclusionProof(key.LogIndex, sth.TreeSize)
+	if err != nil {
+		return err
+	}
+	leaf := crypto.MerkleLeafHash(crypto.KeyLogLeafData(entry.Username, entry.KeyType, entry.PublicKey, entry.LegacyPublicKey, entry.SigningPublicKey, entry.Timestamp))
+	if err := crypto.VerifyInclusion(key.LogIndex, sth.TreeSize, leaf, proof, root); err != nil {
+		return err
+	}
+
+	return saveKeyLogState(owner, keyLogState{LogPublicKey: logPubKey, TreeHead: sth})
+}
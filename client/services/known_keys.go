@@ -0,0 +1,166 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"note_sharing_application/client/crypto"
+)
+
+/*
+	Known keys: ghi nhớ public key của từng người đã liên lạc (Trust On First Use)
+	Lần đầu lấy khóa của ai đó thì ghi nhớ (pin) lại. Các lần sau nếu server trả về khóa khác
+	thì từ chối, vì có thể server đã tráo khóa để đọc trộm note.
+	Người dùng so sánh fingerprint / safety number qua kênh khác (gặp mặt, điện thoại) rồi dùng
+	lệnh trust để ghi nhớ khóa mới và đánh dấu đã xác minh
+*/
+
+// Thư mục chứa file known_keys_<username>.json
+var KnownKeysDir = "."
+
+// Khóa đã ghi nhớ của 1 người liên lạc
+type KnownKey struct {
+	KeyType         string `json:"key_type"`
+	PublicKey       string `json:"public_key"`
+	LegacyPublicKey string `json:"legacy_public_key,omitempty"`
+	// Khóa ký Ed25519 dùng để kiểm tra chữ ký share
+	SigningPublicKey string    `json:"signing_public_key,omitempty"`
+	Fingerprint      string    `json:"fingerprint"`
+	Verified         bool      `json:"verified"`
+	PinnedAt         time.Time `json:"pinned_at"`
+}
+
+// Kết quả kiểm tra khóa server trả về với khóa đã ghi nhớ
+type PinStatus int
+
+const (
+	PinMatched         PinStatus = iota // Trùng khóa đã ghi nhớ
+	PinNew                              // Lần đầu thấy người này, vừa ghi nhớ
+	PinUpgraded                         // Người này nâng cấp DH -> X25519 (khóa DH cũ vẫn khớp), đã ghi nhớ khóa mới
+	PinSigningKeyAdded                  // Người này vừa có khóa ký (khóa trao đổi không đổi), đã ghi nhớ khóa ký
+)
+
+var ErrPinnedKeyChanged = errors.New("public key đã thay đổi so với khóa đã ghi nhớ")
+
+func knownKeysFile(owner string) string {
+	return filepath.Join(KnownKeysDir, fmt.Sprintf("known_keys_%s.json", owner))
+}
+
+func keyTypeOf(k UserPublicKeyResponse) string {
+	if k.KeyType == "" {
+		return crypto.KeyTypeDH
+	}
+	return k.KeyType
+}
+
+// Fingerprint của khóa hiện tại mà server trả về
+func (r UserPublicKeyResponse) Fingerprint() string {
+	return crypto.Fingerprint(keyTypeOf(r), r.PublicKey)
+}
+
+func newKnownKey(k UserPublicKeyResponse, verified bool) KnownKey {
+	return KnownKey{
+		KeyType:          keyTypeOf(k),
+		PublicKey:        k.PublicKey,
+		LegacyPublicKey:  k.LegacyPublicKey,
+		SigningPublicKey: k.SigningPublicKey,
+		Fingerprint:      k.Fingerprint(),
+		Verified:         verified,
+		PinnedAt:         time.Now(),
+	}
+}
+
+func (p KnownKey) matches(k UserPublicKeyResponse) bool {
+	return p.sameExchangeKey(k) && p.SigningPublicKey == k.SigningPublicKey
+}
+
+func (p KnownKey) sameExchangeKey(k UserPublicKeyResponse) bool {
+	return p.KeyType == keyTypeOf(k) && p.PublicKey == k.PublicKey && p.LegacyPublicKey == k.LegacyPublicKey
+}
+
+// Đọc danh sách khóa đã ghi nhớ của owner (chưa có file thì trả về rỗng)
+func LoadKnownKeys(owner string) (map[string]KnownKey, error) {
+	keys := make(map[string]KnownKey)
+
+	data, err := os.ReadFile(knownKeysFile(owner))
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("file known keys bị lỗi: %v", err)
+	}
+	return keys, nil
+}
+
+func saveKnownKeys(owner string, keys map[string]KnownKey) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(knownKeysFile(owner), data, 0600)
+}
+
+// Lấy public key của contact từ server, kiểm tra trong key log và đối chiếu với khóa owner đã ghi nhớ
+// Khóa bị đổi thì trả về ErrPinnedKeyChanged (kèm khóa mới để hiển thị fingerprint)
+func GetTrustedPublicKey(owner, contact string) (UserPublicKeyResponse, KnownKey, PinStatus, error) {
+	fetched, err := GetUserPublicKey(contact)
+	if err != nil {
+		return fetched, KnownKey{}, PinMatched, err
+	}
+	// Khóa phải có trong key transparency log rồi mới so với khóa đã ghi nhớ
+	if err := VerifyKeyInLog(owner, fetched); err != nil {
+		return fetched, KnownKey{}, PinMatched, err
+	}
+
+	keys, err := LoadKnownKeys(owner)
+	if err != nil {
+		return fetched, KnownKey{}, PinMatched, err
+	}
+
+	pin, ok := keys[contact]
+	if !ok {
+		pin = newKnownKey(fetched, false)
+		keys[contact] = pin
+		return fetched, pin, PinNew, saveKnownKeys(owner, keys)
+	}
+	if pin.matches(fetched) {
+		return fetched, pin, PinMatched, nil
+	}
+
+	// Tài khoản cũ vừa có khóa ký: khóa trao đổi không đổi nên giữ trạng thái xác minh
+	// Khóa ký mới đã qua key log nên nếu server tráo thì vẫn để lại dấu vết công khai
+	if pin.SigningPublicKey == "" && fetched.SigningPublicKey != "" && pin.sameExchangeKey(fetched) {
+		pin = newKnownKey(fetched, pin.Verified)
+		keys[contact] = pin
+		return fetched, pin, PinSigningKeyAdded, saveKnownKeys(owner, keys)
+	}
+
+	// Nâng cấp DH -> X25519: khóa DH đã ghi nhớ giờ nằm ở legacy_public_key
+	// Chỉ tự chấp nhận khi khóa cũ chưa từng được xác minh; đã xác minh thì phải xác minh lại
+	upgraded := pin.KeyType == crypto.KeyTypeDH && keyTypeOf(fetched) == crypto.KeyTypeX25519 &&
+		fetched.LegacyPublicKey == pin.PublicKey
+	if upgraded && !pin.Verified {
+		pin = newKnownKey(fetched, false)
+		keys[contact] = pin
+		return fetched, pin, PinUpgraded, saveKnownKeys(owner, keys)
+	}
+
+	return fetched, pin, PinMatched, fmt.Errorf("%w: %s", ErrPinnedKeyChanged, contact)
+}
+
+// Ghi nhớ khóa của contact và đánh dấu đã xác minh (sau khi so fingerprint qua kênh khác)
+func TrustPublicKey(owner, contact string, key UserPublicKeyResponse) error {
+	keys, err := LoadKnownKeys(owner)
+	if err != nil {
+		return err
+	}
+	keys[contact] = newKnownKey(key, true)
+	return saveKnownKeys(owner, keys)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"note_sharing_application/client/models"
+	"strings"
+)
+
+// ---------------------LINK CÔNG KHAI-------------------------------------------
+// Link có dạng <server>/links/<url_id>#<bí mật>, phần #fragment không bao giờ được gửi lên server
+
+// Link có mật khẩu: chưa gửi access token, hoặc token sai (mỗi lần sai server tính 1 lần thử)
+var (
+	ErrLinkPasswordRequired = errors.New("link cần mật khẩu")
+	ErrLinkWrongPassword    = errors.New("sai mật khẩu của link")
+)
+
+// Tạo link công khai cho note, trả về url_id
+func CreateNoteLink(token, noteID string, req models.CreateLinkRequest) (string, error) {
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("lỗi đóng gói JSON: %v", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/notes/%s/links", BaseURL, noteID), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return "", fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var res struct {
+		UrlID string `json:"url_id"`
+	}
+	err = doUploadRequest(httpReq, token, http.StatusCreated, &res)
+	return res.UrlID, err
+}
+
+// Link đầy đủ để gửi cho người khác
+func FormatLink(urlID, secret string) string {
+	return fmt.Sprintf("%s/links/%s#%s", BaseURL, urlID, secret)
+}
+
+// Tách link thành địa chỉ server, url_id và bí mật (phần sau dấu #)
+func ParseLink(link string) (string, string, string, error) {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", "", "", fmt.Errorf("link không hợp lệ: %v", err)
+	}
+
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-2] != "links" || u.Fragment == "" {
+		return "", "", "", fmt.Errorf("link không đúng dạng <server>/links/<id>#<bí mật>")
+	}
+	base := u.Scheme + "://" + u.Host + "/" + strings.Join(parts[:len(parts)-2], "/")
+	return strings.TrimSuffix(base, "/"), parts[len(parts)-1], u.Fragment, nil
+}
+
+// Metadata của link (khóa đã bọc, hash ciphertext, metadata đã mã hóa), không cần đăng nhập và không tính lượt xem
+// token: access token của link có mật khẩu (rỗng nếu link không có mật khẩu)
+func GetLinkMeta(base, urlID, token string) (models.NoteData, error) {
+	var result models.NoteData
+
+	resp, err := getLink(fmt.Sprintf("%s/links/%s", base, urlID), token)
+	if err != nil {
+		return result, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("lỗi cấu trúc JSON: %v", err)
+	}
+	return result, nil
+}
+
+// Mở luồng nội dung đã mã hóa của link, tính 1 lượt xem; người gọi phải Close
+func OpenLinkContent(base, urlID, token string) (io.ReadCloser, error) {
+	resp, err := getLink(fmt.Sprintf("%s/links/%s/content", base, urlID), token)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// GET link công khai kèm access token (nếu có), trả về lỗi nếu status khác 200
+func getLink(apiURL, token string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Link-Token", token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		var res struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&res)
+		if token == "" {
+			return nil, ErrLinkPasswordRequired
+		}
+		return nil, fmt.Errorf("%w: %s", ErrLinkWrongPassword, res.Error)
+	}
+	return nil, serverError(resp)
+}
@@ -12,16 +12,17 @@ import (
 // --------------------- NOTE GROUP ---------------------
 // URL = BaseURL + /notes
 
-// Tạo một note
-func CreateNote(token, cipherText, encryptedAESKey string) (string, error) {
+// Tạo một note, encryptedMetadata (có thể rỗng) là NoteMetadata đã mã hóa bằng crypto.EncryptNoteMetadata
+func CreateNote(token, cipherText, encryptedAESKey, encryptedMetadata string) (string, error) {
 
 	// url
 	apiURL := fmt.Sprintf("%s/notes", BaseURL)
 
 	// data
 	reqBody := models.NoteData{
-		EncryptedContent: cipherText,
-		EncryptedKey:     encryptedAESKey,
+		EncryptedContent:  cipherText,
+		EncryptedKey:      encryptedAESKey,
+		EncryptedMetadata: encryptedMetadata,
 	}
 
 	// gói data vào json
@@ -36,13 +37,11 @@ func CreateNote(token, cipherText, encryptedAESKey string) (string, error) {
 		return "", fmt.Errorf("lỗi tạo request: %v", err)
 	}
 
-	// thiết lập định dạng là json và thêm xác thực
+	// thiết lập định dạng là json
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
 
-	// Client giúp tạo kết nối TCP đến Server
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 	if err != nil {
 		return "", fmt.Errorf("lỗi kết nối server: %v", err)
 	}
@@ -70,7 +69,7 @@ func CreateNote(token, cipherText, encryptedAESKey string) (string, error) {
 	return result.Note_id, nil
 }
 
-// xóa một note
+// xóa một note (chuyển vào thùng rác, khôi phục bằng RestoreNote)
 func DeleteNote(token, noteID string) error {
 
 	// tạo URL
@@ -82,12 +81,8 @@ func DeleteNote(token, noteID string) error {
 		return fmt.Errorf("lỗi tạo request: %v", err)
 	}
 
-	// thiết lập Header xác thực
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	// gửi Request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 	if err != nil {
 		return fmt.Errorf("lỗi kết nối server: %v", err)
 	}
@@ -121,88 +116,123 @@ func DeleteNote(token, noteID string) error {
 
 // lấy danh sách tất cả ghi chú của người dùng hiện tại
 func GetOwnedNotes(token string) ([]models.Note, error) {
+	notes, _, err := GetOwnedNotesPage(token, models.ListQuery{})
+	return notes, err
+}
+
+// lấy 1 trang ghi chú của người dùng hiện tại, kèm cursor trang sau (rỗng nếu là trang cuối)
+func GetOwnedNotesPage(token string, query models.ListQuery) ([]models.Note, string, error) {
 
 	// tạo URL
-	apiURL := fmt.Sprintf("%s/notes/owned", BaseURL)
+	apiURL := fmt.Sprintf("%s/notes/owned%s", BaseURL, query.Encode())
 
 	// tạo request
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+		return nil, "", fmt.Errorf("lỗi tạo request: %v", err)
 	}
 
-	// gắn Header xác thực
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	// gửi Request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 	if err != nil {
-		return nil, fmt.Errorf("lỗi kết nối server: %v", err)
+		return nil, "", fmt.Errorf("lỗi kết nối server: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// đọc phản hồi
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("lỗi đọc dữ liệu phản hồi: %v", err)
+		return nil, "", fmt.Errorf("lỗi đọc dữ liệu phản hồi: %v", err)
 	}
 
 	// kiểm tra Status Code
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
+		return nil, "", fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
 	}
 
 	// giải mã JSON
 	var notes []models.Note
 	if err := json.Unmarshal(body, &notes); err != nil {
-		return nil, fmt.Errorf("lỗi giải mã JSON: %v", err)
+		return nil, "", fmt.Errorf("lỗi giải mã JSON: %v", err)
+	}
+
+	return notes, resp.Header.Get("X-Next-Cursor"), nil
+}
+
+// lấy metadata của 1 ghi chú do người dùng hiện tại sở hữu (nội dung tải bằng OpenNoteContent)
+func GetNote(token, noteID string) (models.Note, error) {
+
+	// tạo URL
+	apiURL := fmt.Sprintf("%s/notes/%s", BaseURL, noteID)
+
+	// tạo request
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return models.Note{}, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return models.Note{}, fmt.Errorf("lỗi kết nối server: %v", err)
 	}
+	defer resp.Body.Close()
 
-	return notes, nil
+	if resp.StatusCode != http.StatusOK {
+		return models.Note{}, serverError(resp)
+	}
+
+	// giải mã JSON
+	var note models.Note
+	if err := json.NewDecoder(resp.Body).Decode(&note); err != nil {
+		return models.Note{}, fmt.Errorf("lỗi giải mã JSON: %v", err)
+	}
+	return note, nil
 }
 
 // lấy danh sách cá URLs được chia sẽ
 func GetReceivedURLs(token string) ([]models.Url, error) {
+	urls, _, err := GetReceivedURLsPage(token, models.ListQuery{})
+	return urls, err
+}
+
+// lấy 1 trang URLs được chia sẻ (lọc theo query), kèm cursor trang sau (rỗng nếu là trang cuối)
+func GetReceivedURLsPage(token string, query models.ListQuery) ([]models.Url, string, error) {
 
 	// tạo url
-	apiURL := fmt.Sprintf("%s/notes/received", BaseURL)
+	apiURL := fmt.Sprintf("%s/notes/received%s", BaseURL, query.Encode())
 
 	// tạo Request
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
-		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+		return nil, "", fmt.Errorf("lỗi tạo request: %v", err)
 	}
 
-	// gắn Header xác thực
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	// gửi Request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 	if err != nil {
-		return nil, fmt.Errorf("lỗi kết nối server: %v", err)
+		return nil, "", fmt.Errorf("lỗi kết nối server: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// đọc body phản hồi
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("lỗi đọc phản hồi: %v", err)
+		return nil, "", fmt.Errorf("lỗi đọc phản hồi: %v", err)
 	}
 
 	// kiểm tra mã lỗi
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
+		return nil, "", fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
 	}
 
 	// giải mã JSON
 	var urls []models.Url
 	if err := json.Unmarshal(body, &urls); err != nil {
-		return nil, fmt.Errorf("lỗi giải mã JSON: %v", err)
+		return nil, "", fmt.Errorf("lỗi giải mã JSON: %v", err)
 	}
 
-	return urls, nil
+	return urls, resp.Header.Get("X-Next-Cursor"), nil
 }
 
 // xóa chia sẻ note
@@ -217,12 +247,8 @@ func DeleteSharedNote(token, noteID string) error {
 		return fmt.Errorf("lỗi tạo request: %v", err)
 	}
 
-	// gắn Header xác thực
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	// gửi Request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 	if err != nil {
 		return fmt.Errorf("lỗi kết nối server: %v", err)
 	}
@@ -247,3 +273,76 @@ func DeleteSharedNote(token, noteID string) error {
 	}
 	return nil
 }
+
+// tải nội dung đã mã hóa (binary) lên cho note vừa tạo bằng CreateNote
+// open trả về luồng ciphertext, được gọi lại nếu phải gửi lại request sau khi làm mới token
+func UploadNoteContent(token, noteID string, open func() (io.ReadCloser, error)) error {
+
+	// tạo URL
+	apiURL := fmt.Sprintf("%s/notes/%s/content", BaseURL, noteID)
+
+	body, err := open()
+	if err != nil {
+		return err
+	}
+
+	// tạo request với body dạng luồng (gửi chunked, không giữ toàn bộ file trên RAM)
+	req, err := http.NewRequest("PUT", apiURL, body)
+	if err != nil {
+		body.Close()
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.GetBody = open
+
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return serverError(resp)
+	}
+	return nil
+}
+
+// mở luồng nội dung đã mã hóa (binary) của note do mình sở hữu, người gọi phải Close
+func OpenNoteContent(token, noteID string) (io.ReadCloser, error) {
+	apiURL := fmt.Sprintf("%s/notes/%s/content", BaseURL, noteID)
+	return openContent(apiURL, token)
+}
+
+// GET url trả về application/octet-stream
+func openContent(apiURL, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, serverError(resp)
+	}
+	return resp.Body, nil
+}
+
+// Lỗi từ server (ưu tiên trường "error" trong JSON)
+func serverError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+
+	var errResponse struct {
+		Error string `json:"error"`
+	}
+	if jsonErr := json.Unmarshal(body, &errResponse); jsonErr == nil && errResponse.Error != "" {
+		return fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, errResponse.Error)
+	}
+	return fmt.Errorf("lỗi từ server (%d): %s", resp.StatusCode, string(body))
+}
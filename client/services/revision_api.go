@@ -0,0 +1,102 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"note_sharing_application/client/models"
+)
+
+// --------------------- REVISION GROUP ---------------------
+// URL = BaseURL + /notes/:note_id, BaseURL + /notes/:note_id/revisions
+// Cập nhật nội dung note thành phiên bản mới, xem / tải / khôi phục các phiên bản cũ
+
+// Note đã được cập nhật từ nơi khác kể từ phiên bản client đang sửa
+var ErrRevisionConflict = errors.New("note đã có phiên bản mới hơn")
+
+// Gửi nội dung mới (mã hóa bằng khóa AES cũ của note) thành phiên bản mới
+// baseRevision > 0: chỉ cập nhật nếu phiên bản hiện tại trên server vẫn là baseRevision
+// encryptedMetadata rỗng thì server giữ metadata của phiên bản trước
+// open trả về luồng ciphertext, được gọi lại nếu phải gửi lại request sau khi làm mới token
+func UpdateNote(token, noteID string, baseRevision int, encryptedMetadata string, open func() (io.ReadCloser, error)) (models.Note, error) {
+	apiURL := fmt.Sprintf("%s/notes/%s", BaseURL, noteID)
+	if baseRevision > 0 {
+		apiURL = fmt.Sprintf("%s?base_revision=%d", apiURL, baseRevision)
+	}
+
+	body, err := open()
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	req, err := http.NewRequest("PUT", apiURL, body)
+	if err != nil {
+		body.Close()
+		return models.Note{}, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if encryptedMetadata != "" {
+		req.Header.Set("X-Encrypted-Metadata", encryptedMetadata)
+	}
+	req.GetBody = open
+
+	var note models.Note
+	err = doRevisionRequest(req, token, &note)
+	return note, err
+}
+
+// Danh sách phiên bản của note (cũ trước)
+func ListRevisions(token, noteID string) ([]models.NoteRevision, error) {
+	apiURL := fmt.Sprintf("%s/notes/%s/revisions", BaseURL, noteID)
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	var revisions []models.NoteRevision
+	err = doRevisionRequest(req, token, &revisions)
+	return revisions, err
+}
+
+// Mở luồng nội dung đã mã hóa (binary) của 1 phiên bản, người gọi phải Close
+func OpenRevisionContent(token, noteID string, revision int) (io.ReadCloser, error) {
+	apiURL := fmt.Sprintf("%s/notes/%s/revisions/%d/content", BaseURL, noteID, revision)
+	return openContent(apiURL, token)
+}
+
+// Khôi phục phiên bản cũ thành phiên bản mới nhất, trả về note sau khi khôi phục
+func RestoreRevision(token, noteID string, revision int) (models.Note, error) {
+	apiURL := fmt.Sprintf("%s/notes/%s/revisions/%d/restore", BaseURL, noteID, revision)
+
+	req, err := http.NewRequest("POST", apiURL, nil)
+	if err != nil {
+		return models.Note{}, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	var note models.Note
+	err = doRevisionRequest(req, token, &note)
+	return note, err
+}
+
+// Giống doUploadRequest nhưng 409 được trả về dạng ErrRevisionConflict
+func doRevisionRequest(req *http.Request, token string, out interface{}) error {
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusConflict {
+		return fmt.Errorf("%w: %v", ErrRevisionConflict, serverError(resp))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return serverError(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("lỗi giải mã JSON: %v", err)
+	}
+	return nil
+}
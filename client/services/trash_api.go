@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"note_sharing_application/client/models"
+)
+
+// --------------------- TRASH GROUP ---------------------
+// URL = BaseURL + /notes/trash
+// DeleteNote chỉ chuyển note vào thùng rác, server xóa hẳn sau thời hạn lưu giữ (purge_at)
+
+// Các note trong thùng rác của người dùng hiện tại
+func GetTrash(token string) ([]models.Note, error) {
+	req, err := http.NewRequest("GET", BaseURL+"/notes/trash", nil)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	var notes []models.Note
+	err = doUploadRequest(req, token, http.StatusOK, &notes)
+	return notes, err
+}
+
+// Lấy note ra khỏi thùng rác, các share còn hạn hoạt động lại
+func RestoreNote(token, noteID string) error {
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/notes/trash/%s/restore", BaseURL, noteID), nil)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	return doUploadRequest(req, token, http.StatusOK, nil)
+}
+
+// Xóa vĩnh viễn note đang nằm trong thùng rác
+func PurgeNote(token, noteID string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/notes/trash/%s", BaseURL, noteID), nil)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	return doUploadRequest(req, token, http.StatusOK, nil)
+}
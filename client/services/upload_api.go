@@ -0,0 +1,155 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"note_sharing_application/client/models"
+	"time"
+)
+
+// --------------------- UPLOAD GROUP ---------------------
+// URL = BaseURL + /notes/:note_id/uploads, BaseURL + /uploads/:upload_id
+// Tải nội dung note theo từng chunk, mất kết nối thì chỉ gửi lại các chunk server chưa nhận
+
+// Kích thước chunk client dùng khi mở phiên upload
+const UploadChunkSize = 4 << 20
+
+// Số lần thử gửi 1 chunk và thời gian chờ giữa các lần (tăng dần)
+var (
+	UploadRetries    = 3
+	UploadRetryDelay = time.Second
+)
+
+// Phiên upload (hoặc note) không tồn tại, phiên upload bỏ dở bị server xóa sau 24 giờ
+var ErrUploadNotFound = errors.New("không tìm thấy trên server")
+
+// Mở phiên upload cho note chưa có nội dung
+func CreateUploadSession(token, noteID string, totalSize, chunkSize int64) (models.UploadSession, error) {
+	apiURL := fmt.Sprintf("%s/notes/%s/uploads", BaseURL, noteID)
+
+	jsonBody, err := json.Marshal(map[string]int64{
+		"total_size": totalSize,
+		"chunk_size": chunkSize,
+	})
+	if err != nil {
+		return models.UploadSession{}, fmt.Errorf("lỗi đóng gói JSON: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", apiURL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return models.UploadSession{}, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var session models.UploadSession
+	err = doUploadRequest(req, token, http.StatusCreated, &session)
+	return session, err
+}
+
+// Trạng thái phiên upload (các chunk server đã nhận)
+func GetUploadStatus(token, uploadID string) (models.UploadSession, error) {
+	apiURL := fmt.Sprintf("%s/uploads/%s", BaseURL, uploadID)
+
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return models.UploadSession{}, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	var session models.UploadSession
+	err = doUploadRequest(req, token, http.StatusOK, &session)
+	return session, err
+}
+
+// Gửi 1 chunk (binary)
+func UploadChunk(token, uploadID string, index int, data []byte) error {
+	apiURL := fmt.Sprintf("%s/uploads/%s/chunks/%d", BaseURL, uploadID, index)
+
+	// body là bytes.Reader nên gửi lại được sau khi làm mới token
+	req, err := http.NewRequest("PUT", apiURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	return doUploadRequest(req, token, http.StatusOK, nil)
+}
+
+// Ghép các chunk thành nội dung note, trả về note với kích thước và hash nội dung server đã lưu
+func CommitUpload(token, uploadID string) (models.Note, error) {
+	apiURL := fmt.Sprintf("%s/uploads/%s/commit", BaseURL, uploadID)
+
+	req, err := http.NewRequest("POST", apiURL, nil)
+	if err != nil {
+		return models.Note{}, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	var note models.Note
+	err = doUploadRequest(req, token, http.StatusOK, &note)
+	return note, err
+}
+
+// Đọc ciphertext từ đầu đến cuối và gửi các chunk session chưa nhận, mỗi chunk thử lại tối đa UploadRetries lần
+// ciphertext phải giống hệt lần gửi trước (cùng khóa và nonce prefix), các chunk đã nhận chỉ được đọc bỏ qua
+// progress (có thể nil) được gọi sau mỗi chunk
+func UploadChunks(token string, session models.UploadSession, ciphertext io.Reader, progress func(done, total int)) error {
+	buf := make([]byte, session.ChunkSize)
+
+	for i := 0; i < session.ChunkCount; i++ {
+		chunk := buf[:session.ChunkLength(i)]
+		if _, err := io.ReadFull(ciphertext, chunk); err != nil {
+			return fmt.Errorf("lỗi đọc dữ liệu mã hóa: %v", err)
+		}
+
+		if !session.HasChunk(i) {
+			var err error
+			for attempt := 1; attempt <= UploadRetries; attempt++ {
+				if err = UploadChunk(token, session.ID, i, chunk); err == nil {
+					break
+				}
+				if attempt < UploadRetries {
+					time.Sleep(time.Duration(attempt) * UploadRetryDelay)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("gửi chunk %d thất bại: %v", i, err)
+			}
+		}
+
+		if progress != nil {
+			progress(i+1, session.ChunkCount)
+		}
+	}
+
+	// File dài hơn lúc mở phiên (bị sửa trong lúc gửi)
+	if n, _ := io.Copy(io.Discard, ciphertext); n > 0 {
+		return fmt.Errorf("dữ liệu mã hóa dài hơn kích thước phiên upload")
+	}
+	return nil
+}
+
+// Gửi request kèm xác thực, kiểm tra status và giải mã JSON phản hồi vào out (nếu khác nil)
+func doUploadRequest(req *http.Request, token string, status int, out interface{}) error {
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %v", ErrUploadNotFound, serverError(resp))
+	}
+	if resp.StatusCode != status {
+		return serverError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("lỗi giải mã JSON: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+	Upload journal: ghi lại các lần save chưa xong để chạy lại lệnh save thì gửi tiếp thay vì gửi lại từ đầu
+	Lưu trong uploads_<username>.json cạnh known keys, khóa là đường dẫn tuyệt đối của file
+	Khóa AES không nằm trong journal: lấy lại từ EncryptedAesKey của note (giải mã bằng password)
+*/
+
+type UploadJournalEntry struct {
+	NoteID   string `json:"note_id"`
+	UploadID string `json:"upload_id"`
+	// Nonce prefix (hex) của luồng mã hóa, để mã hóa lại ra đúng ciphertext đã gửi
+	NoncePrefix string    `json:"nonce_prefix"`
+	FileSize    int64     `json:"file_size"`
+	ModTime     time.Time `json:"mod_time"`
+	// SHA-256 (hex) nội dung file lúc bắt đầu upload
+	ContentHash string    `json:"content_hash"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// SHA-256 (hex) nội dung file path
+func HashUploadFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// File không đổi kể từ lúc bắt đầu upload
+// Kích thước và mtime có thể giữ nguyên dù nội dung đã đổi (sửa rồi đặt lại mtime, mtime thô...),
+// mã hóa nội dung khác với cùng khóa và nonce prefix là dùng lại nonce -> phải so cả hash nội dung
+func (e UploadJournalEntry) Matches(path string, info os.FileInfo) bool {
+	if e.FileSize != info.Size() || !e.ModTime.Equal(info.ModTime()) || e.ContentHash == "" {
+		return false
+	}
+	hash, err := HashUploadFile(path)
+	return err == nil && hash == e.ContentHash
+}
+
+func uploadJournalFile(owner string) string {
+	return filepath.Join(KnownKeysDir, fmt.Sprintf("uploads_%s.json", owner))
+}
+
+// Đọc journal của owner (chưa có file thì trả về rỗng)
+func LoadUploadJournal(owner string) (map[string]UploadJournalEntry, error) {
+	entries := make(map[string]UploadJournalEntry)
+
+	data, err := os.ReadFile(uploadJournalFile(owner))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("file upload journal bị lỗi: %v", err)
+	}
+	return entries, nil
+}
+
+// Ghi (entry != nil) hoặc xóa (entry == nil) mục của file filePath
+func SetUploadJournalEntry(owner, filePath string, entry *UploadJournalEntry) error {
+	entries, err := LoadUploadJournal(owner)
+	if err != nil {
+		return err
+	}
+	if entry != nil {
+		entries[filePath] = *entry
+	} else {
+		delete(entries, filePath)
+	}
+
+	// Hết mục thì xóa luôn file
+	if len(entries) == 0 {
+		err := os.Remove(uploadJournalFile(owner))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(uploadJournalFile(owner), data, 0600)
+}
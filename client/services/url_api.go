@@ -10,7 +10,9 @@ import (
 )
 
 // ---------------------URL------------------------------------------------------
-func CreateNoteUrl(noteId, token, sharedEncryptedAESKey, expiresIn, receiver string, maxAccess int, sender string) error {
+// expiresAt: thời điểm hết hạn (Unix giây) đã được ký cùng share, signature rỗng nếu chưa có khóa ký
+// revision: phiên bản được chia sẻ (0: phiên bản hiện tại), followLatest: share luôn theo phiên bản mới nhất
+func CreateNoteUrl(noteId, token, sharedEncryptedAESKey, keyScheme, expiresIn string, expiresAt int64, signature, receiver string, maxAccess int, sender string, revision int, followLatest bool) error {
 
 	// Chuẩn bị dữ liệu (Marshal JSON)
 	reqBody := models.Metadata{
@@ -19,6 +21,11 @@ func CreateNoteUrl(noteId, token, sharedEncryptedAESKey, expiresIn, receiver str
 		MaxAccess:             maxAccess,
 		Receiver:              receiver,
 		Sender:                sender,
+		KeyScheme:             keyScheme,
+		ExpiresAt:             expiresAt,
+		Signature:             signature,
+		Revision:              revision,
+		FollowLatest:          followLatest,
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -33,10 +40,9 @@ func CreateNoteUrl(noteId, token, sharedEncryptedAESKey, expiresIn, receiver str
 		return fmt.Errorf("lỗi tạo request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 
 	if err != nil {
 		return fmt.Errorf("lỗi kết nối server: %v", err)
@@ -61,14 +67,33 @@ func CreateNoteUrl(noteId, token, sharedEncryptedAESKey, expiresIn, receiver str
 	return nil
 }
 
+// Tạo share cho nhiều người nhận trong 1 request, trả về kết quả của từng người (cùng thứ tự với req.Shares)
+func CreateNoteShares(token, noteID string, req models.CreateSharesRequest) ([]models.ShareResult, error) {
+	jsonBody, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi đóng gói JSON: %v", err)
+	}
+
+	httpReq, err := http.NewRequest("POST", fmt.Sprintf("%s/notes/%s/shares", BaseURL, noteID), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	var res struct {
+		Results []models.ShareResult `json:"results"`
+	}
+	err = doUploadRequest(httpReq, token, http.StatusOK, &res)
+	return res.Results, err
+}
+
 func GetNoteUrl(noteId, token string) (string, error) {
 	url := fmt.Sprintf("%s/notes/%s/url", BaseURL, noteId)
 
 	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 	if err != nil {
 		return "", err
 	}
@@ -100,10 +125,9 @@ func ReadNoteWithURL(urlId, token string) (models.NoteData, error) {
 	url := fmt.Sprintf("%s/note/%s", BaseURL, urlId)
 
 	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+token)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
 
 	if err != nil {
 		return result, fmt.Errorf("lỗi kết nối server: %v", err)
@@ -125,3 +149,55 @@ func ReadNoteWithURL(urlId, token string) (models.NoteData, error) {
 
 	return result, nil
 }
+
+// lấy metadata của share (khóa đã bọc, chữ ký, hash ciphertext), không tính lượt xem
+func GetSharedNoteMeta(urlId, token string) (models.NoteData, error) {
+	var result models.NoteData
+
+	url := fmt.Sprintf("%s/note/%s/meta", BaseURL, urlId)
+
+	req, _ := http.NewRequest("GET", url, nil)
+
+	// gửi Request kèm xác thực (tự làm mới token nếu hết hạn)
+	resp, err := doWithAuth(req, token)
+	if err != nil {
+		return result, fmt.Errorf("lỗi kết nối server: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return result, serverError(resp)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return result, fmt.Errorf("lỗi cấu trúc JSON: %v", err)
+	}
+	return result, nil
+}
+
+// mở luồng nội dung đã mã hóa (binary) của share, tính 1 lượt xem; người gọi phải Close
+func OpenSharedNoteContent(urlId, token string) (io.ReadCloser, error) {
+	url := fmt.Sprintf("%s/note/%s/content", BaseURL, urlId)
+	return openContent(url, token)
+}
+
+// Những người đã được chia sẻ note, kèm hạn dùng và số lượt xem đã dùng
+func ListNoteShares(token, noteID string) ([]models.SentShare, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/notes/%s/shares", BaseURL, noteID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("lỗi tạo request: %v", err)
+	}
+
+	var shares []models.SentShare
+	err = doUploadRequest(req, token, http.StatusOK, &shares)
+	return shares, err
+}
+
+// Thu hồi share của 1 người nhận (urlID lấy từ ListNoteShares)
+func RevokeShare(token, urlID string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/shares/%s", BaseURL, urlID), nil)
+	if err != nil {
+		return fmt.Errorf("lỗi tạo request: %v", err)
+	}
+	return doUploadRequest(req, token, http.StatusOK, nil)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"log"
 	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
 	"os"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -50,6 +52,28 @@ func ConnectDB(dbName string) {
 	} else {
 		log.Println("Đã kích hoạt tính năng tự xóa (TTL Index) cho urls")
 	}
+
+	// Refresh token hết hạn cũng được Mongo tự xóa
+	err = models.CreateTTLIndex(context.Background(), DB.Collection("refresh_tokens"))
+	if err != nil {
+		log.Printf("Cảnh báo: Không thể tạo TTL Index cho refresh_tokens: %v", err)
+	}
+	err = models.CreateTTLIndex(context.Background(), DB.Collection("revoked_tokens"))
+	if err != nil {
+		log.Printf("Cảnh báo: Không thể tạo TTL Index cho revoked_tokens: %v", err)
+	}
+	// Phiên upload bỏ dở KHÔNG dùng TTL index: TTL chỉ xóa document, blob của các chunk sẽ mồ côi
+	// services.StartUploadSweeper xóa blob rồi mới xóa phiên
+
+	// Mỗi note chỉ chia sẻ 1 lần cho 1 nhóm, unique index chặn 2 request đồng thời cùng tạo share
+	// (share trùng không được bọc lại khi xoay khóa nhóm)
+	_, err = DB.Collection("group_shares").Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "group_id", Value: 1}, {Key: "note_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Cảnh báo: Không thể tạo unique Index cho group_shares: %v", err)
+	}
 }
 
 func GetCollection(name string) *mongo.Collection {
@@ -58,3 +82,61 @@ func GetCollection(name string) *mongo.Collection {
 	}
 	return DB.Collection(name)
 }
+
+/*
+Chọn backend lưu trữ theo biến môi trường STORAGE_DRIVER:
+  - mongo  (mặc định): kết nối MongoDB theo MONGO_URI và DB_NAME
+  - memory: lưu trên RAM, mất dữ liệu khi tắt server
+  - file:   lưu trên RAM và đồng bộ xuống file STORAGE_FILE (mặc định notes_data.json)
+
+Nội dung note (blob) mặc định đi theo backend: GridFS với mongo, RAM với memory, thư mục <STORAGE_FILE>_blobs với file
+BLOB_DRIVER=local lưu blob trong thư mục BLOB_DIR (mặc định note_blobs), BLOB_DRIVER=gridfs lưu trong GridFS
+*/
+func InitStorage() {
+	var s stores.Stores
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "mongo":
+		ConnectDB(os.Getenv("DB_NAME"))
+		s = stores.NewMongo(DB)
+	case "memory":
+		s = stores.NewMemory()
+		log.Println("Đang dùng bộ lưu trữ trên RAM (memory)")
+	case "file":
+		path := os.Getenv("STORAGE_FILE")
+		if path == "" {
+			path = "notes_data.json"
+		}
+		var err error
+		s, err = stores.NewFile(path)
+		if err != nil {
+			log.Fatal("Không thể mở file lưu trữ:", err)
+		}
+		log.Printf("Đang dùng bộ lưu trữ file: %s", path)
+	default:
+		log.Fatalf("STORAGE_DRIVER không hợp lệ: %s (mongo | memory | file)", driver)
+	}
+
+	switch driver := os.Getenv("BLOB_DRIVER"); driver {
+	case "":
+	case "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "note_blobs"
+		}
+		blobs, err := stores.NewLocalBlobStore(dir)
+		if err != nil {
+			log.Fatal("Không thể mở thư mục blob:", err)
+		}
+		s.Blobs = blobs
+		log.Printf("Nội dung note lưu trong thư mục: %s", dir)
+	case "gridfs":
+		if DB == nil {
+			log.Fatal("BLOB_DRIVER=gridfs cần STORAGE_DRIVER=mongo")
+		}
+		s.Blobs = stores.NewGridFSBlobStore(DB)
+	default:
+		log.Fatalf("BLOB_DRIVER không hợp lệ: %s (local | gridfs)", driver)
+	}
+
+	stores.Use(s)
+}
@@ -3,21 +3,19 @@ package handlers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"note_sharing_application/server/models"
 	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
 	"note_sharing_application/server/utils"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var UserCollection *mongo.Collection
-
 // API register new account
 func RegisterHandler(c *gin.Context) {
 	fmt.Println("RegisterHandler() is running...")
@@ -31,15 +29,33 @@ func RegisterHandler(c *gin.Context) {
 	}
 
 	// Decrypted Password (RSA/OAEP) from client
-	encryptedPassBytes, err := base64.StdEncoding.DecodeString(req.Password)
+	rawPassword, err := decryptPassword(req.KeyID, req.Password)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "EncyptedPassword is not Base64"})
+		respondPasswordError(c, err, "encryptedPassword")
 		return
 	}
 
-	rawPassword, err := utils.DecryptOAEP(encryptedPassBytes)
-	if err != nil {
-		c.JSON(400, gin.H{"error": "Error decypted encryptedPassword"})
+	// Client cũ không gửi loại khóa -> DH
+	keyType := req.PublicKeyType
+	if keyType == "" {
+		keyType = models.KeyTypeDH
+	}
+	if keyType != models.KeyTypeDH && keyType != models.KeyTypeX25519 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported public_key_type"})
+		return
+	}
+	// Khóa trao đổi phải dùng được: khóa rác đã lưu thì mọi người gửi tới user này đều lỗi
+	validPublicKey := utils.ValidDHPublicKey
+	if keyType == models.KeyTypeX25519 {
+		validPublicKey = utils.ValidX25519PublicKey
+	}
+	if !validPublicKey(req.PublicKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid public_key"})
+		return
+	}
+	// Khóa ký không bắt buộc (client cũ), nhưng có gửi thì phải hợp lệ
+	if req.SigningPublicKey != "" && (!utils.ValidEd25519PublicKey(req.SigningPublicKey) || req.EncryptedSigningPrivKey == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signing_public_key"})
 		return
 	}
 
@@ -47,12 +63,12 @@ func RegisterHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	count, err := UserCollection.CountDocuments(ctx, bson.M{"username": req.Username})
+	exists, err := stores.Users.Exists(ctx, req.Username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-	if count > 0 {
+	if exists {
 		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
 		return
 	}
@@ -72,10 +88,21 @@ func RegisterHandler(c *gin.Context) {
 		Salt:              salt,
 		EncryptedPrivKey:  req.EncryptedPrivKey,
 		PubKey:            req.PublicKey,
+		PubKeyType:        keyType,
+	}
+	if req.SigningPublicKey != "" {
+		newUser.SigningPubKey = req.SigningPublicKey
+		newUser.EncryptedSigningPrivKey = req.EncryptedSigningPrivKey
 	}
 
-	// Insert to DB
-	_, err = UserCollection.InsertOne(ctx, newUser)
+	// Insert to DB, khóa công khai được ghi vào key transparency log trong cùng transaction
+	err = stores.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := stores.Users.Create(ctx, newUser); err != nil {
+			return err
+		}
+		_, err := services.AppendKeyLog(ctx, newUser)
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database insert failed", "details": err.Error()})
 		return
@@ -100,15 +127,9 @@ func LoginHandler(c *gin.Context) {
 	}
 
 	// Decrypted password (RSA/OAEP) from client
-	encryptedPassBytes, err := base64.StdEncoding.DecodeString(req.Password)
-	if err != nil {
-		c.JSON(400, gin.H{"error": "EncyptedPassword is not Base64"})
-		return
-	}
-
-	rawPassword, err := utils.DecryptOAEP(encryptedPassBytes)
+	rawPassword, err := decryptPassword(req.KeyID, req.Password)
 	if err != nil {
-		c.JSON(400, gin.H{"error": "Error decypted encryptedPassword"})
+		respondPasswordError(c, err, "encryptedPassword")
 		return
 	}
 
@@ -116,10 +137,9 @@ func LoginHandler(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var foundUser models.User
-	err = UserCollection.FindOne(ctx, bson.M{"username": req.Username}).Decode(&foundUser)
+	foundUser, err := stores.Users.FindByUsername(ctx, req.Username)
 
-	if err == mongo.ErrNoDocuments {
+	if errors.Is(err, stores.ErrNotFound) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Incorrect username or password"})
 		return
 	}
@@ -138,21 +158,241 @@ func LoginHandler(c *gin.Context) {
 
 	// Generate JWT token
 	// ObjectID -> Hex string
-	tokenString, err := services.GenerateAuthJWT(foundUser.ID.Hex(), foundUser.Username)
+	tokenString, err := services.GenerateAuthJWT(foundUser.ID.Hex(), foundUser.Username, foundUser.TokenVersion)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to generate JWT Token"})
 		return
 	}
 
+	// Generate refresh token (dùng để xin access token mới khi hết hạn)
+	refreshToken, err := services.GenerateRefreshToken(foundUser.ID.Hex(), foundUser.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to generate refresh token"})
+		return
+	}
+
 	// 6. Return response
 	c.JSON(http.StatusOK, gin.H{
 		"message":           "Succesfully Login",
 		"token":             tokenString,
+		"refresh_token":     refreshToken,
 		"encrypted_privKey": foundUser.EncryptedPrivKey,
+		// Loại khóa để client biết có cần nâng cấp lên X25519 hay không
+		"pubKey_type":              foundUser.KeyType(),
+		"encrypted_legacy_privKey": foundUser.EncryptedLegacyPrivKey,
+		// Rỗng nghĩa là chưa có khóa ký, client tự sinh và gửi lên /auth/signing-key
+		"encrypted_signing_privKey": foundUser.EncryptedSigningPrivKey,
+	})
+}
+
+// API refresh access token
+// Refresh token cũ bị vô hiệu, client phải lưu lại refresh token mới
+func RefreshHandler(c *gin.Context) {
+	var req models.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	tokenString, refreshToken, err := services.RotateRefreshToken(req.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenInvalid) || errors.Is(err, services.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         tokenString,
+		"refresh_token": refreshToken,
+	})
+}
+
+// API logout (POST /auth/logout)
+// Thu hồi access token đang dùng và refresh token gửi kèm trong body (nếu có)
+func LogoutHandler(c *gin.Context) {
+	var req models.LogoutRequest
+	// Body không bắt buộc
+	_ = c.ShouldBindJSON(&req)
+
+	err := services.Logout(c.GetString("userId"), c.GetString("jti"), c.GetTime("tokenExpiresAt"), req.RefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to logout"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully Logout"})
+}
+
+// API logout khỏi mọi thiết bị (POST /auth/logout-all)
+// Dùng khi mất máy đang giữ file session
+func LogoutAllHandler(c *gin.Context) {
+	err := services.LogoutAll(c.GetString("userId"), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to logout all sessions"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully Logout All Sessions"})
+}
+
+var errPasswordNotBase64 = errors.New("password is not Base64")
+
+// Giải mã mật khẩu (base64 + RSA/OAEP) client gửi lên bằng khóa RSA có ID keyID
+func decryptPassword(keyID, encrypted string) (string, error) {
+	encryptedPassBytes, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", errPasswordNotBase64
+	}
+	return utils.DecryptOAEP(keyID, encryptedPassBytes)
+}
+
+// Trả lỗi 400 tương ứng với lỗi giải mã password của trường field
+func respondPasswordError(c *gin.Context, err error, field string) {
+	switch {
+	case errors.Is(err, errPasswordNotBase64):
+		c.JSON(http.StatusBadRequest, gin.H{"error": field + " is not Base64"})
+	case errors.Is(err, utils.ErrUnknownKeyID):
+		// Khóa RSA client đang giữ đã bị xoay vòng và hết thời gian ân hạn
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown or retired key_id, fetch the server public key again"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Error decypted " + field})
+	}
+}
+
+// API đổi mật khẩu (POST /auth/change-password)
+// Mọi phiên cũ bị thu hồi, server trả về cặp token mới cho phiên hiện tại
+func ChangePasswordHandler(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.EncryptedPrivKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	oldPassword, err := decryptPassword(req.KeyID, req.OldPassword)
+	if err != nil {
+		respondPasswordError(c, err, "old_password")
+		return
+	}
+	newPassword, err := decryptPassword(req.KeyID, req.NewPassword)
+	if err != nil {
+		respondPasswordError(c, err, "new_password")
+		return
+	}
+	if newPassword == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new_password is empty"})
+		return
+	}
+
+	userID := c.GetString("userId")
+	username := c.GetString("username")
+
+	err = services.ChangePassword(userID, username, oldPassword, newPassword, req.EncryptedPrivKey, req.EncryptedLegacyPrivKey, req.EncryptedSigningPrivKey, req.NoteKeys)
+	if errors.Is(err, services.ErrWrongPassword) {
+		// 403 thay vì 401: phiên vẫn hợp lệ, client không cần làm mới token
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrLegacyKeyMissing) || errors.Is(err, services.ErrSigningKeyMissing) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, services.ErrNoteKeysMismatch) {
+		// Thường do vừa có note được tạo/xóa, client lấy lại danh sách note rồi thử lại
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to change password"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user, err := stores.Users.FindByUsername(ctx, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database select failed"})
+		return
+	}
+
+	tokenString, err := services.GenerateAuthJWT(userID, username, user.TokenVersion)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to generate JWT Token"})
+		return
+	}
+	refreshToken, err := services.GenerateRefreshToken(userID, username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to generate refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Successfully Changed Password",
+		"token":         tokenString,
+		"refresh_token": refreshToken,
 	})
 }
 
+// API nâng cấp khóa trao đổi từ DH lên X25519 (POST /auth/upgrade-key)
+// Cần mật khẩu vì khóa mới sẽ được dùng để nhận mọi share sau này
+func UpgradeKeyHandler(c *gin.Context) {
+	var req models.UpgradeKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	password, err := decryptPassword(req.KeyID, req.Password)
+	if err != nil {
+		respondPasswordError(c, err, "password")
+		return
+	}
+
+	err = services.UpgradeKey(c.GetString("username"), password, req.PublicKey, req.PublicKeyType, req.EncryptedPrivKey)
+	switch {
+	case errors.Is(err, services.ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnsupportedKeyType), errors.Is(err, services.ErrInvalidPublicKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrKeyAlreadyUpgraded):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to upgrade key"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully Upgraded Key"})
+	}
+}
+
+// Thêm khóa ký Ed25519 cho tài khoản chưa có (POST /auth/signing-key)
+func SigningKeyHandler(c *gin.Context) {
+	var req models.SigningKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	password, err := decryptPassword(req.KeyID, req.Password)
+	if err != nil {
+		respondPasswordError(c, err, "password")
+		return
+	}
+
+	err = services.SetSigningKey(c.GetString("username"), password, req.SigningPublicKey, req.EncryptedSigningPrivKey)
+	switch {
+	case errors.Is(err, services.ErrWrongPassword):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidSigningKey):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSigningKeyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Fail to set signing key"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully Set Signing Key"})
+	}
+}
+
 // API get server public key RSA
 func GetServerPublicKeyRSA(c *gin.Context) {
 	pemString, err := utils.ExportPublicKeyAsPEM()
@@ -160,5 +400,6 @@ func GetServerPublicKeyRSA(c *gin.Context) {
 		c.JSON(500, gin.H{"error": "Error export Server public key RSA"})
 		return
 	}
-	c.JSON(200, gin.H{"server-public-key-rsa": pemString})
+	// key_id: client gửi lại kèm password đã mã hóa để server chọn đúng khóa khi đang xoay vòng
+	c.JSON(200, gin.H{"server-public-key-rsa": pemString, "key_id": utils.ServerKeyID()})
 }
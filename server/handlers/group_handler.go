@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /groups
+func CreateGroup(c *gin.Context) {
+	req := c.MustGet("validatedRequest").(models.CreateGroupRequest)
+
+	groupID, err := services.CreateGroup(req.Name, c.GetString("username"), req.WrappedKey, req.KeyScheme)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo nhóm: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"group_id": groupID})
+}
+
+// GET /groups (các nhóm người dùng hiện tại là thành viên)
+func ListGroups(c *gin.Context) {
+	username := c.GetString("username")
+
+	groups, err := services.ListGroups(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := make([]models.GroupResponse, 0, len(groups))
+	for _, g := range groups {
+		res = append(res, groupResponse(g, username))
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// GET /groups/:group_id
+func GetGroup(c *gin.Context) {
+	group := c.MustGet("group").(models.Group)
+	c.JSON(http.StatusOK, groupResponse(group, c.GetString("username")))
+}
+
+// Nhóm như username thấy: danh sách thành viên và khóa nhóm bọc cho riêng username
+func groupResponse(group models.Group, username string) models.GroupResponse {
+	res := models.GroupResponse{
+		ID:         group.ID.Hex(),
+		Name:       group.Name,
+		KeyVersion: group.KeyVersion,
+		Members:    make([]models.GroupMemberInfo, 0, len(group.Members)),
+	}
+	for _, m := range group.Members {
+		res.Members = append(res.Members, models.GroupMemberInfo{Username: m.Username, Role: m.Role})
+		if m.Username == username {
+			res.Key = m
+		}
+	}
+	return res
+}
+
+// POST /groups/:group_id/members
+func AddGroupMember(c *gin.Context) {
+	group := c.MustGet("group").(models.Group)
+	req := c.MustGet("validatedRequest").(models.AddGroupMemberRequest)
+
+	member := models.GroupMember{
+		Username:   req.Username,
+		Role:       req.Role,
+		WrappedKey: req.WrappedKey,
+		WrappedBy:  c.GetString("username"),
+		KeyScheme:  req.KeyScheme,
+	}
+	err := services.AddGroupMember(group.ID.Hex(), req.KeyVersion, member)
+	if errors.Is(err, services.ErrGroupKeyChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thêm thành viên: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã thêm " + req.Username + " vào nhóm"})
+}
+
+// PUT /groups/:group_id/members/:username
+func SetGroupMemberRole(c *gin.Context) {
+	group := c.MustGet("group").(models.Group)
+	username := c.Param("username")
+
+	err := services.SetGroupMemberRole(group.ID.Hex(), username, c.GetString("role"))
+	if errors.Is(err, stores.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User không phải thành viên của nhóm"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể đổi vai trò: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã đổi vai trò của " + username})
+}
+
+// DELETE /groups/:group_id/members/:username
+// Xóa thành viên và xoay khóa nhóm trong cùng 1 transaction
+func RemoveGroupMember(c *gin.Context) {
+	group := c.MustGet("group").(models.Group)
+	req := c.MustGet("validatedRequest").(models.RemoveGroupMemberRequest)
+	username := c.Param("username")
+
+	err := services.RemoveGroupMember(group.ID.Hex(), username, c.GetString("username"), req.KeyVersion, req.Members, req.Shares)
+	if errors.Is(err, services.ErrGroupKeyChanged) || errors.Is(err, services.ErrGroupMembersChanged) || errors.Is(err, services.ErrGroupSharesChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa thành viên: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa " + username + " khỏi nhóm", "key_version": req.KeyVersion + 1})
+}
+
+// GET /groups/:group_id/notes
+func ListGroupNotes(c *gin.Context) {
+	group := c.MustGet("group").(models.Group)
+
+	notes, err := services.ListGroupNotes(group.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// POST /groups/:group_id/notes/:note_id
+func ShareNoteToGroup(c *gin.Context) {
+	group := c.MustGet("group").(models.Group)
+	note := c.MustGet("note").(models.Note)
+	req := c.MustGet("validatedRequest").(models.ShareToGroupRequest)
+
+	shareID, err := services.ShareNoteToGroup(group, note.ID.Hex(), c.GetString("username"), req.EncryptedAESKey, req.KeyVersion)
+	if errors.Is(err, services.ErrGroupKeyChanged) || errors.Is(err, services.ErrGroupNoteShared) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể chia sẻ cho nhóm: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"share_id": shareID})
+}
+
+// GET /groups/:group_id/notes/:note_id/content
+// Nội dung đã mã hóa (phiên bản mới nhất) của note chia sẻ cho nhóm
+func DownloadGroupNoteContent(c *gin.Context) {
+	share := c.MustGet("groupShare").(models.GroupShare)
+
+	note, err := services.GetGroupNote(share)
+	if errors.Is(err, services.ErrNoteInTrash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note gốc đã bị xóa khỏi hệ thống"})
+		return
+	}
+
+	writeNoteContent(c, note)
+}
+
+// DELETE /groups/:group_id/notes/:note_id
+func UnshareNoteFromGroup(c *gin.Context) {
+	share := c.MustGet("groupShare").(models.GroupShare)
+
+	if err := services.UnshareNoteFromGroup(share.ID.Hex()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể gỡ note khỏi nhóm: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã gỡ note khỏi nhóm"})
+}
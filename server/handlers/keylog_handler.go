@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+	"note_sharing_application/server/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Đọc tham số query kiểu int64, trả về false nếu thiếu hoặc sai định dạng
+func queryInt64(c *gin.Context, name string) (int64, bool) {
+	v, err := strconv.ParseInt(c.Query(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameter: " + name})
+		return 0, false
+	}
+	return v, true
+}
+
+func respondLogError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidTreeSize) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tree size or index"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Key log error", "details": err.Error()})
+}
+
+// API trả về public key Ed25519 dùng để ký tree head
+// GET /log/public-key
+func GetLogPublicKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"public_key": utils.LogPublicKeyHex()})
+}
+
+// API trả về Signed Tree Head mới nhất
+// GET /log/sth
+func GetSignedTreeHead(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sth, err := services.GetSignedTreeHead(ctx)
+	if err != nil {
+		respondLogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sth)
+}
+
+// API trả về 1 entry của log
+// GET /log/entries/:index
+func GetLogEntry(c *gin.Context) {
+	index, err := strconv.ParseInt(c.Param("index"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid index"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entry, err := stores.KeyLog.Get(ctx, index)
+	if errors.Is(err, stores.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Entry not found"})
+		return
+	}
+	if err != nil {
+		respondLogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, entry)
+}
+
+// API trả về inclusion proof của entry index trong cây tree_size lá
+// GET /log/proof/inclusion?index=&tree_size=
+func GetInclusionProof(c *gin.Context) {
+	index, ok := queryInt64(c, "index")
+	if !ok {
+		return
+	}
+	treeSize, ok := queryInt64(c, "tree_size")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	proof, err := services.GetInclusionProof(ctx, index, treeSize)
+	if err != nil {
+		respondLogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"index": index, "tree_size": treeSize, "proof": proof})
+}
+
+// API trả về consistency proof giữa cây first lá và cây second lá
+// GET /log/proof/consistency?first=&second=
+func GetConsistencyProof(c *gin.Context) {
+	first, ok := queryInt64(c, "first")
+	if !ok {
+		return
+	}
+	second, ok := queryInt64(c, "second")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	proof, err := services.GetConsistencyProof(ctx, first, second)
+	if err != nil {
+		respondLogError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"first": first, "second": second, "proof": proof})
+}
@@ -1,9 +1,11 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"note_sharing_application/server/models"
 	"note_sharing_application/server/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -23,8 +25,12 @@ func CreateNote(c *gin.Context) {
 	// Gọi Service
 	// Lưu ý: Lúc này req.OwnerID chắc chắn là ID của người đang đăng nhập
 	ownerID := c.GetString("userId")
-	noteID, err := services.CreateNote(req.CipherText, req.EncryptedAesKey, ownerID)
+	noteID, err := services.CreateNote(req.CipherText, req.EncryptedAesKey, req.EncryptedMetadata, ownerID)
 
+	if errors.Is(err, services.ErrInvalidCipherText) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cipher_text không phải Base64 hợp lệ"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo ghi chú: " + err.Error()})
 		return
@@ -36,49 +42,119 @@ func CreateNote(c *gin.Context) {
 	})
 }
 
+// PUT /notes/:note_id/content
+// Tải nội dung đã mã hóa (binary) lên cho note vừa tạo bằng POST /notes, mỗi note chỉ tải 1 lần
+func UploadNoteContent(c *gin.Context) {
+	noteID := c.Param("note_id")
+	ownerID := c.GetString("userId")
+
+	err := services.SetNoteContent(noteID, ownerID, c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Nội dung vượt quá kích thước cho phép"})
+		case errors.Is(err, services.ErrNoteContentEmpty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nội dung rỗng"})
+		case errors.Is(err, services.ErrNoteContentExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Note đã có nội dung"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu nội dung: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tải nội dung lên thành công"})
+}
+
+// GET /notes/:note_id
+// Chủ note lấy metadata và khóa AES đã bọc bằng password, nội dung tải qua GET /notes/:note_id/content
+func GetNote(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+	note.CipherDigest = services.NoteDigest(note)
+	if note.HasContent() {
+		note.Revision = note.CurrentRevisionNumber()
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// GET /notes/:note_id/content
+// Chủ note tải nội dung đã mã hóa dạng binary
+func DownloadNoteContent(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+	writeNoteContent(c, note)
+}
+
+// Trả nội dung note dạng application/octet-stream
+func writeNoteContent(c *gin.Context, note models.Note) {
+	content, size, err := services.OpenNoteContent(note)
+	if errors.Is(err, services.ErrNoteContentEmpty) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note chưa có nội dung"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không đọc được nội dung note: " + err.Error()})
+		return
+	}
+	defer content.Close()
+
+	c.DataFromReader(http.StatusOK, size, "application/octet-stream", content, map[string]string{
+		"X-Cipher-Digest": services.NoteDigest(note),
+	})
+}
+
 // lấy tất cả các notes do user hiện tại tạo
 func GetOwnedNotes(c *gin.Context) {
 	// userID cho khớp với auth_middleware.go
 	ownerID := c.GetString("userId")
+	page := c.MustGet("page").(models.PageQuery)
 
 	// gọi service và gửi kết quả cho client
-	notes, err := services.ViewOwnedNotes(ownerID)
+	notes, next, err := services.ViewOwnedNotes(ownerID, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if notes == nil {
-		c.JSON(http.StatusOK, []interface{}{})
-	} else {
-		c.JSON(http.StatusOK, notes)
-	}
+	setNextCursor(c, next)
+	c.JSON(http.StatusOK, notes)
 }
 
-// lấy tất cả các URLs được gửi đến user hiện tại
+// lấy các URLs được gửi đến user hiện tại (lọc và phân trang theo query)
 func GetReceivedNoteURLs(c *gin.Context) {
 	receiver := c.GetString("username")
+	filter := c.MustGet("shareFilter").(models.ShareFilter)
+	page := c.MustGet("page").(models.PageQuery)
 
-	urls, err := services.ViewReceivedNoteURLs(receiver)
+	shares, next, err := services.ViewReceivedNoteURLs(receiver, filter, page)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if urls == nil {
-		c.JSON(http.StatusOK, []interface{}{})
-	} else {
-		res := []models.UrlResponse{}
-
-		for _, url := range urls {
-			var item models.UrlResponse
-			item.ID = "localhost:8080/note/" + url.ID.Hex()
-			item.NoteID = url.NoteID
-			item.SenderID = url.Sender
-			item.ReceiverID = url.Receiver
-			item.ExpiresAt = url.ExpiresAt
-			item.MaxAccess = url.MaxAccess
-			res = append(res, item)
-		}
-		c.JSON(http.StatusOK, res)
+
+	res := []models.UrlResponse{}
+	for _, share := range shares {
+		url := share.Url
+		var item models.UrlResponse
+		item.ID = "localhost:8080/note/" + url.ID.Hex()
+		item.NoteID = url.NoteID
+		item.SenderID = url.Sender
+		item.ReceiverID = url.Receiver
+		item.ExpiresAt = url.ExpiresAt
+		item.MaxAccess = url.MaxAccess
+		item.SharedEncryptedAESKey = url.SharedEncryptedAESKey
+		item.KeyScheme = url.KeyScheme
+		item.EncryptedMetadata = share.EncryptedMetadata
+		res = append(res, item)
+	}
+	setNextCursor(c, next)
+	c.JSON(http.StatusOK, res)
+}
+
+// Cursor của trang sau trả qua header X-Next-Cursor (không có header: trang cuối)
+// để body vẫn là mảng như với client cũ
+func setNextCursor(c *gin.Context, next string) {
+	if next != "" {
+		c.Header("X-Next-Cursor", next)
 	}
 }
 
@@ -86,9 +162,8 @@ func DeleteNote(c *gin.Context) {
 	// 1. Lấy thông tin (Đã được kiểm chứng an toàn 100% bởi Middleware)
 	noteId := c.Param("note_id")
 
-	// 2. Gọi Service để thực hiện xóa
-	// Lúc này Service không cần kiểm tra quyền sở hữu nữa, chỉ cần thực hiện lệnh Delete
-	err := services.DeleteNote(noteId)
+	// 2. Gọi Service chuyển note vào thùng rác (khôi phục được trong thời hạn TrashRetention)
+	err := services.DeleteNote(noteId, c.GetString("userId"))
 
 	if err != nil {
 		// Vì Middleware đã check tồn tại, lỗi ở đây thường là lỗi hệ thống (DB down, transaction fail...)
@@ -97,7 +172,10 @@ func DeleteNote(c *gin.Context) {
 	}
 
 	// 3. Phản hồi thành công
-	c.JSON(http.StatusOK, gin.H{"message": "Xóa Note và các dữ liệu liên quan thành công"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Đã chuyển Note vào thùng rác, các chia sẻ tạm ngưng",
+		"purge_at": time.Now().Add(services.TrashRetention),
+	})
 }
 
 func DeleteSharedNote(c *gin.Context) {
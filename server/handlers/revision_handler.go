@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PUT /notes/:note_id
+// Lưu nội dung mới (binary, mã hóa bằng khóa AES cũ của note) thành phiên bản mới, các phiên bản cũ được giữ lại
+func UpdateNote(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+
+	updated, err := services.UpdateNoteContent(note, c.Request.Body, c.GetString("encryptedMetadata"), c.GetInt("baseRevision"))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Nội dung vượt quá kích thước cho phép"})
+		case errors.Is(err, services.ErrNoteContentEmpty):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nội dung rỗng"})
+		case errors.Is(err, services.ErrRevisionConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "Note đã được cập nhật từ nơi khác, hãy tải phiên bản mới nhất"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể cập nhật note: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// GET /notes/:note_id/revisions
+// Danh sách phiên bản của note (cũ trước), nội dung từng phiên bản tải qua /revisions/:revision/content
+func ListRevisions(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+
+	revisions := services.NoteRevisions(note)
+	if revisions == nil {
+		revisions = []models.NoteRevision{}
+	}
+	c.JSON(http.StatusOK, revisions)
+}
+
+// GET /notes/:note_id/revisions/:revision/content
+// Nội dung đã mã hóa (binary) của 1 phiên bản
+func DownloadRevisionContent(c *gin.Context) {
+	view := c.MustGet("revisionNote").(models.Note)
+	writeNoteContent(c, view)
+}
+
+// POST /notes/:note_id/revisions/:revision/restore
+// Khôi phục phiên bản cũ thành phiên bản mới nhất
+func RestoreRevision(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+	view := c.MustGet("revisionNote").(models.Note)
+
+	restored, err := services.RestoreRevision(note, view.Revision)
+	if err != nil {
+		if errors.Is(err, services.ErrRevisionConflict) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Note đã được cập nhật từ nơi khác, hãy thử lại"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể khôi phục phiên bản: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
@@ -14,12 +14,16 @@ func CreateNoteUrl(c *gin.Context) {
 	noteId := c.Param("note_id")
 	sender := c.GetString("username")
 	receiver := c.GetString("receiver")
-	expiresIn := c.GetString("expires_in")
+	expiresAt := c.GetTime("expires_at")
+	signature := c.GetString("signature")
 	maxAccess := c.GetInt("max_access")
 	sharedEncryptedAESKey := c.GetString("shared_encrypted_aes_key")
+	keyScheme := c.GetString("key_scheme")
+	revision := c.GetInt("revision")
+	followLatest := c.GetBool("follow_latest")
 
 	// Gọi Service tạo đối tượng trong DB
-	urlId, err := services.CreateUrl(noteId, sender, receiver, sharedEncryptedAESKey, expiresIn, maxAccess)
+	urlId, err := services.CreateUrl(noteId, sender, receiver, sharedEncryptedAESKey, keyScheme, signature, expiresAt, maxAccess, revision, followLatest)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -31,6 +35,44 @@ func CreateNoteUrl(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Tạo URL chia sẻ thành công"})
 }
 
+// POST /notes/:note_id/shares
+// Tạo share cho từng người nhận hợp lệ, trả về kết quả của từng người theo thứ tự trong yêu cầu
+func CreateNoteShares(c *gin.Context) {
+	noteId := c.Param("note_id")
+	sender := c.GetString("username")
+	expiresAt := c.GetTime("expires_at")
+	maxAccess := c.GetInt("max_access")
+	revision := c.GetInt("revision")
+	followLatest := c.GetBool("follow_latest")
+	recipients := c.MustGet("shareRecipients").([]models.ShareRecipient)
+	results := c.MustGet("shareResults").([]models.ShareResult)
+
+	for i, r := range recipients {
+		if results[i].Status != 0 {
+			continue
+		}
+		urlId, err := services.CreateUrl(noteId, sender, r.Receiver, r.SharedEncryptedAESKey, r.KeyScheme, r.Signature, expiresAt, maxAccess, revision, followLatest)
+		if err != nil {
+			results[i].Status, results[i].Error = http.StatusInternalServerError, err.Error()
+			continue
+		}
+		results[i].Status, results[i].UrlID = http.StatusCreated, urlId
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
+
+// POST /notes/:note_id/links
+// Tạo link công khai, bí mật của link chỉ nằm ở client nên server chỉ trả về url_id
+func CreateNoteLink(c *gin.Context) {
+	linkId, err := services.CreateLink(c.Param("note_id"), c.GetString("username"), c.GetString("shared_encrypted_aes_key"), c.GetString("access_verifier"),
+		c.GetTime("expires_at"), c.GetInt("max_access"), c.GetInt("max_attempts"), c.GetInt("revision"), c.GetBool("follow_latest"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo link: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"url_id": linkId})
+}
+
 // GET /api/:note_id/url
 func GetNoteUrl(c *gin.Context) {
 	noteId := c.Param("note_id")
@@ -49,6 +91,50 @@ func GetNoteUrl(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"url": finalUrl})
 }
 
+// GET /notes/:note_id/shares
+// Người gửi xem đã chia sẻ note cho ai, hạn dùng và số lượt xem đã dùng của từng người
+func ListNoteShares(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+
+	urls, err := services.ListNoteShares(note.ID.Hex(), c.GetString("username"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := make([]models.SentShareResponse, 0, len(urls))
+	for _, url := range urls {
+		res = append(res, models.SentShareResponse{
+			ID:           url.ID.Hex(),
+			Receiver:     url.Receiver,
+			CreatedAt:    url.ID.Timestamp(),
+			ExpiresAt:    url.ExpiresAt,
+			MaxAccess:    url.MaxAccess,
+			Accessed:     url.Accessed,
+			Revision:     url.RevisionOf(note),
+			FollowLatest: url.FollowLatest,
+			Public:       url.Public,
+			// Không trả về verifier của link có mật khẩu
+			Protected:      url.Protected(),
+			FailedAttempts: url.FailedAttempts,
+			MaxAttempts:    url.MaxAttempts,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// DELETE /shares/:url_id
+// Thu hồi share của 1 người nhận, share của những người nhận khác giữ nguyên
+func RevokeShare(c *gin.Context) {
+	url := c.MustGet("url").(models.Url)
+
+	if err := services.RevokeShare(url.ID.Hex()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể thu hồi chia sẻ: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã thu hồi chia sẻ với " + url.Receiver})
+}
+
 // (GET note/:url_id)
 func ViewNoteHandler(c *gin.Context) {
 	// Client đã lấy url_id và gọi API này
@@ -61,10 +147,75 @@ func ViewNoteHandler(c *gin.Context) {
 		return
 	}
 
-	// Trả về {cipher_text, encrypted_aes_key}
-	c.JSON(http.StatusOK, gin.H{
-		"cipher_text":            note.CipherText,
+	// Trả về {cipher_text, encrypted_aes_key, key_scheme}
+	// kèm chữ ký của người gửi và các trường được ký để người nhận tự kiểm tra
+	cipherText, err := services.NoteCipherText(note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không đọc được nội dung note: " + err.Error()})
+		return
+	}
+	res := shareMetadata(url, note)
+	res["cipher_text"] = cipherText
+	c.JSON(http.StatusOK, res)
+}
+
+// (GET note/:url_id/meta)
+// Metadata của share, không kèm nội dung và không tính lượt xem
+// Người nhận kiểm tra chữ ký trước rồi mới tải nội dung qua /note/:url_id/content
+func ViewNoteMetaHandler(c *gin.Context) {
+	url := c.MustGet("url").(models.Url)
+
+	note, err := services.GetNoteMetadata(url)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, shareMetadata(url, note))
+}
+
+// (GET links/:url_id)
+// Metadata của link công khai (không tính lượt xem), kèm metadata đã mã hóa để người mở biết tên file
+func ViewLinkMetaHandler(c *gin.Context) {
+	url := c.MustGet("url").(models.Url)
+
+	note, err := services.GetNoteMetadata(url)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	res := shareMetadata(url, note)
+	res["encrypted_metadata"] = note.EncryptedMetadata
+	c.JSON(http.StatusOK, res)
+}
+
+// (GET note/:url_id/content)
+// Nội dung đã mã hóa dạng binary, mỗi lần tải tính 1 lượt xem
+func DownloadSharedNoteHandler(c *gin.Context) {
+	url := c.MustGet("url").(models.Url)
+
+	note, err := services.GetNote(url)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	writeNoteContent(c, note)
+}
+
+// Các trường của share người nhận cần để kiểm tra chữ ký và giải mã
+func shareMetadata(url models.Url, note models.Note) gin.H {
+	return gin.H{
 		"encrypted_aes_key_by_K": url.SharedEncryptedAESKey,
 		"sender":                 url.Sender,
-	})
+		"receiver":               url.Receiver,
+		"note_id":                url.NoteID,
+		"key_scheme":             url.KeyScheme,
+		"expires_at":             url.ExpiresAt.Unix(),
+		"signature":              url.Signature,
+		"cipher_digest":          services.NoteDigest(note),
+		"revision":               url.RevisionOf(note),
+		"follow_latest":          url.FollowLatest,
+	}
 }
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GET /notes/trash
+// Các note trong thùng rác của người dùng hiện tại, kèm thời điểm bị xóa hẳn (purge_at)
+func GetTrash(c *gin.Context) {
+	notes, err := services.ViewTrash(c.GetString("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, notes)
+}
+
+// POST /notes/trash/:note_id/restore
+// Lấy note ra khỏi thùng rác, các share còn hạn hoạt động lại
+func RestoreNote(c *gin.Context) {
+	err := services.RestoreNote(c.Param("note_id"), c.GetString("userId"))
+	if errors.Is(err, stores.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note không nằm trong thùng rác"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể khôi phục note: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã khôi phục Note"})
+}
+
+// DELETE /notes/trash/:note_id
+// Xóa hẳn note trong thùng rác cùng các share và nội dung của mọi phiên bản, không khôi phục được
+func PurgeNote(c *gin.Context) {
+	err := services.PurgeNote(c.Param("note_id"))
+	if errors.Is(err, stores.ErrNotFound) || errors.Is(err, services.ErrNoteNotInTrash) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note không nằm trong thùng rác"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể xóa note: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Đã xóa vĩnh viễn Note và các dữ liệu liên quan"})
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// POST /notes/:note_id/uploads
+// Mở phiên upload nội dung note theo từng chunk
+func CreateUpload(c *gin.Context) {
+	note := c.MustGet("note").(models.Note)
+	req := c.MustGet("validatedRequest").(models.CreateUploadRequest)
+
+	session, err := services.CreateUpload(note.ID.Hex(), c.GetString("userId"), req.TotalSize, req.ChunkSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể tạo phiên upload: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, uploadStatus(session))
+}
+
+// GET /uploads/:upload_id
+// Trạng thái phiên upload, client dùng để biết cần gửi lại những chunk nào
+func GetUploadStatus(c *gin.Context) {
+	session := c.MustGet("upload").(models.UploadSession)
+	c.JSON(http.StatusOK, uploadStatus(session))
+}
+
+// PUT /uploads/:upload_id/chunks/:index
+// Nhận 1 chunk (binary), gửi lại chunk đã có thì ghi đè
+func UploadChunk(c *gin.Context) {
+	session := c.MustGet("upload").(models.UploadSession)
+	index := c.GetInt("chunkIndex")
+
+	err := services.PutUploadChunk(session, index, c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge), errors.Is(err, services.ErrUploadChunkSize):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Kích thước chunk không khớp với phiên upload"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể lưu chunk: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Đã nhận chunk", "index": index})
+}
+
+// POST /uploads/:upload_id/commit
+// Ghép các chunk thành nội dung note, phiên upload bị xóa sau khi commit
+func CommitUpload(c *gin.Context) {
+	session := c.MustGet("upload").(models.UploadSession)
+
+	size, digest, err := services.CommitUpload(session)
+	if err != nil {
+		var incomplete *services.UploadIncompleteError
+		switch {
+		case errors.As(err, &incomplete):
+			c.JSON(http.StatusConflict, gin.H{"error": "Chưa nhận đủ chunk", "missing": incomplete.Missing})
+		case errors.Is(err, services.ErrNoteContentExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "Note đã có nội dung"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Không thể ghép nội dung: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"note_id":       session.NoteID,
+		"size":          size,
+		"cipher_digest": digest,
+	})
+}
+
+func uploadStatus(session models.UploadSession) gin.H {
+	return gin.H{
+		"upload_id":   session.ID.Hex(),
+		"note_id":     session.NoteID,
+		"total_size":  session.TotalSize,
+		"chunk_size":  session.ChunkSize,
+		"chunk_count": session.ChunkCount(),
+		"received":    services.UploadReceivedRanges(session),
+		"expires_at":  session.ExpiresAt,
+	}
+}
@@ -2,14 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
-	"note_sharing_application/server/models" // Import package models của bạn
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // API trả về public_key của 1 client
@@ -21,11 +21,9 @@ func GetUserPublicKey(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	var foundUser models.User
-
-	err := UserCollection.FindOne(ctx, bson.M{"username": targetUsername}).Decode(&foundUser)
+	foundUser, err := stores.Users.FindByUsername(ctx, targetUsername)
 	// Not found user
-	if err == mongo.ErrNoDocuments {
+	if errors.Is(err, stores.ErrNotFound) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
@@ -36,9 +34,26 @@ func GetUserPublicKey(c *gin.Context) {
 		return
 	}
 
+	// Vị trí của khóa này trong key transparency log, -1 nếu chưa có
+	logIndex, err := services.CurrentKeyLogIndex(ctx, foundUser)
+	if errors.Is(err, services.ErrLogEntryMissing) {
+		logIndex = -1
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error", "details": err.Error()})
+		return
+	}
+
 	// Return JSON
+	// key_type cho biết public_key là DH hay X25519
+	// legacy_public_key: khóa DH cũ của user đã nâng cấp, dùng để đọc các share cũ
+	// signing_public_key: khóa Ed25519 để kiểm tra chữ ký trên các share người này gửi
+	// log_index: client dùng để xin inclusion proof trước khi tin khóa
 	c.JSON(http.StatusOK, gin.H{
-		"username":   foundUser.Username,
-		"public_key": foundUser.PubKey,
+		"username":           foundUser.Username,
+		"public_key":         foundUser.PubKey,
+		"key_type":           foundUser.KeyType(),
+		"legacy_public_key":  foundUser.LegacyPubKey,
+		"signing_public_key": foundUser.SigningPubKey,
+		"log_index":          logIndex,
 	})
 }
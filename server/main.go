@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"note_sharing_application/server/configs"
-	"note_sharing_application/server/handlers"
 	"note_sharing_application/server/routers"
+	"note_sharing_application/server/services"
 	"note_sharing_application/server/utils"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -31,7 +34,69 @@ func printKeyInfo(title, keyContent string) {
 	fmt.Println("--------------------------------------------------")
 }
 
+// Nạp khóa RSA của server từ file SERVER_KEY_FILE (mã hóa bằng SERVER_KEY_PASSPHRASE)
+// Chạy với -rotate-key để sinh khóa mới, khóa cũ vẫn dùng được thêm -rotate-grace
+func initServerRSAKeys(rotate bool, grace time.Duration) error {
+	keyFile := os.Getenv("SERVER_KEY_FILE")
+	if keyFile == "" {
+		keyFile = "server_rsa_key.pem"
+	}
+	passphrase := os.Getenv("SERVER_KEY_PASSPHRASE")
+
+	if rotate {
+		fmt.Printf("Đang xoay vòng khóa RSA (khóa cũ còn hiệu lực thêm %v)...\n", grace)
+		return utils.RotateServerRSAKeys(keyFile, passphrase, grace)
+	}
+	return utils.LoadOrCreateServerRSAKeys(keyFile, passphrase)
+}
+
+// Nạp khóa ký key transparency log từ file LOG_KEY_FILE (mã hóa bằng SERVER_KEY_PASSPHRASE)
+// Khóa này không xoay vòng: client đã ghi nhớ nó để kiểm tra tree head
+func initLogSigningKey() error {
+	keyFile := os.Getenv("LOG_KEY_FILE")
+	if keyFile == "" {
+		keyFile = "log_signing_key.pem"
+	}
+	return utils.LoadOrCreateLogSigningKey(keyFile, os.Getenv("SERVER_KEY_PASSPHRASE"))
+}
+
+// Kiểm tra (và sửa nếu repair) dữ liệu không nhất quán giữa notes, urls, group_shares và users
+func runConsistencyCheck(repair bool) {
+	report, err := services.CheckConsistency(repair)
+	if err != nil {
+		log.Fatal("Lỗi: Không kiểm tra được tính nhất quán dữ liệu:", err)
+	}
+
+	fmt.Printf("Share mồ côi (note không còn tồn tại): %d\n", len(report.OrphanShares))
+	for _, id := range report.OrphanShares {
+		fmt.Println("  -", id)
+	}
+	fmt.Printf("Share cho nhóm mồ côi (note không còn tồn tại): %d\n", len(report.OrphanGroupShares))
+	for _, id := range report.OrphanGroupShares {
+		fmt.Println("  -", id)
+	}
+	fmt.Printf("Note không có owner: %d\n", len(report.OwnerlessNotes))
+	for _, id := range report.OwnerlessNotes {
+		fmt.Println("  -", id)
+	}
+
+	switch {
+	case report.Consistent():
+		fmt.Println("Dữ liệu nhất quán")
+	case report.Repaired:
+		fmt.Println("Đã xóa các bản ghi trên")
+	default:
+		fmt.Println("Chạy lại với -check-consistency -repair để xóa các bản ghi trên")
+	}
+}
+
 func main() {
+	rotateKey := flag.Bool("rotate-key", false, "Sinh khóa RSA mới cho server")
+	rotateGrace := flag.Duration("rotate-grace", 7*24*time.Hour, "Thời gian khóa RSA cũ vẫn được chấp nhận sau khi xoay vòng")
+	checkConsistency := flag.Bool("check-consistency", false, "Tìm share mồ côi và note không có owner rồi thoát")
+	repair := flag.Bool("repair", false, "Dùng với -check-consistency: xóa các bản ghi không nhất quán tìm được")
+	flag.Parse()
+
 	fmt.Println("Server is booting...")
 
 	err := godotenv.Load()
@@ -44,27 +109,53 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	configs.ConnectDB(os.Getenv("DB_NAME"))
-	handlers.UserCollection = configs.GetCollection("users")
+	// Khởi tạo bộ lưu trữ (mongo / memory / file) theo STORAGE_DRIVER
+	configs.InitStorage()
+	fmt.Println("Đã khởi tạo bộ lưu trữ thành công")
 
-	if handlers.UserCollection == nil {
-		log.Fatal("Lỗi: UserCollection chưa được khởi tạo!")
-	} else {
-		fmt.Println("Đã khởi tạo UserCollection thành công")
+	if *checkConsistency {
+		runConsistencyCheck(*repair)
+		return
 	}
 
-	// Sinh khóa RSA
+	// Nạp (hoặc sinh) khóa RSA
+	// Không có passphrase thì dừng luôn: file khóa không được phép lưu ở dạng dễ giải mã
+	if os.Getenv("SERVER_KEY_PASSPHRASE") == "" {
+		log.Fatal("Lỗi: SERVER_KEY_PASSPHRASE đang trống, hãy đặt passphrase trong .env để mã hóa file khóa")
+	}
 	fmt.Println("\nĐang khởi tạo hệ thống mật mã RSA...")
-	if err := utils.GenerateServerRSAKeys(); err != nil {
-		log.Fatal("Lỗi: Không thể sinh khóa RSA Server:", err)
+	if err := initServerRSAKeys(*rotateKey, *rotateGrace); err != nil {
+		log.Fatal("Lỗi: Không thể nạp khóa RSA Server:", err)
 	}
 
-	// In khóa RSA của server ra màn hình
-	printKeyInfo("Server Private Key", fmt.Sprintf("%v", utils.ServerPrivateKey))
+	// Chỉ in public key và Key ID, private key không bao giờ ra log
 	pubKeyPEM, _ := utils.ExportPublicKeyAsPEM()
 	printKeyInfo("Server Public Key (PEM)", pubKeyPEM)
+	fmt.Println("Server Key ID:", utils.ServerKeyID())
 	fmt.Printf("\n")
 
+	// Nạp khóa ký log và ghi các khóa chưa có vào log
+	if err := initLogSigningKey(); err != nil {
+		log.Fatal("Lỗi: Không thể nạp khóa ký key log:", err)
+	}
+	added, err := services.BackfillKeyLog(context.Background())
+	if err != nil {
+		log.Fatal("Lỗi: Không thể cập nhật key log:", err)
+	}
+	fmt.Printf("Key log public key: %s (đã bổ sung %d entry)\n\n", utils.LogPublicKeyHex(), added)
+
+	// Thùng rác: note đã xóa được giữ TRASH_RETENTION (mặc định 720h = 30 ngày) rồi bị xóa hẳn
+	if v := os.Getenv("TRASH_RETENTION"); v != "" {
+		retention, err := time.ParseDuration(v)
+		if err != nil || retention <= 0 {
+			log.Fatal("Lỗi: TRASH_RETENTION không hợp lệ (vd: 720h):", v)
+		}
+		services.TrashRetention = retention
+	}
+	services.StartTrashPurger(time.Hour)
+	services.StartUploadSweeper(time.Hour)
+	fmt.Printf("Thùng rác: giữ note đã xóa trong %v\n\n", services.TrashRetention)
+
 	// Gọi hàm setup router đã tách ra file riêng
 	r := routers.SetupRouter()
 
@@ -1,6 +1,7 @@
 package middlewares
 
 import (
+	"errors"
 	"net/http"
 	"note_sharing_application/server/services"
 	"strings"
@@ -51,9 +52,22 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		//Token đúng chữ ký nhưng có thể đã bị thu hồi (đăng xuất)
+		if err := services.CheckTokenRevoked(claims); err != nil {
+			if errors.Is(err, services.ErrTokenRevoked) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token đã bị thu hồi, hãy đăng nhập lại."})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Lỗi kiểm tra token"})
+			}
+			c.Abort()
+			return
+		}
+
 		//Lưu thông tin xác thực thu được từ token vào Context để sử dụng
 		c.Set("userId", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("jti", claims.ID)
+		c.Set("tokenExpiresAt", claims.ExpiresAt.Time)
 
 		c.Next()
 	}
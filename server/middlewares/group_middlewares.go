@@ -0,0 +1,264 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Độ dài tối đa của tên nhóm
+var MaxGroupNameLength = 100
+
+// Khóa nhóm luôn được bọc bằng scheme có HKDF (gắn với username 2 bên)
+func supportedGroupKeyScheme(scheme string) bool {
+	return scheme != models.KeySchemeLegacyDH && supportedKeyScheme(scheme)
+}
+
+// Kiểm tra yêu cầu tạo nhóm (POST /groups), lưu request vào context (key "validatedRequest")
+func ValidateCreateGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.CreateGroupRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thông tin không hợp lệ"})
+			return
+		}
+
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > MaxGroupNameLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Tên nhóm không hợp lệ"})
+			return
+		}
+		if req.WrappedKey == "" || !supportedGroupKeyScheme(req.KeyScheme) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thiếu khóa nhóm hoặc key_scheme không được hỗ trợ"})
+			return
+		}
+
+		c.Set("validatedRequest", req)
+		c.Next()
+	}
+}
+
+// Kiểm tra nhóm tồn tại và người dùng hiện tại là thành viên
+// Lưu nhóm (key "group") và thông tin thành viên của người gọi (key "groupMember") vào context
+// Người ngoài nhóm nhận 404 như nhóm không tồn tại
+func ValidateGroupMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group, err := stores.Groups.FindByID(context.TODO(), c.Param("group_id"))
+		if errors.Is(err, stores.ErrInvalidID) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Group ID không hợp lệ"})
+			return
+		}
+		if err != nil && !errors.Is(err, stores.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi hệ thống cơ sở dữ liệu"})
+			return
+		}
+
+		member, ok := group.Member(c.GetString("username"))
+		if err != nil || !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Nhóm không tồn tại"})
+			return
+		}
+
+		c.Set("group", group)
+		c.Set("groupMember", member)
+		c.Next()
+	}
+}
+
+// Kiểm tra yêu cầu thêm thành viên (sau ValidateGroupMember), lưu request vào context (key "validatedRequest")
+// Owner và admin thêm được thành viên, chỉ owner thêm được admin
+func ValidateAddGroupMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := c.MustGet("group").(models.Group)
+		caller := c.MustGet("groupMember").(models.GroupMember)
+		if !caller.CanManage() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Chỉ owner hoặc admin được thêm thành viên"})
+			return
+		}
+
+		var req models.AddGroupMemberRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thông tin không hợp lệ"})
+			return
+		}
+		if req.Username == "" || req.WrappedKey == "" || !supportedGroupKeyScheme(req.KeyScheme) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thiếu username, khóa nhóm hoặc key_scheme không được hỗ trợ"})
+			return
+		}
+
+		if req.Role == "" {
+			req.Role = models.GroupRoleMember
+		}
+		if req.Role != models.GroupRoleMember && req.Role != models.GroupRoleAdmin {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "role phải là admin hoặc member"})
+			return
+		}
+		if req.Role == models.GroupRoleAdmin && caller.Role != models.GroupRoleOwner {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Chỉ owner được thêm admin"})
+			return
+		}
+
+		if _, exists := group.Member(req.Username); exists {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "User đã là thành viên của nhóm"})
+			return
+		}
+		exists, err := stores.Users.Exists(context.TODO(), req.Username)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi truy vấn người dùng"})
+			return
+		}
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User không tồn tại"})
+			return
+		}
+
+		c.Set("validatedRequest", req)
+		c.Next()
+	}
+}
+
+// Kiểm tra yêu cầu đổi vai trò thành viên (sau ValidateGroupMember), lưu vai trò mới vào context (key "role")
+// Chỉ owner được cấp/bỏ quyền admin, vai trò của owner không đổi được
+func ValidateSetGroupRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := c.MustGet("group").(models.Group)
+		caller := c.MustGet("groupMember").(models.GroupMember)
+		if caller.Role != models.GroupRoleOwner {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Chỉ owner được đổi vai trò thành viên"})
+			return
+		}
+
+		target, ok := group.Member(c.Param("username"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User không phải thành viên của nhóm"})
+			return
+		}
+		if target.Role == models.GroupRoleOwner {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Không đổi được vai trò của owner"})
+			return
+		}
+
+		var req models.SetGroupRoleRequest
+		if err := c.ShouldBindJSON(&req); err != nil || (req.Role != models.GroupRoleMember && req.Role != models.GroupRoleAdmin) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "role phải là admin hoặc member"})
+			return
+		}
+
+		c.Set("role", req.Role)
+		c.Next()
+	}
+}
+
+// Kiểm tra yêu cầu xóa thành viên kèm xoay khóa (sau ValidateGroupMember), lưu request vào context (key "validatedRequest")
+// Owner xóa được mọi thành viên, admin chỉ xóa được member; owner không bị xóa
+// Khóa mới có phủ đủ thành viên còn lại và note của nhóm hay không được kiểm tra trong transaction ở service
+func ValidateRemoveGroupMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := c.MustGet("group").(models.Group)
+		caller := c.MustGet("groupMember").(models.GroupMember)
+		if !caller.CanManage() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Chỉ owner hoặc admin được xóa thành viên"})
+			return
+		}
+
+		target, ok := group.Member(c.Param("username"))
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "User không phải thành viên của nhóm"})
+			return
+		}
+		if target.Role == models.GroupRoleOwner {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Không thể xóa owner khỏi nhóm"})
+			return
+		}
+		if target.Role == models.GroupRoleAdmin && caller.Role != models.GroupRoleOwner {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Chỉ owner được xóa admin"})
+			return
+		}
+
+		var req models.RemoveGroupMemberRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thông tin không hợp lệ"})
+			return
+		}
+		for _, k := range req.Members {
+			if k.WrappedKey == "" || !supportedGroupKeyScheme(k.KeyScheme) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thiếu khóa nhóm mới hoặc key_scheme không được hỗ trợ"})
+				return
+			}
+		}
+		for _, k := range req.Shares {
+			if k.EncryptedAESKey == "" {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thiếu khóa note bọc bằng khóa nhóm mới"})
+				return
+			}
+		}
+
+		c.Set("validatedRequest", req)
+		c.Next()
+	}
+}
+
+// Kiểm tra yêu cầu chia sẻ note cho nhóm (sau ValidateGroupMember)
+// Note phải thuộc người gọi, không nằm trong thùng rác và đã có nội dung
+// Lưu note (key "note") và request (key "validatedRequest") vào context
+func ValidateShareToGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note, ok := shareableNote(c)
+		if !ok {
+			return
+		}
+		if !note.HasContent() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Note chưa có nội dung"})
+			return
+		}
+
+		var req models.ShareToGroupRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.EncryptedAESKey == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thiếu khóa note bọc bằng khóa nhóm"})
+			return
+		}
+
+		c.Set("note", note)
+		c.Set("validatedRequest", req)
+		c.Next()
+	}
+}
+
+// Kiểm tra note đã được chia sẻ cho nhóm (sau ValidateGroupMember), lưu share vào context (key "groupShare")
+func ValidateGroupNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := c.MustGet("group").(models.Group)
+
+		share, err := stores.Groups.FindShare(context.TODO(), group.ID.Hex(), c.Param("note_id"))
+		if errors.Is(err, stores.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note chưa được chia sẻ cho nhóm"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi hệ thống cơ sở dữ liệu"})
+			return
+		}
+
+		c.Set("groupShare", share)
+		c.Next()
+	}
+}
+
+// Người chia sẻ note, owner hoặc admin của nhóm được gỡ note khỏi nhóm (sau ValidateGroupNote)
+func ValidateUnshareFromGroup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		caller := c.MustGet("groupMember").(models.GroupMember)
+		share := c.MustGet("groupShare").(models.GroupShare)
+
+		if share.Sender != caller.Username && !caller.CanManage() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Bạn không có quyền gỡ note này khỏi nhóm"})
+			return
+		}
+		c.Next()
+	}
+}
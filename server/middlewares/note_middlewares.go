@@ -2,16 +2,29 @@ package middlewares
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
-	"note_sharing_application/server/configs"
 	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// Kích thước tối đa (byte) của nội dung note tải lên qua endpoint binary
+// Nội dung nằm trong BlobStore nên không bị giới hạn 16MB của document MongoDB
+var MaxNoteContentSize int64 = 4 << 30
+
+// Kích thước tối đa (ký tự Base64) của metadata đã mã hóa (tên file, tiêu đề...)
+var MaxNoteMetadataSize = 16 << 10
+
+// Số bản ghi tối đa trong 1 trang của các API liệt kê
+var MaxPageLimit = 100
+
 func ValidateGetOwnedNotes() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Kiểm tra tính tồn tại của định danh người dùng (User ID)
@@ -23,10 +36,17 @@ func ValidateGetOwnedNotes() gin.HandlerFunc {
 			})
 			return
 		}
+
+		page, ok := parsePageQuery(c, models.SortCreated)
+		if !ok {
+			return
+		}
+		c.Set("page", page)
 		c.Next()
 	}
 }
 
+// Query sender, state (active) lọc share, lưu vào context (key "shareFilter")
 func ValidateGetReceivedNoteURLs() gin.HandlerFunc {
 	return func(c *gin.Context) {
 
@@ -37,10 +57,68 @@ func ValidateGetReceivedNoteURLs() gin.HandlerFunc {
 			})
 			return
 		}
+
+		filter := models.ShareFilter{Sender: c.Query("sender"), State: c.Query("state")}
+		switch filter.State {
+		case models.ShareStateAll, models.ShareStateActive:
+		default:
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "state chỉ nhận giá trị active"})
+			return
+		}
+
+		page, ok := parsePageQuery(c, models.SortCreated, models.SortExpires)
+		if !ok {
+			return
+		}
+		c.Set("shareFilter", filter)
+		c.Set("page", page)
 		c.Next()
 	}
 }
 
+// Đọc tham số phân trang từ query: limit (1..MaxPageLimit, bỏ trống = lấy hết), after (cursor trang trước),
+// sort (một trong sorts, mặc định sorts[0]), order (asc | desc). Request lỗi thì abort 400 và trả về false
+func parsePageQuery(c *gin.Context, sorts ...string) (models.PageQuery, bool) {
+	page := models.PageQuery{Sort: sorts[0]}
+
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > MaxPageLimit {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit phải từ 1 đến %d", MaxPageLimit)})
+			return page, false
+		}
+		page.Limit = n
+	}
+
+	if v := c.Query("sort"); v != "" {
+		if !slices.Contains(sorts, v) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "sort phải là một trong: " + strings.Join(sorts, ", ")})
+			return page, false
+		}
+		page.Sort = v
+	}
+
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "order phải là asc hoặc desc"})
+		return page, false
+	}
+
+	if v := c.Query("after"); v != "" {
+		// Cursor chỉ dùng được với đúng cách sắp xếp đã tạo ra nó
+		after, err := models.DecodePageCursor(v)
+		if err != nil || after.Sort != page.Sort {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": models.ErrInvalidCursor.Error()})
+			return page, false
+		}
+		page.After = &after
+	}
+	return page, true
+}
+
 func ValidateDeleteNote() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1. Lấy Note ID từ URL
@@ -48,7 +126,7 @@ func ValidateDeleteNote() gin.HandlerFunc {
 
 		// 2. Validate định dạng ObjectID (Fail Fast)
 		// Nếu ID sai định dạng Hex, chặn ngay lập tức, không cần gọi DB
-		id, err := primitive.ObjectIDFromHex(noteIdHex)
+		_, err := primitive.ObjectIDFromHex(noteIdHex)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Note ID không hợp lệ"})
 			return
@@ -63,14 +141,11 @@ func ValidateDeleteNote() gin.HandlerFunc {
 
 		// 4. Truy vấn Database để kiểm tra sự tồn tại và quyền sở hữu
 		// Lưu ý: Việc truy vấn ở đây giúp Handler chính không cần lo về logic này nữa
-		var note models.Note
-		coll := configs.GetCollection("notes")
-
 		// Tìm note theo _id
-		err = coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&note)
+		note, err := stores.Notes.FindByID(context.TODO(), noteIdHex)
 		if err != nil {
 			// Nếu lỗi là do không tìm thấy document
-			if err == mongo.ErrNoDocuments {
+			if errors.Is(err, stores.ErrNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note không tồn tại"})
 				return
 			}
@@ -86,6 +161,12 @@ func ValidateDeleteNote() gin.HandlerFunc {
 			return
 		}
 
+		// 6. Note đã nằm trong thùng rác (xóa hẳn qua DELETE /notes/trash/:note_id)
+		if note.InTrash() {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note đã nằm trong thùng rác"})
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -107,6 +188,12 @@ func ValidateCreateNote() gin.HandlerFunc {
 			return
 		}
 
+		// 3. Metadata đã mã hóa chỉ chứa vài trường ngắn
+		if len(req.EncryptedMetadata) > MaxNoteMetadataSize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "encrypted_metadata quá lớn"})
+			return
+		}
+
 		// 5. Lưu object đã validate vào Context để Handler dùng
 		// Key này dùng để truyền dữ liệu giữa Middleware và Handler
 		c.Set("validatedRequest", req)
@@ -122,7 +209,7 @@ func ValidateDeleteSharedNote() gin.HandlerFunc {
 
 		// 2. Validate định dạng ObjectID (Fail Fast)
 		// Chặn ngay nếu ID gửi lên không phải là chuỗi Hex 24 ký tự hợp lệ
-		id, err := primitive.ObjectIDFromHex(noteIdHex)
+		_, err := primitive.ObjectIDFromHex(noteIdHex)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Note ID không đúng định dạng"})
 			return
@@ -137,13 +224,10 @@ func ValidateDeleteSharedNote() gin.HandlerFunc {
 
 		// 4. Truy vấn Database để kiểm tra quyền sở hữu đối với GHI CHÚ GỐC
 		// Logic: Để xóa link chia sẻ, bạn phải là chủ của ghi chú đó.
-		var note models.Note
-		coll := configs.GetCollection("notes")
-
 		// Tìm note theo _id
-		err = coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&note)
+		note, err := stores.Notes.FindByID(context.TODO(), noteIdHex)
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
+			if errors.Is(err, stores.ErrNotFound) {
 				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Ghi chú không tồn tại để thực hiện thao tác"})
 				return
 			}
@@ -162,3 +246,68 @@ func ValidateDeleteSharedNote() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Kiểm tra note tồn tại, thuộc người dùng hiện tại và không nằm trong thùng rác, lưu note vào context (key "note")
+func ValidateNoteOwner() gin.HandlerFunc {
+	return validateOwnedNote(false)
+}
+
+// Giống ValidateNoteOwner nhưng note phải đang nằm trong thùng rác (khôi phục / xóa hẳn)
+func ValidateTrashedNote() gin.HandlerFunc {
+	return validateOwnedNote(true)
+}
+
+func validateOwnedNote(inTrash bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteIdHex := c.Param("note_id")
+		if _, err := primitive.ObjectIDFromHex(noteIdHex); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Note ID không hợp lệ"})
+			return
+		}
+
+		note, err := stores.Notes.FindByID(c.Request.Context(), noteIdHex)
+		if err != nil {
+			if errors.Is(err, stores.ErrNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note không tồn tại"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi kết nối cơ sở dữ liệu"})
+			return
+		}
+
+		if note.OwnerID != c.GetString("userId") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Bạn không có quyền truy cập Note này"})
+			return
+		}
+
+		if note.InTrash() != inTrash {
+			if inTrash {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note không nằm trong thùng rác"})
+			} else {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note đang nằm trong thùng rác"})
+			}
+			return
+		}
+
+		c.Set("note", note)
+		c.Next()
+	}
+}
+
+// Nội dung tải lên là binary (application/octet-stream), giới hạn kích thước
+func ValidateUploadContent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.ContentType() != "application/octet-stream" {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Nội dung phải gửi dạng application/octet-stream"})
+			return
+		}
+		if c.Request.ContentLength > MaxNoteContentSize {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Nội dung vượt quá kích thước cho phép"})
+			return
+		}
+
+		// Không có Content-Length (chunked) thì chặn khi đọc vượt giới hạn
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxNoteContentSize)
+		c.Next()
+	}
+}
@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net/http"
+	"note_sharing_application/server/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Kiểm tra yêu cầu cập nhật nội dung note (chạy sau ValidateNoteOwner và ValidateUploadContent)
+// Query base_revision (tùy chọn): phiên bản client đã sửa, lưu vào context (key "baseRevision")
+// Header X-Encrypted-Metadata (tùy chọn): metadata mới đã mã hóa, lưu vào context (key "encryptedMetadata")
+func ValidateUpdateNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note := c.MustGet("note").(models.Note)
+		if !note.HasContent() {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Note chưa có nội dung, tải lên qua PUT /notes/:note_id/content"})
+			return
+		}
+
+		baseRevision := 0
+		if v := c.Query("base_revision"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "base_revision không hợp lệ"})
+				return
+			}
+			baseRevision = n
+		}
+
+		metadata := c.GetHeader("X-Encrypted-Metadata")
+		if len(metadata) > MaxNoteMetadataSize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "encrypted_metadata vượt quá kích thước cho phép"})
+			return
+		}
+
+		c.Set("baseRevision", baseRevision)
+		c.Set("encryptedMetadata", metadata)
+		c.Next()
+	}
+}
+
+// Kiểm tra phiên bản :revision của note tồn tại (chạy sau ValidateNoteOwner)
+// Lưu note ở phiên bản đó vào context (key "revisionNote")
+func ValidateRevision() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note := c.MustGet("note").(models.Note)
+
+		number, err := strconv.Atoi(c.Param("revision"))
+		if err != nil || number <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Số phiên bản không hợp lệ"})
+			return
+		}
+		view, ok := note.AtRevision(number)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Phiên bản không tồn tại"})
+			return
+		}
+
+		c.Set("revisionNote", view)
+		c.Next()
+	}
+}
@@ -2,37 +2,36 @@ package middlewares
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
-	"note_sharing_application/server/configs"
 	"note_sharing_application/server/models"
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+	"note_sharing_application/server/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Số người nhận tối đa trong 1 yêu cầu POST /notes/:note_id/shares
+var MaxShareRecipients = 50
+
+// Số lần nhập sai mật khẩu mặc định và tối đa của link có mật khẩu
+var (
+	DefaultLinkMaxAttempts = 5
+	MaxLinkMaxAttempts     = 20
 )
 
 func ValidateCreateUrl() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		noteId := c.Param("note_id")
 
-		//Qua auth_middleware nên có username trong context chỉ cần lấy ra
-		currentUser := c.GetString("userId")
-
-		// 1. Kiểm tra Note có tồn tại không
-		var note models.Note
-		id, _ := primitive.ObjectIDFromHex(noteId)
-		coll := configs.GetCollection("notes")
-		err := coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&note)
-
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note không tồn tại"})
-			return
-		}
-
-		// 2. Kiểm tra người yêu cầu có phải chủ sở hữu không
-		if note.OwnerID != currentUser {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Yêu cầu không hợp lệ"})
+		// 1-2. Kiểm tra Note có tồn tại không và người yêu cầu có phải chủ sở hữu không
+		note, ok := shareableNote(c)
+		if !ok {
 			return
 		}
 
@@ -43,36 +42,271 @@ func ValidateCreateUrl() gin.HandlerFunc {
 			return
 		}
 
-		if req.MaxAccess <= 0 {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Số lượt truy cập tối đa phải > 0"})
+		expiresAt, revision, digest, ok := validateShareOptions(c, note, req.MaxAccess, req.ExpiresAt, req.ExpiresIn, req.Revision, req.FollowLatest)
+		if !ok {
 			return
 		}
 
-		// Parse thử thời gian
-		if _, err := time.ParseDuration(req.ExpiresIn); err != nil {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Định dạng thời gian sai (vd: 1h, 30m)"})
+		if !supportedKeyScheme(req.KeyScheme) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "key_scheme không được hỗ trợ"})
+			return
+		}
+
+		// Người gửi đã có khóa ký thì share bắt buộc có chữ ký hợp lệ
+		sender, err := stores.Users.FindByUsername(context.TODO(), c.GetString("username"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi truy vấn người gửi"})
+			return
+		}
+		recipient := models.ShareRecipient{
+			Receiver:              req.Receiver,
+			SharedEncryptedAESKey: req.SharedEncryptedAESKey,
+			KeyScheme:             req.KeyScheme,
+			Signature:             req.Signature,
+		}
+		if !verifyRecipientSignature(sender, noteId, digest, req.ExpiresAt, &recipient) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Chữ ký của share không hợp lệ"})
 			return
 		}
 
 		// Lưu thông tin đã parse vào Context để Handler dùng
-		c.Set("expires_in", req.ExpiresIn)
+		c.Set("expires_at", expiresAt)
+		c.Set("signature", recipient.Signature)
 		c.Set("max_access", req.MaxAccess)
 		c.Set("shared_encrypted_aes_key", req.SharedEncryptedAESKey)
 		c.Set("receiver", req.Receiver)
+		c.Set("key_scheme", req.KeyScheme)
+		c.Set("revision", revision)
+		c.Set("follow_latest", req.FollowLatest)
+
+		c.Next()
+	}
+}
+
+// Kiểm tra yêu cầu tạo link công khai (POST /notes/:note_id/links)
+// Link không có người nhận và không có chữ ký: chỉ ai biết bí mật trong #fragment mới mở được khóa AES
+func ValidateCreateLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note, ok := shareableNote(c)
+		if !ok {
+			return
+		}
+
+		var req models.CreateLinkRequest
+		if err := c.ShouldBindJSON(&req); err != nil || req.SharedEncryptedAESKey == "" {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thiếu khóa AES đã bọc bằng khóa của link"})
+			return
+		}
+
+		expiresAt, revision, _, ok := validateShareOptions(c, note, req.MaxAccess, req.ExpiresAt, req.ExpiresIn, req.Revision, req.FollowLatest)
+		if !ok {
+			return
+		}
+
+		// Link có mật khẩu: verifier là SHA-256 (hex) của access token
+		if req.AccessVerifier != "" {
+			if raw, err := hex.DecodeString(req.AccessVerifier); err != nil || len(raw) != sha256.Size {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "access_verifier không hợp lệ"})
+				return
+			}
+			if req.MaxAttempts == 0 {
+				req.MaxAttempts = DefaultLinkMaxAttempts
+			}
+			if req.MaxAttempts < 0 || req.MaxAttempts > MaxLinkMaxAttempts {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Số lần nhập sai tối đa phải từ 1 đến %d", MaxLinkMaxAttempts)})
+				return
+			}
+		} else if req.MaxAttempts != 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "max_attempts chỉ dùng cho link có mật khẩu"})
+			return
+		}
+
+		c.Set("expires_at", expiresAt)
+		c.Set("max_access", req.MaxAccess)
+		c.Set("shared_encrypted_aes_key", req.SharedEncryptedAESKey)
+		c.Set("revision", revision)
+		c.Set("follow_latest", req.FollowLatest)
+		c.Set("access_verifier", req.AccessVerifier)
+		c.Set("max_attempts", req.MaxAttempts)
+		c.Next()
+	}
+}
+
+// Kiểm tra yêu cầu chia sẻ note cho nhiều người nhận (POST /notes/:note_id/shares)
+// Hạn dùng, số lượt xem và phiên bản chung cho cả nhóm: sai thì từ chối cả yêu cầu
+// Từng người nhận được kiểm tra riêng, kết quả lưu vào context (key "shareResults", Status 0 = hợp lệ)
+// cùng thứ tự với danh sách người nhận (key "shareRecipients")
+func ValidateCreateShares() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		noteId := c.Param("note_id")
+
+		note, ok := shareableNote(c)
+		if !ok {
+			return
+		}
+
+		var req models.CreateSharesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thông tin không hợp lệ"})
+			return
+		}
+		if len(req.Shares) == 0 || len(req.Shares) > MaxShareRecipients {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cần từ 1 đến %d người nhận", MaxShareRecipients)})
+			return
+		}
+
+		expiresAt, revision, digest, ok := validateShareOptions(c, note, req.MaxAccess, req.ExpiresAt, req.ExpiresIn, req.Revision, req.FollowLatest)
+		if !ok {
+			return
+		}
+
+		sender, err := stores.Users.FindByUsername(context.TODO(), c.GetString("username"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi truy vấn người gửi"})
+			return
+		}
 
+		results := make([]models.ShareResult, len(req.Shares))
+		seen := make(map[string]bool)
+		for i := range req.Shares {
+			r := &req.Shares[i]
+			results[i].Receiver = r.Receiver
+			reject := func(status int, msg string) {
+				results[i].Status, results[i].Error = status, msg
+			}
+
+			switch {
+			case r.Receiver == "" || r.SharedEncryptedAESKey == "":
+				reject(http.StatusBadRequest, "Thiếu receiver hoặc shared_encrypted_aes_key")
+				continue
+			case seen[r.Receiver]:
+				reject(http.StatusConflict, "Người nhận bị lặp lại trong yêu cầu")
+				continue
+			case !supportedKeyScheme(r.KeyScheme):
+				reject(http.StatusBadRequest, "key_scheme không được hỗ trợ")
+				continue
+			}
+			seen[r.Receiver] = true
+
+			exists, err := stores.Users.Exists(context.TODO(), r.Receiver)
+			if err != nil {
+				reject(http.StatusInternalServerError, "Lỗi truy vấn người nhận")
+				continue
+			}
+			if !exists {
+				reject(http.StatusNotFound, "Người nhận không tồn tại")
+				continue
+			}
+			if !verifyRecipientSignature(sender, noteId, digest, req.ExpiresAt, r) {
+				reject(http.StatusBadRequest, "Chữ ký của share không hợp lệ")
+				continue
+			}
+		}
+
+		c.Set("expires_at", expiresAt)
+		c.Set("max_access", req.MaxAccess)
+		c.Set("revision", revision)
+		c.Set("follow_latest", req.FollowLatest)
+		c.Set("shareRecipients", req.Shares)
+		c.Set("shareResults", results)
 		c.Next()
 	}
 }
 
+// Note được chia sẻ phải tồn tại, không nằm trong thùng rác và thuộc người dùng hiện tại
+func shareableNote(c *gin.Context) (models.Note, bool) {
+	note, err := stores.Notes.FindByID(context.TODO(), c.Param("note_id"))
+	if err != nil || note.InTrash() {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note không tồn tại"})
+		return note, false
+	}
+
+	//Qua auth_middleware nên có userId trong context chỉ cần lấy ra
+	if note.OwnerID != c.GetString("userId") {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Yêu cầu không hợp lệ"})
+		return note, false
+	}
+	return note, true
+}
+
+// Kiểm tra các tùy chọn chung của share, trả về thời điểm hết hạn, phiên bản được chia sẻ
+// và hash nội dung được ký. Request lỗi thì abort và trả về false
+func validateShareOptions(c *gin.Context, note models.Note, maxAccess int, expiresAtUnix int64, expiresIn string, reqRevision int, followLatest bool) (time.Time, int, string, bool) {
+	if maxAccess <= 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Số lượt truy cập tối đa phải > 0"})
+		return time.Time{}, 0, "", false
+	}
+
+	// Thời điểm hết hạn: client mới gửi expires_at (đã được ký), client cũ gửi expires_in
+	var expiresAt time.Time
+	if expiresAtUnix != 0 {
+		expiresAt = time.Unix(expiresAtUnix, 0)
+		if !expiresAt.After(time.Now()) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Thời điểm hết hạn đã qua"})
+			return time.Time{}, 0, "", false
+		}
+	} else {
+		duration, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Định dạng thời gian sai (vd: 1h, 30m)"})
+			return time.Time{}, 0, "", false
+		}
+		expiresAt = time.Now().Add(duration)
+	}
+
+	// Note tạo bằng POST /notes nhưng chưa tải nội dung lên thì chưa chia sẻ được
+	if !note.HasContent() {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Note chưa có nội dung"})
+		return time.Time{}, 0, "", false
+	}
+
+	// Phiên bản được chia sẻ: mặc định là phiên bản hiện tại, follow_latest thì ký "latest" thay cho hash nội dung
+	revision := note.CurrentRevisionNumber()
+	digest := utils.ShareDigestLatest
+	if followLatest && reqRevision != 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Không dùng đồng thời revision và follow_latest"})
+		return time.Time{}, 0, "", false
+	}
+	if !followLatest {
+		if reqRevision != 0 {
+			revision = reqRevision
+		}
+		view, ok := note.AtRevision(revision)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Phiên bản không tồn tại"})
+			return time.Time{}, 0, "", false
+		}
+		digest = services.NoteDigest(view)
+	}
+	return expiresAt, revision, digest, true
+}
+
+func supportedKeyScheme(scheme string) bool {
+	switch scheme {
+	case models.KeySchemeLegacyDH, models.KeySchemeDHHKDF, models.KeySchemeX25519:
+		return true
+	}
+	return false
+}
+
+// Người gửi đã có khóa ký thì share bắt buộc có chữ ký hợp lệ
+// Người gửi chưa có khóa ký thì bỏ chữ ký client gửi lên (không kiểm tra được)
+func verifyRecipientSignature(sender models.User, noteId, digest string, expiresAt int64, r *models.ShareRecipient) bool {
+	if sender.SigningPubKey == "" {
+		r.Signature = ""
+		return true
+	}
+	msg := utils.ShareSignatureMessage(sender.Username, r.Receiver, noteId, digest,
+		r.SharedEncryptedAESKey, r.KeyScheme, expiresAt)
+	return expiresAt != 0 && utils.VerifyShareSignature(sender.SigningPubKey, r.Signature, msg)
+}
+
 // Kiểm tra quyền truy cập có được lấy url hay không
 func ValidateNote() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		noteId := c.Param("note_id")
 
-		var note models.Note
-		id, _ := primitive.ObjectIDFromHex(noteId)
-		noteColl := configs.GetCollection("notes")
-		err := noteColl.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&note)
+		_, err := stores.Notes.FindByID(context.TODO(), noteId)
 
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Note không tồn tại"})
@@ -83,16 +317,39 @@ func ValidateNote() gin.HandlerFunc {
 	}
 }
 
+// Kiểm tra share tồn tại và do người dùng hiện tại gửi, lưu share vào context (key "url")
+func ValidateShareSender() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		url, err := stores.Shares.FindByID(context.TODO(), c.Param("url_id"))
+		if errors.Is(err, stores.ErrInvalidID) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "URL ID không hợp lệ"})
+			return
+		}
+		if errors.Is(err, stores.ErrNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Liên kết sai hoặc đã hết hạn"})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi hệ thống cơ sở dữ liệu"})
+			return
+		}
+
+		if url.Sender != c.GetString("username") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Bạn không có quyền thu hồi chia sẻ này"})
+			return
+		}
+		c.Set("url", url)
+		c.Next()
+	}
+}
+
 // Nếu đã có quyền truy cập thì kiểm tra Url có tồn tại
 func ValidateUrl() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		urlId := c.Param("url_id")
 		receiver := c.GetString("username")
 
-		var url models.Url
-		id, _ := primitive.ObjectIDFromHex(urlId)
-		coll := configs.GetCollection("urls")
-		err := coll.FindOne(context.TODO(), bson.M{"_id": id}).Decode(&url)
+		url, err := stores.Shares.FindByID(context.TODO(), urlId)
 
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Liên kết sai hoặc đã hết hạn"})
@@ -107,3 +364,41 @@ func ValidateUrl() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Kiểm tra link công khai tồn tại (không cần đăng nhập), lưu link vào context (key "url")
+// Share cho người nhận cụ thể không mở được qua đường này
+// Link có mật khẩu cần header X-Link-Token, mỗi token sai tính 1 lần thử
+func ValidatePublicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		url, err := stores.Shares.FindByID(context.TODO(), c.Param("url_id"))
+		if err != nil || !url.Public {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Liên kết sai hoặc đã hết hạn"})
+			return
+		}
+
+		if url.Protected() {
+			token := c.GetHeader("X-Link-Token")
+			if token == "" {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Link cần mật khẩu", "password_required": true})
+				return
+			}
+			if !utils.CheckLinkAccessToken(url.AccessVerifier, token) {
+				left, err := services.FailLinkAttempt(url.ID.Hex())
+				if err != nil {
+					c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Liên kết sai hoặc đã hết hạn"})
+					return
+				}
+				if left == 0 {
+					// Lần sai cuối cùng: link đã bị xóa
+					c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": models.ErrUrlLocked.Error()})
+					return
+				}
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": fmt.Sprintf("Sai mật khẩu, còn %d lần thử", left), "password_required": true, "attempts_left": left})
+				return
+			}
+		}
+
+		c.Set("url", url)
+		c.Next()
+	}
+}
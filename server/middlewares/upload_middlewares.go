@@ -0,0 +1,105 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Giới hạn kích thước chunk (byte) của phiên upload, chunk cuối có thể ngắn hơn MinUploadChunkSize
+var (
+	MinUploadChunkSize int64 = 64 << 10
+	MaxUploadChunkSize int64 = 64 << 20
+)
+
+// Kiểm tra yêu cầu mở phiên upload (chạy sau ValidateNoteOwner), lưu request vào context (key "validatedRequest")
+func ValidateCreateUpload() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		note := c.MustGet("note").(models.Note)
+		if note.HasContent() {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "Note đã có nội dung"})
+			return
+		}
+
+		var req models.CreateUploadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Dữ liệu đầu vào không hợp lệ: " + err.Error()})
+			return
+		}
+		if req.TotalSize <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "total_size phải lớn hơn 0"})
+			return
+		}
+		if req.TotalSize > MaxNoteContentSize {
+			c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Nội dung vượt quá kích thước cho phép"})
+			return
+		}
+		if req.ChunkSize < MinUploadChunkSize || req.ChunkSize > MaxUploadChunkSize {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "chunk_size nằm ngoài giới hạn cho phép"})
+			return
+		}
+
+		c.Set("validatedRequest", req)
+		c.Next()
+	}
+}
+
+// Kiểm tra phiên upload tồn tại, chưa hết hạn và thuộc người dùng hiện tại, lưu phiên vào context (key "upload")
+func ValidateUploadSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session, err := stores.Uploads.FindByID(c.Request.Context(), c.Param("upload_id"))
+		if err != nil {
+			switch {
+			case errors.Is(err, stores.ErrInvalidID):
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Upload ID không hợp lệ"})
+			case errors.Is(err, stores.ErrNotFound):
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Phiên upload không tồn tại hoặc đã hết hạn"})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Lỗi kết nối cơ sở dữ liệu"})
+			}
+			return
+		}
+
+		// Không tiết lộ phiên của người khác
+		if session.OwnerID != c.GetString("userId") {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Phiên upload không tồn tại hoặc đã hết hạn"})
+			return
+		}
+
+		c.Set("upload", session)
+		c.Next()
+	}
+}
+
+// Kiểm tra chunk gửi lên (chạy sau ValidateUploadSession): số thứ tự hợp lệ, binary, đúng kích thước
+// Lưu số thứ tự vào context (key "chunkIndex")
+func ValidateUploadChunk() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := c.MustGet("upload").(models.UploadSession)
+
+		index, err := strconv.Atoi(c.Param("index"))
+		if err != nil || index < 0 || index >= session.ChunkCount() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Số thứ tự chunk không hợp lệ"})
+			return
+		}
+		if c.ContentType() != "application/octet-stream" {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "Nội dung phải gửi dạng application/octet-stream"})
+			return
+		}
+
+		length := session.ChunkLength(index)
+		if c.Request.ContentLength >= 0 && c.Request.ContentLength != length {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Kích thước chunk không khớp với phiên upload"})
+			return
+		}
+
+		// Đọc tối đa 1 byte dư để phát hiện chunk dài hơn khai báo
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, length+1)
+		c.Set("chunkIndex", index)
+		c.Next()
+	}
+}
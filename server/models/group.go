@@ -0,0 +1,136 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Vai trò trong nhóm
+// owner: người tạo nhóm, duy nhất, không bị xóa khỏi nhóm, cấp/bỏ quyền admin
+// admin: thêm/xóa thành viên (không xóa được admin khác)
+// member: đọc note được chia sẻ cho nhóm và chia sẻ note của mình cho nhóm
+const (
+	GroupRoleOwner  = "owner"
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
+// Nhóm người dùng (collection "groups")
+// Khóa nhóm (AES) do client sinh ra, server chỉ lưu các bản đã bọc riêng cho từng thành viên
+type Group struct {
+	ID   primitive.ObjectID `bson:"_id,omitempty" json:"group_id"`
+	Name string             `bson:"name" json:"name"`
+	// Phiên bản khóa nhóm hiện tại, bắt đầu từ 1 và tăng mỗi lần xoay khóa (khi xóa thành viên)
+	KeyVersion int           `bson:"key_version" json:"key_version"`
+	Members    []GroupMember `bson:"members" json:"members"`
+}
+
+// Thành viên nhóm và khóa nhóm (phiên bản hiện tại) đã bọc cho thành viên đó
+// Khóa được bọc bằng khóa chung giữa WrappedBy và thành viên (như khóa AES của share)
+type GroupMember struct {
+	Username   string `bson:"username" json:"username"`
+	Role       string `bson:"role" json:"role"`
+	WrappedKey string `bson:"wrapped_key" json:"wrapped_key"`
+	WrappedBy  string `bson:"wrapped_by" json:"wrapped_by"`
+	KeyScheme  string `bson:"key_scheme" json:"key_scheme"`
+}
+
+// Thông tin thành viên của username trong nhóm
+func (g Group) Member(username string) (GroupMember, bool) {
+	for _, m := range g.Members {
+		if m.Username == username {
+			return m, true
+		}
+	}
+	return GroupMember{}, false
+}
+
+// Owner và admin được quản lý thành viên
+func (m GroupMember) CanManage() bool {
+	return m.Role == GroupRoleOwner || m.Role == GroupRoleAdmin
+}
+
+// Note chia sẻ cho nhóm (collection "group_shares"), mỗi note chỉ chia sẻ 1 lần cho 1 nhóm
+// Khóa AES của note được bọc bằng khóa nhóm phiên bản KeyVersion
+// Thành viên luôn đọc phiên bản mới nhất của note, share không có hạn dùng và giới hạn lượt xem
+type GroupShare struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"share_id"`
+	GroupID         string             `bson:"group_id" json:"group_id"`
+	NoteID          string             `bson:"note_id" json:"note_id"`
+	Sender          string             `bson:"sender" json:"sender"`
+	EncryptedAESKey string             `bson:"encrypted_aes_key" json:"encrypted_aes_key"`
+	KeyVersion      int                `bson:"key_version" json:"key_version"`
+}
+
+// POST /groups: người tạo gửi kèm khóa nhóm đã bọc cho chính mình
+type CreateGroupRequest struct {
+	Name       string `json:"name"`
+	WrappedKey string `json:"wrapped_key"`
+	KeyScheme  string `json:"key_scheme"`
+}
+
+// POST /groups/:group_id/members: khóa nhóm phiên bản KeyVersion bọc cho thành viên mới
+type AddGroupMemberRequest struct {
+	Username   string `json:"username"`
+	Role       string `json:"role"` // mặc định member
+	WrappedKey string `json:"wrapped_key"`
+	KeyScheme  string `json:"key_scheme"`
+	KeyVersion int    `json:"key_version"`
+}
+
+// PUT /groups/:group_id/members/:username
+type SetGroupRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// DELETE /groups/:group_id/members/:username
+// Xóa thành viên kèm xoay khóa: client sinh khóa nhóm mới, bọc cho mọi thành viên còn lại
+// và bọc lại khóa AES của mọi note đã chia sẻ cho nhóm. KeyVersion là phiên bản khóa cũ
+type RemoveGroupMemberRequest struct {
+	KeyVersion int              `json:"key_version"`
+	Members    []GroupMemberKey `json:"members"`
+	Shares     []GroupShareKey  `json:"shares"`
+}
+
+// Khóa nhóm mới bọc cho 1 thành viên
+type GroupMemberKey struct {
+	Username   string `json:"username"`
+	WrappedKey string `json:"wrapped_key"`
+	KeyScheme  string `json:"key_scheme"`
+}
+
+// Khóa AES của 1 note trong nhóm bọc bằng khóa nhóm mới
+type GroupShareKey struct {
+	ShareID         string `json:"share_id"`
+	EncryptedAESKey string `json:"encrypted_aes_key"`
+}
+
+// POST /groups/:group_id/notes/:note_id
+type ShareToGroupRequest struct {
+	EncryptedAESKey string `json:"encrypted_aes_key"`
+	KeyVersion      int    `json:"key_version"`
+}
+
+// Nhóm người gọi là thành viên (GET /groups, GET /groups/:group_id)
+// Khóa đã bọc của thành viên khác không được trả về
+type GroupResponse struct {
+	ID         string            `json:"group_id"`
+	Name       string            `json:"name"`
+	KeyVersion int               `json:"key_version"`
+	Members    []GroupMemberInfo `json:"members"`
+	// Khóa nhóm bọc cho người gọi
+	Key GroupMember `json:"key"`
+}
+
+type GroupMemberInfo struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Note chia sẻ cho nhóm (GET /groups/:group_id/notes), kèm metadata đã mã hóa bằng khóa AES của note
+// Note trong thùng rác vẫn có trong danh sách (Suspended) vì khóa của nó cũng phải được bọc lại khi xoay khóa
+type GroupNoteResponse struct {
+	GroupShare
+	EncryptedMetadata string `json:"encrypted_metadata,omitempty"`
+	Revision          int    `json:"revision,omitempty"`
+	Suspended         bool   `json:"suspended,omitempty"`
+}
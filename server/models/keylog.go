@@ -0,0 +1,22 @@
+package models
+
+// 1 bản ghi trong key transparency log: public key của user tại 1 thời điểm
+// Mỗi lần đăng ký hoặc đổi khóa thêm 1 bản ghi vào cuối log, không bao giờ sửa hay xóa
+type KeyLogEntry struct {
+	Index           int64  `bson:"_id" json:"index"`
+	Username        string `bson:"username" json:"username"`
+	KeyType         string `bson:"key_type" json:"key_type"`
+	PublicKey       string `bson:"public_key" json:"public_key"`
+	LegacyPublicKey string `bson:"legacy_public_key" json:"legacy_public_key"`
+	// Khóa ký Ed25519, rỗng với user chưa có khóa ký
+	SigningPublicKey string `bson:"signing_public_key,omitempty" json:"signing_public_key,omitempty"`
+	Timestamp        int64  `bson:"timestamp" json:"timestamp"` // Unix giây
+}
+
+// Signed Tree Head: gốc cây Merkle của log tại kích thước TreeSize, được server ký (Ed25519)
+type SignedTreeHead struct {
+	TreeSize  int64  `json:"tree_size"`
+	RootHash  string `json:"root_hash"` // hex
+	Timestamp int64  `json:"timestamp"` // Unix giây
+	Signature string `json:"signature"` // base64
+}
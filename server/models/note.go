@@ -1,19 +1,102 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Note struct {
 	ID              primitive.ObjectID `bson:"_id,omitempty" json:"note_id"` // omitempty = nếu trường rỗng thì tự sinh ID
 	Title           string             `bson:"title" json:"title"`
-	CipherText      string             `bson:"cipher_text" json:"cipher_text"`             // Nội dung ghi chú đã mã hóa
 	EncryptedAesKey string             `bson:"encrypted_aes_key" json:"encrypted_aes_key"` // Key giải mã (đã bị bọc)
 	OwnerID         string             `bson:"owner_id" json:"owner_id"`                   // ID của người tạo (dạng string)
+	// Nội dung đã mã hóa nằm trong BlobStore, note chỉ giữ tham chiếu, kích thước (byte) và hash
+	BlobRef string `bson:"blob_ref,omitempty" json:"-"`
+	Size    int64  `bson:"size,omitempty" json:"size"`
+	// SHA-256 (hex) của ciphertext ở dạng Base64, trường được ký trong share. Rỗng khi chưa tải nội dung lên
+	CipherDigest string `bson:"cipher_digest,omitempty" json:"cipher_digest,omitempty"`
+	// Note cũ lưu ciphertext (Base64) ngay trong document, note mới để trống
+	CipherText string `bson:"cipher_text,omitempty" json:"cipher_text,omitempty"`
+	// Tên file, tiêu đề, MIME type... do client mã hóa bằng khóa AES của note (Base64), server không đọc được
+	EncryptedMetadata string `bson:"encrypted_metadata,omitempty" json:"encrypted_metadata,omitempty"`
+	// Số thứ tự phiên bản của nội dung hiện tại (note cũ không có trường này: phiên bản 1) và thời điểm tạo phiên bản đó
+	Revision  int       `bson:"revision,omitempty" json:"revision"`
+	UpdatedAt time.Time `bson:"updated_at,omitempty" json:"updated_at,omitempty"`
+	// Các phiên bản cũ (tăng dần), nội dung hiện tại nằm ở các trường phía trên
+	History []NoteRevision `bson:"history,omitempty" json:"-"`
+	// Thời điểm chuyển vào thùng rác (nil: note đang dùng), PurgeAt là lúc bị xóa hẳn (chỉ có khi trả về danh sách thùng rác)
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+	PurgeAt   *time.Time `bson:"-" json:"purge_at,omitempty"`
+}
+
+// Một phiên bản nội dung của note. Mọi phiên bản dùng chung khóa AES của note nên share không phải bọc lại khóa
+type NoteRevision struct {
+	Number            int       `bson:"number" json:"revision"`
+	BlobRef           string    `bson:"blob_ref,omitempty" json:"-"`
+	Size              int64     `bson:"size,omitempty" json:"size"`
+	CipherDigest      string    `bson:"cipher_digest,omitempty" json:"cipher_digest,omitempty"`
+	CipherText        string    `bson:"cipher_text,omitempty" json:"-"` // note cũ: ciphertext inline
+	EncryptedMetadata string    `bson:"encrypted_metadata,omitempty" json:"encrypted_metadata,omitempty"`
+	CreatedAt         time.Time `bson:"created_at,omitempty" json:"created_at,omitempty"`
+}
+
+// Note đã có nội dung (blob hoặc ciphertext inline của note cũ)
+func (n Note) HasContent() bool {
+	return n.BlobRef != "" || n.CipherText != ""
+}
+
+// Note đang nằm trong thùng rác: chủ note chỉ khôi phục hoặc xóa hẳn được, các share bị tạm ngưng
+func (n Note) InTrash() bool {
+	return n.DeletedAt != nil
+}
+
+// Số thứ tự phiên bản hiện tại
+func (n Note) CurrentRevisionNumber() int {
+	if n.Revision == 0 {
+		return 1
+	}
+	return n.Revision
+}
+
+// Phiên bản hiện tại dựng từ các trường nội dung của note
+func (n Note) CurrentRevision() NoteRevision {
+	return NoteRevision{
+		Number:            n.CurrentRevisionNumber(),
+		BlobRef:           n.BlobRef,
+		Size:              n.Size,
+		CipherDigest:      n.CipherDigest,
+		CipherText:        n.CipherText,
+		EncryptedMetadata: n.EncryptedMetadata,
+		CreatedAt:         n.UpdatedAt,
+	}
+}
+
+// Tất cả phiên bản (cũ trước, hiện tại sau cùng), rỗng nếu note chưa có nội dung
+func (n Note) Revisions() []NoteRevision {
+	if !n.HasContent() {
+		return nil
+	}
+	return append(append([]NoteRevision{}, n.History...), n.CurrentRevision())
+}
+
+// Bản sao của note với các trường nội dung thay bằng phiên bản number
+func (n Note) AtRevision(number int) (Note, bool) {
+	for _, r := range n.Revisions() {
+		if r.Number == number {
+			n.Revision = r.Number
+			n.BlobRef, n.Size, n.CipherDigest, n.CipherText = r.BlobRef, r.Size, r.CipherDigest, r.CipherText
+			n.EncryptedMetadata, n.UpdatedAt = r.EncryptedMetadata, r.CreatedAt
+			return n, true
+		}
+	}
+	return Note{}, false
 }
 
 type CreateNoteRequest struct {
 	CipherText      string `json:"cipher_text"`
 	EncryptedAesKey string `json:"encrypted_aes_key_by_K"`
 	Sender          string `json:"sender"`
+	// Metadata đã mã hóa (tùy chọn)
+	EncryptedMetadata string `json:"encrypted_metadata"`
 }
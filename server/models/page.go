@@ -0,0 +1,93 @@
+package models
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Cách sắp xếp các API liệt kê
+const (
+	SortCreated = "created" // theo thời điểm tạo (thứ tự ObjectID)
+	SortExpires = "expires" // theo thời điểm hết hạn (chỉ share), cùng hạn thì theo thời điểm tạo
+)
+
+// Lọc share nhận được theo trạng thái
+// Không có trạng thái "expired": share hết hạn không bao giờ được liệt kê, share hết lượt bị xóa ở lần truy cập cuối
+const (
+	ShareStateAll    = ""
+	ShareStateActive = "active" // còn hạn và còn lượt xem
+)
+
+var ErrInvalidCursor = errors.New("cursor không hợp lệ")
+
+// Vị trí bản ghi cuối của trang trước, gửi cho client dạng chuỗi opaque (Encode)
+type PageCursor struct {
+	Sort      string             `json:"s"`
+	ID        primitive.ObjectID `json:"id"`
+	ExpiresAt time.Time          `json:"t,omitempty"` // chỉ dùng khi Sort là SortExpires
+}
+
+func (c PageCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodePageCursor(s string) (PageCursor, error) {
+	var c PageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(raw, &c) != nil || c.ID.IsZero() {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// So sánh vị trí 2 bản ghi theo thứ tự tăng dần (-1, 0, 1)
+func (c PageCursor) Compare(o PageCursor) int {
+	if c.Sort == SortExpires {
+		if c.ExpiresAt.Before(o.ExpiresAt) {
+			return -1
+		}
+		if c.ExpiresAt.After(o.ExpiresAt) {
+			return 1
+		}
+	}
+	return bytes.Compare(c.ID[:], o.ID[:])
+}
+
+// Tham số phân trang theo cursor
+type PageQuery struct {
+	Limit int         // 0: không giới hạn (client cũ)
+	After *PageCursor // chỉ lấy các bản ghi đứng sau cursor theo thứ tự đang sắp xếp
+	Sort  string
+	Desc  bool
+}
+
+func (q PageQuery) NoteCursor(n Note) PageCursor {
+	return PageCursor{Sort: SortCreated, ID: n.ID}
+}
+
+func (q PageQuery) UrlCursor(u Url) PageCursor {
+	if q.Sort == SortExpires {
+		return PageCursor{Sort: SortExpires, ID: u.ID, ExpiresAt: u.ExpiresAt}
+	}
+	return PageCursor{Sort: SortCreated, ID: u.ID}
+}
+
+// Lọc share nhận được
+type ShareFilter struct {
+	Sender string // rỗng: mọi người gửi
+	State  string // ShareState...
+}
+
+// Share có khớp trạng thái State tại thời điểm now không
+func (f ShareFilter) MatchState(u Url, now time.Time) bool {
+	if f.State == ShareStateActive {
+		return now.Before(u.ExpiresAt) && u.Accessed < u.MaxAccess
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Refresh token lưu phía server (chỉ lưu mã băm, không lưu token gốc)
+// Mỗi lần làm mới, token cũ bị đánh dấu Used và token mới cùng FamilyID được cấp
+// Nếu một token đã Used bị dùng lại -> nghi bị đánh cắp -> thu hồi cả family
+type RefreshToken struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	TokenHash string             `bson:"token_hash" json:"-"`
+	FamilyID  string             `bson:"family_id" json:"family_id"`
+	UserID    string             `bson:"user_id" json:"user_id"`
+	Username  string             `bson:"username" json:"username"`
+	ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+	Used      bool               `bson:"used" json:"used"`
+	Revoked   bool               `bson:"revoked" json:"revoked"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Access token đã bị thu hồi trước khi hết hạn (đăng xuất)
+// Chỉ cần giữ tới thời điểm token hết hạn, sau đó Mongo tự xóa bằng TTL Index
+type RevokedToken struct {
+	JTI       string    `bson:"_id" json:"jti"`
+	ExpiresAt time.Time `bson:"expires_at" json:"expires_at"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
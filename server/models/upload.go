@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Phiên upload nội dung note theo từng chunk, client gửi lại được các chunk còn thiếu khi mất kết nối
+// Mỗi chunk đã nhận nằm trong BlobStore cho tới khi commit ghép lại thành nội dung của note
+type UploadSession struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"upload_id"`
+	NoteID    string             `bson:"note_id" json:"note_id"`
+	OwnerID   string             `bson:"owner_id" json:"-"`
+	TotalSize int64              `bson:"total_size" json:"total_size"` // byte
+	ChunkSize int64              `bson:"chunk_size" json:"chunk_size"` // byte, chunk cuối có thể ngắn hơn
+	// Chunk đã nhận: số thứ tự (dạng chuỗi thập phân) -> tham chiếu blob
+	Chunks    map[string]string `bson:"chunks" json:"-"`
+	CreatedAt time.Time         `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time         `bson:"expires_at" json:"expires_at"` // phiên bỏ dở bị services.SweepExpiredUploads dọn
+}
+
+// Số chunk của phiên
+func (u UploadSession) ChunkCount() int {
+	if u.TotalSize == 0 {
+		return 0
+	}
+	return int((u.TotalSize + u.ChunkSize - 1) / u.ChunkSize)
+}
+
+// Kích thước đúng của chunk index
+func (u UploadSession) ChunkLength(index int) int64 {
+	if index == u.ChunkCount()-1 {
+		return u.TotalSize - int64(index)*u.ChunkSize
+	}
+	return u.ChunkSize
+}
+
+type CreateUploadRequest struct {
+	TotalSize int64 `json:"total_size"`
+	ChunkSize int64 `json:"chunk_size"`
+}
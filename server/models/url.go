@@ -2,7 +2,7 @@ package models
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -11,6 +11,17 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Cách client dẫn xuất khóa dùng để bọc AES key của share
+// Server chỉ lưu lại để người nhận biết cách giải mã
+const (
+	KeySchemeLegacyDH = ""            // SHA-256(K), K từ DH group 14 (share tạo bởi client cũ)
+	KeySchemeDHHKDF   = "dh-hkdf"     // HKDF từ K của DH group 14, gắn với username người gửi và người nhận
+	KeySchemeX25519   = "x25519-hkdf" // HKDF từ X25519, gắn với username người gửi và người nhận
+	KeySchemeLink     = "link-hkdf"   // HKDF từ bí mật ngẫu nhiên nằm trong #fragment của link công khai
+	// Link có mật khẩu: bí mật của link = Argon2id(mật khẩu, bí mật trong #fragment), sau đó HKDF như link-hkdf
+	KeySchemeLinkPassword = "link-argon2id"
+)
+
 type Url struct {
 	ID                    primitive.ObjectID `bson:"_id,omitempty" json:"url_id"`
 	NoteID                string             `bson:"note_id" json:"note_id"`       // ID của ghi chú gốc
@@ -20,6 +31,95 @@ type Url struct {
 	SharedEncryptedAESKey string             `bson:"shared_encrypted_aes_key" json:"shared_encrypted_aes_key"`
 	Sender                string             `bson:"sender" json:"sender"`
 	Receiver              string             `bson:"receiver" json:"receiver"`
+	KeyScheme             string             `bson:"key_scheme" json:"key_scheme"`
+	// Chữ ký Ed25519 của người gửi (base64), rỗng với share do client cũ tạo
+	Signature string `bson:"signature,omitempty" json:"signature,omitempty"`
+	// Share gắn với 1 phiên bản của note, hoặc luôn theo phiên bản mới nhất
+	// Share tạo trước khi có phiên bản (cả 2 trường rỗng) gắn với phiên bản 1
+	Revision     int  `bson:"revision,omitempty" json:"revision,omitempty"`
+	FollowLatest bool `bson:"follow_latest,omitempty" json:"follow_latest,omitempty"`
+	// Link công khai: không có người nhận, ai có link cũng xem được (không cần đăng nhập)
+	// Khóa AES được bọc bằng khóa dẫn xuất từ bí mật trong #fragment của link, server không biết bí mật này
+	Public bool `bson:"public,omitempty" json:"public,omitempty"`
+	// Link có mật khẩu: SHA-256 (hex) của access token client dẫn xuất từ bí mật của link
+	// Mỗi lần gửi sai token tính 1 lần thử, link bị xóa khi FailedAttempts chạm MaxAttempts
+	AccessVerifier string `bson:"access_verifier,omitempty" json:"-"`
+	FailedAttempts int    `bson:"failed_attempts,omitempty" json:"failed_attempts,omitempty"`
+	MaxAttempts    int    `bson:"max_attempts,omitempty" json:"max_attempts,omitempty"`
+}
+
+// Link công khai có mật khẩu
+func (u Url) Protected() bool {
+	return u.AccessVerifier != ""
+}
+
+// Phiên bản của note mà share trỏ tới
+func (u Url) RevisionOf(note Note) int {
+	if u.FollowLatest {
+		return note.CurrentRevisionNumber()
+	}
+	if u.Revision == 0 {
+		return 1
+	}
+	return u.Revision
+}
+
+// Yêu cầu chia sẻ note cho nhiều người nhận trong 1 lần (POST /notes/:note_id/shares)
+// Hạn dùng, số lượt xem và phiên bản dùng chung, khóa AES được bọc riêng cho từng người nhận
+type CreateSharesRequest struct {
+	ExpiresIn    string           `json:"expires_in"`
+	ExpiresAt    int64            `json:"expires_at"`
+	MaxAccess    int              `json:"max_access"`
+	Revision     int              `json:"revision"`
+	FollowLatest bool             `json:"follow_latest"`
+	Shares       []ShareRecipient `json:"shares"`
+}
+
+// Khóa AES đã bọc và chữ ký của share cho 1 người nhận
+type ShareRecipient struct {
+	Receiver              string `json:"receiver"`
+	SharedEncryptedAESKey string `json:"shared_encrypted_aes_key"`
+	KeyScheme             string `json:"key_scheme"`
+	Signature             string `json:"signature"`
+}
+
+// Kết quả tạo share cho 1 người nhận
+type ShareResult struct {
+	Receiver string `json:"receiver"`
+	Status   int    `json:"status"` // mã HTTP như khi tạo share riêng lẻ
+	UrlID    string `json:"url_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Một share người gửi đã tạo cho note (GET /notes/:note_id/shares)
+type SentShareResponse struct {
+	ID           string    `json:"url_id"` // dùng cho DELETE /shares/:url_id
+	Receiver     string    `json:"receiver"`
+	CreatedAt    time.Time `json:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	MaxAccess    int       `json:"max_access"`
+	Accessed     int       `json:"accessed"` // số lượt xem đã dùng
+	Revision     int       `json:"revision"`
+	FollowLatest bool      `json:"follow_latest,omitempty"`
+	Public       bool      `json:"public,omitempty"` // link công khai (Receiver rỗng)
+	// Link có mật khẩu: số lần nhập sai đã dùng và tối đa
+	Protected      bool `json:"protected,omitempty"`
+	FailedAttempts int  `json:"failed_attempts,omitempty"`
+	MaxAttempts    int  `json:"max_attempts,omitempty"`
+}
+
+// Yêu cầu tạo link công khai (POST /notes/:note_id/links)
+// Khóa AES của note được bọc bằng khóa dẫn xuất từ bí mật của link (key scheme "link-hkdf")
+type CreateLinkRequest struct {
+	SharedEncryptedAESKey string `json:"shared_encrypted_aes_key"`
+	ExpiresIn             string `json:"expires_in"`
+	ExpiresAt             int64  `json:"expires_at"`
+	MaxAccess             int    `json:"max_access"`
+	Revision              int    `json:"revision"`
+	FollowLatest          bool   `json:"follow_latest"`
+	// Link có mật khẩu: SHA-256 (hex) của access token và số lần nhập sai tối đa (mặc định DefaultLinkMaxAttempts)
+	AccessVerifier string `json:"access_verifier"`
+	MaxAttempts    int    `json:"max_attempts"`
 }
 
 type CreateUrlRequest struct {
@@ -28,6 +128,13 @@ type CreateUrlRequest struct {
 	MaxAccess             int    `json:"max_access"` // int (Server yêu cầu số)
 	Sender                string `json:"sender"`
 	Receiver              string `json:"receiver"`
+	KeyScheme             string `json:"key_scheme"`
+	// Share có chữ ký: thời điểm hết hạn (Unix giây) nằm trong nội dung được ký nên client gửi giá trị tuyệt đối
+	ExpiresAt int64  `json:"expires_at"`
+	Signature string `json:"signature"`
+	// Phiên bản được chia sẻ (0: phiên bản hiện tại), hoặc follow_latest để luôn theo phiên bản mới nhất
+	Revision     int  `json:"revision"`
+	FollowLatest bool `json:"follow_latest"`
 }
 
 type UrlResponse struct {
@@ -37,6 +144,10 @@ type UrlResponse struct {
 	ReceiverID string    `json:"receiver"`
 	ExpiresAt  time.Time `json:"expires_at"`
 	MaxAccess  int       `json:"max_access"`
+	// Người nhận mở khóa AES của share để đọc metadata (tên file, tiêu đề) mà không tính lượt xem
+	SharedEncryptedAESKey string `json:"shared_encrypted_aes_key"`
+	KeyScheme             string `json:"key_scheme"`
+	EncryptedMetadata     string `json:"encrypted_metadata,omitempty"`
 }
 
 func CreateTTLIndex(ctx context.Context, collection *mongo.Collection) error {
@@ -48,40 +159,98 @@ func CreateTTLIndex(ctx context.Context, collection *mongo.Collection) error {
 	return err
 }
 
+// Lỗi trả về khi link không còn dùng được
+var (
+	ErrUrlExpired   = errors.New("link đã hết hạn")
+	ErrUrlExhausted = errors.New("link đã hết lượt truy cập")
+	ErrUrlLocked    = errors.New("link đã bị khóa do nhập sai mật khẩu quá nhiều lần")
+)
+
+// Bộ đếm có giới hạn của link: tăng đến giới hạn thì link bị xóa
+type UrlCounter struct {
+	Field      string // tên trường bson của bộ đếm (dùng trong truy vấn Mongo)
+	LimitField string // tên trường bson của giới hạn
+	// Con trỏ tới bộ đếm và giới hạn tương ứng của url
+	Of        func(url *Url) (*int, int)
+	Exhausted error // lỗi trả về khi đã chạm giới hạn
+}
+
+var (
+	// Lượt xem
+	UrlViews = UrlCounter{
+		Field: "accessed", LimitField: "max_access",
+		Of: func(url *Url) (*int, int) {
+			return &url.Accessed, url.MaxAccess
+		},
+		Exhausted: ErrUrlExhausted,
+	}
+	// Lượt nhập sai mật khẩu của link có mật khẩu
+	UrlFailedAttempts = UrlCounter{
+		Field: "failed_attempts", LimitField: "max_attempts",
+		Of: func(url *Url) (*int, int) {
+			return &url.FailedAttempts, url.MaxAttempts
+		},
+		Exhausted: ErrUrlLocked,
+	}
+)
+
 // Hàm xử lý truy cập (Gọi mỗi khi user xem link)
+// Kiểm tra hạn dùng, kiểm tra lượt xem và tăng view trong CÙNG MỘT thao tác nguyên tử
+// -> nhiều request đồng thời cũng không thể đọc link quá MaxAccess lần
 func AccessUrl(ctx context.Context, collection *mongo.Collection, urlID primitive.ObjectID) (*Url, error) {
+	return IncrementUrlCounter(ctx, collection, urlID, UrlViews)
+}
+
+// Tăng bộ đếm của link nếu còn hạn và chưa chạm giới hạn, xóa link khi chạm giới hạn
+func IncrementUrlCounter(ctx context.Context, collection *mongo.Collection, urlID primitive.ObjectID, counter UrlCounter) (*Url, error) {
+	now := time.Now().UTC()
+
+	// Chỉ khớp khi: còn hạn VÀ bộ đếm < giới hạn
+	filter := bson.M{
+		"_id":        urlID,
+		"expires_at": bson.M{"$gt": now},
+		"$expr":      bson.M{"$lt": bson.A{"$" + counter.Field, "$" + counter.LimitField}},
+	}
+	update := bson.M{"$inc": bson.M{counter.Field: 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
 	var url Url
-	err1 := collection.FindOne(ctx, bson.M{"_id": urlID}).Decode(&url)
-	if err1 != nil {
-		return nil, err1 // Lỗi kết nối hoặc không tìm thấy ID
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&url)
+	if err == mongo.ErrNoDocuments {
+		// Không khớp điều kiện: tìm lý do để báo lỗi và dọn link không còn dùng được
+		return nil, rejectUrl(ctx, collection, urlID, now, counter)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	// So sánh thời gian: Nếu hiện tại > thời gian hết hạn
-	if time.Now().UTC().After(url.ExpiresAt) {
-		// Xóa luôn document này
-		go func() {
-			collection.DeleteOne(context.Background(), bson.M{"_id": urlID})
-			fmt.Printf("Deleted Expired URL %s\n", urlID.Hex())
-		}()
-		return nil, fmt.Errorf("link đã hết hạn")
+	// Chạm giới hạn thì xóa (chỉ xóa khi bộ đếm >= giới hạn để không xóa nhầm)
+	if current, limit := counter.Of(&url); *current >= limit {
+		deleteExhaustedUrl(ctx, collection, urlID, counter)
 	}
 
-	// Tăng view
-	update := bson.M{"$inc": bson.M{"accessed": 1}}
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	return &url, nil
+}
 
-	err2 := collection.FindOneAndUpdate(ctx, bson.M{"_id": urlID}, update, opts).Decode(&url)
-	if err2 != nil {
-		return nil, err2
+// Xác định vì sao link bị từ chối, đồng thời xóa link nếu đã hết hạn hoặc chạm giới hạn
+func rejectUrl(ctx context.Context, collection *mongo.Collection, urlID primitive.ObjectID, now time.Time, counter UrlCounter) error {
+	var url Url
+	if err := collection.FindOne(ctx, bson.M{"_id": urlID}).Decode(&url); err != nil {
+		return err // Lỗi kết nối hoặc không tìm thấy ID
 	}
 
-	// Logic xóa nếu vượt quá giới hạn
-	if url.Accessed >= url.MaxAccess {
-		go func() {
-			collection.DeleteOne(context.Background(), bson.M{"_id": urlID})
-			fmt.Printf("Deleted URL %s (Limit reached)\n", urlID.Hex())
-		}()
+	if !now.Before(url.ExpiresAt) {
+		collection.DeleteOne(ctx, bson.M{"_id": urlID, "expires_at": bson.M{"$lte": now}})
+		return ErrUrlExpired
 	}
 
-	return &url, nil
+	deleteExhaustedUrl(ctx, collection, urlID, counter)
+	return counter.Exhausted
+}
+
+func deleteExhaustedUrl(ctx context.Context, collection *mongo.Collection, urlID primitive.ObjectID, counter UrlCounter) {
+	collection.DeleteOne(ctx, bson.M{
+		"_id":   urlID,
+		"$expr": bson.M{"$gte": bson.A{"$" + counter.Field, "$" + counter.LimitField}},
+	})
 }
@@ -4,6 +4,12 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Loại khóa trao đổi (public key) của user
+const (
+	KeyTypeDH     = "dh-group14" // Diffie-Hellman RFC 3526 group 14 (khóa cũ, rỗng cũng là loại này)
+	KeyTypeX25519 = "x25519"
+)
+
 type User struct {
 	ID                primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Username          string             `bson:"username" json:"username"`
@@ -11,16 +17,78 @@ type User struct {
 	Salt              string             `bson:"salt" json:"salt"`
 	EncryptedPrivKey  string             `bson:"encrypted_privKey" json:"encrypted_privKey"`
 	PubKey            string             `bson:"pubKey" json:"pubKey"`
+	PubKeyType        string             `bson:"pubKey_type" json:"pubKey_type"`
+	// Khóa DH cũ được giữ lại sau khi nâng cấp lên X25519 để còn đọc được các share cũ
+	LegacyPubKey           string `bson:"legacy_pubKey,omitempty" json:"legacy_pubKey,omitempty"`
+	EncryptedLegacyPrivKey string `bson:"encrypted_legacy_privKey,omitempty" json:"encrypted_legacy_privKey,omitempty"`
+	// Khóa Ed25519 dùng để ký các share đã gửi (user cũ có thể chưa có)
+	SigningPubKey           string `bson:"signing_pubKey,omitempty" json:"signing_pubKey,omitempty"`
+	EncryptedSigningPrivKey string `bson:"encrypted_signing_privKey,omitempty" json:"encrypted_signing_privKey,omitempty"`
+	// Tăng lên mỗi khi "đăng xuất khỏi mọi thiết bị", access token mang thế hệ cũ bị từ chối
+	TokenVersion int `bson:"token_version" json:"-"`
+}
+
+// Loại khóa của user, user cũ chưa có trường này là DH
+func (u User) KeyType() string {
+	if u.PubKeyType == "" {
+		return KeyTypeDH
+	}
+	return u.PubKeyType
 }
 
+// KeyID: ID khóa RSA của server mà client đã dùng để mã hóa password (rỗng = khóa hiện hành)
 type RegisterRequest struct {
 	Username         string `json:"username"`
 	Password         string `json:"password"`
+	KeyID            string `json:"key_id"`
 	PublicKey        string `json:"public_key"`
+	PublicKeyType    string `json:"public_key_type"` // rỗng = dh-group14 (client cũ)
 	EncryptedPrivKey string `json:"encrypted_privKey"`
+	// Khóa ký Ed25519 (client cũ không gửi)
+	SigningPublicKey        string `json:"signing_public_key"`
+	EncryptedSigningPrivKey string `json:"encrypted_signing_privKey"`
 }
 
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	KeyID    string `json:"key_id"`
+}
+
+// Khóa AES của 1 note đã được client bọc lại bằng mật khẩu mới
+type NoteKeyUpdate struct {
+	NoteID          string `json:"note_id"`
+	EncryptedAesKey string `json:"encrypted_aes_key"`
+}
+
+// Mật khẩu cũ/mới được mã hóa RSA/OAEP như lúc đăng nhập
+// Client phải gửi lại khóa AES của TẤT CẢ note mình sở hữu, bọc bằng mật khẩu mới
+type ChangePasswordRequest struct {
+	OldPassword      string `json:"old_password"`
+	NewPassword      string `json:"new_password"`
+	KeyID            string `json:"key_id"`
+	EncryptedPrivKey string `json:"encrypted_privKey"`
+	// Bắt buộc nếu user còn giữ khóa DH cũ
+	EncryptedLegacyPrivKey string `json:"encrypted_legacy_privKey"`
+	// Bắt buộc nếu user đã có khóa ký
+	EncryptedSigningPrivKey string          `json:"encrypted_signing_privKey"`
+	NoteKeys                []NoteKeyUpdate `json:"note_keys"`
+}
+
+// Nâng cấp khóa trao đổi từ DH lên X25519
+// Khóa DH hiện tại được chuyển thành khóa cũ (legacy) chứ không bị xóa
+type UpgradeKeyRequest struct {
+	Password         string `json:"password"`
+	KeyID            string `json:"key_id"`
+	PublicKey        string `json:"public_key"`
+	PublicKeyType    string `json:"public_key_type"`
+	EncryptedPrivKey string `json:"encrypted_privKey"`
+}
+
+// Thêm khóa ký Ed25519 cho user tạo trước khi có chữ ký share
+type SigningKeyRequest struct {
+	Password                string `json:"password"`
+	KeyID                   string `json:"key_id"`
+	SigningPublicKey        string `json:"signing_public_key"`
+	EncryptedSigningPrivKey string `json:"encrypted_signing_privKey"`
 }
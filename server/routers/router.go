@@ -20,28 +20,98 @@ func SetupRouter() *gin.Engine {
 			auth.POST("/register", handlers.RegisterHandler)
 			// API yêu cầu đăng nhập
 			auth.POST("/login", handlers.LoginHandler)
+			// API yêu cầu cấp lại access token bằng refresh token
+			auth.POST("/refresh", handlers.RefreshHandler)
 			// API yêu cầu lấy pubKey RSA của server
 			auth.GET("/server-public-key-rsa", handlers.GetServerPublicKeyRSA)
 			// API yêu cầu lấy pubKey của client khác
 			auth.GET("/users/:username/pubkey", handlers.GetUserPublicKey)
 		}
 
+		// group key transparency log (công khai, ai cũng kiểm tra được)
+		keyLog := api.Group("/log")
+		{
+			// API lấy public key dùng để ký tree head
+			keyLog.GET("/public-key", handlers.GetLogPublicKey)
+			// API lấy Signed Tree Head mới nhất
+			keyLog.GET("/sth", handlers.GetSignedTreeHead)
+			// API lấy 1 entry của log
+			keyLog.GET("/entries/:index", handlers.GetLogEntry)
+			// API lấy inclusion proof
+			keyLog.GET("/proof/inclusion", handlers.GetInclusionProof)
+			// API lấy consistency proof
+			keyLog.GET("/proof/consistency", handlers.GetConsistencyProof)
+		}
+
+		// group link công khai (không cần đăng nhập, bí mật để giải mã nằm trong #fragment của link)
+		links := api.Group("/links/:url_id", middlewares.ValidatePublicLink())
+		{
+			// Metadata của link (không tính lượt xem)
+			links.GET("", handlers.ViewLinkMetaHandler)
+			// Nội dung binary (tính 1 lượt xem)
+			links.GET("/content", handlers.DownloadSharedNoteHandler)
+		}
+
 		// group cần đăng nhập
 		protected := api.Group("/")
 		protected.Use(middlewares.AuthMiddleware())
 		{
+			// API đăng xuất phiên hiện tại
+			protected.POST("/auth/logout", handlers.LogoutHandler)
+			// API đăng xuất khỏi mọi thiết bị
+			protected.POST("/auth/logout-all", handlers.LogoutAllHandler)
+			// API đổi mật khẩu (client gửi kèm khóa note đã bọc lại)
+			protected.POST("/auth/change-password", handlers.ChangePasswordHandler)
+			// API nâng cấp khóa trao đổi DH lên X25519
+			protected.POST("/auth/upgrade-key", handlers.UpgradeKeyHandler)
+			// API thêm khóa ký Ed25519 cho tài khoản cũ
+			protected.POST("/auth/signing-key", handlers.SigningKeyHandler)
+
 			// Gom nhóm liên quan đến Notes: /api/notes
 			noteRoutes := protected.Group("/notes")
 			{
 				// POST /notes
 				noteRoutes.POST("", middlewares.ValidateCreateNote(), handlers.CreateNote)
 
+				// PUT /notes/:note_id/content (nội dung đã mã hóa dạng binary)
+				noteRoutes.PUT("/:note_id/content", middlewares.ValidateNoteOwner(), middlewares.ValidateUploadContent(), handlers.UploadNoteContent)
+
+				// GET /notes/:note_id (metadata và khóa AES đã bọc của note do mình sở hữu)
+				noteRoutes.GET("/:note_id", middlewares.ValidateNoteOwner(), handlers.GetNote)
+
+				// GET /notes/:note_id/content
+				noteRoutes.GET("/:note_id/content", middlewares.ValidateNoteOwner(), handlers.DownloadNoteContent)
+
+				// PUT /notes/:note_id (nội dung mới thành phiên bản mới, giữ lại các phiên bản cũ)
+				noteRoutes.PUT("/:note_id", middlewares.ValidateNoteOwner(), middlewares.ValidateUploadContent(), middlewares.ValidateUpdateNote(), handlers.UpdateNote)
+
+				// GET /notes/:note_id/revisions
+				noteRoutes.GET("/:note_id/revisions", middlewares.ValidateNoteOwner(), handlers.ListRevisions)
+
+				// GET /notes/:note_id/revisions/:revision/content
+				noteRoutes.GET("/:note_id/revisions/:revision/content", middlewares.ValidateNoteOwner(), middlewares.ValidateRevision(), handlers.DownloadRevisionContent)
+
+				// POST /notes/:note_id/revisions/:revision/restore
+				noteRoutes.POST("/:note_id/revisions/:revision/restore", middlewares.ValidateNoteOwner(), middlewares.ValidateRevision(), handlers.RestoreRevision)
+
+				// POST /notes/:note_id/uploads (mở phiên upload nội dung theo từng chunk, gửi lại được khi mất kết nối)
+				noteRoutes.POST("/:note_id/uploads", middlewares.ValidateNoteOwner(), middlewares.ValidateCreateUpload(), handlers.CreateUpload)
+
 				// DELETE /notes/:note_id
 				noteRoutes.DELETE("/:note_id", middlewares.ValidateDeleteNote(), handlers.DeleteNote)
 
 				// DELETE /notes/shared/:note_id
 				noteRoutes.DELETE("/shared/:note_id", middlewares.ValidateDeleteSharedNote(), handlers.DeleteSharedNote)
 
+				// GET /notes/trash (note đã xóa, khôi phục được trong thời hạn TRASH_RETENTION)
+				noteRoutes.GET("/trash", handlers.GetTrash)
+
+				// POST /notes/trash/:note_id/restore
+				noteRoutes.POST("/trash/:note_id/restore", middlewares.ValidateTrashedNote(), handlers.RestoreNote)
+
+				// DELETE /notes/trash/:note_id (xóa vĩnh viễn)
+				noteRoutes.DELETE("/trash/:note_id", middlewares.ValidateTrashedNote(), handlers.PurgeNote)
+
 				// GET /notes/owned
 				noteRoutes.GET("/owned", middlewares.ValidateGetOwnedNotes(), handlers.GetOwnedNotes)
 
@@ -54,10 +124,75 @@ func SetupRouter() *gin.Engine {
 				// Có thêm middleware: ValidateCreateUrl (check chủ sở hữu, check metadata)
 				noteRoutes.POST("/:note_id/url", middlewares.ValidateCreateUrl(), handlers.CreateNoteUrl)
 
+				// POST /notes/:note_id/shares (chia sẻ cho nhiều người nhận, kết quả riêng cho từng người)
+				noteRoutes.POST("/:note_id/shares", middlewares.ValidateCreateShares(), handlers.CreateNoteShares)
+
+				// POST /notes/:note_id/links (link công khai, ai có link cũng xem được)
+				noteRoutes.POST("/:note_id/links", middlewares.ValidateCreateLink(), handlers.CreateNoteLink)
+
+				// GET /notes/:note_id/shares (người nhận, hạn dùng, lượt xem đã dùng của từng share)
+				noteRoutes.GET("/:note_id/shares", middlewares.ValidateNoteOwner(), handlers.ListNoteShares)
+
 				//Nếu muốn xem thì cần tìm 1 url sẵn trước thì mới được truy cập
 				noteRoutes.GET("/:note_id/url", middlewares.ValidateNote(), handlers.GetNoteUrl)
 			}
+			// Gom nhóm phiên upload: /uploads
+			uploadRoutes := protected.Group("/uploads/:upload_id", middlewares.ValidateUploadSession())
+			{
+				// GET /uploads/:upload_id (các chunk đã nhận)
+				uploadRoutes.GET("", handlers.GetUploadStatus)
+
+				// PUT /uploads/:upload_id/chunks/:index
+				uploadRoutes.PUT("/chunks/:index", middlewares.ValidateUploadChunk(), handlers.UploadChunk)
+
+				// POST /uploads/:upload_id/commit
+				uploadRoutes.POST("/commit", handlers.CommitUpload)
+			}
+
+			// Gom nhóm người dùng: /groups
+			groupRoutes := protected.Group("/groups")
+			{
+				// POST /groups (người tạo là owner, gửi kèm khóa nhóm bọc cho chính mình)
+				groupRoutes.POST("", middlewares.ValidateCreateGroup(), handlers.CreateGroup)
+
+				// GET /groups (các nhóm mình là thành viên)
+				groupRoutes.GET("", handlers.ListGroups)
+
+				// Các API dưới đây chỉ dành cho thành viên của nhóm
+				group := groupRoutes.Group("/:group_id", middlewares.ValidateGroupMember())
+
+				// GET /groups/:group_id (thành viên, vai trò và khóa nhóm bọc cho mình)
+				group.GET("", handlers.GetGroup)
+
+				// POST /groups/:group_id/members
+				group.POST("/members", middlewares.ValidateAddGroupMember(), handlers.AddGroupMember)
+
+				// PUT /groups/:group_id/members/:username (đổi vai trò)
+				group.PUT("/members/:username", middlewares.ValidateSetGroupRole(), handlers.SetGroupMemberRole)
+
+				// DELETE /groups/:group_id/members/:username (xóa thành viên và xoay khóa nhóm)
+				group.DELETE("/members/:username", middlewares.ValidateRemoveGroupMember(), handlers.RemoveGroupMember)
+
+				// GET /groups/:group_id/notes
+				group.GET("/notes", handlers.ListGroupNotes)
+
+				// POST /groups/:group_id/notes/:note_id (chia sẻ note của mình cho nhóm)
+				group.POST("/notes/:note_id", middlewares.ValidateShareToGroup(), handlers.ShareNoteToGroup)
+
+				// GET /groups/:group_id/notes/:note_id/content
+				group.GET("/notes/:note_id/content", middlewares.ValidateGroupNote(), handlers.DownloadGroupNoteContent)
+
+				// DELETE /groups/:group_id/notes/:note_id (gỡ note khỏi nhóm)
+				group.DELETE("/notes/:note_id", middlewares.ValidateGroupNote(), middlewares.ValidateUnshareFromGroup(), handlers.UnshareNoteFromGroup)
+			}
+
+			// DELETE /shares/:url_id (thu hồi share của 1 người nhận)
+			protected.DELETE("/shares/:url_id", middlewares.ValidateShareSender(), handlers.RevokeShare)
+
 			protected.GET("/note/:url_id", middlewares.ValidateUrl(), handlers.ViewNoteHandler)
+			// Metadata của share (không tính lượt xem) và nội dung binary (tính 1 lượt xem)
+			protected.GET("/note/:url_id/meta", middlewares.ValidateUrl(), handlers.ViewNoteMetaHandler)
+			protected.GET("/note/:url_id/content", middlewares.ValidateUrl(), handlers.DownloadSharedNoteHandler)
 		}
 	}
 	return r
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"note_sharing_application/server/utils"
+)
+
+/*
+	Đổi mật khẩu
+	Private key và khóa AES của mọi note đều được bọc bằng mật khẩu ở phía client,
+	nên client tự giải mã bằng mật khẩu cũ và bọc lại bằng mật khẩu mới rồi gửi lên.
+	Server kiểm tra mật khẩu cũ, sau đó thay hash đăng nhập, private key và khóa của từng note
+	trong cùng 1 transaction: hoặc đổi hết, hoặc không đổi gì
+	Đổi mật khẩu xong thì mọi phiên đăng nhập cũ bị thu hồi
+*/
+
+var (
+	ErrWrongPassword      = errors.New("mật khẩu cũ không đúng")
+	ErrNoteKeysMismatch   = errors.New("danh sách khóa note không khớp với các note đang sở hữu")
+	ErrLegacyKeyMissing   = errors.New("thiếu khóa DH cũ đã bọc lại bằng mật khẩu mới")
+	ErrKeyAlreadyUpgraded = errors.New("khóa của user đã được nâng cấp")
+	ErrUnsupportedKeyType = errors.New("loại khóa không được hỗ trợ")
+	ErrSigningKeyMissing  = errors.New("thiếu khóa ký đã bọc lại bằng mật khẩu mới")
+	ErrSigningKeyExists   = errors.New("user đã có khóa ký")
+	ErrInvalidSigningKey  = errors.New("khóa ký Ed25519 không hợp lệ")
+	ErrInvalidPublicKey   = errors.New("public key X25519 không hợp lệ")
+)
+
+func ChangePassword(userID, username, oldPassword, newPassword, encryptedPrivKey, encryptedLegacyPrivKey, encryptedSigningPrivKey string, noteKeys []models.NoteKeyUpdate) error {
+	ctx := context.TODO()
+
+	user, err := stores.Users.FindByUsername(ctx, username)
+	if errors.Is(err, stores.ErrNotFound) {
+		return ErrWrongPassword
+	}
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(oldPassword, user.Salt, user.EncryptedPassword) {
+		return ErrWrongPassword
+	}
+
+	// User đã nâng cấp lên X25519 còn giữ khóa DH cũ, khóa này cũng phải được bọc lại
+	if user.EncryptedLegacyPrivKey == "" {
+		encryptedLegacyPrivKey = ""
+	} else if encryptedLegacyPrivKey == "" {
+		return ErrLegacyKeyMissing
+	}
+	// Khóa ký cũng được bọc bằng mật khẩu
+	if user.EncryptedSigningPrivKey == "" {
+		encryptedSigningPrivKey = ""
+	} else if encryptedSigningPrivKey == "" {
+		return ErrSigningKeyMissing
+	}
+
+	salt, err := utils.GenerateSalt()
+	if err != nil {
+		return err
+	}
+	hashPassword := utils.HashPassword(newPassword, salt)
+
+	return stores.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		// Kiểm tra trong transaction để note vừa tạo xen giữa không bị bỏ sót
+		if err := checkNoteKeysCoverOwned(ctx, userID, noteKeys); err != nil {
+			return err
+		}
+
+		if err := stores.Users.UpdateCredentials(ctx, username, hashPassword, salt, encryptedPrivKey, encryptedLegacyPrivKey, encryptedSigningPrivKey); err != nil {
+			return err
+		}
+		for _, k := range noteKeys {
+			err := stores.Notes.UpdateEncryptedKey(ctx, k.NoteID, userID, k.EncryptedAesKey)
+			if errors.Is(err, stores.ErrNotFound) || errors.Is(err, stores.ErrInvalidID) {
+				return ErrNoteKeysMismatch
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := stores.Users.IncrementTokenVersion(ctx, username); err != nil {
+			return err
+		}
+		return stores.Tokens.RevokeUser(ctx, userID)
+	})
+}
+
+// Mỗi note đang sở hữu phải có đúng 1 khóa mới, không thừa không thiếu
+func checkNoteKeysCoverOwned(ctx context.Context, userID string, noteKeys []models.NoteKeyUpdate) error {
+	owned, err := stores.Notes.ListByOwner(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(owned) != len(noteKeys) {
+		return ErrNoteKeysMismatch
+	}
+
+	pending := make(map[string]bool, len(owned))
+	for _, n := range owned {
+		pending[n.ID.Hex()] = true
+	}
+	for _, k := range noteKeys {
+		if !pending[k.NoteID] || k.EncryptedAesKey == "" {
+			return ErrNoteKeysMismatch
+		}
+		delete(pending, k.NoteID)
+	}
+	return nil
+}
+
+// Nâng cấp khóa trao đổi của user từ DH lên X25519 (cần mật khẩu)
+// Khóa DH vẫn được giữ lại (legacy) để đọc các share cũ
+func UpgradeKey(username, password, pubKey, keyType, encryptedPrivKey string) error {
+	ctx := context.TODO()
+
+	if keyType != models.KeyTypeX25519 || encryptedPrivKey == "" {
+		return ErrUnsupportedKeyType
+	}
+	if !utils.ValidX25519PublicKey(pubKey) {
+		return ErrInvalidPublicKey
+	}
+
+	user, err := stores.Users.FindByUsername(ctx, username)
+	if errors.Is(err, stores.ErrNotFound) {
+		return ErrWrongPassword
+	}
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(password, user.Salt, user.EncryptedPassword) {
+		return ErrWrongPassword
+	}
+
+	// Đổi khóa và ghi khóa mới vào key transparency log trong cùng transaction
+	return stores.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		err := stores.Users.UpgradeKey(ctx, username, pubKey, keyType, encryptedPrivKey)
+		if errors.Is(err, stores.ErrNotFound) {
+			return ErrKeyAlreadyUpgraded
+		}
+		if err != nil {
+			return err
+		}
+
+		upgraded, err := stores.Users.FindByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+		_, err = AppendKeyLog(ctx, upgraded)
+		return err
+	})
+}
+
+// Thêm khóa ký Ed25519 cho user chưa có (tài khoản tạo trước khi có chữ ký share)
+// Khóa ký là 1 lần đổi khóa nên cũng được ghi vào key transparency log
+func SetSigningKey(username, password, signingPubKey, encryptedSigningPrivKey string) error {
+	ctx := context.TODO()
+
+	if !utils.ValidEd25519PublicKey(signingPubKey) || encryptedSigningPrivKey == "" {
+		return ErrInvalidSigningKey
+	}
+
+	user, err := stores.Users.FindByUsername(ctx, username)
+	if errors.Is(err, stores.ErrNotFound) {
+		return ErrWrongPassword
+	}
+	if err != nil {
+		return err
+	}
+	if !utils.CheckPasswordHash(password, user.Salt, user.EncryptedPassword) {
+		return ErrWrongPassword
+	}
+
+	return stores.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		err := stores.Users.SetSigningKey(ctx, username, signingPubKey, encryptedSigningPrivKey)
+		if errors.Is(err, stores.ErrNotFound) {
+			return ErrSigningKeyExists
+		}
+		if err != nil {
+			return err
+		}
+
+		updated, err := stores.Users.FindByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+		_, err = AppendKeyLog(ctx, updated)
+		return err
+	})
+}
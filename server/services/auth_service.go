@@ -1,8 +1,11 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
 	"os"
 	"time"
 
@@ -13,16 +16,16 @@ import (
 	Access Token dùng để xác thực người dùng với thông tin (user_id và username) được gói trong Claims
 	Khi người dùng xác thực thành công thông tin đăng nhập sẽ gửi kèm Access Token về cho người dùng
 	Mỗi khi người dùng gọi API cần phải có token xác thực để server biết có đúng người dùng hay không
-	Nếu token hết hạn, phải đăng nhập lại để nhận access token mới
-
-	**Chú ý bên client cần xử lý khi access token hết hạn tránh gây khó khăn khi đang sử dụng
-	mà hết hạn access token
+	Nếu token hết hạn, client dùng refresh token (refresh_service.go) để xin access token mới
+	mà không phải đăng nhập lại
 */
 
 // Định nghĩa một JWTClaims với thông tin user và thông tin chuẩn của Claims
+// Generation là thế hệ token của user lúc cấp, ID (jti) dùng để thu hồi riêng token này
 type authClaims struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
+	UserID     string `json:"user_id"`
+	Username   string `json:"username"`
+	Generation int    `json:"gen"`
 	jwt.RegisteredClaims
 }
 
@@ -33,15 +36,23 @@ func getSecretKey() []byte {
 }
 
 // Tạo access token xác thực khi đăng nhập thành công
-func GenerateAuthJWT(userID, username string) (string, error) {
+func GenerateAuthJWT(userID, username string, generation int) (string, error) {
 	//Quy định thời gian hết hạn của token
 	expirationTime := time.Now().Add(15 * time.Minute)
 
+	//Mỗi token có 1 ID ngẫu nhiên để có thể thu hồi khi đăng xuất
+	jti, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+
 	//Ghi nội dung cho claims
 	claims := &authClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:     userID,
+		Username:   username,
+		Generation: generation,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -83,3 +94,67 @@ func ValidateAuthJWT(tokenString string) (*authClaims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+var ErrTokenRevoked = errors.New("token đã bị thu hồi")
+
+// Kiểm tra token (đã đúng chữ ký) có bị thu hồi hay không
+// Bị thu hồi khi: jti nằm trong danh sách đăng xuất, hoặc thế hệ token cũ hơn thế hệ hiện tại của user
+func CheckTokenRevoked(claims *authClaims) error {
+	ctx := context.TODO()
+
+	revoked, err := stores.Tokens.IsAccessTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+
+	user, err := stores.Users.FindByUsername(ctx, claims.Username)
+	if errors.Is(err, stores.ErrNotFound) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return err
+	}
+	if user.ID.Hex() != claims.UserID || user.TokenVersion != claims.Generation {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// Đăng xuất phiên hiện tại: thu hồi access token (theo jti) và refresh token đi kèm (nếu có)
+func Logout(userID, jti string, expiresAt time.Time, refreshToken string) error {
+	ctx := context.TODO()
+
+	err := stores.Tokens.RevokeAccessToken(ctx, models.RevokedToken{JTI: jti, ExpiresAt: expiresAt})
+	if err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	stored, err := stores.Tokens.FindByHash(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, stores.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Chỉ thu hồi refresh token của chính user đang đăng xuất
+	if stored.UserID != userID {
+		return nil
+	}
+	return stores.Tokens.RevokeFamily(ctx, stored.FamilyID)
+}
+
+// Đăng xuất khỏi mọi thiết bị: tăng thế hệ token và thu hồi toàn bộ refresh token của user
+func LogoutAll(userID, username string) error {
+	ctx := context.TODO()
+
+	if _, err := stores.Users.IncrementTokenVersion(ctx, username); err != nil {
+		return err
+	}
+	return stores.Tokens.RevokeUser(ctx, userID)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+)
+
+// Kết quả kiểm tra tính nhất quán giữa notes, urls, group_shares và users
+type ConsistencyReport struct {
+	// Share trỏ tới note không còn tồn tại
+	OrphanShares []string `json:"orphan_shares"`
+	// Share cho nhóm trỏ tới note không còn tồn tại
+	OrphanGroupShares []string `json:"orphan_group_shares"`
+	// Note có owner không còn tồn tại
+	OwnerlessNotes []string `json:"ownerless_notes"`
+	// Đã sửa (xóa) các bản ghi trên hay chưa
+	Repaired bool `json:"repaired"`
+}
+
+func (r ConsistencyReport) Consistent() bool {
+	return len(r.OrphanShares) == 0 && len(r.OrphanGroupShares) == 0 && len(r.OwnerlessNotes) == 0
+}
+
+// Tìm share mồ côi (cả share cho nhóm) và note không có owner (dữ liệu cũ từ trước khi xóa theo transaction)
+// repair: xóa share mồ côi, xóa hẳn note không có owner cùng share và nội dung của nó
+func CheckConsistency(repair bool) (ConsistencyReport, error) {
+	ctx := context.TODO()
+	report := ConsistencyReport{OrphanShares: []string{}, OrphanGroupShares: []string{}, OwnerlessNotes: []string{}}
+
+	// Đọc share -> note -> user: bản ghi tạo xen giữa luôn thấy được bản ghi cha của nó,
+	// nên không bị nhận nhầm là mồ côi
+	shares, err := stores.Shares.List(ctx)
+	if err != nil {
+		return report, err
+	}
+	groupShares, err := stores.Groups.ListAllShares(ctx)
+	if err != nil {
+		return report, err
+	}
+	notes, err := stores.Notes.List(ctx)
+	if err != nil {
+		return report, err
+	}
+	users, err := stores.Users.List(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	userIDs := make(map[string]bool, len(users))
+	for _, u := range users {
+		userIDs[u.ID.Hex()] = true
+	}
+	noteIDs := make(map[string]bool, len(notes))
+	for _, n := range notes {
+		noteIDs[n.ID.Hex()] = true
+		if !userIDs[n.OwnerID] {
+			report.OwnerlessNotes = append(report.OwnerlessNotes, n.ID.Hex())
+		}
+	}
+	for _, u := range shares {
+		if !noteIDs[u.NoteID] {
+			report.OrphanShares = append(report.OrphanShares, u.ID.Hex())
+		}
+	}
+	for _, gs := range groupShares {
+		if !noteIDs[gs.NoteID] {
+			report.OrphanGroupShares = append(report.OrphanGroupShares, gs.ID.Hex())
+		}
+	}
+
+	if !repair {
+		return report, nil
+	}
+
+	for _, urlID := range report.OrphanShares {
+		// Share có thể vừa hết hạn/hết lượt và tự bị xóa
+		if err := stores.Shares.Delete(ctx, urlID); err != nil && !errors.Is(err, stores.ErrNotFound) {
+			return report, err
+		}
+	}
+	for _, shareID := range report.OrphanGroupShares {
+		if err := stores.Groups.DeleteShare(ctx, shareID); err != nil && !errors.Is(err, stores.ErrNotFound) {
+			return report, err
+		}
+	}
+	for _, noteID := range report.OwnerlessNotes {
+		err := purgeNote(noteID, func(models.Note) error { return nil })
+		if err != nil && !errors.Is(err, stores.ErrNotFound) {
+			return report, err
+		}
+	}
+	report.Repaired = true
+	return report, nil
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+)
+
+/*
+	Chia sẻ note cho nhóm
+	Khóa nhóm (AES) do client sinh ra và bọc riêng cho từng thành viên bằng khóa chung DH/X25519,
+	khóa AES của note chia sẻ cho nhóm được bọc bằng khóa nhóm, nên server không đọc được nội dung.
+	Thành viên mới nhận khóa nhóm hiện tại nên đọc được cả các note đã chia sẻ trước đó.
+	Xóa thành viên thì khóa nhóm được xoay: client gửi khóa mới cho mọi thành viên còn lại
+	và khóa của mọi note trong nhóm bọc lại bằng khóa mới, server thay tất cả trong 1 transaction
+*/
+
+var (
+	ErrGroupKeyChanged     = errors.New("khóa nhóm đã được xoay hoặc thành viên đã thay đổi, hãy tải lại nhóm rồi thử lại")
+	ErrGroupMembersChanged = errors.New("danh sách khóa không khớp với các thành viên còn lại của nhóm")
+	ErrGroupSharesChanged  = errors.New("danh sách khóa không khớp với các note đã chia sẻ cho nhóm")
+	ErrGroupNoteShared     = errors.New("note đã được chia sẻ cho nhóm này")
+)
+
+// Tạo nhóm với người tạo là owner, khóa nhóm bắt đầu từ phiên bản 1
+func CreateGroup(name, owner, wrappedKey, keyScheme string) (string, error) {
+	group := models.Group{
+		Name:       name,
+		KeyVersion: 1,
+		Members: []models.GroupMember{{
+			Username:   owner,
+			Role:       models.GroupRoleOwner,
+			WrappedKey: wrappedKey,
+			WrappedBy:  owner,
+			KeyScheme:  keyScheme,
+		}},
+	}
+	return stores.Groups.Create(context.TODO(), group)
+}
+
+// Các nhóm username là thành viên
+func ListGroups(username string) ([]models.Group, error) {
+	return stores.Groups.ListByMember(context.TODO(), username)
+}
+
+// Thêm thành viên mang khóa nhóm phiên bản keyVersion do người thêm bọc
+func AddGroupMember(groupID string, keyVersion int, member models.GroupMember) error {
+	err := stores.Groups.AddMember(context.TODO(), groupID, keyVersion, member)
+	if errors.Is(err, stores.ErrNotFound) {
+		// Khóa vừa được xoay, hoặc user vừa được người khác thêm vào
+		return ErrGroupKeyChanged
+	}
+	return err
+}
+
+func SetGroupMemberRole(groupID, username, role string) error {
+	return stores.Groups.SetMemberRole(context.TODO(), groupID, username, role)
+}
+
+// Xóa removed khỏi nhóm và xoay khóa nhóm từ phiên bản keyVersion
+// memberKeys phải có đúng 1 khóa cho mỗi thành viên còn lại, shareKeys đúng 1 khóa cho mỗi note của nhóm
+func RemoveGroupMember(groupID, removed, wrappedBy string, keyVersion int, memberKeys []models.GroupMemberKey, shareKeys []models.GroupShareKey) error {
+	return stores.Tx.WithTransaction(context.TODO(), func(ctx context.Context) error {
+		// Kiểm tra trong transaction để thành viên/note vừa thêm xen giữa không bị bỏ sót
+		group, err := stores.Groups.FindByID(ctx, groupID)
+		if err != nil {
+			return err
+		}
+		if group.KeyVersion != keyVersion {
+			return ErrGroupKeyChanged
+		}
+
+		members, err := rotatedMembers(group, removed, wrappedBy, memberKeys)
+		if err != nil {
+			return err
+		}
+		if err := checkShareKeysCoverGroup(ctx, groupID, shareKeys); err != nil {
+			return err
+		}
+
+		err = stores.Groups.RotateKey(ctx, groupID, keyVersion, members)
+		if errors.Is(err, stores.ErrNotFound) {
+			return ErrGroupKeyChanged
+		}
+		if err != nil {
+			return err
+		}
+		for _, k := range shareKeys {
+			if err := stores.Groups.UpdateShareKey(ctx, k.ShareID, keyVersion+1, k.EncryptedAESKey); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Thành viên còn lại (giữ nguyên vai trò) với khóa nhóm mới do wrappedBy bọc
+func rotatedMembers(group models.Group, removed, wrappedBy string, memberKeys []models.GroupMemberKey) ([]models.GroupMember, error) {
+	keys := make(map[string]models.GroupMemberKey, len(memberKeys))
+	for _, k := range memberKeys {
+		keys[k.Username] = k
+	}
+	if len(keys) != len(memberKeys) || len(keys) != len(group.Members)-1 {
+		return nil, ErrGroupMembersChanged
+	}
+
+	members := make([]models.GroupMember, 0, len(keys))
+	for _, m := range group.Members {
+		if m.Username == removed {
+			continue
+		}
+		k, ok := keys[m.Username]
+		if !ok {
+			return nil, ErrGroupMembersChanged
+		}
+		m.WrappedKey, m.WrappedBy, m.KeyScheme = k.WrappedKey, wrappedBy, k.KeyScheme
+		members = append(members, m)
+	}
+	return members, nil
+}
+
+// Mọi note của nhóm đều có khóa mới, không thừa không thiếu
+func checkShareKeysCoverGroup(ctx context.Context, groupID string, shareKeys []models.GroupShareKey) error {
+	shares, err := stores.Groups.ListShares(ctx, groupID)
+	if err != nil {
+		return err
+	}
+	if len(shares) != len(shareKeys) {
+		return ErrGroupSharesChanged
+	}
+
+	ids := make(map[string]bool, len(shareKeys))
+	for _, k := range shareKeys {
+		ids[k.ShareID] = true
+	}
+	for _, s := range shares {
+		if !ids[s.ID.Hex()] {
+			return ErrGroupSharesChanged
+		}
+	}
+	return nil
+}
+
+// Chia sẻ note cho nhóm, khóa AES của note đã được bọc bằng khóa nhóm phiên bản keyVersion
+func ShareNoteToGroup(group models.Group, noteID, sender, encryptedAESKey string, keyVersion int) (string, error) {
+	ctx := context.TODO()
+	if keyVersion != group.KeyVersion {
+		return "", ErrGroupKeyChanged
+	}
+
+	// Unique index (group_id, note_id) chặn cả 2 request đồng thời
+	shareID, err := stores.Groups.CreateShare(ctx, models.GroupShare{
+		GroupID:         group.ID.Hex(),
+		NoteID:          noteID,
+		Sender:          sender,
+		EncryptedAESKey: encryptedAESKey,
+		KeyVersion:      keyVersion,
+	})
+	if errors.Is(err, stores.ErrDuplicate) {
+		return "", ErrGroupNoteShared
+	}
+	return shareID, err
+}
+
+// Mọi note đã chia sẻ cho nhóm, note đang trong thùng rác được đánh dấu tạm ngưng (không kèm metadata)
+func ListGroupNotes(groupID string) ([]models.GroupNoteResponse, error) {
+	shares, err := stores.Groups.ListShares(context.TODO(), groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]models.GroupNoteResponse, 0, len(shares))
+	for _, s := range shares {
+		res := models.GroupNoteResponse{GroupShare: s}
+		note, err := GetGroupNote(s)
+		if errors.Is(err, ErrNoteInTrash) || errors.Is(err, stores.ErrNotFound) {
+			res.Suspended = true
+		} else if err != nil {
+			return nil, err
+		} else {
+			res.EncryptedMetadata, res.Revision = note.EncryptedMetadata, note.CurrentRevisionNumber()
+		}
+		notes = append(notes, res)
+	}
+	return notes, nil
+}
+
+// Note gốc của share cho nhóm (thành viên luôn đọc phiên bản mới nhất)
+func GetGroupNote(share models.GroupShare) (models.Note, error) {
+	note, err := stores.Notes.FindByID(context.TODO(), share.NoteID)
+	if err != nil {
+		return models.Note{}, err
+	}
+	if note.InTrash() {
+		return models.Note{}, ErrNoteInTrash
+	}
+	return note, nil
+}
+
+// Gỡ note khỏi nhóm
+func UnshareNoteFromGroup(shareID string) error {
+	err := stores.Groups.DeleteShare(context.TODO(), shareID)
+	if errors.Is(err, stores.ErrNotFound) {
+		return nil
+	}
+	return err
+}
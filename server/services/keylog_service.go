@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"note_sharing_application/server/utils"
+)
+
+/*
+	Key transparency log
+	Mỗi lần đăng ký hoặc đổi khóa, public key của user được thêm vào cuối 1 log chỉ-thêm
+	Log là cây Merkle (RFC 6962), server ký gốc cây (Signed Tree Head) bằng khóa Ed25519
+	Client kiểm tra:
+	  - Inclusion proof: khóa server trả về thật sự nằm trong log mà server đã ký
+	  - Consistency proof: log mới là phần mở rộng của log cũ (server không âm thầm sửa lịch sử)
+	Nhờ vậy server không thể đưa khóa giả cho 1 người mà không để lại dấu vết công khai
+*/
+
+var (
+	ErrInvalidTreeSize = errors.New("kích thước cây không hợp lệ")
+	ErrLogEntryMissing = errors.New("khóa hiện tại của user chưa có trong log")
+)
+
+// Dữ liệu của 1 lá trong log, client dựng lại đúng chuỗi byte này để tính hash lá
+// Mỗi trường có độ dài đi kèm để 2 entry khác nhau không bao giờ ra cùng 1 chuỗi
+// Entry có khóa ký dùng định dạng v2, entry không có khóa ký giữ định dạng v1 nên hash cũ không đổi
+func KeyLogLeafData(e models.KeyLogEntry) []byte {
+	v1 := fmt.Sprintf("%d:%s|%d:%s|%d:%s|%d:%s|%d",
+		len(e.Username), e.Username,
+		len(e.KeyType), e.KeyType,
+		len(e.PublicKey), e.PublicKey,
+		len(e.LegacyPublicKey), e.LegacyPublicKey,
+		e.Timestamp)
+	if e.SigningPublicKey == "" {
+		return []byte("v1|" + v1)
+	}
+	return []byte(fmt.Sprintf("v2|%s|%d:%s", v1, len(e.SigningPublicKey), e.SigningPublicKey))
+}
+
+// Thêm khóa hiện tại của user vào cuối log
+// Gọi trong cùng transaction với thao tác tạo/đổi khóa để log và bảng users không lệch nhau
+func AppendKeyLog(ctx context.Context, user models.User) (int64, error) {
+	return stores.KeyLog.Append(ctx, models.KeyLogEntry{
+		Username:         user.Username,
+		KeyType:          user.KeyType(),
+		PublicKey:        user.PubKey,
+		LegacyPublicKey:  user.LegacyPubKey,
+		SigningPublicKey: user.SigningPubKey,
+		Timestamp:        time.Now().Unix(),
+	})
+}
+
+// Entry có khớp với khóa hiện tại của user không
+func keyLogMatchesUser(e models.KeyLogEntry, user models.User) bool {
+	return e.KeyType == user.KeyType() && e.PublicKey == user.PubKey && e.LegacyPublicKey == user.LegacyPubKey &&
+		e.SigningPublicKey == user.SigningPubKey
+}
+
+// Index trong log của khóa hiện tại của user
+func CurrentKeyLogIndex(ctx context.Context, user models.User) (int64, error) {
+	entry, err := stores.KeyLog.LatestByUsername(ctx, user.Username)
+	if errors.Is(err, stores.ErrNotFound) {
+		return 0, ErrLogEntryMissing
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !keyLogMatchesUser(entry, user) {
+		return 0, ErrLogEntryMissing
+	}
+	return entry.Index, nil
+}
+
+// Ghi vào log các user có khóa chưa nằm trong log (dữ liệu tạo trước khi có log)
+// Gọi 1 lần lúc server khởi động, trả về số entry đã thêm
+func BackfillKeyLog(ctx context.Context) (int, error) {
+	users, err := stores.Users.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	added := 0
+	for _, u := range users {
+		_, err := CurrentKeyLogIndex(ctx, u)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrLogEntryMissing) {
+			return added, err
+		}
+		if _, err := AppendKeyLog(ctx, u); err != nil {
+			return added, err
+		}
+		added++
+	}
+	return added, nil
+}
+
+// Hash lá của size entry đầu tiên
+func keyLogLeaves(ctx context.Context, size int64) ([][]byte, error) {
+	entries, err := stores.KeyLog.List(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(entries)) != size {
+		return nil, ErrInvalidTreeSize
+	}
+	leaves := make([][]byte, len(entries))
+	for i, e := range entries {
+		leaves[i] = utils.MerkleLeafHash(KeyLogLeafData(e))
+	}
+	return leaves, nil
+}
+
+func hexProof(proof [][]byte) []string {
+	out := make([]string, len(proof))
+	for i, h := range proof {
+		out[i] = hex.EncodeToString(h)
+	}
+	return out
+}
+
+// Gốc cây Merkle hiện tại của log, có chữ ký của server
+func GetSignedTreeHead(ctx context.Context) (models.SignedTreeHead, error) {
+	size, err := stores.KeyLog.Size(ctx)
+	if err != nil {
+		return models.SignedTreeHead{}, err
+	}
+	leaves, err := keyLogLeaves(ctx, size)
+	if err != nil {
+		return models.SignedTreeHead{}, err
+	}
+
+	sth := models.SignedTreeHead{
+		TreeSize:  size,
+		RootHash:  hex.EncodeToString(utils.MerkleRoot(leaves)),
+		Timestamp: time.Now().Unix(),
+	}
+	sig, err := utils.SignTreeHead(sth.TreeSize, sth.RootHash, sth.Timestamp)
+	if err != nil {
+		return models.SignedTreeHead{}, err
+	}
+	sth.Signature = base64.StdEncoding.EncodeToString(sig)
+	return sth, nil
+}
+
+// Inclusion proof của entry index trong cây treeSize lá đầu tiên
+func GetInclusionProof(ctx context.Context, index, treeSize int64) ([]string, error) {
+	if index < 0 || treeSize <= index {
+		return nil, ErrInvalidTreeSize
+	}
+	leaves, err := keyLogLeaves(ctx, treeSize)
+	if err != nil {
+		return nil, err
+	}
+	return hexProof(utils.MerkleInclusionProof(int(index), leaves)), nil
+}
+
+// Consistency proof giữa cây first lá và cây second lá
+func GetConsistencyProof(ctx context.Context, first, second int64) ([]string, error) {
+	if first < 0 || second < first {
+		return nil, ErrInvalidTreeSize
+	}
+	leaves, err := keyLogLeaves(ctx, second)
+	if err != nil {
+		return nil, err
+	}
+	return hexProof(utils.MerkleConsistencyProof(int(first), leaves)), nil
+}
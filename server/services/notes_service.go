@@ -2,121 +2,228 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	"fmt"
-	"note_sharing_application/server/configs"
+	"io"
 	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"note_sharing_application/server/utils"
+	"strings"
+	"time"
+)
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+var (
+	ErrNoteContentExists = errors.New("note đã có nội dung")
+	ErrNoteContentEmpty  = errors.New("note chưa có nội dung")
+	ErrInvalidCipherText = errors.New("cipher_text không phải Base64 hợp lệ")
 )
 
-func CreateNote(cipherText string, encryptedAesKey string, ownerIDStr string) (string, error) {
+// cipherText (Base64, client cũ) rỗng: chỉ tạo metadata, nội dung tải lên sau qua SetNoteContent
+func CreateNote(cipherText string, encryptedAesKey string, encryptedMetadata string, ownerIDStr string) (string, error) {
+	ctx := context.TODO()
 	newNote := models.Note{
-		CipherText:      cipherText,
-		EncryptedAesKey: encryptedAesKey,
-		OwnerID:         ownerIDStr,
+		EncryptedAesKey:   encryptedAesKey,
+		EncryptedMetadata: encryptedMetadata,
+		OwnerID:           ownerIDStr,
 	}
 
-	result, err := configs.GetCollection("notes").InsertOne(context.TODO(), newNote)
-	if err != nil {
-		return "", err
+	if cipherText != "" {
+		ref, size, digest, err := putBlob(ctx, base64.NewDecoder(base64.StdEncoding, strings.NewReader(cipherText)))
+		var corrupt base64.CorruptInputError
+		if errors.As(err, &corrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return "", ErrInvalidCipherText
+		}
+		if err != nil {
+			return "", err
+		}
+		newNote.BlobRef, newNote.Size, newNote.CipherDigest = ref, size, digest
 	}
 
-	if oid, ok := result.InsertedID.(primitive.ObjectID); ok {
-		return oid.Hex(), nil
+	noteID, err := stores.Notes.Create(ctx, newNote)
+	if err != nil && newNote.BlobRef != "" {
+		_ = stores.Blobs.Delete(ctx, newNote.BlobRef)
 	}
-	return "", err
+	return noteID, err
+}
 
+// Ghi nội dung binary vào BlobStore, đồng thời tính hash (CipherTextDigest) theo luồng
+func putBlob(ctx context.Context, r io.Reader) (string, int64, string, error) {
+	h := sha256.New()
+	enc := base64.NewEncoder(base64.StdEncoding, h)
+	ref, size, err := stores.Blobs.Put(ctx, io.TeeReader(r, enc))
+	if err != nil {
+		return "", 0, "", err
+	}
+	enc.Close()
+	return ref, size, hex.EncodeToString(h.Sum(nil)), nil
 }
 
-// Service: xem tất cả ghi chú do một owner
-func ViewOwnedNotes(ownerIDStr string) ([]models.Note, error) {
-	// lọc theo owner
-	filter := bson.M{"owner_id": ownerIDStr}
+// Nhận nội dung đã mã hóa dạng binary từ r, lưu vào BlobStore và gán cho note chưa có nội dung
+func SetNoteContent(noteID, ownerID string, r io.Reader) error {
+	ctx := context.TODO()
 
-	// tìm tất cả note - lúc này chỉ mới trỏ đến collection
+	ref, size, digest, err := putBlob(ctx, r)
+	if err != nil {
+		return err
+	}
+	if size == 0 {
+		_ = stores.Blobs.Delete(ctx, ref)
+		return ErrNoteContentEmpty
+	}
 
-	cursor, err := configs.GetCollection("notes").Find(context.TODO(), filter)
+	err = stores.Notes.SetContent(ctx, noteID, ownerID, ref, size, digest)
 	if err != nil {
-		return nil, err
+		// Không gán được thì blob vừa ghi không còn ai dùng
+		_ = stores.Blobs.Delete(ctx, ref)
 	}
+	if errors.Is(err, stores.ErrNotFound) {
+		return ErrNoteContentExists
+	}
+	return err
+}
 
-	// load vào notes thực sự, All() = duyệt, decode, đóng cursor
-	notes := make([]models.Note, 0)
-	if err = cursor.All(context.TODO(), &notes); err != nil {
-		return nil, err
+// Mở nội dung binary của note, trả về kèm kích thước (byte); người gọi phải Close
+func OpenNoteContent(note models.Note) (io.ReadCloser, int64, error) {
+	if note.BlobRef != "" {
+		content, err := stores.Blobs.Open(context.TODO(), note.BlobRef)
+		return content, note.Size, err
+	}
+	if note.CipherText == "" {
+		return nil, 0, ErrNoteContentEmpty
 	}
 
-	// trả về kết quả
-	return notes, nil
+	// Note cũ: ciphertext Base64 trong document
+	size := int64(base64.StdEncoding.DecodedLen(len(note.CipherText)) - strings.Count(note.CipherText[len(note.CipherText)-2:], "="))
+	return io.NopCloser(base64.NewDecoder(base64.StdEncoding, strings.NewReader(note.CipherText))), size, nil
 }
 
-// Servce: xem tất cả urls được gửi đến receiver
-func ViewReceivedNoteURLs(receiver string) ([]models.Url, error) {
-	fmt.Print(receiver)
-
-	// lọc url
-	urlFilter := bson.M{
-		"receiver": receiver, // Receiver
+// Nội dung note dạng Base64 cho client cũ đọc qua JSON (phải đọc hết blob vào RAM)
+func NoteCipherText(note models.Note) (string, error) {
+	if note.BlobRef == "" {
+		return note.CipherText, nil
 	}
-
-	// lấy tất cả các urls thỏa mãn lưu vào validUrls
-	cursor, err := configs.GetCollection("urls").Find(context.TODO(), urlFilter)
+	content, _, err := OpenNoteContent(note)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	receivedUrls := make([]models.Url, 0)
-	if err = cursor.All(context.TODO(), &receivedUrls); err != nil {
-		return nil, err
+	defer content.Close()
+
+	var cipherText strings.Builder
+	enc := base64.NewEncoder(base64.StdEncoding, &cipherText)
+	if _, err := io.Copy(enc, content); err != nil {
+		return "", err
 	}
-	return receivedUrls, nil
+	enc.Close()
+	return cipherText.String(), nil
 }
 
-func DeleteNote(noteIDStr string) error {
-
-	// string --> ObjectID lấy ID của node
-	NoteIDObj, err := primitive.ObjectIDFromHex(noteIDStr)
-	if err != nil {
-		return errors.New("invalid note ID format")
+// Hash ciphertext dùng trong chữ ký share (note cũ chưa lưu hash thì tính lại)
+func NoteDigest(note models.Note) string {
+	if note.CipherDigest != "" || note.CipherText == "" {
+		return note.CipherDigest
 	}
+	return utils.CipherTextDigest(note.CipherText)
+}
 
-	// lọc note id và người sở hữu
-	filter := bson.M{
-		"_id": NoteIDObj,
+// Service: xem các ghi chú do một owner sở hữu (bỏ qua note trong thùng rác) theo page
+// Trả về kèm cursor của trang sau (rỗng nếu đây là trang cuối)
+func ViewOwnedNotes(ownerIDStr string, page models.PageQuery) ([]models.Note, string, error) {
+	// lấy dư 1 note để biết còn trang sau hay không
+	query := page
+	if page.Limit > 0 {
+		query.Limit = page.Limit + 1
 	}
-
-	// Xóa note
-	res, err := configs.GetCollection("notes").DeleteOne(context.TODO(), filter)
+	notes, err := stores.Notes.ListActiveByOwner(context.TODO(), ownerIDStr, query)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	if res.DeletedCount == 0 {
-		return errors.New("non-exist note id")
+
+	next := ""
+	if page.Limit > 0 && len(notes) > page.Limit {
+		notes = notes[:page.Limit]
+		next = page.NoteCursor(notes[len(notes)-1]).Encode()
+	}
+	for i, n := range notes {
+		if n.HasContent() {
+			notes[i].Revision = n.CurrentRevisionNumber()
+		}
 	}
+	return notes, next, nil
+}
 
-	// lọc note id
-	urlFilter := bson.M{"note_id": noteIDStr}
+// Share người nhận thấy trong danh sách, kèm metadata đã mã hóa của note (rỗng nếu không đọc được)
+type ReceivedShare struct {
+	Url               models.Url
+	EncryptedMetadata string
+}
 
-	// Xóa URLs
-	_, _ = configs.GetCollection("urls").DeleteMany(context.TODO(), urlFilter)
+// Servce: xem các urls được gửi đến receiver khớp filter theo page
+// Share của note trong thùng rác đang tạm ngưng nên không được tính vào trang
+func ViewReceivedNoteURLs(receiver string, filter models.ShareFilter, page models.PageQuery) ([]ReceivedShare, string, error) {
+	shares := make([]ReceivedShare, 0)
+	query := page
+	for {
+		// lấy dư 1 share để biết còn trang sau hay không
+		if page.Limit > 0 {
+			query.Limit = page.Limit + 1 - len(shares)
+		}
+		urls, err := stores.Shares.ListByReceiver(context.TODO(), receiver, filter, query)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, url := range urls {
+			note, err := GetNoteMetadata(url)
+			if errors.Is(err, ErrNoteInTrash) {
+				continue
+			}
+			share := ReceivedShare{Url: url}
+			// Note đã bị xóa thì bỏ qua metadata
+			if err == nil {
+				share.EncryptedMetadata = note.EncryptedMetadata
+			}
+			shares = append(shares, share)
+		}
+
+		// Hết dữ liệu hoặc đã đủ: dừng, ngược lại lấy tiếp phần bị bỏ qua
+		if page.Limit == 0 || len(urls) < query.Limit || len(shares) > page.Limit {
+			break
+		}
+		after := page.UrlCursor(urls[len(urls)-1])
+		query.After = &after
+	}
 
-	return nil
+	next := ""
+	if page.Limit > 0 && len(shares) > page.Limit {
+		shares = shares[:page.Limit]
+		next = page.UrlCursor(shares[len(shares)-1].Url).Encode()
+	}
+	return shares, next, nil
+}
 
+// Chuyển note vào thùng rác, share của note bị tạm ngưng (không bị xóa) cho tới khi note được khôi phục
+func DeleteNote(noteIDStr, ownerID string) error {
+	now := time.Now()
+	err := stores.Notes.SetDeletedAt(context.TODO(), noteIDStr, ownerID, &now)
+	if errors.Is(err, stores.ErrInvalidID) {
+		return errors.New("invalid note ID format")
+	}
+	if errors.Is(err, stores.ErrNotFound) {
+		return errors.New("non-exist note id")
+	}
+	return err
 }
 
 func DeleteSharedNote(noteID string, owner string) error {
 
-	filter := bson.M{
-		"note_id": noteID,
-		"sender":  owner,
-	}
-	result, err := configs.GetCollection("urls").DeleteMany(context.TODO(), filter)
+	deleted, err := stores.Shares.DeleteByNoteAndSender(context.TODO(), noteID, owner)
 	if err != nil {
 		return err
 	}
 
-	if result.DeletedCount == 0 {
+	if deleted == 0 {
 		return errors.New("không tìm thấy liên kết chia sẻ nào để xóa")
 	}
 	return nil
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+)
+
+/*
+	Refresh Token dùng để xin access token mới mà không cần đăng nhập lại
+	Token gốc chỉ gửi cho client, server chỉ lưu mã băm SHA-256
+	Mỗi refresh token chỉ dùng được 1 lần (rotation): khi làm mới, server cấp token mới cùng family
+	Nếu token đã dùng bị gửi lại (reuse) -> có thể đã bị đánh cắp -> thu hồi toàn bộ family,
+	cả kẻ gian lẫn người dùng thật đều phải đăng nhập lại
+*/
+
+// Thời gian sống của refresh token
+const refreshTokenTTL = 7 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token không hợp lệ hoặc đã hết hạn")
+	ErrRefreshTokenReused  = errors.New("refresh token đã bị dùng lại, toàn bộ phiên đã bị thu hồi")
+)
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashRefreshToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// Tạo refresh token mới thuộc family cho trước và lưu mã băm vào DB
+func newRefreshToken(ctx context.Context, userID, username, familyID string) (string, error) {
+	raw, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = stores.Tokens.Create(ctx, models.RefreshToken{
+		TokenHash: hashRefreshToken(raw),
+		FamilyID:  familyID,
+		UserID:    userID,
+		Username:  username,
+		ExpiresAt: time.Now().Add(refreshTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Cấp refresh token khi đăng nhập thành công (bắt đầu 1 family mới)
+func GenerateRefreshToken(userID, username string) (string, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	return newRefreshToken(context.TODO(), userID, username, familyID)
+}
+
+// Đổi refresh token cũ lấy cặp (access token, refresh token) mới
+func RotateRefreshToken(raw string) (string, string, error) {
+	ctx := context.TODO()
+
+	stored, err := stores.Tokens.FindByHash(ctx, hashRefreshToken(raw))
+	if errors.Is(err, stores.ErrNotFound) {
+		return "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	if stored.Revoked || time.Now().After(stored.ExpiresAt) {
+		return "", "", ErrRefreshTokenInvalid
+	}
+
+	// Token đã dùng rồi mà còn gửi lại -> thu hồi cả family
+	// MarkUsed là thao tác có điều kiện nên 2 request đồng thời cũng chỉ 1 cái thành công
+	consumed, err := stores.Tokens.MarkUsed(ctx, stored.ID.Hex())
+	if err != nil {
+		return "", "", err
+	}
+	if !consumed {
+		if err := stores.Tokens.RevokeFamily(ctx, stored.FamilyID); err != nil {
+			return "", "", err
+		}
+		return "", "", ErrRefreshTokenReused
+	}
+
+	user, err := stores.Users.FindByUsername(ctx, stored.Username)
+	if errors.Is(err, stores.ErrNotFound) {
+		return "", "", ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := GenerateAuthJWT(stored.UserID, stored.Username, user.TokenVersion)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, err := newRefreshToken(ctx, stored.UserID, stored.Username, stored.FamilyID)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Đăng xuất / LogoutAll / đổi mật khẩu chạy xen giữa lúc kiểm tra ở trên và lúc lưu token mới
+	// thì không thu hồi được token mới -> kiểm tra lại sau khi lưu, bị thu hồi thì hủy cả family
+	if err := checkRotationNotRevoked(ctx, stored, user.TokenVersion); err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// Token cũ (và cả family) chưa bị thu hồi, thế hệ token của user vẫn là tokenVersion
+// Việc thu hồi xảy ra sau lần kiểm tra này sẽ thu hồi luôn token mới vì nó đã được lưu
+func checkRotationNotRevoked(ctx context.Context, stored models.RefreshToken, tokenVersion int) error {
+	current, err := stores.Tokens.FindByHash(ctx, stored.TokenHash)
+	if err != nil && !errors.Is(err, stores.ErrNotFound) {
+		return err
+	}
+	revoked := err != nil || current.Revoked
+
+	if !revoked {
+		user, err := stores.Users.FindByUsername(ctx, stored.Username)
+		if err != nil && !errors.Is(err, stores.ErrNotFound) {
+			return err
+		}
+		revoked = err != nil || user.TokenVersion != tokenVersion
+	}
+
+	if !revoked {
+		return nil
+	}
+	if err := stores.Tokens.RevokeFamily(ctx, stored.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenInvalid
+}
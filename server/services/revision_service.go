@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"note_sharing_application/server/utils"
+	"time"
+)
+
+var (
+	ErrRevisionNotFound = errors.New("phiên bản không tồn tại")
+	ErrRevisionConflict = errors.New("note đã được cập nhật bởi phiên bản khác")
+)
+
+// Lưu nội dung mới (binary, cùng khóa AES) thành phiên bản mới của note, phiên bản hiện tại được giữ lại trong lịch sử
+// encryptedMetadata rỗng thì giữ metadata của phiên bản trước
+// baseRevision > 0: chỉ cập nhật nếu phiên bản hiện tại vẫn là baseRevision (tránh ghi đè cập nhật của máy khác)
+func UpdateNoteContent(note models.Note, r io.Reader, encryptedMetadata string, baseRevision int) (models.Note, error) {
+	if !note.HasContent() {
+		return models.Note{}, ErrNoteContentEmpty
+	}
+	if baseRevision > 0 && baseRevision != note.CurrentRevisionNumber() {
+		return models.Note{}, ErrRevisionConflict
+	}
+
+	ctx := context.TODO()
+	ref, size, digest, err := putBlob(ctx, r)
+	if err != nil {
+		return models.Note{}, err
+	}
+	if size == 0 {
+		_ = stores.Blobs.Delete(ctx, ref)
+		return models.Note{}, ErrNoteContentEmpty
+	}
+
+	if encryptedMetadata == "" {
+		encryptedMetadata = note.EncryptedMetadata
+	}
+	next := models.NoteRevision{
+		BlobRef:           ref,
+		Size:              size,
+		CipherDigest:      digest,
+		EncryptedMetadata: encryptedMetadata,
+	}
+
+	updated, err := setCurrentRevision(ctx, note, next)
+	if err != nil {
+		// Không gán được thì blob vừa ghi không còn ai dùng
+		_ = stores.Blobs.Delete(ctx, ref)
+	}
+	return updated, err
+}
+
+// Khôi phục phiên bản number: nội dung của nó trở thành phiên bản mới nhất, lịch sử không bị mất
+func RestoreRevision(note models.Note, number int) (models.Note, error) {
+	old, ok := note.AtRevision(number)
+	if !ok {
+		return models.Note{}, ErrRevisionNotFound
+	}
+
+	// Phiên bản mới dùng chung blob với phiên bản được khôi phục
+	next := models.NoteRevision{
+		BlobRef:           old.BlobRef,
+		Size:              old.Size,
+		CipherDigest:      NoteDigest(old),
+		CipherText:        old.CipherText,
+		EncryptedMetadata: old.EncryptedMetadata,
+	}
+	return setCurrentRevision(context.TODO(), note, next)
+}
+
+// Đưa phiên bản hiện tại vào lịch sử và thay bằng next (được đánh số tiếp theo)
+func setCurrentRevision(ctx context.Context, note models.Note, next models.NoteRevision) (models.Note, error) {
+	base := note.CurrentRevisionNumber()
+	current := note.CurrentRevision()
+	current.CipherDigest = NoteDigest(note)
+
+	history := append(append([]models.NoteRevision{}, note.History...), current)
+	next.Number = base + 1
+	next.CreatedAt = time.Now()
+
+	err := stores.Notes.UpdateContent(ctx, note.ID.Hex(), note.OwnerID, base, next, history)
+	if errors.Is(err, stores.ErrNotFound) {
+		return models.Note{}, ErrRevisionConflict
+	}
+	if err != nil {
+		return models.Note{}, err
+	}
+
+	note.History = history
+	note.Revision = next.Number
+	note.BlobRef, note.Size, note.CipherDigest, note.CipherText = next.BlobRef, next.Size, next.CipherDigest, next.CipherText
+	note.EncryptedMetadata, note.UpdatedAt = next.EncryptedMetadata, next.CreatedAt
+	return note, nil
+}
+
+// Các phiên bản của note (cũ trước), có hash ciphertext để client kiểm tra khi tải
+func NoteRevisions(note models.Note) []models.NoteRevision {
+	revisions := note.Revisions()
+	for i := range revisions {
+		if revisions[i].CipherDigest == "" && revisions[i].CipherText != "" {
+			revisions[i].CipherDigest = utils.CipherTextDigest(revisions[i].CipherText)
+		}
+	}
+	return revisions
+}
+
+// Các blob khác nhau mà note đang dùng (khôi phục phiên bản cũ thì nhiều phiên bản chung 1 blob)
+func noteBlobRefs(note models.Note) []string {
+	var refs []string
+	seen := map[string]bool{}
+	for _, r := range note.Revisions() {
+		if r.BlobRef != "" && !seen[r.BlobRef] {
+			seen[r.BlobRef] = true
+			refs = append(refs, r.BlobRef)
+		}
+	}
+	return refs
+}
@@ -4,20 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"note_sharing_application/server/configs"
 	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // 1. Tạo URL mới
-func CreateUrl(noteId, sender, receiver, sharedEncryptedAESKey, expiresIn string, maxAccess int) (string, error) {
-	duration, _ := time.ParseDuration(expiresIn)
-	expireTime := time.Now().Add(duration)
-
+// revision là phiên bản được chia sẻ (bỏ qua nếu followLatest)
+func CreateUrl(noteId, sender, receiver, sharedEncryptedAESKey, keyScheme, signature string, expireTime time.Time, maxAccess, revision int, followLatest bool) (string, error) {
 	newUrl := models.Url{
 		NoteID:                noteId,
 		SharedEncryptedAESKey: sharedEncryptedAESKey,
@@ -26,26 +20,81 @@ func CreateUrl(noteId, sender, receiver, sharedEncryptedAESKey, expiresIn string
 		Accessed:              0,
 		Sender:                sender,
 		Receiver:              receiver,
+		KeyScheme:             keyScheme,
+		Signature:             signature,
+		FollowLatest:          followLatest,
+	}
+	if !followLatest {
+		newUrl.Revision = revision
+	}
+
+	return stores.Shares.Create(context.TODO(), newUrl)
+}
+
+// Tạo link công khai: không có người nhận, khóa AES bọc bằng khóa của link
+// accessVerifier khác rỗng: link có mật khẩu, bị xóa sau maxAttempts lần nhập sai
+func CreateLink(noteId, sender, sharedEncryptedAESKey, accessVerifier string, expireTime time.Time, maxAccess, maxAttempts, revision int, followLatest bool) (string, error) {
+	link := models.Url{
+		NoteID:                noteId,
+		SharedEncryptedAESKey: sharedEncryptedAESKey,
+		ExpiresAt:             expireTime,
+		MaxAccess:             maxAccess,
+		Sender:                sender,
+		KeyScheme:             models.KeySchemeLink,
+		FollowLatest:          followLatest,
+		Public:                true,
+	}
+	if accessVerifier != "" {
+		link.KeyScheme = models.KeySchemeLinkPassword
+		link.AccessVerifier = accessVerifier
+		link.MaxAttempts = maxAttempts
 	}
+	if !followLatest {
+		link.Revision = revision
+	}
+
+	return stores.Shares.Create(context.TODO(), link)
+}
+
+// Ghi nhận 1 lần nhập sai mật khẩu của link, trả về số lần thử còn lại (0: link đã bị xóa)
+func FailLinkAttempt(urlId string) (int, error) {
+	url, err := stores.Shares.RecordFailedAttempt(context.TODO(), urlId)
+	if err != nil {
+		return 0, err
+	}
+	return url.MaxAttempts - url.FailedAttempts, nil
+}
 
-	res, err := configs.GetCollection("urls").InsertOne(context.TODO(), newUrl)
+// Các share sender đã tạo cho note, mỗi share ứng với 1 người nhận
+func ListNoteShares(noteId, sender string) ([]models.Url, error) {
+	urls, err := stores.Shares.ListByNote(context.TODO(), noteId)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	sent := make([]models.Url, 0, len(urls))
+	for _, u := range urls {
+		if u.Sender == sender {
+			sent = append(sent, u)
+		}
+	}
+	return sent, nil
 }
 
-// 2. Lấy URL đang tồn tại của Note
-func GetExistingUrl(noteId, receiver string) (string, error) {
-	var url models.Url
-	// Tìm url của note này mà còn hạn và còn lượt xem
-	filter := bson.M{
-		"note_id":  noteId,
-		"receiver": receiver,
+// Thu hồi 1 share: chỉ người nhận của share đó mất quyền truy cập
+func RevokeShare(urlId string) error {
+	err := stores.Shares.Delete(context.TODO(), urlId)
+	if errors.Is(err, stores.ErrNotFound) {
+		// Vừa hết hạn/hết lượt và bị dọn: kết quả như nhau
+		return nil
 	}
+	return err
+}
 
-	err := configs.GetCollection("urls").FindOne(context.TODO(), filter).Decode(&url)
+// 2. Lấy URL đang tồn tại của Note
+func GetExistingUrl(noteId, receiver string) (string, error) {
+	// Tìm url của note này gửi đến receiver
+	url, err := stores.Shares.FindByNoteAndReceiver(context.TODO(), noteId, receiver)
 	if err != nil {
 		return "", errors.New("không tìm thấy URL hợp lệ")
 	}
@@ -53,34 +102,65 @@ func GetExistingUrl(noteId, receiver string) (string, error) {
 	return url.ID.Hex(), nil
 }
 
+// Metadata của share (không tính lượt xem): note ở phiên bản share trỏ tới
+func GetNoteMetadata(reqUrl models.Url) (models.Note, error) {
+	if !time.Now().Before(reqUrl.ExpiresAt) {
+		return models.Note{}, models.ErrUrlExpired
+	}
+	if reqUrl.Accessed >= reqUrl.MaxAccess {
+		return models.Note{}, models.ErrUrlExhausted
+	}
+
+	note, err := stores.Notes.FindByID(context.TODO(), reqUrl.NoteID)
+	if err != nil {
+		if errors.Is(err, stores.ErrNotFound) {
+			return models.Note{}, fmt.Errorf("note gốc đã bị xóa khỏi hệ thống")
+		}
+		return models.Note{}, err
+	}
+	if note.InTrash() {
+		return models.Note{}, ErrNoteInTrash
+	}
+	return shareView(reqUrl, note)
+}
+
 // 3. Xử lý xem Note
 func GetNote(reqUrl models.Url) (models.Note, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	urlColl := configs.GetCollection("urls")
-	noteColl := configs.GetCollection("notes")
-
-	// B. Gọi hàm AccessUrl (Logic tăng view và tự xóa nằm ở đây)
-	// Lưu ý: Truyền reqUrl.ID (kiểu ObjectID) vào thẳng, không cần convert từ string
-	validUrl, err := models.AccessUrl(ctx, urlColl, reqUrl.ID)
+	// A. Lấy Note gốc trước: note trong thùng rác thì share tạm ngưng, không tính lượt xem
+	note, err := stores.Notes.FindByID(ctx, reqUrl.NoteID)
 	if err != nil {
-		return models.Note{}, fmt.Errorf("không thể truy cập link này: %v", err)
+		if errors.Is(err, stores.ErrNotFound) {
+			return models.Note{}, fmt.Errorf("note gốc đã bị xóa khỏi hệ thống")
+		}
+		if errors.Is(err, stores.ErrInvalidID) {
+			return models.Note{}, fmt.Errorf("note ID trong dữ liệu bị lỗi")
+		}
+		return models.Note{}, err
 	}
-	// Lấy Note gốc dựa trên NoteID lưu trong Url
-	// Vì trong struct Url, NoteID là string, cần convert sang ObjectID để query
-	noteOID, err := primitive.ObjectIDFromHex(validUrl.NoteID)
-	if err != nil {
-		return models.Note{}, fmt.Errorf("note ID trong dữ liệu bị lỗi")
+	if note.InTrash() {
+		return models.Note{}, ErrNoteInTrash
 	}
 
-	var note models.Note
-	err = noteColl.FindOne(ctx, bson.M{"_id": noteOID}).Decode(&note)
+	// B. Gọi Access (Logic tăng view và tự xóa nằm ở đây)
+	validUrl, err := stores.Shares.Access(ctx, reqUrl.ID.Hex())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return models.Note{}, fmt.Errorf("note gốc đã bị xóa khỏi hệ thống")
+		return models.Note{}, fmt.Errorf("không thể truy cập link này: %v", err)
+	}
+	return shareView(validUrl, note)
+}
+
+// Note ở phiên bản mà share trỏ tới (phiên bản được ghim hoặc mới nhất)
+func shareView(url models.Url, note models.Note) (models.Note, error) {
+	view, ok := note.AtRevision(url.RevisionOf(note))
+	if !ok {
+		if !note.HasContent() {
+			// Note chưa có nội dung: để người gọi báo "chưa có nội dung"
+			return note, nil
 		}
-		return models.Note{}, err
+		return models.Note{}, ErrRevisionNotFound
 	}
-	return note, nil
+	return view, nil
 }
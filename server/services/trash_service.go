@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"time"
+)
+
+// Note nằm trong thùng rác quá thời hạn này thì bị xóa hẳn (đổi bằng TRASH_RETENTION)
+var TrashRetention = 30 * 24 * time.Hour
+
+var (
+	// Share của note đang trong thùng rác bị tạm ngưng
+	ErrNoteInTrash    = errors.New("note đang nằm trong thùng rác, chia sẻ tạm ngưng")
+	ErrNoteNotInTrash = errors.New("note không nằm trong thùng rác")
+)
+
+// Các note trong thùng rác của owner, kèm thời điểm sẽ bị xóa hẳn
+func ViewTrash(ownerID string) ([]models.Note, error) {
+	owned, err := stores.Notes.ListByOwner(context.TODO(), ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]models.Note, 0)
+	for _, n := range owned {
+		if !n.InTrash() {
+			continue
+		}
+		purgeAt := n.DeletedAt.Add(TrashRetention)
+		n.PurgeAt = &purgeAt
+		notes = append(notes, n)
+	}
+	return notes, nil
+}
+
+// Lấy note ra khỏi thùng rác, các share còn hạn hoạt động lại
+func RestoreNote(noteID, ownerID string) error {
+	return stores.Notes.SetDeletedAt(context.TODO(), noteID, ownerID, nil)
+}
+
+// Xóa hẳn note trong thùng rác: document, mọi share (kể cả share cho nhóm), phiên upload dở và nội dung của mọi phiên bản
+func PurgeNote(noteID string) error {
+	return purgeNote(noteID, func(note models.Note) error {
+		if !note.InTrash() {
+			// Vừa được khôi phục
+			return ErrNoteNotInTrash
+		}
+		return nil
+	})
+}
+
+// Xóa note cùng mọi share của nó trong 1 transaction (không để lại share mồ côi),
+// check được gọi trong transaction để quyết định còn xóa hay không
+// Blob chỉ xóa sau khi commit: xóa blob không rollback được, blob sót lại chỉ là rác
+func purgeNote(noteID string, check func(models.Note) error) error {
+	ctx := context.TODO()
+
+	var note models.Note
+	var uploads []models.UploadSession
+	err := stores.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		// Lấy tham chiếu blob trước khi xóa note
+		var err error
+		note, err = stores.Notes.FindByID(ctx, noteID)
+		if err != nil {
+			return err
+		}
+		if err := check(note); err != nil {
+			return err
+		}
+
+		if err := stores.Notes.Delete(ctx, noteID); err != nil {
+			return err
+		}
+		if _, err := stores.Shares.DeleteByNote(ctx, noteID); err != nil {
+			return err
+		}
+		if _, err := stores.Groups.DeleteSharesByNote(ctx, noteID); err != nil {
+			return err
+		}
+
+		// Phiên upload dở của note: lấy blob của chunk trước khi xóa phiên
+		uploads, err = stores.Uploads.ListByNote(ctx, noteID)
+		if err != nil {
+			return err
+		}
+		_, err = stores.Uploads.DeleteByNote(ctx, noteID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, session := range uploads {
+		deleteUploadChunks(ctx, session)
+	}
+	for _, ref := range noteBlobRefs(note) {
+		if err := stores.Blobs.Delete(ctx, ref); err != nil && !errors.Is(err, stores.ErrNotFound) {
+			log.Printf("Không xóa được blob %s của note %s: %v", ref, noteID, err)
+		}
+	}
+	return nil
+}
+
+// Xóa hẳn các note đã nằm trong thùng rác quá TrashRetention, trả về số note đã xóa
+func PurgeExpiredTrash() (int, error) {
+	expired, err := stores.Notes.ListTrashedBefore(context.TODO(), time.Now().Add(-TrashRetention))
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, n := range expired {
+		err := PurgeNote(n.ID.Hex())
+		if errors.Is(err, stores.ErrNotFound) || errors.Is(err, ErrNoteNotInTrash) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Không xóa được note %s trong thùng rác: %v", n.ID.Hex(), err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// Chạy PurgeExpiredTrash định kỳ trong goroutine riêng (suốt vòng đời server)
+func StartTrashPurger(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := PurgeExpiredTrash(); err != nil {
+				log.Printf("Lỗi dọn thùng rác: %v", err)
+			} else if n > 0 {
+				log.Printf("Đã xóa hẳn %d note quá hạn trong thùng rác", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
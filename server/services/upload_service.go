@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Phiên upload bỏ dở quá thời hạn này thì bị xóa, client phải tải lại từ đầu
+const UploadSessionTTL = 24 * time.Hour
+
+var ErrUploadChunkSize = errors.New("kích thước chunk không khớp với phiên upload")
+
+// Commit khi còn thiếu chunk
+type UploadIncompleteError struct {
+	Missing []int
+}
+
+func (e *UploadIncompleteError) Error() string {
+	return fmt.Sprintf("còn thiếu %d chunk", len(e.Missing))
+}
+
+// Mở phiên upload cho note chưa có nội dung (kích thước đã được middleware kiểm tra)
+func CreateUpload(noteID, ownerID string, totalSize, chunkSize int64) (models.UploadSession, error) {
+	now := time.Now()
+	session := models.UploadSession{
+		NoteID:    noteID,
+		OwnerID:   ownerID,
+		TotalSize: totalSize,
+		ChunkSize: chunkSize,
+		Chunks:    map[string]string{},
+		CreatedAt: now,
+		ExpiresAt: now.Add(UploadSessionTTL),
+	}
+
+	id, err := stores.Uploads.Create(context.TODO(), session)
+	if err != nil {
+		return models.UploadSession{}, err
+	}
+	return stores.Uploads.FindByID(context.TODO(), id)
+}
+
+// Lưu chunk index của phiên. Gửi lại chunk đã có thì chunk mới thay chunk cũ
+func PutUploadChunk(session models.UploadSession, index int, r io.Reader) error {
+	ctx := context.TODO()
+
+	ref, size, err := stores.Blobs.Put(ctx, r)
+	if err != nil {
+		return err
+	}
+	if size != session.ChunkLength(index) {
+		_ = stores.Blobs.Delete(ctx, ref)
+		return ErrUploadChunkSize
+	}
+
+	oldRef, err := stores.Uploads.SetChunk(ctx, session.ID.Hex(), index, ref)
+	if err != nil {
+		_ = stores.Blobs.Delete(ctx, ref)
+		return err
+	}
+	if oldRef != "" {
+		deleteBlob(ctx, oldRef)
+	}
+	return nil
+}
+
+// Các đoạn chunk đã nhận, mỗi đoạn là [chunk đầu, chunk cuối] (tính cả 2 đầu)
+func UploadReceivedRanges(session models.UploadSession) [][2]int {
+	indexes := make([]int, 0, len(session.Chunks))
+	for key := range session.Chunks {
+		if i, err := strconv.Atoi(key); err == nil {
+			indexes = append(indexes, i)
+		}
+	}
+	sort.Ints(indexes)
+
+	ranges := [][2]int{}
+	for _, i := range indexes {
+		if n := len(ranges); n > 0 && ranges[n-1][1] == i-1 {
+			ranges[n-1][1] = i
+			continue
+		}
+		ranges = append(ranges, [2]int{i, i})
+	}
+	return ranges
+}
+
+// Ghép các chunk theo thứ tự thành nội dung của note, sau đó xóa chunk và phiên upload
+// Trả về kích thước và hash (CipherTextDigest) của nội dung
+func CommitUpload(session models.UploadSession) (int64, string, error) {
+	ctx := context.TODO()
+
+	refs := make([]string, session.ChunkCount())
+	var missing []int
+	for i := range refs {
+		ref, ok := session.Chunks[strconv.Itoa(i)]
+		if !ok {
+			missing = append(missing, i)
+		}
+		refs[i] = ref
+	}
+	if len(missing) > 0 {
+		return 0, "", &UploadIncompleteError{Missing: missing}
+	}
+
+	content := &chunkReader{ctx: ctx, refs: refs}
+	ref, size, digest, err := putBlob(ctx, content)
+	content.Close()
+	if err != nil {
+		return 0, "", err
+	}
+	if size != session.TotalSize {
+		deleteBlob(ctx, ref)
+		return 0, "", ErrUploadChunkSize
+	}
+
+	err = stores.Notes.SetContent(ctx, session.NoteID, session.OwnerID, ref, size, digest)
+	if err != nil {
+		deleteBlob(ctx, ref)
+		if errors.Is(err, stores.ErrNotFound) {
+			return 0, "", ErrNoteContentExists
+		}
+		return 0, "", err
+	}
+
+	// Nội dung đã gán cho note, chunk và phiên không còn cần nữa
+	deleteUploadChunks(ctx, session)
+	if err := stores.Uploads.Delete(ctx, session.ID.Hex()); err != nil {
+		log.Printf("Không xóa được phiên upload %s: %v", session.ID.Hex(), err)
+	}
+
+	return size, digest, nil
+}
+
+// Xóa blob của mọi chunk đã nhận trong phiên
+func deleteUploadChunks(ctx context.Context, session models.UploadSession) {
+	for _, ref := range session.Chunks {
+		deleteBlob(ctx, ref)
+	}
+}
+
+// Xóa các phiên upload đã hết hạn: xóa blob của chunk trước rồi mới xóa phiên,
+// phiên còn lại khi lỗi giữa chừng sẽ được dọn ở lần sau. Trả về số phiên đã xóa
+func SweepExpiredUploads() (int, error) {
+	ctx := context.TODO()
+
+	expired, err := stores.Uploads.ListExpired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	swept := 0
+	for _, session := range expired {
+		deleteUploadChunks(ctx, session)
+		err := stores.Uploads.Delete(ctx, session.ID.Hex())
+		if errors.Is(err, stores.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Không xóa được phiên upload %s: %v", session.ID.Hex(), err)
+			continue
+		}
+		swept++
+	}
+	return swept, nil
+}
+
+// Chạy SweepExpiredUploads định kỳ trong goroutine riêng (suốt vòng đời server)
+func StartUploadSweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if n, err := SweepExpiredUploads(); err != nil {
+				log.Printf("Lỗi dọn phiên upload: %v", err)
+			} else if n > 0 {
+				log.Printf("Đã xóa %d phiên upload hết hạn", n)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// Xóa blob không còn dùng, lỗi chỉ ghi log (blob sót lại là rác, không note nào trỏ tới)
+func deleteBlob(ctx context.Context, ref string) {
+	if err := stores.Blobs.Delete(ctx, ref); err != nil && !errors.Is(err, stores.ErrNotFound) {
+		log.Printf("Không xóa được blob %s: %v", ref, err)
+	}
+}
+
+// Đọc lần lượt các blob chunk như 1 luồng, mỗi lúc chỉ mở 1 blob
+type chunkReader struct {
+	ctx  context.Context
+	refs []string
+	cur  io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.refs) == 0 {
+				return 0, io.EOF
+			}
+			blob, err := stores.Blobs.Open(r.ctx, r.refs[0])
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.refs = blob, r.refs[1:]
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			r.cur.Close()
+			r.cur = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur != nil {
+		return r.cur.Close()
+	}
+	return nil
+}
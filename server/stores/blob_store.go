@@ -0,0 +1,140 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cài đặt BlobStore trên thư mục local và trên RAM (GridFS nằm trong mongo_store.go)
+
+// Tham chiếu blob: 16 byte ngẫu nhiên dạng hex
+func newBlobRef() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Chỉ chấp nhận tham chiếu do newBlobRef sinh ra (chặn path traversal như "../x")
+func validBlobRef(ref string) bool {
+	b, err := hex.DecodeString(ref)
+	return err == nil && len(b) == 16
+}
+
+// --------------------- LOCAL ---------------------
+
+// Mỗi blob là 1 file trong dir, tên file là tham chiếu
+type localBlobStore struct{ dir string }
+
+// Tạo BlobStore lưu trong thư mục dir (tự tạo nếu chưa có)
+func NewLocalBlobStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("không tạo được thư mục blob: %w", err)
+	}
+	return &localBlobStore{dir: dir}, nil
+}
+
+func (s *localBlobStore) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	ref, err := newBlobRef()
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Ghi ra file tạm rồi rename để không bao giờ có blob ghi dở
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.dir, ref))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return ref, size, nil
+}
+
+func (s *localBlobStore) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	if !validBlobRef(ref) {
+		return nil, ErrNotFound
+	}
+	f, err := os.Open(filepath.Join(s.dir, ref))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *localBlobStore) Delete(ctx context.Context, ref string) error {
+	if !validBlobRef(ref) {
+		return ErrNotFound
+	}
+	err := os.Remove(filepath.Join(s.dir, ref))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// --------------------- MEMORY ---------------------
+
+// Blob trên RAM, dùng cùng bộ store memory (CI, test)
+type memoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+func newMemoryBlobStore() *memoryBlobStore {
+	return &memoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (s *memoryBlobStore) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", 0, err
+	}
+	ref, err := newBlobRef()
+	if err != nil {
+		return "", 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[ref] = data
+	return ref, int64(len(data)), nil
+}
+
+func (s *memoryBlobStore) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.blobs[ref]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memoryBlobStore) Delete(ctx context.Context, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.blobs[ref]; !ok {
+		return ErrNotFound
+	}
+	delete(s.blobs, ref)
+	return nil
+}
@@ -0,0 +1,1209 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"note_sharing_application/server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+	Cài đặt store nhúng (không cần MongoDB)
+	Toàn bộ dữ liệu nằm trong RAM, được bảo vệ bằng 1 mutex chung
+	Nếu có path thì sau mỗi lần ghi, dữ liệu được lưu xuống file (định dạng Extended JSON của bson)
+	để lần chạy sau đọc lại được
+*/
+
+type memoryDB struct {
+	mu sync.Mutex
+	// Mỗi lúc chỉ 1 transaction chạy
+	txMu    sync.Mutex
+	path    string
+	notes   map[primitive.ObjectID]models.Note
+	urls    map[primitive.ObjectID]models.Url
+	users   map[primitive.ObjectID]models.User
+	tokens  map[primitive.ObjectID]models.RefreshToken
+	revoked map[string]models.RevokedToken
+	keyLog  []models.KeyLogEntry
+	uploads map[primitive.ObjectID]models.UploadSession
+	groups  map[primitive.ObjectID]models.Group
+	// Note chia sẻ cho nhóm
+	groupShares map[primitive.ObjectID]models.GroupShare
+}
+
+// Nội dung file lưu trữ, dùng chung tên trường với các collection bên Mongo
+type memorySnapshot struct {
+	Notes   []models.Note          `bson:"notes"`
+	Urls    []models.Url           `bson:"urls"`
+	Users   []models.User          `bson:"users"`
+	Tokens  []models.RefreshToken  `bson:"refresh_tokens"`
+	Revoked []models.RevokedToken  `bson:"revoked_tokens"`
+	KeyLog  []models.KeyLogEntry   `bson:"key_log"`
+	Uploads []models.UploadSession `bson:"upload_sessions"`
+	Groups  []models.Group         `bson:"groups"`
+	// Note chia sẻ cho nhóm
+	GroupShares []models.GroupShare `bson:"group_shares"`
+}
+
+type memoryNoteStore struct{ db *memoryDB }
+type memoryShareStore struct{ db *memoryDB }
+type memoryUserStore struct{ db *memoryDB }
+type memoryTokenStore struct{ db *memoryDB }
+type memoryKeyLogStore struct{ db *memoryDB }
+type memoryUploadStore struct{ db *memoryDB }
+type memoryGroupStore struct{ db *memoryDB }
+type memoryTransactor struct{ db *memoryDB }
+
+func newMemoryDB(path string) *memoryDB {
+	return &memoryDB{
+		path:    path,
+		notes:   make(map[primitive.ObjectID]models.Note),
+		urls:    make(map[primitive.ObjectID]models.Url),
+		users:   make(map[primitive.ObjectID]models.User),
+		tokens:  make(map[primitive.ObjectID]models.RefreshToken),
+		revoked: make(map[string]models.RevokedToken),
+		uploads: make(map[primitive.ObjectID]models.UploadSession),
+		groups:  make(map[primitive.ObjectID]models.Group),
+
+		groupShares: make(map[primitive.ObjectID]models.GroupShare),
+	}
+}
+
+func (db *memoryDB) stores(blobs BlobStore) Stores {
+	return Stores{
+		Blobs:   blobs,
+		Notes:   &memoryNoteStore{db: db},
+		Shares:  &memoryShareStore{db: db},
+		Users:   &memoryUserStore{db: db},
+		Tokens:  &memoryTokenStore{db: db},
+		KeyLog:  &memoryKeyLogStore{db: db},
+		Uploads: &memoryUploadStore{db: db},
+		Groups:  &memoryGroupStore{db: db},
+		Tx:      &memoryTransactor{db: db},
+	}
+}
+
+// Tạo bộ store chỉ lưu trên RAM (mất dữ liệu khi tắt server), blob cũng trên RAM
+func NewMemory() Stores {
+	return newMemoryDB("").stores(newMemoryBlobStore())
+}
+
+// Tạo bộ store lưu trên RAM và đồng bộ xuống file path
+// Nếu file đã tồn tại thì nạp lại dữ liệu cũ
+// Blob lưu trong thư mục cạnh file (notes_data.json -> notes_data_blobs/)
+func NewFile(path string) (Stores, error) {
+	db := newMemoryDB(path)
+	if err := db.load(); err != nil {
+		return Stores{}, err
+	}
+	blobs, err := NewLocalBlobStore(strings.TrimSuffix(path, filepath.Ext(path)) + "_blobs")
+	if err != nil {
+		return Stores{}, err
+	}
+	return db.stores(blobs), nil
+}
+
+func (db *memoryDB) load() error {
+	data, err := os.ReadFile(db.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("không đọc được file dữ liệu: %w", err)
+	}
+
+	var snap memorySnapshot
+	if err := bson.UnmarshalExtJSON(data, true, &snap); err != nil {
+		return fmt.Errorf("file dữ liệu bị lỗi: %w", err)
+	}
+	db.restore(snap)
+	return nil
+}
+
+// Ghi toàn bộ dữ liệu xuống file, gọi khi đang giữ khóa
+// Ghi ra file tạm rồi rename để không bao giờ để lại file ghi dở
+func (db *memoryDB) persist() error {
+	if db.path == "" {
+		return nil
+	}
+
+	data, err := bson.MarshalExtJSONIndent(db.snapshot(), true, false, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(db.path), filepath.Base(db.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), db.path)
+}
+
+// Sao chép toàn bộ dữ liệu, gọi khi đang giữ khóa
+func (db *memoryDB) snapshot() memorySnapshot {
+	snap := memorySnapshot{
+		Notes:   sortedValues(db.notes),
+		Urls:    sortedValues(db.urls),
+		Users:   sortedValues(db.users),
+		Tokens:  sortedValues(db.tokens),
+		Revoked: make([]models.RevokedToken, 0, len(db.revoked)),
+		KeyLog:  append([]models.KeyLogEntry{}, db.keyLog...),
+		Uploads: sortedValues(db.uploads),
+		Groups:  sortedValues(db.groups),
+
+		GroupShares: sortedValues(db.groupShares),
+	}
+	for _, r := range db.revoked {
+		snap.Revoked = append(snap.Revoked, r)
+	}
+	return snap
+}
+
+// Nạp lại dữ liệu từ bản sao, gọi khi đang giữ khóa
+func (db *memoryDB) restore(snap memorySnapshot) {
+	db.notes = make(map[primitive.ObjectID]models.Note)
+	db.urls = make(map[primitive.ObjectID]models.Url)
+	db.users = make(map[primitive.ObjectID]models.User)
+	db.tokens = make(map[primitive.ObjectID]models.RefreshToken)
+	db.revoked = make(map[string]models.RevokedToken)
+	db.keyLog = append([]models.KeyLogEntry{}, snap.KeyLog...)
+	db.uploads = make(map[primitive.ObjectID]models.UploadSession)
+	db.groups = make(map[primitive.ObjectID]models.Group)
+	db.groupShares = make(map[primitive.ObjectID]models.GroupShare)
+	for _, g := range snap.Groups {
+		db.groups[g.ID] = g
+	}
+	for _, gs := range snap.GroupShares {
+		db.groupShares[gs.ID] = gs
+	}
+	for _, u := range snap.Uploads {
+		db.uploads[u.ID] = withChunks(u)
+	}
+	for _, n := range snap.Notes {
+		db.notes[n.ID] = n
+	}
+	for _, u := range snap.Urls {
+		db.urls[u.ID] = u
+	}
+	for _, u := range snap.Users {
+		db.users[u.ID] = u
+	}
+	for _, t := range snap.Tokens {
+		db.tokens[t.ID] = t
+	}
+	for _, r := range snap.Revoked {
+		db.revoked[r.JTI] = r
+	}
+}
+
+// Transaction trên RAM: chụp lại dữ liệu trước khi chạy fn, fn lỗi thì khôi phục bản chụp
+// Các transaction chạy tuần tự với nhau. Đây là bộ lưu trữ cho dev/CI nên không cô lập
+// với các thao tác lẻ (ngoài transaction) chạy xen giữa
+func (t *memoryTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.db.txMu.Lock()
+	defer t.db.txMu.Unlock()
+
+	t.db.mu.Lock()
+	before := t.db.snapshot()
+	t.db.mu.Unlock()
+
+	if err := fn(ctx); err != nil {
+		t.db.mu.Lock()
+		defer t.db.mu.Unlock()
+		t.db.restore(before)
+		if perr := t.db.persist(); perr != nil {
+			return perr
+		}
+		return err
+	}
+	return nil
+}
+
+// Mô phỏng TTL Index của Mongo: xóa các url đã hết hạn, gọi khi đang giữ khóa
+func (db *memoryDB) pruneExpiredUrls() {
+	now := time.Now()
+	for id, u := range db.urls {
+		if now.After(u.ExpiresAt) {
+			delete(db.urls, id)
+		}
+	}
+}
+
+// Trả về các giá trị của map theo thứ tự tạo (ObjectID tăng dần)
+func sortedValues[T any](m map[primitive.ObjectID]T) []T {
+	ids := make([]primitive.ObjectID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Hex() < ids[j].Hex() })
+
+	values := make([]T, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, m[id])
+	}
+	return values
+}
+
+// Áp dụng page lên items (đã sắp xếp theo ID): sắp xếp lại, bỏ các phần tử đến hết cursor, cắt theo Limit
+func paginate[T any](items []T, page models.PageQuery, cursor func(T) models.PageCursor) []T {
+	sort.SliceStable(items, func(i, j int) bool {
+		cmp := cursor(items[i]).Compare(cursor(items[j]))
+		if page.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	if page.After != nil {
+		start := len(items)
+		for i, item := range items {
+			cmp := cursor(item).Compare(*page.After)
+			if (page.Desc && cmp < 0) || (!page.Desc && cmp > 0) {
+				start = i
+				break
+			}
+		}
+		items = items[start:]
+	}
+	if page.Limit > 0 && len(items) > page.Limit {
+		items = items[:page.Limit]
+	}
+	return items
+}
+
+// --------------------- NOTES ---------------------
+
+func (s *memoryNoteStore) Create(ctx context.Context, note models.Note) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if note.ID.IsZero() {
+		note.ID = primitive.NewObjectID()
+	}
+	s.db.notes[note.ID] = note
+	return note.ID.Hex(), s.db.persist()
+}
+
+func (s *memoryNoteStore) FindByID(ctx context.Context, noteID string) (models.Note, error) {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return models.Note{}, ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	note, ok := s.db.notes[id]
+	if !ok {
+		return models.Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+func (s *memoryNoteStore) ListByOwner(ctx context.Context, ownerID string) ([]models.Note, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	notes := make([]models.Note, 0)
+	for _, n := range sortedValues(s.db.notes) {
+		if n.OwnerID == ownerID {
+			notes = append(notes, n)
+		}
+	}
+	return notes, nil
+}
+
+func (s *memoryNoteStore) ListActiveByOwner(ctx context.Context, ownerID string, page models.PageQuery) ([]models.Note, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	notes := make([]models.Note, 0)
+	for _, n := range sortedValues(s.db.notes) {
+		if n.OwnerID == ownerID && !n.InTrash() {
+			notes = append(notes, n)
+		}
+	}
+	return paginate(notes, page, page.NoteCursor), nil
+}
+
+func (s *memoryNoteStore) ListTrashedBefore(ctx context.Context, cutoff time.Time) ([]models.Note, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	notes := make([]models.Note, 0)
+	for _, n := range sortedValues(s.db.notes) {
+		if n.InTrash() && !n.DeletedAt.After(cutoff) {
+			notes = append(notes, n)
+		}
+	}
+	return notes, nil
+}
+
+func (s *memoryNoteStore) List(ctx context.Context) ([]models.Note, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return sortedValues(s.db.notes), nil
+}
+
+func (s *memoryNoteStore) Delete(ctx context.Context, noteID string) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.notes[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.db.notes, id)
+	return s.db.persist()
+}
+
+func (s *memoryNoteStore) UpdateEncryptedKey(ctx context.Context, noteID, ownerID, encryptedAesKey string) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	note, ok := s.db.notes[id]
+	if !ok || note.OwnerID != ownerID {
+		return ErrNotFound
+	}
+	note.EncryptedAesKey = encryptedAesKey
+	s.db.notes[id] = note
+	return s.db.persist()
+}
+
+func (s *memoryNoteStore) SetContent(ctx context.Context, noteID, ownerID, blobRef string, size int64, cipherDigest string) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	note, ok := s.db.notes[id]
+	if !ok || note.OwnerID != ownerID || note.BlobRef != "" || note.CipherText != "" {
+		return ErrNotFound
+	}
+	note.BlobRef = blobRef
+	note.Size = size
+	note.CipherDigest = cipherDigest
+	note.Revision = 1
+	note.UpdatedAt = time.Now()
+	s.db.notes[id] = note
+	return s.db.persist()
+}
+
+func (s *memoryNoteStore) UpdateContent(ctx context.Context, noteID, ownerID string, baseRevision int, current models.NoteRevision, history []models.NoteRevision) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	note, ok := s.db.notes[id]
+	if !ok || note.OwnerID != ownerID || !note.HasContent() || note.CurrentRevisionNumber() != baseRevision {
+		return ErrNotFound
+	}
+	note.Revision = current.Number
+	note.BlobRef, note.Size, note.CipherDigest, note.CipherText = current.BlobRef, current.Size, current.CipherDigest, current.CipherText
+	note.EncryptedMetadata, note.UpdatedAt = current.EncryptedMetadata, current.CreatedAt
+	note.History = history
+	s.db.notes[id] = note
+	return s.db.persist()
+}
+
+func (s *memoryNoteStore) SetDeletedAt(ctx context.Context, noteID, ownerID string, deletedAt *time.Time) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	note, ok := s.db.notes[id]
+	if !ok || note.OwnerID != ownerID || note.InTrash() == (deletedAt != nil) {
+		return ErrNotFound
+	}
+	note.DeletedAt = deletedAt
+	s.db.notes[id] = note
+	return s.db.persist()
+}
+
+// --------------------- URLS ---------------------
+
+func (s *memoryShareStore) Create(ctx context.Context, url models.Url) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if url.ID.IsZero() {
+		url.ID = primitive.NewObjectID()
+	}
+	s.db.urls[url.ID] = url
+	return url.ID.Hex(), s.db.persist()
+}
+
+func (s *memoryShareStore) FindByID(ctx context.Context, urlID string) (models.Url, error) {
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return models.Url{}, ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.pruneExpiredUrls()
+	url, ok := s.db.urls[id]
+	if !ok {
+		return models.Url{}, ErrNotFound
+	}
+	return url, nil
+}
+
+func (s *memoryShareStore) FindByNoteAndReceiver(ctx context.Context, noteID, receiver string) (models.Url, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.pruneExpiredUrls()
+	for _, u := range sortedValues(s.db.urls) {
+		if u.NoteID == noteID && u.Receiver == receiver {
+			return u, nil
+		}
+	}
+	return models.Url{}, ErrNotFound
+}
+
+func (s *memoryShareStore) ListByNote(ctx context.Context, noteID string) ([]models.Url, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.pruneExpiredUrls()
+	urls := make([]models.Url, 0)
+	for _, u := range sortedValues(s.db.urls) {
+		if u.NoteID == noteID {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+func (s *memoryShareStore) ListByReceiver(ctx context.Context, receiver string, filter models.ShareFilter, page models.PageQuery) ([]models.Url, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.pruneExpiredUrls()
+	now := time.Now()
+	urls := make([]models.Url, 0)
+	for _, u := range sortedValues(s.db.urls) {
+		if u.Receiver != receiver || (filter.Sender != "" && u.Sender != filter.Sender) || !filter.MatchState(u, now) {
+			continue
+		}
+		urls = append(urls, u)
+	}
+	return paginate(urls, page, page.UrlCursor), nil
+}
+
+func (s *memoryShareStore) Access(ctx context.Context, urlID string) (models.Url, error) {
+	return s.increment(urlID, models.UrlViews)
+}
+
+func (s *memoryShareStore) RecordFailedAttempt(ctx context.Context, urlID string) (models.Url, error) {
+	return s.increment(urlID, models.UrlFailedAttempts)
+}
+
+// Tăng bộ đếm của link (lượt xem hoặc lượt nhập sai), xóa link khi hết hạn hoặc chạm giới hạn
+func (s *memoryShareStore) increment(urlID string, counter models.UrlCounter) (models.Url, error) {
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return models.Url{}, ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// Kiểm tra hạn dùng, giới hạn và tăng bộ đếm đều nằm trong khóa -> nguyên tử
+	url, ok := s.db.urls[id]
+	if !ok {
+		return models.Url{}, ErrNotFound
+	}
+	current, limit := counter.Of(&url)
+
+	// Hết hạn hoặc đã chạm giới hạn thì xóa luôn
+	if !time.Now().Before(url.ExpiresAt) || *current >= limit {
+		delete(s.db.urls, id)
+		if err := s.db.persist(); err != nil {
+			return models.Url{}, err
+		}
+		if *current >= limit {
+			return models.Url{}, counter.Exhausted
+		}
+		return models.Url{}, models.ErrUrlExpired
+	}
+
+	// Tăng bộ đếm, xóa nếu đã chạm giới hạn
+	*current++
+	if *current >= limit {
+		delete(s.db.urls, id)
+	} else {
+		s.db.urls[id] = url
+	}
+	return url, s.db.persist()
+}
+
+func (s *memoryShareStore) List(ctx context.Context) ([]models.Url, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.pruneExpiredUrls()
+	return sortedValues(s.db.urls), nil
+}
+
+func (s *memoryShareStore) Delete(ctx context.Context, urlID string) error {
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.urls[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.db.urls, id)
+	return s.db.persist()
+}
+
+func (s *memoryShareStore) deleteWhere(match func(models.Url) bool) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var count int64
+	for id, u := range s.db.urls {
+		if match(u) {
+			delete(s.db.urls, id)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return count, s.db.persist()
+}
+
+func (s *memoryShareStore) DeleteByNote(ctx context.Context, noteID string) (int64, error) {
+	return s.deleteWhere(func(u models.Url) bool {
+		return u.NoteID == noteID
+	})
+}
+
+func (s *memoryShareStore) DeleteByNoteAndSender(ctx context.Context, noteID, sender string) (int64, error) {
+	return s.deleteWhere(func(u models.Url) bool {
+		return u.NoteID == noteID && u.Sender == sender
+	})
+}
+
+// --------------------- USERS ---------------------
+
+func (s *memoryUserStore) Create(ctx context.Context, user models.User) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	s.db.users[user.ID] = user
+	return user.ID.Hex(), s.db.persist()
+}
+
+func (s *memoryUserStore) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, u := range s.db.users {
+		if u.Username == username {
+			return u, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (s *memoryUserStore) IncrementTokenVersion(ctx context.Context, username string) (int, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, u := range s.db.users {
+		if u.Username == username {
+			u.TokenVersion++
+			s.db.users[id] = u
+			return u.TokenVersion, s.db.persist()
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (s *memoryUserStore) UpdateCredentials(ctx context.Context, username, encryptedPassword, salt, encryptedPrivKey, encryptedLegacyPrivKey, encryptedSigningPrivKey string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, u := range s.db.users {
+		if u.Username == username {
+			u.EncryptedPassword = encryptedPassword
+			u.Salt = salt
+			u.EncryptedPrivKey = encryptedPrivKey
+			if encryptedLegacyPrivKey != "" {
+				u.EncryptedLegacyPrivKey = encryptedLegacyPrivKey
+			}
+			if encryptedSigningPrivKey != "" {
+				u.EncryptedSigningPrivKey = encryptedSigningPrivKey
+			}
+			s.db.users[id] = u
+			return s.db.persist()
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryUserStore) UpgradeKey(ctx context.Context, username, pubKey, keyType, encryptedPrivKey string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, u := range s.db.users {
+		if u.Username == username && u.KeyType() == models.KeyTypeDH {
+			u.LegacyPubKey = u.PubKey
+			u.EncryptedLegacyPrivKey = u.EncryptedPrivKey
+			u.PubKey = pubKey
+			u.PubKeyType = keyType
+			u.EncryptedPrivKey = encryptedPrivKey
+			s.db.users[id] = u
+			return s.db.persist()
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryUserStore) SetSigningKey(ctx context.Context, username, signingPubKey, encryptedSigningPrivKey string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, u := range s.db.users {
+		if u.Username == username && u.SigningPubKey == "" {
+			u.SigningPubKey = signingPubKey
+			u.EncryptedSigningPrivKey = encryptedSigningPrivKey
+			s.db.users[id] = u
+			return s.db.persist()
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryUserStore) List(ctx context.Context) ([]models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return sortedValues(s.db.users), nil
+}
+
+func (s *memoryUserStore) Exists(ctx context.Context, username string) (bool, error) {
+	_, err := s.FindByUsername(ctx, username)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// --------------------- REFRESH TOKENS ---------------------
+
+func (s *memoryTokenStore) Create(ctx context.Context, token models.RefreshToken) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if token.ID.IsZero() {
+		token.ID = primitive.NewObjectID()
+	}
+	s.db.tokens[token.ID] = token
+	return token.ID.Hex(), s.db.persist()
+}
+
+func (s *memoryTokenStore) FindByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, t := range s.db.tokens {
+		if t.TokenHash == tokenHash {
+			return t, nil
+		}
+	}
+	return models.RefreshToken{}, ErrNotFound
+}
+
+func (s *memoryTokenStore) MarkUsed(ctx context.Context, tokenID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return false, ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	t, ok := s.db.tokens[id]
+	if !ok || t.Used || t.Revoked {
+		return false, nil
+	}
+	t.Used = true
+	s.db.tokens[id] = t
+	return true, s.db.persist()
+}
+
+func (s *memoryTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, t := range s.db.tokens {
+		if t.FamilyID == familyID {
+			t.Revoked = true
+			s.db.tokens[id] = t
+		}
+	}
+	return s.db.persist()
+}
+
+func (s *memoryTokenStore) RevokeUser(ctx context.Context, userID string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for id, t := range s.db.tokens {
+		if t.UserID == userID {
+			t.Revoked = true
+			s.db.tokens[id] = t
+		}
+	}
+	return s.db.persist()
+}
+
+func (s *memoryTokenStore) RevokeAccessToken(ctx context.Context, revoked models.RevokedToken) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.revoked[revoked.JTI] = revoked
+	return s.db.persist()
+}
+
+func (s *memoryTokenStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	r, ok := s.db.revoked[jti]
+	if ok && time.Now().After(r.ExpiresAt) {
+		// Token đã tự hết hạn, không cần giữ trong danh sách thu hồi nữa
+		delete(s.db.revoked, jti)
+		return false, nil
+	}
+	return ok, nil
+}
+
+// --------------------- KEY LOG ---------------------
+
+func (s *memoryKeyLogStore) Append(ctx context.Context, entry models.KeyLogEntry) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	entry.Index = int64(len(s.db.keyLog))
+	s.db.keyLog = append(s.db.keyLog, entry)
+	return entry.Index, s.db.persist()
+}
+
+func (s *memoryKeyLogStore) List(ctx context.Context, size int64) ([]models.KeyLogEntry, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if size > int64(len(s.db.keyLog)) {
+		size = int64(len(s.db.keyLog))
+	}
+	if size < 0 {
+		size = 0
+	}
+	return append([]models.KeyLogEntry{}, s.db.keyLog[:size]...), nil
+}
+
+func (s *memoryKeyLogStore) Size(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return int64(len(s.db.keyLog)), nil
+}
+
+func (s *memoryKeyLogStore) Get(ctx context.Context, index int64) (models.KeyLogEntry, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if index < 0 || index >= int64(len(s.db.keyLog)) {
+		return models.KeyLogEntry{}, ErrNotFound
+	}
+	return s.db.keyLog[index], nil
+}
+
+func (s *memoryKeyLogStore) LatestByUsername(ctx context.Context, username string) (models.KeyLogEntry, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for i := len(s.db.keyLog) - 1; i >= 0; i-- {
+		if s.db.keyLog[i].Username == username {
+			return s.db.keyLog[i], nil
+		}
+	}
+	return models.KeyLogEntry{}, ErrNotFound
+}
+
+// --------------------- UPLOAD SESSIONS ---------------------
+
+// Bản sao có map Chunks riêng, tránh sửa chung map giữa bản lưu và bản trả ra ngoài
+func withChunks(u models.UploadSession) models.UploadSession {
+	chunks := make(map[string]string, len(u.Chunks))
+	for k, v := range u.Chunks {
+		chunks[k] = v
+	}
+	u.Chunks = chunks
+	return u
+}
+
+func (s *memoryUploadStore) Create(ctx context.Context, session models.UploadSession) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	s.db.uploads[session.ID] = withChunks(session)
+	return session.ID.Hex(), s.db.persist()
+}
+
+// Phiên còn hạn, gọi khi đang giữ khóa
+func (s *memoryUploadStore) find(uploadID string) (models.UploadSession, error) {
+	id, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return models.UploadSession{}, ErrInvalidID
+	}
+	session, ok := s.db.uploads[id]
+	if !ok || !time.Now().Before(session.ExpiresAt) {
+		return models.UploadSession{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *memoryUploadStore) FindByID(ctx context.Context, uploadID string) (models.UploadSession, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	session, err := s.find(uploadID)
+	if err != nil {
+		return session, err
+	}
+	return withChunks(session), nil
+}
+
+func (s *memoryUploadStore) SetChunk(ctx context.Context, uploadID string, index int, blobRef string) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	session, err := s.find(uploadID)
+	if err != nil {
+		return "", err
+	}
+	session = withChunks(session)
+	key := strconv.Itoa(index)
+	old := session.Chunks[key]
+	session.Chunks[key] = blobRef
+	s.db.uploads[session.ID] = session
+	return old, s.db.persist()
+}
+
+func (s *memoryUploadStore) Delete(ctx context.Context, uploadID string) error {
+	id, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.uploads[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.db.uploads, id)
+	return s.db.persist()
+}
+
+// Các phiên thỏa keep, sắp theo ID
+func (s *memoryUploadStore) listWhere(keep func(models.UploadSession) bool) []models.UploadSession {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	sessions := make([]models.UploadSession, 0)
+	for _, u := range sortedValues(s.db.uploads) {
+		if keep(u) {
+			sessions = append(sessions, withChunks(u))
+		}
+	}
+	return sessions
+}
+
+func (s *memoryUploadStore) ListExpired(ctx context.Context, cutoff time.Time) ([]models.UploadSession, error) {
+	return s.listWhere(func(u models.UploadSession) bool {
+		return !u.ExpiresAt.After(cutoff)
+	}), nil
+}
+
+func (s *memoryUploadStore) ListByNote(ctx context.Context, noteID string) ([]models.UploadSession, error) {
+	return s.listWhere(func(u models.UploadSession) bool {
+		return u.NoteID == noteID
+	}), nil
+}
+
+func (s *memoryUploadStore) DeleteByNote(ctx context.Context, noteID string) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var n int64
+	for id, u := range s.db.uploads {
+		if u.NoteID == noteID {
+			delete(s.db.uploads, id)
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.db.persist()
+}
+
+func (s *memoryGroupStore) Create(ctx context.Context, group models.Group) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if group.ID.IsZero() {
+		group.ID = primitive.NewObjectID()
+	}
+	group.Members = append([]models.GroupMember{}, group.Members...)
+	s.db.groups[group.ID] = group
+	return group.ID.Hex(), s.db.persist()
+}
+
+// Nhóm theo ID, gọi khi đang giữ khóa
+func (s *memoryGroupStore) find(groupID string) (models.Group, error) {
+	id, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return models.Group{}, ErrInvalidID
+	}
+	group, ok := s.db.groups[id]
+	if !ok {
+		return models.Group{}, ErrNotFound
+	}
+	return group, nil
+}
+
+func (s *memoryGroupStore) FindByID(ctx context.Context, groupID string) (models.Group, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	group, err := s.find(groupID)
+	group.Members = append([]models.GroupMember{}, group.Members...)
+	return group, err
+}
+
+func (s *memoryGroupStore) ListByMember(ctx context.Context, username string) ([]models.Group, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	groups := make([]models.Group, 0)
+	for _, g := range sortedValues(s.db.groups) {
+		if _, ok := g.Member(username); ok {
+			g.Members = append([]models.GroupMember{}, g.Members...)
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// Danh sách thành viên luôn được thay bằng slice mới để không sửa vào bản chụp của transaction
+func (s *memoryGroupStore) AddMember(ctx context.Context, groupID string, keyVersion int, member models.GroupMember) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	group, err := s.find(groupID)
+	if err != nil {
+		return err
+	}
+	if _, exists := group.Member(member.Username); exists || group.KeyVersion != keyVersion {
+		return ErrNotFound
+	}
+	group.Members = append(append([]models.GroupMember{}, group.Members...), member)
+	s.db.groups[group.ID] = group
+	return s.db.persist()
+}
+
+func (s *memoryGroupStore) SetMemberRole(ctx context.Context, groupID, username, role string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	group, err := s.find(groupID)
+	if err != nil {
+		return err
+	}
+	members := append([]models.GroupMember{}, group.Members...)
+	for i, m := range members {
+		if m.Username == username && m.Role != models.GroupRoleOwner {
+			members[i].Role = role
+			group.Members = members
+			s.db.groups[group.ID] = group
+			return s.db.persist()
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *memoryGroupStore) RotateKey(ctx context.Context, groupID string, baseVersion int, members []models.GroupMember) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	group, err := s.find(groupID)
+	if err != nil {
+		return err
+	}
+	if group.KeyVersion != baseVersion {
+		return ErrNotFound
+	}
+	group.Members = append([]models.GroupMember{}, members...)
+	group.KeyVersion++
+	s.db.groups[group.ID] = group
+	return s.db.persist()
+}
+
+func (s *memoryGroupStore) CreateShare(ctx context.Context, share models.GroupShare) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, gs := range s.db.groupShares {
+		if gs.GroupID == share.GroupID && gs.NoteID == share.NoteID {
+			return "", ErrDuplicate
+		}
+	}
+	if share.ID.IsZero() {
+		share.ID = primitive.NewObjectID()
+	}
+	s.db.groupShares[share.ID] = share
+	return share.ID.Hex(), s.db.persist()
+}
+
+func (s *memoryGroupStore) FindShare(ctx context.Context, groupID, noteID string) (models.GroupShare, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, gs := range s.db.groupShares {
+		if gs.GroupID == groupID && gs.NoteID == noteID {
+			return gs, nil
+		}
+	}
+	return models.GroupShare{}, ErrNotFound
+}
+
+func (s *memoryGroupStore) ListShares(ctx context.Context, groupID string) ([]models.GroupShare, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	shares := make([]models.GroupShare, 0)
+	for _, gs := range sortedValues(s.db.groupShares) {
+		if gs.GroupID == groupID {
+			shares = append(shares, gs)
+		}
+	}
+	return shares, nil
+}
+
+func (s *memoryGroupStore) ListAllShares(ctx context.Context) ([]models.GroupShare, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return sortedValues(s.db.groupShares), nil
+}
+
+func (s *memoryGroupStore) UpdateShareKey(ctx context.Context, shareID string, keyVersion int, encryptedAESKey string) error {
+	id, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	share, ok := s.db.groupShares[id]
+	if !ok {
+		return ErrNotFound
+	}
+	share.KeyVersion, share.EncryptedAESKey = keyVersion, encryptedAESKey
+	s.db.groupShares[id] = share
+	return s.db.persist()
+}
+
+func (s *memoryGroupStore) DeleteShare(ctx context.Context, shareID string) error {
+	id, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if _, ok := s.db.groupShares[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.db.groupShares, id)
+	return s.db.persist()
+}
+
+func (s *memoryGroupStore) DeleteSharesByNote(ctx context.Context, noteID string) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var deleted int64
+	for id, gs := range s.db.groupShares {
+		if gs.NoteID == noteID {
+			delete(s.db.groupShares, id)
+			deleted++
+		}
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+	return deleted, s.db.persist()
+}
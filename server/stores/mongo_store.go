@@ -0,0 +1,1026 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"note_sharing_application/server/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Cài đặt store trên MongoDB
+type mongoNoteStore struct{ coll *mongo.Collection }
+type mongoShareStore struct{ coll *mongo.Collection }
+type mongoUserStore struct{ coll *mongo.Collection }
+type mongoTokenStore struct {
+	coll    *mongo.Collection
+	revoked *mongo.Collection
+}
+
+type mongoKeyLogStore struct{ coll *mongo.Collection }
+
+type mongoUploadStore struct{ coll *mongo.Collection }
+
+type mongoGroupStore struct {
+	coll   *mongo.Collection
+	shares *mongo.Collection
+}
+
+// Blob lưu trong GridFS bucket "note_blobs" (collection note_blobs.files và note_blobs.chunks)
+type gridfsBlobStore struct{ db *mongo.Database }
+
+type mongoTransactor struct{ client *mongo.Client }
+
+// Tạo bộ store dùng các collection "notes", "urls", "users", "refresh_tokens", "revoked_tokens", "key_log",
+// "upload_sessions", "groups", "group_shares" và GridFS bucket "note_blobs" của db
+func NewMongo(db *mongo.Database) Stores {
+	return Stores{
+		Tx:      &mongoTransactor{client: db.Client()},
+		Notes:   &mongoNoteStore{coll: db.Collection("notes")},
+		Shares:  &mongoShareStore{coll: db.Collection("urls")},
+		Users:   &mongoUserStore{coll: db.Collection("users")},
+		Tokens:  &mongoTokenStore{coll: db.Collection("refresh_tokens"), revoked: db.Collection("revoked_tokens")},
+		KeyLog:  &mongoKeyLogStore{coll: db.Collection("key_log")},
+		Blobs:   NewGridFSBlobStore(db),
+		Uploads: &mongoUploadStore{coll: db.Collection("upload_sessions")},
+		Groups:  &mongoGroupStore{coll: db.Collection("groups"), shares: db.Collection("group_shares")},
+	}
+}
+
+// Tạo BlobStore trên GridFS của db
+func NewGridFSBlobStore(db *mongo.Database) BlobStore {
+	return &gridfsBlobStore{db: db}
+}
+
+// Đổi lỗi của driver sang lỗi chung của package
+func mongoErr(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func insertedHex(res *mongo.InsertOneResult) (string, error) {
+	if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+		return oid.Hex(), nil
+	}
+	return "", errors.New("không đọc được ID vừa tạo")
+}
+
+// Transaction của Mongo chỉ chạy được trên replica set (hoặc mongos)
+// ctx truyền vào fn là SessionContext nên mọi thao tác store dùng ctx đó đều nằm trong transaction
+func (t *mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// --------------------- NOTES ---------------------
+
+func (s *mongoNoteStore) Create(ctx context.Context, note models.Note) (string, error) {
+	res, err := s.coll.InsertOne(ctx, note)
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+func (s *mongoNoteStore) FindByID(ctx context.Context, noteID string) (models.Note, error) {
+	var note models.Note
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return note, ErrInvalidID
+	}
+	err = s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&note)
+	return note, mongoErr(err)
+}
+
+func (s *mongoNoteStore) ListByOwner(ctx context.Context, ownerID string) ([]models.Note, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"owner_id": ownerID})
+	if err != nil {
+		return nil, err
+	}
+
+	// load vào notes thực sự, All() = duyệt, decode, đóng cursor
+	notes := make([]models.Note, 0)
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (s *mongoNoteStore) ListActiveByOwner(ctx context.Context, ownerID string, page models.PageQuery) ([]models.Note, error) {
+	filter, opts := mongoPage(bson.M{"owner_id": ownerID, "deleted_at": nil}, page)
+	cursor, err := s.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]models.Note, 0)
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (s *mongoNoteStore) ListTrashedBefore(ctx context.Context, cutoff time.Time) ([]models.Note, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"deleted_at": bson.M{"$ne": nil, "$lte": cutoff}})
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]models.Note, 0)
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (s *mongoNoteStore) List(ctx context.Context) ([]models.Note, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	notes := make([]models.Note, 0)
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+func (s *mongoNoteStore) Delete(ctx context.Context, noteID string) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoNoteStore) UpdateEncryptedKey(ctx context.Context, noteID, ownerID, encryptedAesKey string) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	filter := bson.M{"_id": id, "owner_id": ownerID}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"encrypted_aes_key": encryptedAesKey}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoNoteStore) SetContent(ctx context.Context, noteID, ownerID, blobRef string, size int64, cipherDigest string) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	// Note chưa có nội dung: chưa có blob và không có ciphertext inline (note cũ)
+	filter := bson.M{
+		"_id":         id,
+		"owner_id":    ownerID,
+		"blob_ref":    bson.M{"$in": bson.A{nil, ""}},
+		"cipher_text": bson.M{"$in": bson.A{nil, ""}},
+	}
+	update := bson.M{"$set": bson.M{
+		"blob_ref":      blobRef,
+		"size":          size,
+		"cipher_digest": cipherDigest,
+		"revision":      1,
+		"updated_at":    time.Now(),
+	}}
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoNoteStore) UpdateContent(ctx context.Context, noteID, ownerID string, baseRevision int, current models.NoteRevision, history []models.NoteRevision) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	// Note cũ chưa có trường revision được coi là phiên bản 1
+	revision := bson.M{"$eq": baseRevision}
+	if baseRevision == 1 {
+		revision = bson.M{"$in": bson.A{nil, 0, 1}}
+	}
+	filter := bson.M{"_id": id, "owner_id": ownerID, "revision": revision}
+
+	set := bson.M{
+		"revision":      current.Number,
+		"blob_ref":      current.BlobRef,
+		"size":          current.Size,
+		"cipher_digest": current.CipherDigest,
+		"updated_at":    current.CreatedAt,
+		"history":       history,
+	}
+	unset := bson.M{}
+	// Trường rỗng thì xóa khỏi document thay vì ghi chuỗi rỗng (giống omitempty)
+	if current.CipherText != "" {
+		set["cipher_text"] = current.CipherText
+	} else {
+		unset["cipher_text"] = ""
+	}
+	if current.EncryptedMetadata != "" {
+		set["encrypted_metadata"] = current.EncryptedMetadata
+	} else {
+		unset["encrypted_metadata"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoNoteStore) SetDeletedAt(ctx context.Context, noteID, ownerID string, deletedAt *time.Time) error {
+	id, err := primitive.ObjectIDFromHex(noteID)
+	if err != nil {
+		return ErrInvalidID
+	}
+
+	filter := bson.M{"_id": id, "owner_id": ownerID}
+	var update bson.M
+	if deletedAt != nil {
+		filter["deleted_at"] = nil
+		update = bson.M{"$set": bson.M{"deleted_at": *deletedAt}}
+	} else {
+		filter["deleted_at"] = bson.M{"$ne": nil}
+		update = bson.M{"$unset": bson.M{"deleted_at": ""}}
+	}
+
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// --------------------- BLOBS (GridFS) ---------------------
+
+// Bucket không dùng chung được giữa nhiều goroutine nên mỗi thao tác tạo 1 bucket mới (rẻ)
+func (s *gridfsBlobStore) bucket() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(s.db, options.GridFSBucket().SetName("note_blobs"))
+}
+
+func (s *gridfsBlobStore) Put(ctx context.Context, r io.Reader) (string, int64, error) {
+	bucket, err := s.bucket()
+	if err != nil {
+		return "", 0, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetWriteDeadline(deadline)
+	}
+
+	upload, err := bucket.OpenUploadStream("note")
+	if err != nil {
+		return "", 0, err
+	}
+	size, err := io.Copy(upload, r)
+	if err != nil {
+		// Xóa các chunk đã ghi
+		upload.Abort()
+		return "", 0, err
+	}
+	if err := upload.Close(); err != nil {
+		return "", 0, err
+	}
+
+	id, ok := upload.FileID.(primitive.ObjectID)
+	if !ok {
+		return "", 0, errors.New("không đọc được ID blob vừa tạo")
+	}
+	return id.Hex(), size, nil
+}
+
+func (s *gridfsBlobStore) Open(ctx context.Context, ref string) (io.ReadCloser, error) {
+	id, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	bucket, err := s.bucket()
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		bucket.SetReadDeadline(deadline)
+	}
+
+	stream, err := bucket.OpenDownloadStream(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s *gridfsBlobStore) Delete(ctx context.Context, ref string) error {
+	id, err := primitive.ObjectIDFromHex(ref)
+	if err != nil {
+		return ErrNotFound
+	}
+	bucket, err := s.bucket()
+	if err != nil {
+		return err
+	}
+
+	err = bucket.DeleteContext(ctx, id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// --------------------- UPLOAD SESSIONS ---------------------
+
+func (s *mongoUploadStore) Create(ctx context.Context, session models.UploadSession) (string, error) {
+	if session.Chunks == nil {
+		session.Chunks = map[string]string{}
+	}
+	res, err := s.coll.InsertOne(ctx, session)
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+// TTL index của Mongo xóa trễ (tới ~1 phút) nên vẫn lọc theo expires_at
+func liveUploadFilter(id primitive.ObjectID) bson.M {
+	return bson.M{"_id": id, "expires_at": bson.M{"$gt": time.Now()}}
+}
+
+func (s *mongoUploadStore) FindByID(ctx context.Context, uploadID string) (models.UploadSession, error) {
+	id, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return models.UploadSession{}, ErrInvalidID
+	}
+	var session models.UploadSession
+	err = s.coll.FindOne(ctx, liveUploadFilter(id)).Decode(&session)
+	return session, mongoErr(err)
+}
+
+func (s *mongoUploadStore) SetChunk(ctx context.Context, uploadID string, index int, blobRef string) (string, error) {
+	id, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return "", ErrInvalidID
+	}
+	key := strconv.Itoa(index)
+
+	// Trả về document trước khi cập nhật để biết blob cũ của chunk (nếu chunk được gửi lại)
+	var before models.UploadSession
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	update := bson.M{"$set": bson.M{"chunks." + key: blobRef}}
+	err = s.coll.FindOneAndUpdate(ctx, liveUploadFilter(id), update, opts).Decode(&before)
+	if err != nil {
+		return "", mongoErr(err)
+	}
+	return before.Chunks[key], nil
+}
+
+func (s *mongoUploadStore) Delete(ctx context.Context, uploadID string) error {
+	id, err := primitive.ObjectIDFromHex(uploadID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoUploadStore) list(ctx context.Context, filter bson.M) ([]models.UploadSession, error) {
+	cursor, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]models.UploadSession, 0)
+	if err = cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (s *mongoUploadStore) ListExpired(ctx context.Context, cutoff time.Time) ([]models.UploadSession, error) {
+	return s.list(ctx, bson.M{"expires_at": bson.M{"$lte": cutoff}})
+}
+
+func (s *mongoUploadStore) ListByNote(ctx context.Context, noteID string) ([]models.UploadSession, error) {
+	return s.list(ctx, bson.M{"note_id": noteID})
+}
+
+func (s *mongoUploadStore) DeleteByNote(ctx context.Context, noteID string) (int64, error) {
+	res, err := s.coll.DeleteMany(ctx, bson.M{"note_id": noteID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// --------------------- URLS ---------------------
+
+func (s *mongoShareStore) Create(ctx context.Context, url models.Url) (string, error) {
+	res, err := s.coll.InsertOne(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+func (s *mongoShareStore) FindByID(ctx context.Context, urlID string) (models.Url, error) {
+	var url models.Url
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return url, ErrInvalidID
+	}
+	err = s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&url)
+	return url, mongoErr(err)
+}
+
+func (s *mongoShareStore) FindByNoteAndReceiver(ctx context.Context, noteID, receiver string) (models.Url, error) {
+	var url models.Url
+	err := s.coll.FindOne(ctx, bson.M{"note_id": noteID, "receiver": receiver}).Decode(&url)
+	return url, mongoErr(err)
+}
+
+func (s *mongoShareStore) ListByNote(ctx context.Context, noteID string) ([]models.Url, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"note_id": noteID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]models.Url, 0)
+	if err = cursor.All(ctx, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (s *mongoShareStore) ListByReceiver(ctx context.Context, receiver string, filter models.ShareFilter, page models.PageQuery) ([]models.Url, error) {
+	query := bson.M{"receiver": receiver}
+	if filter.Sender != "" {
+		query["sender"] = filter.Sender
+	}
+	// Share hết hạn nằm lại tới khi TTL Index dọn -> lọc ra như bộ nhớ (pruneExpiredUrls)
+	query["expires_at"] = bson.M{"$gt": time.Now()}
+	if filter.State == models.ShareStateActive {
+		query["$expr"] = bson.M{"$lt": bson.A{"$accessed", "$max_access"}}
+	}
+
+	query, opts := mongoPage(query, page)
+	cursor, err := s.coll.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]models.Url, 0)
+	if err = cursor.All(ctx, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (s *mongoShareStore) Access(ctx context.Context, urlID string) (models.Url, error) {
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return models.Url{}, ErrInvalidID
+	}
+	url, err := models.AccessUrl(ctx, s.coll, id)
+	if err != nil {
+		return models.Url{}, mongoErr(err)
+	}
+	return *url, nil
+}
+
+func (s *mongoShareStore) RecordFailedAttempt(ctx context.Context, urlID string) (models.Url, error) {
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return models.Url{}, ErrInvalidID
+	}
+	url, err := models.IncrementUrlCounter(ctx, s.coll, id, models.UrlFailedAttempts)
+	if err != nil {
+		return models.Url{}, mongoErr(err)
+	}
+	return *url, nil
+}
+
+func (s *mongoShareStore) List(ctx context.Context) ([]models.Url, error) {
+	// Share hết hạn nằm lại tới khi TTL Index dọn -> lọc ra như bộ nhớ (pruneExpiredUrls)
+	filter := bson.M{"expires_at": bson.M{"$gt": time.Now()}}
+	cursor, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]models.Url, 0)
+	if err = cursor.All(ctx, &urls); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+func (s *mongoShareStore) Delete(ctx context.Context, urlID string) error {
+	id, err := primitive.ObjectIDFromHex(urlID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	res, err := s.coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoShareStore) DeleteByNote(ctx context.Context, noteID string) (int64, error) {
+	res, err := s.coll.DeleteMany(ctx, bson.M{"note_id": noteID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+func (s *mongoShareStore) DeleteByNoteAndSender(ctx context.Context, noteID, sender string) (int64, error) {
+	res, err := s.coll.DeleteMany(ctx, bson.M{"note_id": noteID, "sender": sender})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// Thêm điều kiện cursor, thứ tự sắp xếp và giới hạn của page vào truy vấn filter
+func mongoPage(filter bson.M, page models.PageQuery) (bson.M, *options.FindOptions) {
+	dir, cmp := 1, "$gt"
+	if page.Desc {
+		dir, cmp = -1, "$lt"
+	}
+
+	sortKeys := bson.D{{Key: "_id", Value: dir}}
+	if page.Sort == models.SortExpires {
+		sortKeys = bson.D{{Key: "expires_at", Value: dir}, {Key: "_id", Value: dir}}
+	}
+	opts := options.Find().SetSort(sortKeys)
+	if page.Limit > 0 {
+		opts.SetLimit(int64(page.Limit))
+	}
+
+	if after := page.After; after != nil {
+		var afterCond bson.M
+		if page.Sort == models.SortExpires {
+			afterCond = bson.M{"$or": bson.A{
+				bson.M{"expires_at": bson.M{cmp: after.ExpiresAt}},
+				bson.M{"expires_at": after.ExpiresAt, "_id": bson.M{cmp: after.ID}},
+			}}
+		} else {
+			afterCond = bson.M{"_id": bson.M{cmp: after.ID}}
+		}
+		filter = bson.M{"$and": bson.A{filter, afterCond}}
+	}
+	return filter, opts
+}
+
+// --------------------- USERS ---------------------
+
+func (s *mongoUserStore) Create(ctx context.Context, user models.User) (string, error) {
+	res, err := s.coll.InsertOne(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+func (s *mongoUserStore) FindByUsername(ctx context.Context, username string) (models.User, error) {
+	var user models.User
+	err := s.coll.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	return user, mongoErr(err)
+}
+
+func (s *mongoUserStore) Exists(ctx context.Context, username string) (bool, error) {
+	count, err := s.coll.CountDocuments(ctx, bson.M{"username": username})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *mongoUserStore) IncrementTokenVersion(ctx context.Context, username string) (int, error) {
+	var user models.User
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := s.coll.FindOneAndUpdate(ctx, bson.M{"username": username}, bson.M{"$inc": bson.M{"token_version": 1}}, opts).Decode(&user)
+	if err != nil {
+		return 0, mongoErr(err)
+	}
+	return user.TokenVersion, nil
+}
+
+func (s *mongoUserStore) UpdateCredentials(ctx context.Context, username, encryptedPassword, salt, encryptedPrivKey, encryptedLegacyPrivKey, encryptedSigningPrivKey string) error {
+	set := bson.M{
+		"encrypted_password": encryptedPassword,
+		"salt":               salt,
+		"encrypted_privKey":  encryptedPrivKey,
+	}
+	if encryptedLegacyPrivKey != "" {
+		set["encrypted_legacy_privKey"] = encryptedLegacyPrivKey
+	}
+	if encryptedSigningPrivKey != "" {
+		set["encrypted_signing_privKey"] = encryptedSigningPrivKey
+	}
+	update := bson.M{"$set": set}
+	res, err := s.coll.UpdateOne(ctx, bson.M{"username": username}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) UpgradeKey(ctx context.Context, username, pubKey, keyType, encryptedPrivKey string) error {
+	// Chỉ user còn dùng khóa DH (chưa có pubKey_type hoặc là dh-group14)
+	filter := bson.M{
+		"username":    username,
+		"pubKey_type": bson.M{"$in": bson.A{nil, "", models.KeyTypeDH}},
+	}
+	// Update dạng pipeline để copy khóa hiện tại sang legacy trong cùng 1 thao tác
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"legacy_pubKey":            "$pubKey",
+		"encrypted_legacy_privKey": "$encrypted_privKey",
+		"pubKey":                   bson.M{"$literal": pubKey},
+		"pubKey_type":              bson.M{"$literal": keyType},
+		"encrypted_privKey":        bson.M{"$literal": encryptedPrivKey},
+	}}}}
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) SetSigningKey(ctx context.Context, username, signingPubKey, encryptedSigningPrivKey string) error {
+	filter := bson.M{
+		"username":       username,
+		"signing_pubKey": bson.M{"$in": bson.A{nil, ""}},
+	}
+	update := bson.M{"$set": bson.M{
+		"signing_pubKey":            signingPubKey,
+		"encrypted_signing_privKey": encryptedSigningPrivKey,
+	}}
+	res, err := s.coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoUserStore) List(ctx context.Context) ([]models.User, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	users := make([]models.User, 0)
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// --------------------- REFRESH TOKENS ---------------------
+
+func (s *mongoTokenStore) Create(ctx context.Context, token models.RefreshToken) (string, error) {
+	res, err := s.coll.InsertOne(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+func (s *mongoTokenStore) FindByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := s.coll.FindOne(ctx, bson.M{"token_hash": tokenHash}).Decode(&token)
+	return token, mongoErr(err)
+}
+
+func (s *mongoTokenStore) MarkUsed(ctx context.Context, tokenID string) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		return false, ErrInvalidID
+	}
+	// Cập nhật có điều kiện -> chỉ 1 request đồng thời đổi được token
+	filter := bson.M{"_id": id, "used": false, "revoked": false}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"used": true}})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func (s *mongoTokenStore) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := s.coll.UpdateMany(ctx, bson.M{"family_id": familyID}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+func (s *mongoTokenStore) RevokeUser(ctx context.Context, userID string) error {
+	_, err := s.coll.UpdateMany(ctx, bson.M{"user_id": userID}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+func (s *mongoTokenStore) RevokeAccessToken(ctx context.Context, revoked models.RevokedToken) error {
+	// Upsert để đăng xuất 2 lần không bị lỗi trùng khóa
+	opts := options.Replace().SetUpsert(true)
+	_, err := s.revoked.ReplaceOne(ctx, bson.M{"_id": revoked.JTI}, revoked, opts)
+	return err
+}
+
+func (s *mongoTokenStore) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	count, err := s.revoked.CountDocuments(ctx, bson.M{"_id": jti})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// --------------------- KEY LOG ---------------------
+
+// Số lần thử lại khi 2 request cùng lấy 1 index
+const keyLogAppendRetries = 5
+
+func (s *mongoKeyLogStore) Append(ctx context.Context, entry models.KeyLogEntry) (int64, error) {
+	for attempt := 0; ; attempt++ {
+		size, err := s.Size(ctx)
+		if err != nil {
+			return 0, err
+		}
+		// _id là index nên insert trùng index sẽ bị unique index của _id chặn lại
+		entry.Index = size
+		_, err = s.coll.InsertOne(ctx, entry)
+		if err == nil {
+			return entry.Index, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) || attempt >= keyLogAppendRetries {
+			return 0, err
+		}
+	}
+}
+
+func (s *mongoKeyLogStore) List(ctx context.Context, size int64) ([]models.KeyLogEntry, error) {
+	filter := bson.M{"_id": bson.M{"$lt": size}}
+	cursor, err := s.coll.Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.KeyLogEntry, 0)
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Index liên tục từ 0 nên kích thước log = index lớn nhất + 1
+func (s *mongoKeyLogStore) Size(ctx context.Context) (int64, error) {
+	var last models.KeyLogEntry
+	opts := options.FindOne().SetSort(bson.M{"_id": -1})
+	err := s.coll.FindOne(ctx, bson.M{}, opts).Decode(&last)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return last.Index + 1, nil
+}
+
+func (s *mongoKeyLogStore) Get(ctx context.Context, index int64) (models.KeyLogEntry, error) {
+	var entry models.KeyLogEntry
+	err := s.coll.FindOne(ctx, bson.M{"_id": index}).Decode(&entry)
+	return entry, mongoErr(err)
+}
+
+func (s *mongoKeyLogStore) LatestByUsername(ctx context.Context, username string) (models.KeyLogEntry, error) {
+	var entry models.KeyLogEntry
+	opts := options.FindOne().SetSort(bson.M{"_id": -1})
+	err := s.coll.FindOne(ctx, bson.M{"username": username}, opts).Decode(&entry)
+	return entry, mongoErr(err)
+}
+
+// --------------------- GROUPS ---------------------
+
+func (s *mongoGroupStore) Create(ctx context.Context, group models.Group) (string, error) {
+	res, err := s.coll.InsertOne(ctx, group)
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+func (s *mongoGroupStore) FindByID(ctx context.Context, groupID string) (models.Group, error) {
+	var group models.Group
+	id, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return group, ErrInvalidID
+	}
+	err = s.coll.FindOne(ctx, bson.M{"_id": id}).Decode(&group)
+	return group, mongoErr(err)
+}
+
+func (s *mongoGroupStore) ListByMember(ctx context.Context, username string) ([]models.Group, error) {
+	cursor, err := s.coll.Find(ctx, bson.M{"members.username": username}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]models.Group, 0)
+	if err = cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Điều kiện phiên bản khóa và "chưa là thành viên" nằm trong filter nên 2 request đồng thời không thêm trùng
+func (s *mongoGroupStore) AddMember(ctx context.Context, groupID string, keyVersion int, member models.GroupMember) error {
+	id, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	filter := bson.M{
+		"_id":              id,
+		"key_version":      keyVersion,
+		"members.username": bson.M{"$ne": member.Username},
+	}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"members": member}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoGroupStore) SetMemberRole(ctx context.Context, groupID, username, role string) error {
+	id, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	filter := bson.M{
+		"_id":     id,
+		"members": bson.M{"$elemMatch": bson.M{"username": username, "role": bson.M{"$ne": models.GroupRoleOwner}}},
+	}
+	res, err := s.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"members.$.role": role}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoGroupStore) RotateKey(ctx context.Context, groupID string, baseVersion int, members []models.GroupMember) error {
+	id, err := primitive.ObjectIDFromHex(groupID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	update := bson.M{
+		"$set": bson.M{"members": members},
+		"$inc": bson.M{"key_version": 1},
+	}
+	res, err := s.coll.UpdateOne(ctx, bson.M{"_id": id, "key_version": baseVersion}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoGroupStore) CreateShare(ctx context.Context, share models.GroupShare) (string, error) {
+	res, err := s.shares.InsertOne(ctx, share)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", ErrDuplicate
+	}
+	if err != nil {
+		return "", err
+	}
+	return insertedHex(res)
+}
+
+func (s *mongoGroupStore) FindShare(ctx context.Context, groupID, noteID string) (models.GroupShare, error) {
+	var share models.GroupShare
+	err := s.shares.FindOne(ctx, bson.M{"group_id": groupID, "note_id": noteID}).Decode(&share)
+	return share, mongoErr(err)
+}
+
+func (s *mongoGroupStore) ListShares(ctx context.Context, groupID string) ([]models.GroupShare, error) {
+	cursor, err := s.shares.Find(ctx, bson.M{"group_id": groupID}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]models.GroupShare, 0)
+	if err = cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (s *mongoGroupStore) ListAllShares(ctx context.Context) ([]models.GroupShare, error) {
+	cursor, err := s.shares.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	shares := make([]models.GroupShare, 0)
+	if err = cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
+	return shares, nil
+}
+
+func (s *mongoGroupStore) UpdateShareKey(ctx context.Context, shareID string, keyVersion int, encryptedAESKey string) error {
+	id, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	update := bson.M{"$set": bson.M{"key_version": keyVersion, "encrypted_aes_key": encryptedAESKey}}
+	res, err := s.shares.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoGroupStore) DeleteShare(ctx context.Context, shareID string) error {
+	id, err := primitive.ObjectIDFromHex(shareID)
+	if err != nil {
+		return ErrInvalidID
+	}
+	res, err := s.shares.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoGroupStore) DeleteSharesByNote(ctx context.Context, noteID string) (int64, error) {
+	res, err := s.shares.DeleteMany(ctx, bson.M{"note_id": noteID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
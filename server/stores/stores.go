@@ -0,0 +1,219 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"note_sharing_application/server/models"
+)
+
+/*
+	Tầng lưu trữ (storage) tách khỏi services/middlewares/handlers
+	Các tầng trên chỉ làm việc với các interface NoteStore, ShareStore, UserStore, TokenStore, KeyLogStore, UploadStore, GroupStore, BlobStore
+	Hiện có 2 cách cài đặt:
+	  - Mongo (mongo_store.go): dùng cho môi trường chạy thật
+	  - Memory (memory_store.go): lưu trên RAM, có thể kèm file để giữ dữ liệu giữa các lần chạy
+	    -> dùng cho CI và máy dev không có Docker Mongo
+	Nội dung note (ciphertext) nằm ở BlobStore: GridFS, thư mục local (blob_store.go) hoặc RAM
+*/
+
+var (
+	// Không tìm thấy bản ghi (tương đương mongo.ErrNoDocuments)
+	ErrNotFound = errors.New("không tìm thấy dữ liệu")
+	// ID truyền vào không đúng định dạng ObjectID
+	ErrInvalidID = errors.New("ID không đúng định dạng")
+	// Trùng với bản ghi đã có theo unique index (tương đương duplicate key của Mongo)
+	ErrDuplicate = errors.New("dữ liệu đã tồn tại")
+)
+
+// Lưu trữ ghi chú (collection "notes")
+type NoteStore interface {
+	Create(ctx context.Context, note models.Note) (string, error)
+	FindByID(ctx context.Context, noteID string) (models.Note, error)
+	// Mọi note của owner, kể cả note trong thùng rác
+	ListByOwner(ctx context.Context, ownerID string) ([]models.Note, error)
+	// Các note đang dùng (không trong thùng rác) của owner, phân trang theo page (chỉ sắp xếp theo SortCreated)
+	ListActiveByOwner(ctx context.Context, ownerID string, page models.PageQuery) ([]models.Note, error)
+	// Các note đã nằm trong thùng rác từ trước thời điểm cutoff (của mọi owner)
+	ListTrashedBefore(ctx context.Context, cutoff time.Time) ([]models.Note, error)
+	// Toàn bộ note của mọi owner (dùng cho kiểm tra tính nhất quán)
+	List(ctx context.Context) ([]models.Note, error)
+	Delete(ctx context.Context, noteID string) error
+	// Thay khóa AES đã bọc của note (chỉ khi note thuộc ownerID)
+	UpdateEncryptedKey(ctx context.Context, noteID, ownerID, encryptedAesKey string) error
+	// Gán blob chứa nội dung đã mã hóa cho note chưa có nội dung (chỉ khi note thuộc ownerID)
+	// Trả về ErrNotFound nếu note không tồn tại hoặc đã có nội dung
+	SetContent(ctx context.Context, noteID, ownerID, blobRef string, size int64, cipherDigest string) error
+	// Thay nội dung hiện tại bằng phiên bản current và ghi lại danh sách phiên bản cũ history
+	// Chỉ khi note thuộc ownerID và phiên bản hiện tại vẫn là baseRevision, ngược lại trả về ErrNotFound
+	UpdateContent(ctx context.Context, noteID, ownerID string, baseRevision int, current models.NoteRevision, history []models.NoteRevision) error
+	// deletedAt khác nil: chuyển note đang dùng vào thùng rác, nil: khôi phục note từ thùng rác
+	// Trả về ErrNotFound nếu note không thuộc ownerID hoặc không ở trạng thái tương ứng
+	SetDeletedAt(ctx context.Context, noteID, ownerID string, deletedAt *time.Time) error
+}
+
+// Phiên upload theo chunk (collection "upload_sessions"), phiên hết hạn coi như không tồn tại
+type UploadStore interface {
+	Create(ctx context.Context, session models.UploadSession) (string, error)
+	FindByID(ctx context.Context, uploadID string) (models.UploadSession, error)
+	// Ghi nhận blob của chunk index, trả về blob cũ của chunk đó nếu gửi lại (rỗng nếu chưa có)
+	SetChunk(ctx context.Context, uploadID string, index int, blobRef string) (string, error)
+	Delete(ctx context.Context, uploadID string) error
+	// Các phiên hết hạn trước cutoff (chưa bị xóa), để dọn blob của chunk trước khi xóa phiên
+	ListExpired(ctx context.Context, cutoff time.Time) ([]models.UploadSession, error)
+	// Mọi phiên của note, kể cả phiên đã hết hạn
+	ListByNote(ctx context.Context, noteID string) ([]models.UploadSession, error)
+	DeleteByNote(ctx context.Context, noteID string) (int64, error)
+}
+
+// Lưu nội dung đã mã hóa của note (binary) tách khỏi document note, không giới hạn kích thước
+type BlobStore interface {
+	// Ghi toàn bộ r thành 1 blob mới, trả về tham chiếu và kích thước (byte)
+	Put(ctx context.Context, r io.Reader) (string, int64, error)
+	// Mở blob để đọc theo luồng, người gọi phải Close. Trả về ErrNotFound nếu không có
+	Open(ctx context.Context, ref string) (io.ReadCloser, error)
+	// Trả về ErrNotFound nếu không có
+	Delete(ctx context.Context, ref string) error
+}
+
+// Lưu trữ URL chia sẻ (collection "urls")
+type ShareStore interface {
+	Create(ctx context.Context, url models.Url) (string, error)
+	FindByID(ctx context.Context, urlID string) (models.Url, error)
+	FindByNoteAndReceiver(ctx context.Context, noteID, receiver string) (models.Url, error)
+	// Các share của note theo thứ tự tạo
+	ListByNote(ctx context.Context, noteID string) ([]models.Url, error)
+	// Các share gửi tới receiver khớp filter, phân trang theo page
+	ListByReceiver(ctx context.Context, receiver string, filter models.ShareFilter, page models.PageQuery) ([]models.Url, error)
+	// Kiểm tra hạn dùng + tăng lượt xem, trả về Url sau khi tăng
+	Access(ctx context.Context, urlID string) (models.Url, error)
+	// Link có mật khẩu: tăng số lần nhập sai như Access, xóa link khi chạm MaxAttempts
+	RecordFailedAttempt(ctx context.Context, urlID string) (models.Url, error)
+	// Toàn bộ share chưa hết hạn (dùng cho kiểm tra tính nhất quán)
+	List(ctx context.Context) ([]models.Url, error)
+	// Trả về ErrNotFound nếu share không tồn tại
+	Delete(ctx context.Context, urlID string) error
+	DeleteByNote(ctx context.Context, noteID string) (int64, error)
+	DeleteByNoteAndSender(ctx context.Context, noteID, sender string) (int64, error)
+}
+
+// Lưu trữ nhóm (collection "groups") và note chia sẻ cho nhóm (collection "group_shares")
+type GroupStore interface {
+	Create(ctx context.Context, group models.Group) (string, error)
+	FindByID(ctx context.Context, groupID string) (models.Group, error)
+	// Các nhóm có username là thành viên, theo thứ tự tạo
+	ListByMember(ctx context.Context, username string) ([]models.Group, error)
+	// Thêm thành viên khi nhóm vẫn ở phiên bản khóa keyVersion và username chưa là thành viên
+	// Ngược lại trả về ErrNotFound
+	AddMember(ctx context.Context, groupID string, keyVersion int, member models.GroupMember) error
+	// Đổi vai trò của thành viên không phải owner, trả về ErrNotFound nếu không có
+	SetMemberRole(ctx context.Context, groupID, username, role string) error
+	// Thay danh sách thành viên (kèm khóa nhóm mới đã bọc) và tăng phiên bản khóa
+	// Chỉ khi nhóm vẫn ở phiên bản baseVersion, ngược lại trả về ErrNotFound
+	RotateKey(ctx context.Context, groupID string, baseVersion int, members []models.GroupMember) error
+
+	// Trả về ErrDuplicate nếu note đã được chia sẻ cho nhóm (unique theo group_id, note_id)
+	CreateShare(ctx context.Context, share models.GroupShare) (string, error)
+	FindShare(ctx context.Context, groupID, noteID string) (models.GroupShare, error)
+	// Các note chia sẻ cho nhóm theo thứ tự chia sẻ
+	ListShares(ctx context.Context, groupID string) ([]models.GroupShare, error)
+	// Toàn bộ share cho nhóm của mọi nhóm (dùng cho kiểm tra tính nhất quán)
+	ListAllShares(ctx context.Context) ([]models.GroupShare, error)
+	// Thay khóa AES đã bọc của share bằng khóa bọc theo khóa nhóm phiên bản keyVersion
+	UpdateShareKey(ctx context.Context, shareID string, keyVersion int, encryptedAESKey string) error
+	// Trả về ErrNotFound nếu share không tồn tại
+	DeleteShare(ctx context.Context, shareID string) error
+	DeleteSharesByNote(ctx context.Context, noteID string) (int64, error)
+}
+
+// Lưu trữ người dùng (collection "users")
+type UserStore interface {
+	Create(ctx context.Context, user models.User) (string, error)
+	FindByUsername(ctx context.Context, username string) (models.User, error)
+	Exists(ctx context.Context, username string) (bool, error)
+	// Tăng thế hệ token của user, trả về giá trị mới
+	IncrementTokenVersion(ctx context.Context, username string) (int, error)
+	// Thay mật khẩu (hash + salt) và các private key đã mã hóa bằng mật khẩu
+	// Private key rỗng (legacy, ký) thì giữ nguyên
+	UpdateCredentials(ctx context.Context, username, encryptedPassword, salt, encryptedPrivKey, encryptedLegacyPrivKey, encryptedSigningPrivKey string) error
+	// Thay khóa DH hiện tại bằng khóa loại keyType, khóa DH chuyển sang legacy
+	// Trả về ErrNotFound nếu user không tồn tại hoặc đã nâng cấp rồi
+	UpgradeKey(ctx context.Context, username, pubKey, keyType, encryptedPrivKey string) error
+	// Gán khóa ký cho user chưa có khóa ký, trả về ErrNotFound nếu user không tồn tại hoặc đã có
+	SetSigningKey(ctx context.Context, username, signingPubKey, encryptedSigningPrivKey string) error
+	// Toàn bộ user theo thứ tự tạo
+	List(ctx context.Context) ([]models.User, error)
+}
+
+// Key transparency log (collection "key_log"), chỉ thêm vào cuối, không sửa/xóa
+type KeyLogStore interface {
+	// Thêm entry vào cuối log, trả về index (bắt đầu từ 0) được gán cho entry
+	Append(ctx context.Context, entry models.KeyLogEntry) (int64, error)
+	// size entry đầu tiên của log theo thứ tự index
+	List(ctx context.Context, size int64) ([]models.KeyLogEntry, error)
+	Size(ctx context.Context) (int64, error)
+	Get(ctx context.Context, index int64) (models.KeyLogEntry, error)
+	// Entry mới nhất của username
+	LatestByUsername(ctx context.Context, username string) (models.KeyLogEntry, error)
+}
+
+// Lưu trữ refresh token (collection "refresh_tokens") và access token bị thu hồi (collection "revoked_tokens")
+type TokenStore interface {
+	Create(ctx context.Context, token models.RefreshToken) (string, error)
+	FindByHash(ctx context.Context, tokenHash string) (models.RefreshToken, error)
+	// Đánh dấu đã dùng nếu token chưa dùng và chưa bị thu hồi
+	// Trả về false nếu token đã bị dùng/thu hồi trước đó (kể cả do request đồng thời)
+	MarkUsed(ctx context.Context, tokenID string) (bool, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID string) error
+
+	RevokeAccessToken(ctx context.Context, revoked models.RevokedToken) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// Chạy nhiều thao tác trên nhiều store trong cùng 1 transaction
+// Mọi thao tác dùng ctx truyền vào fn cùng thành công, hoặc cùng bị hủy nếu fn trả về lỗi
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Bộ store của cùng một backend
+type Stores struct {
+	Notes   NoteStore
+	Shares  ShareStore
+	Users   UserStore
+	Tokens  TokenStore
+	KeyLog  KeyLogStore
+	Blobs   BlobStore
+	Uploads UploadStore
+	Groups  GroupStore
+	Tx      Transactor
+}
+
+// Các store đang được server sử dụng, khởi tạo một lần lúc boot bằng Use()
+var (
+	Notes   NoteStore
+	Shares  ShareStore
+	Users   UserStore
+	Tokens  TokenStore
+	KeyLog  KeyLogStore
+	Blobs   BlobStore
+	Uploads UploadStore
+	Groups  GroupStore
+	Tx      Transactor
+)
+
+// Chọn backend lưu trữ cho toàn bộ server
+func Use(s Stores) {
+	Notes = s.Notes
+	Shares = s.Shares
+	Users = s.Users
+	Tokens = s.Tokens
+	KeyLog = s.KeyLog
+	Blobs = s.Blobs
+	Uploads = s.Uploads
+	Groups = s.Groups
+	Tx = s.Tx
+}
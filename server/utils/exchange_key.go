@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"encoding/hex"
+	"math/big"
+)
+
+/*
+	Kiểm tra public key trao đổi khóa (X25519 hoặc DH group 14) trước khi lưu
+	Khóa rác đã lưu thì mọi người gửi tới user đó đều lỗi ở phía client
+	Cùng điều kiện với client (computeX25519Secret, ValidateDHPublicKey)
+*/
+
+// P của DH: số nguyên tố 2048-bit RFC 3526 group 14 (khớp với client)
+const dhPrimeHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
+	"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
+	"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
+	"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
+	"670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9" +
+	"DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+
+var (
+	dhP, _ = new(big.Int).SetString(dhPrimeHex, 16)
+	// Q = (P-1)/2 là bậc của nhóm con sinh bởi 2 (P là safe prime)
+	dhQ = new(big.Int).Rsh(dhP, 1)
+
+	// Private key cố định chỉ dùng để thử ECDH với public key cần kiểm tra
+	x25519Probe, _ = ecdh.X25519().NewPrivateKey(bytes.Repeat([]byte{0x42}, 32))
+)
+
+// Public key X25519 dạng hex có hợp lệ không: 32 bytes và không phải điểm bậc thấp
+// (ECDH với điểm bậc thấp cho khóa chung toàn 0 với mọi private key, Go trả lỗi)
+func ValidX25519PublicKey(pubHex string) bool {
+	b, err := hex.DecodeString(pubHex)
+	if err != nil || len(b) != 32 {
+		return false
+	}
+	pub, err := ecdh.X25519().NewPublicKey(b)
+	if err != nil {
+		return false
+	}
+	_, err = x25519Probe.ECDH(pub)
+	return err == nil
+}
+
+// Public key DH group 14 dạng hex có hợp lệ không: 1 < pub < P-1 và thuộc nhóm con bậc Q (pub^Q mod P = 1)
+func ValidDHPublicKey(pubHex string) bool {
+	pub, ok := new(big.Int).SetString(pubHex, 16)
+	if !ok {
+		return false
+	}
+	one := big.NewInt(1)
+	pMinusOne := new(big.Int).Sub(dhP, one)
+	if pub.Cmp(one) <= 0 || pub.Cmp(pMinusOne) >= 0 {
+		return false
+	}
+	return new(big.Int).Exp(pub, dhQ, dhP).Cmp(one) == 0
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+/*
+	Khóa Ed25519 dùng để ký Signed Tree Head của key transparency log
+	Khác khóa RSA (có thể xoay vòng), khóa này cố định: client ghi nhớ nó lần đầu
+	và dùng để kiểm tra mọi tree head về sau
+	Lưu trong file PEM mã hóa giống file khóa RSA
+*/
+
+const logKeyBlockType = "ENCRYPTED LOG SIGNING KEY"
+
+var LogSigningKey ed25519.PrivateKey
+
+// Sinh khóa ký log chỉ trên RAM, dùng cho test
+func GenerateLogSigningKey() error {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	LogSigningKey = priv
+	return nil
+}
+
+func logKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Nạp khóa ký log từ file path (mã hóa bằng passphrase), chưa có thì sinh mới và ghi vào file
+func LoadOrCreateLogSigningKey(path, passphrase string) error {
+	if passphrase == "" {
+		return ErrMissingKeyPassphrase
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return err
+		}
+		b, err := sealKeyBlock(logKeyBlockType, der, logKeyID(priv.Public().(ed25519.PublicKey)), passphrase, nil)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(path, pem.EncodeToMemory(b)); err != nil {
+			return err
+		}
+		LogSigningKey = priv
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	b, _ := pem.Decode(data)
+	if b == nil || b.Type != logKeyBlockType {
+		return fmt.Errorf("file %s không phải file khóa ký log", path)
+	}
+	der, err := openKeyBlock(b, passphrase)
+	if err != nil {
+		return err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return errors.New("file khóa ký log không chứa khóa Ed25519")
+	}
+	LogSigningKey = priv
+	return nil
+}
+
+// Public key của khóa ký log (hex)
+func LogPublicKeyHex() string {
+	if LogSigningKey == nil {
+		return ""
+	}
+	return hex.EncodeToString(LogSigningKey.Public().(ed25519.PublicKey))
+}
+
+// Nội dung được ký của 1 tree head (client dựng lại đúng chuỗi này để kiểm tra chữ ký)
+func TreeHeadMessage(treeSize int64, rootHashHex string, timestamp int64) []byte {
+	return []byte(fmt.Sprintf("note-sharing-keylog-v1\n%d\n%s\n%d", treeSize, rootHashHex, timestamp))
+}
+
+func SignTreeHead(treeSize int64, rootHashHex string, timestamp int64) ([]byte, error) {
+	if LogSigningKey == nil {
+		return nil, errors.New("chưa nạp khóa ký log")
+	}
+	return ed25519.Sign(LogSigningKey, TreeHeadMessage(treeSize, rootHashHex, timestamp)), nil
+}
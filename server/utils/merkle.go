@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"crypto/sha256"
+)
+
+/*
+	Cây Merkle theo RFC 6962 (Certificate Transparency)
+	Lá:   SHA-256(0x00 || dữ liệu)
+	Nút:  SHA-256(0x01 || trái || phải)
+	Cây n lá được chia tại k = lũy thừa của 2 lớn nhất nhỏ hơn n
+*/
+
+func MerkleLeafHash(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0x00}, data...))
+	return sum[:]
+}
+
+func merkleNodeHash(left, right []byte) []byte {
+	buf := make([]byte, 0, 1+len(left)+len(right))
+	buf = append(buf, 0x01)
+	buf = append(buf, left...)
+	buf = append(buf, right...)
+	sum := sha256.Sum256(buf)
+	return sum[:]
+}
+
+// Lũy thừa của 2 lớn nhất mà nhỏ hơn n (n >= 2)
+func merkleSplit(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// Gốc của cây có các lá (đã băm) leaves
+func MerkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	}
+	k := merkleSplit(len(leaves))
+	return merkleNodeHash(MerkleRoot(leaves[:k]), MerkleRoot(leaves[k:]))
+}
+
+// Inclusion proof (audit path) của lá thứ index trong cây leaves
+func MerkleInclusionProof(index int, leaves [][]byte) [][]byte {
+	n := len(leaves)
+	if n <= 1 {
+		return nil
+	}
+	k := merkleSplit(n)
+	if index < k {
+		return append(MerkleInclusionProof(index, leaves[:k]), MerkleRoot(leaves[k:]))
+	}
+	return append(MerkleInclusionProof(index-k, leaves[k:]), MerkleRoot(leaves[:k]))
+}
+
+// Consistency proof: chứng minh cây m lá đầu là tiền tố của cây leaves
+func MerkleConsistencyProof(m int, leaves [][]byte) [][]byte {
+	if m <= 0 || m >= len(leaves) {
+		return nil
+	}
+	return merkleSubProof(m, leaves, true)
+}
+
+func merkleSubProof(m int, leaves [][]byte, complete bool) [][]byte {
+	n := len(leaves)
+	if m == n {
+		if complete {
+			return nil
+		}
+		return [][]byte{MerkleRoot(leaves)}
+	}
+	k := merkleSplit(n)
+	if m <= k {
+		return append(merkleSubProof(m, leaves[:k], complete), MerkleRoot(leaves[k:]))
+	}
+	return append(merkleSubProof(m-k, leaves[k:], false), MerkleRoot(leaves[:k]))
+}
@@ -3,6 +3,7 @@ package utils
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 
@@ -35,3 +36,14 @@ func CheckPasswordHash(password, salt, sortedPassword string) bool {
 	newHash := HashPassword(password, salt)
 	return newHash == sortedPassword
 }
+
+// Kiểm tra access token (hex) của link có mật khẩu với verifier đã lưu (SHA-256 hex của token)
+// Token do client dẫn xuất từ mật khẩu qua Argon2id nên server không cần băm chậm lại
+func CheckLinkAccessToken(verifier, token string) bool {
+	raw, err := hex.DecodeString(token)
+	if err != nil || len(raw) == 0 {
+		return false
+	}
+	sum := sha256.Sum256(raw)
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(verifier)) == 1
+}
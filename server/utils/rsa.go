@@ -4,18 +4,35 @@ import (
 	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"time"
 )
 
 // Tạo biến toàn bộ khởi tạo chung khi server được khởi tạo
+// ServerPrivateKey/ServerPublicKey là khóa hiện hành (khóa được gửi cho client)
 var (
 	ServerPrivateKey *rsa.PrivateKey
 	ServerPublicKey  *rsa.PublicKey
 )
 
+// Khóa cũ sau khi xoay vòng, vẫn giải mã được tới thời điểm until
+type retiredKey struct {
+	id    string
+	key   *rsa.PrivateKey
+	until time.Time
+}
+
+// Chỉ được gán lúc boot (LoadOrCreateServerRSAKeys / RotateServerRSAKeys), sau đó chỉ đọc
+var retiredServerKeys []retiredKey
+
+var ErrUnknownKeyID = errors.New("key id không tồn tại hoặc đã hết hạn")
+
 // Tạo cặp khóa RSA (private key và public key) của Server
+// Khóa chỉ nằm trên RAM, dùng cho test. Server thật dùng LoadOrCreateServerRSAKeys
 func GenerateServerRSAKeys() error {
 	var err error
 	ServerPrivateKey, err = rsa.GenerateKey(rand.Reader, 2048)
@@ -25,9 +42,29 @@ func GenerateServerRSAKeys() error {
 	// Struct của private key thường chứa sẵn public key
 	// Lấy địa chỉ của public key từ private key
 	ServerPublicKey = &ServerPrivateKey.PublicKey
+	retiredServerKeys = nil
 	return nil
 }
 
+// Key ID = 16 ký tự hex đầu của SHA-256(public key dạng DER)
+// Client gửi kèm key ID để server biết password được mã hóa bằng khóa nào
+func rsaKeyID(pub *rsa.PublicKey) string {
+	pubASN1, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(pubASN1)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Key ID của khóa hiện hành
+func ServerKeyID() string {
+	if ServerPublicKey == nil {
+		return ""
+	}
+	return rsaKeyID(ServerPublicKey)
+}
+
 // Chuyển Public Key sang dạng string (PEM format) để dễ gửi
 // Trả về public key dưới dạng string (PEM)
 func ExportPublicKeyAsPEM() (string, error) {
@@ -46,16 +83,36 @@ func ExportPublicKeyAsPEM() (string, error) {
 	return string(pubBytes), nil
 }
 
+// Tìm private key theo key ID
+// keyID rỗng (client cũ không gửi key ID) -> dùng khóa hiện hành
+// Khóa cũ chỉ được chấp nhận trong thời gian ân hạn sau khi xoay vòng
+func findServerKey(keyID string) (*rsa.PrivateKey, error) {
+	if keyID == "" || keyID == ServerKeyID() {
+		return ServerPrivateKey, nil
+	}
+	for _, k := range retiredServerKeys {
+		if k.id == keyID && time.Now().Before(k.until) {
+			return k.key, nil
+		}
+	}
+	return nil, ErrUnknownKeyID
+}
+
 // Phương pháp OAEP (Optimal Asymmetric Encryption Padding)
 // Là phương pháp giải mã an toàn cho RSA
-// Client mã hóa password bằng EncrypteOAEP
-func DecryptOAEP(cipherText []byte) (string, error) {
+// Client mã hóa password bằng EncrypteOAEP với khóa có ID keyID
+func DecryptOAEP(keyID string, cipherText []byte) (string, error) {
 	hash := crypto.SHA256
 
+	privateKey, err := findServerKey(keyID)
+	if err != nil {
+		return "", err
+	}
+
 	decryptedBytes, err := rsa.DecryptOAEP(
 		hash.New(),
 		rand.Reader,
-		ServerPrivateKey,
+		privateKey,
 		cipherText,
 		nil,
 	)
@@ -0,0 +1,295 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+/*
+	Lưu khóa RSA của server ra file để khởi động lại không bị đổi khóa
+	File gồm 1 hoặc nhiều khối PEM, mỗi khối là 1 private key (PKCS#8) được mã hóa AES-GCM
+	bằng khóa dẫn xuất từ passphrase (PBKDF2). Header của khối ghi Key-Id, Salt, Nonce
+	Khối đầu tiên là khóa hiện hành, các khối sau là khóa cũ có Retire-After (hết thời gian ân hạn)
+*/
+
+const (
+	keyFileBlockType  = "ENCRYPTED SERVER RSA KEY"
+	keyFileIterations = 100000
+)
+
+var (
+	ErrWrongKeyPassphrase   = errors.New("sai passphrase hoặc file khóa bị lỗi")
+	ErrMissingKeyPassphrase = errors.New("thiếu SERVER_KEY_PASSPHRASE: không mã hóa file khóa bằng passphrase rỗng")
+)
+
+// Passphrase rỗng thì ai đọc được file cũng giải mã được khóa -> từ chối luôn
+func deriveKeyFileKey(passphrase string, salt []byte) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrMissingKeyPassphrase
+	}
+	return pbkdf2.Key([]byte(passphrase), salt, keyFileIterations, 32, sha256.New), nil
+}
+
+// Mã hóa private key dạng DER thành 1 khối PEM (AES-GCM, khóa dẫn xuất từ passphrase)
+func sealKeyBlock(blockType string, der []byte, id, passphrase string, headers map[string]string) (*pem.Block, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := deriveKeyFileKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aesGCM.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	all := map[string]string{
+		"Key-Id": id,
+		"Salt":   hex.EncodeToString(salt),
+		"Nonce":  hex.EncodeToString(nonce),
+	}
+	for k, v := range headers {
+		all[k] = v
+	}
+
+	return &pem.Block{
+		Type:    blockType,
+		Headers: all,
+		// Key ID làm dữ liệu xác thực kèm để không tráo được khối này sang ID khác
+		Bytes: aesGCM.Seal(nil, nonce, der, []byte(id)),
+	}, nil
+}
+
+// Giải mã khối PEM do sealKeyBlock tạo, trả về private key dạng DER
+func openKeyBlock(b *pem.Block, passphrase string) ([]byte, error) {
+	salt, err := hex.DecodeString(b.Headers["Salt"])
+	if err != nil {
+		return nil, ErrWrongKeyPassphrase
+	}
+	nonce, err := hex.DecodeString(b.Headers["Nonce"])
+	if err != nil {
+		return nil, ErrWrongKeyPassphrase
+	}
+
+	key, err := deriveKeyFileKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aesGCM, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aesGCM.NonceSize() {
+		return nil, ErrWrongKeyPassphrase
+	}
+	der, err := aesGCM.Open(nil, nonce, b.Bytes, []byte(b.Headers["Key-Id"]))
+	if err != nil {
+		return nil, ErrWrongKeyPassphrase
+	}
+	return der, nil
+}
+
+func encryptKeyBlock(priv *rsa.PrivateKey, passphrase string, retireAfter time.Time) (*pem.Block, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	if !retireAfter.IsZero() {
+		headers["Retire-After"] = retireAfter.UTC().Format(time.RFC3339)
+	}
+	return sealKeyBlock(keyFileBlockType, der, rsaKeyID(&priv.PublicKey), passphrase, headers)
+}
+
+func decryptKeyBlock(b *pem.Block, passphrase string) (*rsa.PrivateKey, error) {
+	der, err := openKeyBlock(b, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	priv, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("file khóa không chứa khóa RSA")
+	}
+	return priv, nil
+}
+
+// Đọc file khóa, trả về khóa hiện hành và các khóa cũ còn trong thời gian ân hạn
+func readKeyFile(path, passphrase string) (*rsa.PrivateKey, []retiredKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current *rsa.PrivateKey
+	var retired []retiredKey
+	for {
+		var b *pem.Block
+		b, data = pem.Decode(data)
+		if b == nil {
+			break
+		}
+		if b.Type != keyFileBlockType {
+			continue
+		}
+
+		var until time.Time
+		if s, ok := b.Headers["Retire-After"]; ok {
+			until, err = time.Parse(time.RFC3339, s)
+			if err != nil {
+				return nil, nil, fmt.Errorf("Retire-After không hợp lệ: %w", err)
+			}
+			// Hết thời gian ân hạn -> bỏ luôn, không cần giải mã
+			if time.Now().After(until) {
+				continue
+			}
+		}
+
+		priv, err := decryptKeyBlock(b, passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		if until.IsZero() {
+			if current != nil {
+				return nil, nil, errors.New("file khóa có nhiều hơn 1 khóa hiện hành")
+			}
+			current = priv
+		} else {
+			retired = append(retired, retiredKey{id: rsaKeyID(&priv.PublicKey), key: priv, until: until})
+		}
+	}
+
+	if current == nil {
+		return nil, nil, errors.New("file khóa không có khóa hiện hành")
+	}
+	return current, retired, nil
+}
+
+// Ghi file khóa (khóa hiện hành trước, khóa cũ sau)
+func writeKeyFile(path, passphrase string, current *rsa.PrivateKey, retired []retiredKey) error {
+	var out []byte
+
+	b, err := encryptKeyBlock(current, passphrase, time.Time{})
+	if err != nil {
+		return err
+	}
+	out = append(out, pem.EncodeToMemory(b)...)
+	for _, k := range retired {
+		b, err := encryptKeyBlock(k.key, passphrase, k.until)
+		if err != nil {
+			return err
+		}
+		out = append(out, pem.EncodeToMemory(b)...)
+	}
+
+	return writeFileAtomic(path, out)
+}
+
+// Ghi ra file tạm (quyền 0600) rồi rename để không bao giờ để lại file ghi dở
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func useServerKeys(current *rsa.PrivateKey, retired []retiredKey) {
+	ServerPrivateKey = current
+	ServerPublicKey = &current.PublicKey
+	retiredServerKeys = retired
+}
+
+// Nạp khóa RSA của server từ file path (mã hóa bằng passphrase)
+// Nếu file chưa có thì sinh khóa mới và ghi vào file
+func LoadOrCreateServerRSAKeys(path, passphrase string) error {
+	if passphrase == "" {
+		return ErrMissingKeyPassphrase
+	}
+
+	current, retired, err := readKeyFile(path, passphrase)
+	if errors.Is(err, os.ErrNotExist) {
+		current, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return err
+		}
+		if err := writeKeyFile(path, passphrase, current, nil); err != nil {
+			return err
+		}
+		useServerKeys(current, nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	useServerKeys(current, retired)
+	return nil
+}
+
+// Xoay vòng khóa RSA: sinh khóa mới làm khóa hiện hành
+// Khóa hiện hành cũ vẫn được chấp nhận thêm 1 khoảng grace để client đã lấy khóa cũ không bị lỗi
+func RotateServerRSAKeys(path, passphrase string, grace time.Duration) error {
+	if err := LoadOrCreateServerRSAKeys(path, passphrase); err != nil {
+		return err
+	}
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return err
+	}
+	retired := append([]retiredKey{{
+		id:    ServerKeyID(),
+		key:   ServerPrivateKey,
+		until: time.Now().Add(grace),
+	}}, retiredServerKeys...)
+
+	if err := writeKeyFile(path, passphrase, newKey, retired); err != nil {
+		return err
+	}
+	useServerKeys(newKey, retired)
+	return nil
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+/*
+	Chữ ký Ed25519 của người gửi trên 1 share
+	Người gửi ký (người gửi, người nhận, note, hash ciphertext, khóa đã bọc, key scheme, hạn dùng)
+	Người nhận kiểm tra chữ ký bằng khóa ký của người gửi (lấy qua key log) trước khi giải mã
+	Server cũng kiểm tra lúc tạo share để từ chối sớm dữ liệu sai
+*/
+
+// Public key Ed25519 dạng hex có hợp lệ không
+func ValidEd25519PublicKey(pubHex string) bool {
+	b, err := hex.DecodeString(pubHex)
+	return err == nil && len(b) == ed25519.PublicKeySize
+}
+
+// Hash của ciphertext được ký: SHA-256 (hex) của ciphertext ở dạng Base64 chuẩn
+func CipherTextDigest(cipherTextBase64 string) string {
+	sum := sha256.Sum256([]byte(cipherTextBase64))
+	return hex.EncodeToString(sum[:])
+}
+
+// Giá trị thay cho cipherDigest trong nội dung được ký của share theo phiên bản mới nhất
+// (người gửi đồng ý cho người nhận đọc mọi phiên bản sau này nên không ký nội dung cụ thể)
+const ShareDigestLatest = "latest"
+
+// Nội dung được ký của 1 share, client dựng lại đúng chuỗi này
+// cipherDigest là kết quả của CipherTextDigest (hoặc ShareDigestLatest)
+func ShareSignatureMessage(sender, receiver, noteID, cipherDigest, wrappedKey, keyScheme string, expiresAt int64) []byte {
+	return []byte(fmt.Sprintf("note-sharing-share-v1\n%d:%s|%d:%s|%d:%s|%s|%d:%s|%d:%s|%d",
+		len(sender), sender,
+		len(receiver), receiver,
+		len(noteID), noteID,
+		cipherDigest,
+		len(wrappedKey), wrappedKey,
+		len(keyScheme), keyScheme,
+		expiresAt))
+}
+
+// Kiểm tra chữ ký (base64) của share bằng public key ký (hex) của người gửi
+func VerifyShareSignature(signingPubHex, signatureB64 string, message []byte) bool {
+	pub, err := hex.DecodeString(signingPubHex)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(ed25519.PublicKey(pub), message, sig)
+}
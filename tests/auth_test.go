@@ -2,70 +2,51 @@ package tests
 
 import (
 	"bytes"
-	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
 	"log"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
-	"time"
 
-	"note_sharing_application/server/configs"
-	"note_sharing_application/server/handlers"
+	"note_sharing_application/client/crypto"
 	"note_sharing_application/server/routers"
+	"note_sharing_application/server/stores"
 	"note_sharing_application/server/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Đặt tên db test xác thực
-const TestDBName = "NoteAppDB_Test_Auth"
-
 var router *gin.Engine
 
 func TestMain(m *testing.M) {
 	// Set Gin mode Test
 	gin.SetMode(gin.TestMode)
 
-	// Kết nối MongoDB Test
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		log.Fatal("Không thể kết nối MongoDB Test:", err)
-	}
-
-	configs.DB = client.Database(TestDBName)
-
-	// Gán đè biến toàn cục trong handlers để dùng DB Test
-	handlers.UserCollection = configs.DB.Collection("users")
+	// Dùng bộ lưu trữ trên RAM, không cần MongoDB
+	stores.Use(stores.NewMemory())
 
 	// Sinh khóa RSA cho Server
 	if err := utils.GenerateServerRSAKeys(); err != nil {
 		log.Fatal("Lỗi sinh RSA Key Server:", err)
 	}
+	// Sinh khóa ký key transparency log
+	if err := utils.GenerateLogSigningKey(); err != nil {
+		log.Fatal("Lỗi sinh khóa ký key log:", err)
+	}
 
 	// Setup Router
 	router = routers.SetupRouter()
 
-	// Chạy test
-	exitVal := m.Run()
-
-	// Xóa DB sau test
-	fmt.Println("\n Đang dọn dẹp Database Test...")
-	configs.DB.Drop(context.Background())
-
-	os.Exit(exitVal)
+	// Chạy test (dữ liệu trên RAM tự mất khi kết thúc)
+	os.Exit(m.Run())
 }
 
 // Mã hóa password bằng server pubkey RSA
@@ -90,7 +71,7 @@ func TestAuthFlow(t *testing.T) {
 	password := "pass"
 
 	// Dữ liệu giả cho DH Key
-	mockPubKey := "MockPublicKeyHexString"
+	mockPubKey := mockPublicKey()
 	mockEncPrivKey := "MockEncryptedPrivateKeyHex"
 
 	// Test Register
@@ -193,3 +174,40 @@ func TestAuthFlow(t *testing.T) {
 		assert.Equal(t, http.StatusUnauthorized, w.Code)
 	})
 }
+
+// Khóa trao đổi sai bị từ chối lúc đăng ký, không ghi vào key log
+func TestRegisterRejectsInvalidPublicKey(t *testing.T) {
+	register := func(username, pubKey, keyType string) int {
+		body, _ := json.Marshal(map[string]string{
+			"username":          username,
+			"password":          encryptPasswordForTest("pass"),
+			"public_key":        pubKey,
+			"public_key_type":   keyType,
+			"encrypted_privKey": "MockEncryptedPrivateKeyHex",
+		})
+		req, _ := http.NewRequest("POST", "/auth/register", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	pMinusOne := new(big.Int).Sub(crypto.P, big.NewInt(1))
+	pMinusTwo := new(big.Int).Sub(crypto.P, big.NewInt(2))
+	// 1 < khóa < P-1 và thuộc nhóm con bậc Q (P-2 nằm trong khoảng nhưng ngoài nhóm con)
+	for _, bad := range []string{"", "MockPublicKeyHexString", "1", pMinusOne.Text(16), pMinusTwo.Text(16), crypto.P.Text(16)} {
+		assert.Equal(t, http.StatusBadRequest, register("bad_dh_user", bad, crypto.KeyTypeDH), bad)
+	}
+
+	_, x25519Pub, _ := crypto.GenerateX25519KeyPair()
+	// Sai độ dài, không phải hex, điểm bậc thấp (0 và 1)
+	for _, bad := range []string{"", x25519Pub[:62], "zz" + x25519Pub[2:], strings.Repeat("00", 32), "01" + strings.Repeat("00", 31)} {
+		assert.Equal(t, http.StatusBadRequest, register("bad_x25519_user", bad, crypto.KeyTypeX25519), bad)
+	}
+
+	exists, err := stores.Users.Exists(t.Context(), "bad_x25519_user")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	assert.Equal(t, http.StatusOK, register("good_x25519_user", x25519Pub, crypto.KeyTypeX25519))
+	assert.Equal(t, http.StatusOK, register("good_dh_user", mockPublicKey(), crypto.KeyTypeDH))
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Gửi POST /notes/:note_id/shares, trả về status code và kết quả từng người nhận
+func createSharesRequest(token, noteID string, body models.CreateSharesRequest) (int, []models.ShareResult) {
+	w := authedRequest("POST", "/notes/"+noteID+"/shares", token, body)
+
+	var res struct {
+		Results []models.ShareResult `json:"results"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res.Results
+}
+
+func TestBatchShare(t *testing.T) {
+	aliceToken := SetupMockUser(t, "batch_alice", "123")
+	bobToken := SetupMockUser(t, "batch_bob", "123")
+	carolToken := SetupMockUser(t, "batch_carol", "123")
+	SetupMockUser(t, "batch_dave", "123")
+
+	noteID := SetupMockNote(t, "123", aliceToken)
+	recipient := func(receiver string) models.ShareRecipient {
+		return models.ShareRecipient{Receiver: receiver, SharedEncryptedAESKey: "wrapped_" + receiver, KeyScheme: crypto.KeySchemeX25519}
+	}
+
+	t.Run("Per-recipient results", func(t *testing.T) {
+		badScheme := recipient("batch_dave")
+		badScheme.KeyScheme = "rot13"
+		code, results := createSharesRequest(aliceToken, noteID, models.CreateSharesRequest{
+			ExpiresIn: "1h", MaxAccess: 2,
+			Shares: []models.ShareRecipient{
+				recipient("batch_bob"), recipient("batch_carol"), recipient("batch_bob"),
+				recipient("batch_ghost"), badScheme, {Receiver: "batch_dave"},
+			},
+		})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Len(t, results, 6)
+
+		statuses := []int{}
+		for _, r := range results {
+			statuses = append(statuses, r.Status)
+		}
+		assert.Equal(t, []int{http.StatusCreated, http.StatusCreated, http.StatusConflict, http.StatusNotFound, http.StatusBadRequest, http.StatusBadRequest}, statuses)
+		assert.Equal(t, "batch_ghost", results[3].Receiver)
+		assert.NotEmpty(t, results[3].Error)
+
+		assert.Equal(t, http.StatusOK, AccessURL(t, results[0].UrlID, bobToken))
+		assert.Equal(t, http.StatusOK, AccessURL(t, results[1].UrlID, carolToken))
+		assert.Len(t, noteShares(t, noteID, aliceToken), 2)
+	})
+
+	t.Run("Request-level errors", func(t *testing.T) {
+		code, _ := createSharesRequest(aliceToken, noteID, models.CreateSharesRequest{ExpiresIn: "1h", MaxAccess: 1})
+		assert.Equal(t, http.StatusBadRequest, code, "Không có người nhận")
+
+		code, _ = createSharesRequest(aliceToken, noteID, models.CreateSharesRequest{
+			ExpiresIn: "1h", MaxAccess: 0, Shares: []models.ShareRecipient{recipient("batch_bob")},
+		})
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = createSharesRequest(aliceToken, noteID, models.CreateSharesRequest{
+			ExpiresIn: "1h", MaxAccess: 1, Revision: 7, Shares: []models.ShareRecipient{recipient("batch_bob")},
+		})
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, _ = createSharesRequest(bobToken, noteID, models.CreateSharesRequest{
+			ExpiresIn: "1h", MaxAccess: 1, Shares: []models.ShareRecipient{recipient("batch_carol")},
+		})
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Signatures are checked per recipient", func(t *testing.T) {
+		signingPriv, signingPub, err := crypto.GenerateSigningKeyPair()
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, signingKeyRequest(aliceToken, "123", signingPub))
+
+		var cipherDigest string
+		for _, n := range ownedNotes(t, aliceToken) {
+			if n.ID == noteID {
+				cipherDigest = n.CipherDigest
+			}
+		}
+		expiresAt := time.Now().Add(time.Hour).Unix()
+		signed := func(receiver, signedFor string) models.ShareRecipient {
+			r := recipient(receiver)
+			msg := crypto.ShareSignatureMessage("batch_alice", signedFor, noteID, cipherDigest, r.SharedEncryptedAESKey, r.KeyScheme, expiresAt)
+			r.Signature, _ = crypto.SignMessage(signingPriv, msg)
+			return r
+		}
+
+		code, results := createSharesRequest(aliceToken, noteID, models.CreateSharesRequest{
+			ExpiresAt: expiresAt, MaxAccess: 1,
+			Shares: []models.ShareRecipient{signed("batch_dave", "batch_dave"), signed("batch_carol", "batch_bob")},
+		})
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, http.StatusCreated, results[0].Status)
+		assert.Equal(t, http.StatusBadRequest, results[1].Status, "Chữ ký của người nhận khác")
+	})
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestConsistencyCheck(t *testing.T) {
+	ctx := t.Context()
+	aliceToken := SetupMockUser(t, "consistency_alice", "123")
+	bobToken := SetupMockUser(t, "consistency_bob", "123")
+
+	// Dữ liệu hợp lệ, không được đụng tới
+	noteID := SetupMockNote(t, "123", aliceToken)
+	urlID := SetupMockURL(t, noteID, "consistency_alice", "consistency_bob", "1h", 2, aliceToken, bobToken)
+
+	// Share trỏ tới note không còn tồn tại
+	orphanURL, err := stores.Shares.Create(ctx, models.Url{
+		NoteID: primitive.NewObjectID().Hex(), Sender: "consistency_alice", Receiver: "consistency_bob",
+		ExpiresAt: time.Now().Add(time.Hour), MaxAccess: 1,
+	})
+	assert.NoError(t, err)
+
+	// Share cho nhóm trỏ tới note không còn tồn tại, share cho nhóm của note hợp lệ được giữ
+	groupID := primitive.NewObjectID().Hex()
+	orphanGroupShare, err := stores.Groups.CreateShare(ctx, models.GroupShare{
+		GroupID: groupID, NoteID: primitive.NewObjectID().Hex(), Sender: "consistency_alice", KeyVersion: 1,
+	})
+	assert.NoError(t, err)
+	groupShare, err := stores.Groups.CreateShare(ctx, models.GroupShare{
+		GroupID: groupID, NoteID: noteID, Sender: "consistency_alice", KeyVersion: 1,
+	})
+	assert.NoError(t, err)
+
+	// Note của owner không còn tồn tại, kèm share và nội dung
+	blobRef, size, err := stores.Blobs.Put(ctx, bytes.NewReader([]byte("ownerless")))
+	assert.NoError(t, err)
+	ownerlessNote, err := stores.Notes.Create(ctx, models.Note{
+		OwnerID: primitive.NewObjectID().Hex(), BlobRef: blobRef, Size: size, CipherDigest: "digest",
+	})
+	assert.NoError(t, err)
+	ownerlessURL, err := stores.Shares.Create(ctx, models.Url{
+		NoteID: ownerlessNote, Sender: "ghost", Receiver: "consistency_bob",
+		ExpiresAt: time.Now().Add(time.Hour), MaxAccess: 1,
+	})
+	assert.NoError(t, err)
+
+	t.Run("Check only reports", func(t *testing.T) {
+		report, err := services.CheckConsistency(false)
+		assert.NoError(t, err)
+		assert.False(t, report.Consistent())
+		assert.False(t, report.Repaired)
+		assert.Contains(t, report.OrphanShares, orphanURL)
+		assert.NotContains(t, report.OrphanShares, urlID)
+		assert.Contains(t, report.OrphanGroupShares, orphanGroupShare)
+		assert.NotContains(t, report.OrphanGroupShares, groupShare)
+		assert.Contains(t, report.OwnerlessNotes, ownerlessNote)
+		assert.NotContains(t, report.OwnerlessNotes, noteID)
+
+		_, err = stores.Shares.FindByID(ctx, orphanURL)
+		assert.NoError(t, err)
+		_, err = stores.Notes.FindByID(ctx, ownerlessNote)
+		assert.NoError(t, err)
+		shares, err := stores.Groups.ListShares(ctx, groupID)
+		assert.NoError(t, err)
+		assert.Len(t, shares, 2)
+	})
+
+	t.Run("Repair", func(t *testing.T) {
+		report, err := services.CheckConsistency(true)
+		assert.NoError(t, err)
+		assert.True(t, report.Repaired)
+
+		_, err = stores.Shares.FindByID(ctx, orphanURL)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+		_, err = stores.Notes.FindByID(ctx, ownerlessNote)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+		_, err = stores.Shares.FindByID(ctx, ownerlessURL)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+		_, err = stores.Blobs.Open(ctx, blobRef)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+
+		_, err = stores.Notes.FindByID(ctx, noteID)
+		assert.NoError(t, err)
+		_, err = stores.Shares.FindByID(ctx, urlID)
+		assert.NoError(t, err)
+		shares, err := stores.Groups.ListShares(ctx, groupID)
+		assert.NoError(t, err)
+		if assert.Len(t, shares, 1) {
+			assert.Equal(t, groupShare, shares[0].ID.Hex())
+		}
+
+		report, err = services.CheckConsistency(false)
+		assert.NoError(t, err)
+		assert.NotContains(t, report.OrphanShares, orphanURL)
+		assert.NotContains(t, report.OrphanGroupShares, orphanGroupShare)
+		assert.NotContains(t, report.OwnerlessNotes, ownerlessNote)
+	})
+}
@@ -0,0 +1,282 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/services"
+	"note_sharing_application/server/middlewares"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Gửi request với body binary, trả về status code
+func putContent(token, noteID string, body []byte, contentType string) int {
+	req, _ := http.NewRequest("PUT", "/notes/"+noteID+"/content", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+// Tạo note chỉ có metadata (nội dung tải lên sau)
+func createMetadataNote(token string) (string, error) {
+	w := authedRequest("POST", "/notes", token, map[string]string{"encrypted_aes_key_by_K": "EncAESKey"})
+
+	var res struct {
+		NoteID string `json:"note_id"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &res)
+	return res.NoteID, err
+}
+
+func TestBinaryNoteContent(t *testing.T) {
+	ownerToken := SetupMockUser(t, "binary_alice", "123")
+	otherToken := SetupMockUser(t, "binary_bob", "123")
+
+	// Tạo note chỉ có metadata
+	noteID, err := createMetadataNote(ownerToken)
+	assert.NoError(t, err)
+
+	content := generateRandomBytes(100 * 1024)
+
+	t.Run("Kiểm tra quyền và định dạng khi tải lên", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, putContent(otherToken, noteID, content, "application/octet-stream"))
+		assert.Equal(t, http.StatusUnsupportedMediaType, putContent(ownerToken, noteID, content, "application/json"))
+		assert.Equal(t, http.StatusBadRequest, putContent(ownerToken, noteID, nil, "application/octet-stream"))
+
+		oldMax := middlewares.MaxNoteContentSize
+		middlewares.MaxNoteContentSize = 1024
+		defer func() { middlewares.MaxNoteContentSize = oldMax }()
+		assert.Equal(t, http.StatusRequestEntityTooLarge, putContent(ownerToken, noteID, content, "application/octet-stream"))
+	})
+
+	t.Run("Chưa có nội dung thì không tải về hay chia sẻ được", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/notes/"+noteID+"/content", ownerToken, nil).Code)
+		code := createShareRequest(ownerToken, noteID, map[string]interface{}{
+			"receiver": "binary_bob", "max_access": 1, "expires_in": "1h",
+			"shared_encrypted_aes_key": "k", "key_scheme": crypto.KeySchemeX25519,
+		})
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("Tải lên và tải về nội dung binary", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, putContent(ownerToken, noteID, content, "application/octet-stream"))
+		// Mỗi note chỉ tải nội dung 1 lần
+		assert.Equal(t, http.StatusConflict, putContent(ownerToken, noteID, content, "application/octet-stream"))
+
+		w := authedRequest("GET", "/notes/"+noteID+"/content", ownerToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+		assert.True(t, bytes.Equal(content, w.Body.Bytes()))
+
+		// Danh sách note chỉ có kích thước và hash, không kèm nội dung
+		digest := crypto.CipherTextDigest(base64.StdEncoding.EncodeToString(content))
+		for _, n := range ownedNotes(t, ownerToken) {
+			if n.ID == noteID {
+				assert.Empty(t, n.CipherText)
+				assert.Equal(t, int64(len(content)), n.Size)
+				assert.Equal(t, digest, n.CipherDigest)
+				assert.Equal(t, digest, w.Header().Get("X-Cipher-Digest"))
+			}
+		}
+
+		assert.Equal(t, http.StatusForbidden, authedRequest("GET", "/notes/"+noteID+"/content", otherToken, nil).Code)
+	})
+
+	t.Run("Metadata không tính lượt xem, tải nội dung thì có", func(t *testing.T) {
+		code := createShareRequest(ownerToken, noteID, map[string]interface{}{
+			"receiver": "binary_bob", "max_access": 1, "expires_in": "1h",
+			"shared_encrypted_aes_key": "k", "key_scheme": crypto.KeySchemeX25519,
+		})
+		assert.Equal(t, http.StatusOK, code)
+
+		var res struct {
+			Url string `json:"url"`
+		}
+		_ = json.Unmarshal(authedRequest("GET", "/notes/"+noteID+"/url", otherToken, nil).Body.Bytes(), &res)
+		urlID := res.Url[len(res.Url)-24:]
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, http.StatusOK, authedRequest("GET", "/note/"+urlID+"/meta", otherToken, nil).Code)
+		}
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/note/"+urlID+"/meta", ownerToken, nil).Code)
+
+		w := authedRequest("GET", "/note/"+urlID+"/content", otherToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, bytes.Equal(content, w.Body.Bytes()))
+
+		// max_access = 1 -> đã hết lượt
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/note/"+urlID+"/content", otherToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/note/"+urlID+"/meta", otherToken, nil).Code)
+	})
+}
+
+// Nội dung nằm trong blob store, xóa note thì xóa luôn blob
+func TestNoteBlobStorage(t *testing.T) {
+	ctx := context.Background()
+	token := SetupMockUser(t, "blob_alice", "123")
+
+	t.Run("Xóa hẳn note thì xóa blob", func(t *testing.T) {
+		noteID := SetupMockNote(t, "123", token)
+		note, err := stores.Notes.FindByID(ctx, noteID)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, note.BlobRef)
+		assert.Empty(t, note.CipherText, "Không còn lưu ciphertext trong document note")
+
+		blob, err := stores.Blobs.Open(ctx, note.BlobRef)
+		assert.NoError(t, err)
+		blob.Close()
+
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+noteID, token, nil).Code)
+
+		// Trong thùng rác nội dung vẫn còn
+		blob, err = stores.Blobs.Open(ctx, note.BlobRef)
+		assert.NoError(t, err)
+		blob.Close()
+
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/trash/"+noteID, token, nil).Code)
+
+		_, err = stores.Blobs.Open(ctx, note.BlobRef)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+	})
+
+	t.Run("Note cũ lưu ciphertext inline vẫn đọc được", func(t *testing.T) {
+		content := []byte("legacy ciphertext")
+		user, _ := stores.Users.FindByUsername(ctx, "blob_alice")
+		noteID, err := stores.Notes.Create(ctx, models.Note{
+			CipherText: base64.StdEncoding.EncodeToString(content),
+			OwnerID:    user.ID.Hex(),
+		})
+		assert.NoError(t, err)
+
+		w := authedRequest("GET", "/notes/"+noteID+"/content", token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, content, w.Body.Bytes())
+		// Đã có nội dung inline thì không tải lên thêm
+		assert.Equal(t, http.StatusConflict, putContent(token, noteID, content, "application/octet-stream"))
+	})
+
+	t.Run("cipher_text không phải Base64", func(t *testing.T) {
+		w := authedRequest("POST", "/notes", token, map[string]string{"cipher_text": "!!!", "encrypted_aes_key_by_K": "k"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+// Client gửi file qua endpoint binary theo luồng và giải mã lại được
+func TestStreamingUploadClient(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+	oldBaseURL := services.BaseURL
+	services.BaseURL = server.URL
+	defer func() { services.BaseURL = oldBaseURL }()
+
+	token := SetupMockUser(t, "stream_alice", "123")
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "big.bin")
+	plain := generateRandomBytes(3*crypto.StreamChunkSize + 7)
+	assert.NoError(t, os.WriteFile(src, plain, 0644))
+
+	aesKey, encKey, err := crypto.NewNoteKey("123")
+	assert.NoError(t, err)
+	noteID, err := services.CreateNote(token, "", encKey, "")
+	assert.NoError(t, err)
+
+	err = services.UploadNoteContent(token, noteID, func() (io.ReadCloser, error) {
+		return crypto.EncryptFileReader(src, aesKey)
+	})
+	assert.NoError(t, err)
+
+	var digest string
+	for _, n := range ownedNotes(t, token) {
+		if n.ID == noteID {
+			digest = n.CipherDigest
+		}
+	}
+
+	out := filepath.Join(dir, "out.bin")
+	body, err := services.OpenNoteContent(token, noteID)
+	assert.NoError(t, err)
+	assert.NoError(t, crypto.RestoreFileFromReader(body, aesKey, digest, out))
+	body.Close()
+	restored, _ := os.ReadFile(out)
+	assert.True(t, bytes.Equal(plain, restored))
+
+	// Hash không khớp (server đổi nội dung) -> lỗi và không để lại file
+	body, err = services.OpenNoteContent(token, noteID)
+	assert.NoError(t, err)
+	bad := filepath.Join(dir, "bad.bin")
+	err = crypto.RestoreFileFromReader(body, aesKey, crypto.CipherTextDigest("other"), bad)
+	body.Close()
+	assert.ErrorIs(t, err, crypto.ErrCipherDigest)
+	assert.NoFileExists(t, bad)
+}
+
+func TestGetOwnNote(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+	oldBaseURL := services.BaseURL
+	services.BaseURL = server.URL
+	defer func() { services.BaseURL = oldBaseURL }()
+
+	token := SetupMockUser(t, "get_alice", "123")
+	otherToken := SetupMockUser(t, "get_bob", "123")
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "secret.bin")
+	plain := generateRandomBytes(crypto.StreamChunkSize + 11)
+	assert.NoError(t, os.WriteFile(src, plain, 0644))
+
+	_, encKey, err := crypto.NewNoteKey("123")
+	assert.NoError(t, err)
+	noteID, err := services.CreateNote(token, "", encKey, "")
+	assert.NoError(t, err)
+
+	// Chỉ chủ note xem được, /notes/owned không bị route /:note_id che mất
+	assert.Equal(t, http.StatusForbidden, authedRequest("GET", "/notes/"+noteID, otherToken, nil).Code)
+	assert.Equal(t, http.StatusBadRequest, authedRequest("GET", "/notes/not-an-id", token, nil).Code)
+	assert.Equal(t, http.StatusOK, authedRequest("GET", "/notes/owned", token, nil).Code)
+
+	aesKeyHex, err := crypto.DecryptByPassword(encKey, "123")
+	assert.NoError(t, err)
+	aesKey, _ := hex.DecodeString(aesKeyHex)
+	err = services.UploadNoteContent(token, noteID, func() (io.ReadCloser, error) {
+		return crypto.EncryptFileReader(src, aesKey)
+	})
+	assert.NoError(t, err)
+
+	// Luồng của lệnh get: lấy note, mở khóa bằng password, giải mã nội dung
+	note, err := services.GetNote(token, noteID)
+	assert.NoError(t, err)
+	assert.Equal(t, noteID, note.ID)
+	assert.Equal(t, encKey, note.EncryptedAesKey)
+	assert.NotEmpty(t, note.CipherDigest)
+
+	keyHex, err := crypto.DecryptByPassword(note.EncryptedAesKey, "123")
+	assert.NoError(t, err)
+	key, _ := hex.DecodeString(keyHex)
+	body, err := services.OpenNoteContent(token, noteID)
+	assert.NoError(t, err)
+	out := filepath.Join(dir, "out.bin")
+	assert.NoError(t, crypto.RestoreFileFromReader(body, key, note.CipherDigest, out))
+	body.Close()
+	restored, _ := os.ReadFile(out)
+	assert.True(t, bytes.Equal(plain, restored))
+
+	_, err = services.GetNote(otherToken, noteID)
+	assert.Error(t, err)
+}
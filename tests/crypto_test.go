@@ -1,7 +1,12 @@
 package tests
 
 import (
+	"bytes"
 	"crypto/rand"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"note_sharing_application/client/crypto"
@@ -117,3 +122,179 @@ func TestSharedKeyExchange(t *testing.T) {
 		assert.Equal(t, originalAESKey, decryptedAESKey, "Khóa AES sau khi chia sẻ bị sai lệch")
 	})
 }
+
+// Test từ chối public key DH không hợp lệ
+func TestDHPeerKeyValidation(t *testing.T) {
+	myPriv, _, err := crypto.GenerateKeyPair()
+	assert.NoError(t, err)
+
+	pMinusOne := new(big.Int).Sub(crypto.P, big.NewInt(1))
+	badKeys := map[string]string{
+		"0":   "0",
+		"1":   "1",
+		"p-1": pMinusOne.Text(16),
+		"p":   crypto.P.Text(16),
+		// -2 không phải thặng dư bậc 2 nên không thuộc nhóm con bậc Q
+		"p-2":       new(big.Int).Sub(crypto.P, big.NewInt(2)).Text(16),
+		"không hex": "xyz",
+	}
+	for name, key := range badKeys {
+		_, err := crypto.ComputeSharedSecret(myPriv, key)
+		assert.Error(t, err, "Public key %s phải bị từ chối", name)
+	}
+}
+
+// Test X25519 + HKDF gắn với username 2 bên
+func TestX25519ShareKey(t *testing.T) {
+	alicePriv, alicePub, err := crypto.GenerateX25519KeyPair()
+	assert.NoError(t, err)
+	bobPriv, bobPub, err := crypto.GenerateX25519KeyPair()
+	assert.NoError(t, err)
+
+	aliceKey, err := crypto.DeriveShareKey(crypto.KeySchemeX25519, alicePriv, bobPub, "alice", "bob")
+	assert.NoError(t, err)
+	bobKey, err := crypto.DeriveShareKey(crypto.KeySchemeX25519, bobPriv, alicePub, "alice", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, aliceKey, bobKey, "2 bên phải dẫn xuất cùng 1 khóa")
+
+	// Đổi vai trò hoặc đổi username -> khóa khác
+	swapped, _ := crypto.DeriveShareKey(crypto.KeySchemeX25519, alicePriv, bobPub, "bob", "alice")
+	assert.NotEqual(t, aliceKey, swapped)
+	renamed, _ := crypto.DeriveShareKey(crypto.KeySchemeX25519, alicePriv, bobPub, "alice", "mallory")
+	assert.NotEqual(t, aliceKey, renamed)
+
+	// Bọc và mở AES key
+	aesKey := generateRandomBytes(32)
+	wrapped, err := crypto.WrapAESKey(aesKey, aliceKey)
+	assert.NoError(t, err)
+	unwrapped, err := crypto.UnwrapAESKey(wrapped, bobKey)
+	assert.NoError(t, err)
+	assert.Equal(t, aesKey, unwrapped)
+
+	// Điểm bậc thấp (toàn 0) và sai độ dài bị từ chối
+	_, err = crypto.DeriveShareKey(crypto.KeySchemeX25519, alicePriv, strings.Repeat("00", 32), "alice", "bob")
+	assert.Error(t, err)
+	_, err = crypto.DeriveShareKey(crypto.KeySchemeX25519, alicePriv, bobPub[:20], "alice", "bob")
+	assert.Error(t, err)
+}
+
+// Share cũ (SHA-256(K)) vẫn mở được, share DH mới dùng HKDF
+func TestDHShareKeySchemes(t *testing.T) {
+	alicePriv, alicePub, _ := crypto.GenerateKeyPair()
+	bobPriv, bobPub, _ := crypto.GenerateKeyPair()
+
+	sharedK, err := crypto.ComputeSharedSecret(alicePriv, bobPub.Text(16))
+	assert.NoError(t, err)
+	aesKey := generateRandomBytes(32)
+	legacyWrapped, err := crypto.EncryptAESKeyWithSharedK(aesKey, sharedK)
+	assert.NoError(t, err)
+
+	legacyKey, err := crypto.DeriveShareKey(crypto.KeySchemeLegacyDH, bobPriv.Text(16), alicePub.Text(16), "alice", "bob")
+	assert.NoError(t, err)
+	unwrapped, err := crypto.UnwrapAESKey(legacyWrapped, legacyKey)
+	assert.NoError(t, err)
+	assert.Equal(t, aesKey, unwrapped)
+
+	aliceKey, err := crypto.DeriveShareKey(crypto.KeySchemeDHHKDF, alicePriv.Text(16), bobPub.Text(16), "alice", "bob")
+	assert.NoError(t, err)
+	bobKey, err := crypto.DeriveShareKey(crypto.KeySchemeDHHKDF, bobPriv.Text(16), alicePub.Text(16), "alice", "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, aliceKey, bobKey)
+	assert.NotEqual(t, legacyKey, aliceKey)
+}
+
+// Mã hóa theo luồng (chunk) cho file lớn
+func TestStreamEncryption(t *testing.T) {
+	key, _ := crypto.GenerateAESKey()
+	chunk := crypto.StreamChunkSize
+
+	encrypt := func(plain []byte) []byte {
+		var out bytes.Buffer
+		assert.NoError(t, crypto.EncryptStream(&out, bytes.NewReader(plain), key))
+		return out.Bytes()
+	}
+	decrypt := func(ct []byte) ([]byte, error) {
+		var out bytes.Buffer
+		err := crypto.DecryptStream(&out, bytes.NewReader(ct), key)
+		return out.Bytes(), err
+	}
+
+	t.Run("Mã hóa và giải mã đúng với mọi kích thước", func(t *testing.T) {
+		for _, size := range []int{0, 1, chunk - 1, chunk, chunk + 1, 3*chunk + 5} {
+			plain := generateRandomBytes(size)
+			got, err := decrypt(encrypt(plain))
+			assert.NoError(t, err, "size %d", size)
+			assert.True(t, bytes.Equal(plain, got), "size %d", size)
+		}
+	})
+
+	plain := generateRandomBytes(3*chunk + 5)
+	ct := encrypt(plain)
+	header := len(ct) - (len(plain) + 4*16)
+	chunkCT := chunk + 16
+
+	t.Run("Phát hiện dữ liệu bị sửa", func(t *testing.T) {
+		tampered := append([]byte{}, ct...)
+		tampered[header+chunkCT+10] ^= 1
+		_, err := decrypt(tampered)
+		assert.ErrorIs(t, err, crypto.ErrStreamCorrupted)
+
+		// Sửa header (chunk size / nonce prefix)
+		tampered = append([]byte{}, ct...)
+		tampered[header-1] ^= 1
+		_, err = decrypt(tampered)
+		assert.ErrorIs(t, err, crypto.ErrStreamCorrupted)
+	})
+
+	t.Run("Phát hiện cắt bớt, đổi thứ tự hoặc nối thêm chunk", func(t *testing.T) {
+		// Cắt đúng ranh giới chunk
+		_, err := decrypt(ct[:header+2*chunkCT])
+		assert.Error(t, err)
+		_, err = decrypt(ct[:header])
+		assert.ErrorIs(t, err, crypto.ErrStreamTruncated)
+
+		// Đổi chỗ chunk 0 và 1
+		swapped := append([]byte{}, ct[:header]...)
+		swapped = append(swapped, ct[header+chunkCT:header+2*chunkCT]...)
+		swapped = append(swapped, ct[header:header+chunkCT]...)
+		swapped = append(swapped, ct[header+2*chunkCT:]...)
+		_, err = decrypt(swapped)
+		assert.ErrorIs(t, err, crypto.ErrStreamCorrupted)
+
+		// Nối thêm dữ liệu sau chunk cuối
+		_, err = decrypt(append(append([]byte{}, ct...), ct[header:header+chunkCT]...))
+		assert.ErrorIs(t, err, crypto.ErrStreamCorrupted)
+	})
+
+	t.Run("Vẫn giải mã được note định dạng cũ", func(t *testing.T) {
+		legacy, err := crypto.EncryptBytes([]byte("note cũ"), key)
+		assert.NoError(t, err)
+		got, err := decrypt(legacy)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("note cũ"), got)
+	})
+
+	t.Run("Upload và khôi phục file không để lại file tạm", func(t *testing.T) {
+		dir := t.TempDir()
+		src := filepath.Join(dir, "big.bin")
+		assert.NoError(t, os.WriteFile(src, plain, 0644))
+
+		cipherText, encKey, err := crypto.PrepareFileForUpload(src, "pass")
+		assert.NoError(t, err)
+		aesKeyHex, err := crypto.DecryptByPassword(encKey, "pass")
+		assert.NoError(t, err)
+
+		out := filepath.Join(dir, "restored.bin")
+		assert.NoError(t, crypto.RestoreFileFromNote(cipherText, aesKeyHex, out))
+		restored, _ := os.ReadFile(out)
+		assert.True(t, bytes.Equal(plain, restored))
+
+		// Giải mã lỗi không để lại file đầu ra dở dang
+		bad := filepath.Join(dir, "bad.bin")
+		assert.Error(t, crypto.RestoreFileFromNote(cipherText[:len(cipherText)/2], aesKeyHex, bad))
+		assert.NoFileExists(t, bad)
+
+		entries, _ := os.ReadDir(dir)
+		assert.Len(t, entries, 2, "Chỉ còn file gốc và file đã khôi phục")
+	})
+}
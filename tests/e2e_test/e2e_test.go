@@ -2,7 +2,6 @@ package tests
 
 import (
 	"bytes"
-	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
@@ -17,26 +16,19 @@ import (
 	"os"
 	"strings"
 	"testing"
-	"time"
 
 	"note_sharing_application/client/crypto"
-	"note_sharing_application/server/configs"
-	"note_sharing_application/server/handlers"
 	"note_sharing_application/server/models"
 	"note_sharing_application/server/routers"
+	"note_sharing_application/server/stores"
 	"note_sharing_application/server/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // --- CẤU HÌNH ---
-const E2E_TestDBName = "E2E_Test"
-
 var E2E_router *gin.Engine
-var E2E_testDB *mongo.Database
 
 // Struct hứng response khi xem chi tiết Note
 type TestNoteResponseDTO struct {
@@ -72,46 +64,35 @@ func TestMain(m *testing.M) {
 // --- HÀM KHỞI TẠO MÔI TRƯỜNG ---
 // Đảm bảo Router, DB và Keys luôn sẵn sàng trước khi test chạy
 func setupTestEnvironment() func() {
-	if E2E_router != nil && E2E_testDB != nil {
+	if E2E_router != nil {
 		return func() {}
 	}
 
 	fmt.Println("[INFO] Dang thiet lap moi truong Test...")
 
-	// 1. Kết nối DB
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
-	if err != nil {
-		cancel()
-		log.Fatal("[ERROR] Loi ket noi DB:", err)
-	}
-
-	E2E_testDB = client.Database(E2E_TestDBName)
-	configs.DB = E2E_testDB
-	handlers.UserCollection = E2E_testDB.Collection("users")
+	// 1. Bộ lưu trữ trên RAM (không cần MongoDB)
+	stores.Use(stores.NewMemory())
 
 	// 2. Khởi tạo RSA Keys (In-memory) cho Server Utils
 	priv, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		cancel()
 		log.Fatal("[ERROR] Khong the tao RSA Key:", err)
 	}
 	utils.ServerPrivateKey = priv
 	utils.ServerPublicKey = &priv.PublicKey
+	if err := utils.GenerateLogSigningKey(); err != nil {
+		log.Fatal("[ERROR] Khong the tao khoa ky key log:", err)
+	}
 
 	// 3. Khởi tạo Router
 	E2E_router = routers.SetupRouter()
 	if E2E_router == nil {
-		cancel()
 		log.Fatal("[ERROR] Router khoi tao that bai (nil)")
 	}
 
-	// Trả về hàm cleanup
+	// Trả về hàm cleanup (dữ liệu trên RAM tự mất khi kết thúc)
 	return func() {
 		fmt.Println("[INFO] Dang don dep du lieu Test...")
-		_ = E2E_testDB.Drop(context.Background())
-		_ = client.Disconnect(context.Background())
-		cancel()
 	}
 }
 
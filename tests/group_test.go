@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	clientmodels "note_sharing_application/client/models"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func getGroup(t *testing.T, groupID, token string) clientmodels.Group {
+	w := authedRequest("GET", "/groups/"+groupID, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var group clientmodels.Group
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &group))
+	return group
+}
+
+func groupNotes(t *testing.T, groupID, token string) []clientmodels.GroupNote {
+	w := authedRequest("GET", "/groups/"+groupID+"/notes", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var notes []clientmodels.GroupNote
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notes))
+	return notes
+}
+
+func TestGroupSharing(t *testing.T) {
+	ownerToken := SetupMockUser(t, "group_owner", "123")
+	adminToken := SetupMockUser(t, "group_admin", "123")
+	bobToken := SetupMockUser(t, "group_bob", "123")
+	carolToken := SetupMockUser(t, "group_carol", "123")
+
+	w := authedRequest("POST", "/groups", ownerToken, clientmodels.CreateGroupRequest{Name: "team", WrappedKey: "k1_owner", KeyScheme: crypto.KeySchemeX25519})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		GroupID string `json:"group_id"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	groupID := created.GroupID
+	members := "/groups/" + groupID + "/members"
+
+	addMember := func(token, username, role string, keyVersion int) int {
+		return authedRequest("POST", members, token, clientmodels.AddGroupMemberRequest{
+			Username: username, Role: role, WrappedKey: "k1_" + username, KeyScheme: crypto.KeySchemeX25519, KeyVersion: keyVersion,
+		}).Code
+	}
+
+	t.Run("Members and roles", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, authedRequest("POST", "/groups", ownerToken, clientmodels.CreateGroupRequest{Name: "x", WrappedKey: "k", KeyScheme: crypto.KeySchemeLegacyDH}).Code)
+
+		assert.Equal(t, http.StatusOK, addMember(ownerToken, "group_admin", "admin", 1))
+		assert.Equal(t, http.StatusOK, addMember(adminToken, "group_bob", "", 1))
+		assert.Equal(t, http.StatusForbidden, addMember(adminToken, "group_carol", "admin", 1), "Chỉ owner thêm được admin")
+		assert.Equal(t, http.StatusForbidden, addMember(bobToken, "group_carol", "", 1))
+		assert.Equal(t, http.StatusConflict, addMember(ownerToken, "group_bob", "", 1))
+		assert.Equal(t, http.StatusNotFound, addMember(ownerToken, "group_ghost", "", 1))
+		assert.Equal(t, http.StatusConflict, addMember(ownerToken, "group_carol", "", 2), "Sai phiên bản khóa")
+
+		// Người ngoài nhóm không thấy nhóm
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/groups/"+groupID, carolToken, nil).Code)
+
+		group := getGroup(t, groupID, bobToken)
+		assert.Equal(t, 1, group.KeyVersion)
+		assert.Len(t, group.Members, 3)
+		assert.Equal(t, "k1_group_bob", group.Key.WrappedKey)
+		assert.Equal(t, "group_admin", group.Key.WrappedBy)
+
+		assert.Equal(t, http.StatusForbidden, authedRequest("PUT", members+"/group_bob", adminToken, map[string]string{"role": "admin"}).Code)
+		assert.Equal(t, http.StatusBadRequest, authedRequest("PUT", members+"/group_owner", ownerToken, map[string]string{"role": "member"}).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("PUT", members+"/group_bob", ownerToken, map[string]string{"role": "admin"}).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("PUT", members+"/group_bob", ownerToken, map[string]string{"role": "member"}).Code)
+	})
+
+	noteID := SetupMockNote(t, "123", bobToken)
+	trashedID := SetupMockNote(t, "123", bobToken)
+	groupNote := "/groups/" + groupID + "/notes/"
+
+	t.Run("Share a note once to the group", func(t *testing.T) {
+		share := clientmodels.ShareToGroupRequest{EncryptedAESKey: "note_k1", KeyVersion: 1}
+		assert.Equal(t, http.StatusForbidden, authedRequest("POST", groupNote+noteID, ownerToken, share).Code, "Note của người khác")
+		assert.Equal(t, http.StatusNotFound, authedRequest("POST", groupNote+noteID, carolToken, share).Code)
+		assert.Equal(t, http.StatusCreated, authedRequest("POST", groupNote+noteID, bobToken, share).Code)
+		assert.Equal(t, http.StatusConflict, authedRequest("POST", groupNote+noteID, bobToken, share).Code)
+		assert.Equal(t, http.StatusCreated, authedRequest("POST", groupNote+trashedID, bobToken, share).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+trashedID, bobToken, nil).Code)
+
+		notes := groupNotes(t, groupID, adminToken)
+		assert.Len(t, notes, 2)
+		assert.Equal(t, "group_bob", notes[0].Sender)
+		assert.False(t, notes[0].Suspended)
+		assert.True(t, notes[1].Suspended, "Note trong thùng rác tạm ngưng")
+
+		assert.Equal(t, http.StatusOK, authedRequest("GET", groupNote+noteID+"/content", ownerToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", groupNote+trashedID+"/content", ownerToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", groupNote+noteID+"/content", carolToken, nil).Code)
+	})
+
+	t.Run("Removing a member rotates the group key", func(t *testing.T) {
+		notes := groupNotes(t, groupID, ownerToken)
+		shareKeys := []clientmodels.GroupShareKey{}
+		for _, n := range notes {
+			shareKeys = append(shareKeys, clientmodels.GroupShareKey{ShareID: n.ShareID, EncryptedAESKey: "note_k2"})
+		}
+		memberKey := func(username string) clientmodels.GroupKey {
+			return clientmodels.GroupKey{Username: username, WrappedKey: "k2_" + username, KeyScheme: crypto.KeySchemeX25519}
+		}
+		rotation := clientmodels.RemoveGroupMemberRequest{
+			KeyVersion: 1,
+			Members:    []clientmodels.GroupKey{memberKey("group_owner"), memberKey("group_bob")},
+			Shares:     shareKeys,
+		}
+
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", members+"/group_admin", bobToken, rotation).Code)
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", members+"/group_owner", adminToken, rotation).Code)
+
+		partial := rotation
+		partial.Shares = shareKeys[:1]
+		assert.Equal(t, http.StatusConflict, authedRequest("DELETE", members+"/group_admin", ownerToken, partial).Code, "Thiếu khóa của 1 note")
+		partial = rotation
+		partial.Members = rotation.Members[:1]
+		assert.Equal(t, http.StatusConflict, authedRequest("DELETE", members+"/group_admin", ownerToken, partial).Code, "Thiếu khóa của 1 thành viên")
+		assert.Equal(t, 1, getGroup(t, groupID, adminToken).KeyVersion, "Yêu cầu lỗi không đổi gì")
+
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", members+"/group_admin", ownerToken, rotation).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/groups/"+groupID, adminToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", groupNote+noteID+"/content", adminToken, nil).Code)
+
+		group := getGroup(t, groupID, bobToken)
+		assert.Equal(t, 2, group.KeyVersion)
+		assert.Equal(t, "k2_group_bob", group.Key.WrappedKey)
+		assert.Equal(t, "group_owner", group.Key.WrappedBy)
+		for _, n := range groupNotes(t, groupID, bobToken) {
+			assert.Equal(t, 2, n.KeyVersion)
+			assert.Equal(t, "note_k2", n.EncryptedAESKey)
+		}
+
+		assert.Equal(t, http.StatusConflict, authedRequest("DELETE", members+"/group_bob", ownerToken, rotation).Code, "Khóa đã được xoay")
+	})
+
+	t.Run("Unshare and purge", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, addMember(ownerToken, "group_carol", "", 2))
+		assert.Len(t, groupNotes(t, groupID, carolToken), 2, "Thành viên mới thấy cả note cũ")
+
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", groupNote+noteID, carolToken, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", groupNote+noteID, ownerToken, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/trash/"+trashedID, bobToken, nil).Code)
+		assert.Empty(t, groupNotes(t, groupID, carolToken))
+	})
+}
+
+// Khóa nhóm bọc qua khóa chung X25519 như khóa AES của share, khóa note bọc bằng khóa nhóm
+func TestGroupKeyWrapping(t *testing.T) {
+	ownerPriv, ownerPub, _ := crypto.GenerateX25519KeyPair()
+	bobPriv, bobPub, _ := crypto.GenerateX25519KeyPair()
+	groupKey, _ := crypto.GenerateAESKey()
+	noteKey, _ := crypto.GenerateAESKey()
+
+	// Owner bọc cho chính mình và cho bob
+	selfKey, err := crypto.DeriveShareKey(crypto.KeySchemeX25519, ownerPriv, ownerPub, "owner", "owner")
+	assert.NoError(t, err)
+	wrappedSelf, _ := crypto.WrapAESKey(groupKey, selfKey)
+	toBob, _ := crypto.DeriveShareKey(crypto.KeySchemeX25519, ownerPriv, bobPub, "owner", "bob")
+	wrappedBob, _ := crypto.WrapAESKey(groupKey, toBob)
+
+	unwrapped, err := crypto.UnwrapAESKey(wrappedSelf, selfKey)
+	assert.NoError(t, err)
+	assert.Equal(t, groupKey, unwrapped)
+
+	fromOwner, _ := crypto.DeriveShareKey(crypto.KeySchemeX25519, bobPriv, ownerPub, "owner", "bob")
+	bobGroupKey, err := crypto.UnwrapAESKey(wrappedBob, fromOwner)
+	assert.NoError(t, err)
+	assert.Equal(t, groupKey, bobGroupKey)
+
+	wrappedNote, _ := crypto.WrapAESKey(noteKey, groupKey)
+	opened, err := crypto.UnwrapAESKey(wrappedNote, bobGroupKey)
+	assert.NoError(t, err)
+	assert.Equal(t, noteKey, opened)
+
+	// Sau khi xoay khóa, khóa nhóm cũ không mở được khóa note mới
+	newGroupKey, _ := crypto.GenerateAESKey()
+	rewrapped, _ := crypto.WrapAESKey(noteKey, newGroupKey)
+	_, err = crypto.UnwrapAESKey(rewrapped, groupKey)
+	assert.Error(t, err)
+}
+
+// 2 request đồng thời chia sẻ cùng note cho cùng nhóm: chỉ 1 share được tạo
+func TestGroupShareUnique(t *testing.T) {
+	ctx := t.Context()
+	share := models.GroupShare{
+		GroupID: primitive.NewObjectID().Hex(), NoteID: primitive.NewObjectID().Hex(),
+		Sender: "unique_alice", EncryptedAESKey: "note_k1", KeyVersion: 1,
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = stores.Groups.CreateShare(ctx, share)
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		if err == nil {
+			created++
+			continue
+		}
+		assert.ErrorIs(t, err, stores.ErrDuplicate)
+	}
+	assert.Equal(t, 1, created)
+
+	shares, err := stores.Groups.ListShares(ctx, share.GroupID)
+	assert.NoError(t, err)
+	assert.Len(t, shares, 1)
+}
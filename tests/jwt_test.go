@@ -20,7 +20,7 @@ func TestJWT(t *testing.T) {
 	username := "jwt_test"
 	password := "jwt_pass"
 	// Dữ liệu giả cho DH Key
-	mockPubKey := "MockPublicKeyHexString"
+	mockPubKey := mockPublicKey()
 	mockEncPrivKey := "MockEncryptedPrivateKeyHex"
 
 	//Đăng ký
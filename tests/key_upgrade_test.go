@@ -0,0 +1,77 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/models"
+	"note_sharing_application/client/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func upgradeKeyRequest(token, password, pubKey, encPrivKey string) int {
+	return authedRequest("POST", "/auth/upgrade-key", token, models.UpgradeKeyRequest{
+		Password:            encryptPasswordForTest(password),
+		PublicKey:           pubKey,
+		PublicKeyType:       crypto.KeyTypeX25519,
+		EncryptedPrivateKey: encPrivKey,
+	}).Code
+}
+
+func getPublicKeys(username string) services.UserPublicKeyResponse {
+	req, _ := http.NewRequest("GET", "/auth/users/"+username+"/pubkey", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res services.UserPublicKeyResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return res
+}
+
+// User DH cũ nâng cấp lên X25519, khóa DH vẫn được giữ để đọc share cũ
+func TestUpgradeKeyToX25519(t *testing.T) {
+	// SetupMockUser đăng ký không kèm loại khóa -> DH (client cũ)
+	token := SetupMockUser(t, "upgrade_key_user", "123")
+	before := getPublicKeys("upgrade_key_user")
+	assert.Equal(t, crypto.KeyTypeDH, before.KeyType)
+
+	_, pubHex, err := crypto.GenerateX25519KeyPair()
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusForbidden, upgradeKeyRequest(token, "wrong", pubHex, "EncX25519Priv"))
+	// Khóa rác hoặc điểm bậc thấp không được ghi vào key log
+	for _, bad := range []string{"", "zz", pubHex[:62], strings.Repeat("00", 32), "01" + strings.Repeat("00", 31)} {
+		assert.Equal(t, http.StatusBadRequest, upgradeKeyRequest(token, "123", bad, "EncX25519Priv"), bad)
+	}
+	assert.Equal(t, http.StatusOK, upgradeKeyRequest(token, "123", pubHex, "EncX25519Priv"))
+	assert.Equal(t, http.StatusConflict, upgradeKeyRequest(token, "123", pubHex, "EncX25519Priv"), "Chỉ nâng cấp được 1 lần")
+
+	after := getPublicKeys("upgrade_key_user")
+	assert.Equal(t, crypto.KeyTypeX25519, after.KeyType)
+	assert.Equal(t, pubHex, after.X25519Key())
+	assert.Equal(t, before.PublicKey, after.DHKey(), "Khóa DH cũ phải được giữ lại")
+
+	// Đăng nhập nhận cả 2 private key đã mã hóa
+	body, _ := json.Marshal(map[string]string{
+		"username": "upgrade_key_user",
+		"password": encryptPasswordForTest("123"),
+	})
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var login models.LoginResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &login)
+	assert.Equal(t, crypto.KeyTypeX25519, login.KeyType)
+	assert.Equal(t, "EncX25519Priv", login.EncryptedPrivateKey)
+	assert.Equal(t, "MockEncryptedPrivateKeyHex", login.EncryptedLegacyPrivateKey)
+
+	// Đổi mật khẩu mà không bọc lại khóa DH cũ -> bị từ chối
+	code, _ := changePasswordRequest(login.Token, "123", "456", "NewEncPriv", nil)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/services"
+	"note_sharing_application/server/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = utils.MerkleLeafHash([]byte(fmt.Sprintf("leaf-%d", i)))
+	}
+	return leaves
+}
+
+// Proof do server sinh ra phải qua được bộ kiểm tra của client với mọi kích thước cây
+func TestMerkleProofs(t *testing.T) {
+	const maxSize = 20
+	all := testLeaves(maxSize)
+
+	for n := 1; n <= maxSize; n++ {
+		leaves := all[:n]
+		root := utils.MerkleRoot(leaves)
+
+		for i := 0; i < n; i++ {
+			proof := utils.MerkleInclusionProof(i, leaves)
+			assert.NoError(t, crypto.VerifyInclusion(int64(i), int64(n), leaves[i], proof, root), "inclusion %d/%d", i, n)
+
+			// Sai vị trí hoặc sai lá thì phải bị từ chối
+			other := leaves[(i+1)%n]
+			if n > 1 {
+				assert.Error(t, crypto.VerifyInclusion(int64(i), int64(n), other, proof, root))
+			}
+		}
+
+		for m := 1; m <= n; m++ {
+			proof := utils.MerkleConsistencyProof(m, leaves)
+			oldRoot := utils.MerkleRoot(leaves[:m])
+			assert.NoError(t, crypto.VerifyConsistency(int64(m), int64(n), oldRoot, root, proof), "consistency %d->%d", m, n)
+
+			// Lịch sử bị sửa (lá đầu tiên khác) -> gốc cũ không khớp
+			if m < n {
+				forged := append([][]byte{utils.MerkleLeafHash([]byte("forged"))}, leaves[1:m]...)
+				assert.Error(t, crypto.VerifyConsistency(int64(m), int64(n), utils.MerkleRoot(forged), root, proof))
+			}
+		}
+	}
+
+	// Gốc cây rỗng theo RFC 6962 là SHA-256 của chuỗi rỗng
+	empty := sha256.Sum256(nil)
+	assert.Equal(t, empty[:], utils.MerkleRoot(nil))
+}
+
+func getSTH(t *testing.T) services.SignedTreeHead {
+	req, _ := http.NewRequest("GET", "/log/sth", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var sth services.SignedTreeHead
+	_ = json.Unmarshal(w.Body.Bytes(), &sth)
+	return sth
+}
+
+func TestKeyLog(t *testing.T) {
+	before := getSTH(t)
+	token := SetupMockUser(t, "keylog_user", "123")
+
+	t.Run("Đăng ký thêm 1 entry, tree head có chữ ký hợp lệ", func(t *testing.T) {
+		sth := getSTH(t)
+		assert.Greater(t, sth.TreeSize, before.TreeSize)
+		assert.NoError(t, crypto.VerifyTreeHead(utils.LogPublicKeyHex(), sth.TreeSize, sth.RootHash, sth.Timestamp, sth.Signature))
+
+		// Sửa bất kỳ trường nào thì chữ ký hỏng
+		assert.ErrorIs(t, crypto.VerifyTreeHead(utils.LogPublicKeyHex(), sth.TreeSize+1, sth.RootHash, sth.Timestamp, sth.Signature), crypto.ErrTreeHeadSig)
+	})
+
+	t.Run("Đổi khóa thêm entry mới, pubkey trả về index mới", func(t *testing.T) {
+		oldKeys := getPublicKeys("keylog_user")
+		_, pubHex, _ := crypto.GenerateX25519KeyPair()
+		assert.Equal(t, http.StatusOK, upgradeKeyRequest(token, "123", pubHex, "EncX25519Priv"))
+
+		newKeys := getPublicKeys("keylog_user")
+		assert.Greater(t, newKeys.LogIndex, oldKeys.LogIndex)
+	})
+
+	t.Run("Tham số proof sai", func(t *testing.T) {
+		for _, path := range []string{
+			"/log/proof/inclusion?index=5&tree_size=2",
+			"/log/proof/inclusion?index=abc&tree_size=2",
+			"/log/proof/consistency?first=3&second=1",
+			"/log/proof/consistency?first=0&second=100000",
+		} {
+			req, _ := http.NewRequest("GET", path, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		}
+	})
+}
+
+// Client chỉ chấp nhận khóa có trong log và log không bị viết lại
+func TestVerifyKeyInLog(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	oldBaseURL, oldDir := services.BaseURL, services.KnownKeysDir
+	services.BaseURL = server.URL
+	services.KnownKeysDir = t.TempDir()
+	defer func() { services.BaseURL, services.KnownKeysDir = oldBaseURL, oldDir }()
+
+	SetupMockUser(t, "logged_bob", "123")
+	key, err := services.GetUserPublicKey("logged_bob")
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, key.LogIndex, int64(0))
+
+	assert.NoError(t, services.VerifyKeyInLog("log_alice", key))
+
+	t.Run("Log dài thêm vẫn nhất quán với tree head cũ", func(t *testing.T) {
+		SetupMockUser(t, "logged_carol", "123")
+		assert.NoError(t, services.VerifyKeyInLog("log_alice", key))
+	})
+
+	t.Run("Khóa không khớp entry trong log bị từ chối", func(t *testing.T) {
+		_, fakePub, _ := crypto.GenerateX25519KeyPair()
+		fake := key
+		fake.PublicKey = fakePub
+		assert.ErrorIs(t, services.VerifyKeyInLog("log_alice", fake), services.ErrKeyNotInLog)
+
+		notLogged := key
+		notLogged.LogIndex = -1
+		assert.ErrorIs(t, services.VerifyKeyInLog("log_alice", notLogged), services.ErrKeyNotInLog)
+	})
+
+	t.Run("Server đổi khóa ký log bị phát hiện", func(t *testing.T) {
+		oldKey := utils.LogSigningKey
+		defer func() { utils.LogSigningKey = oldKey }()
+		assert.NoError(t, utils.GenerateLogSigningKey())
+
+		assert.ErrorIs(t, services.VerifyKeyInLog("log_alice", key), services.ErrLogKeyChanged)
+	})
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafetyNumber(t *testing.T) {
+	fpAlice := crypto.Fingerprint(crypto.KeyTypeX25519, "aa11")
+	fpBob := crypto.Fingerprint(crypto.KeyTypeX25519, "bb22")
+	assert.NotEqual(t, fpAlice, fpBob)
+
+	// 2 bên tính phải ra cùng 1 số
+	assert.Equal(t,
+		crypto.SafetyNumber("alice", fpAlice, "bob", fpBob),
+		crypto.SafetyNumber("bob", fpBob, "alice", fpAlice))
+	// Khóa của 1 bên bị tráo -> số khác
+	fpFake := crypto.Fingerprint(crypto.KeyTypeX25519, "cc33")
+	assert.NotEqual(t,
+		crypto.SafetyNumber("alice", fpAlice, "bob", fpBob),
+		crypto.SafetyNumber("alice", fpAlice, "bob", fpFake))
+
+	// Public key tính lại từ private key khớp với khóa sinh ra
+	priv, pub, err := crypto.GenerateX25519KeyPair()
+	assert.NoError(t, err)
+	derived, err := crypto.PublicKeyFromPrivate(crypto.KeyTypeX25519, priv)
+	assert.NoError(t, err)
+	assert.Equal(t, pub, derived)
+}
+
+// Client ghi nhớ khóa lần đầu và từ chối khi khóa bị đổi
+func TestKnownKeysPinning(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	oldBaseURL, oldDir := services.BaseURL, services.KnownKeysDir
+	services.BaseURL = server.URL
+	services.KnownKeysDir = t.TempDir()
+	defer func() { services.BaseURL, services.KnownKeysDir = oldBaseURL, oldDir }()
+
+	token := SetupMockUser(t, "pinned_bob", "123")
+
+	_, pin, status, err := services.GetTrustedPublicKey("pinned_alice", "pinned_bob")
+	assert.NoError(t, err)
+	assert.Equal(t, services.PinNew, status, "Lần đầu phải ghi nhớ khóa")
+	assert.False(t, pin.Verified)
+
+	_, _, status, err = services.GetTrustedPublicKey("pinned_alice", "pinned_bob")
+	assert.NoError(t, err)
+	assert.Equal(t, services.PinMatched, status)
+
+	t.Run("Nâng cấp DH lên X25519 khi chưa xác minh thì tự ghi nhớ khóa mới", func(t *testing.T) {
+		_, pubHex, _ := crypto.GenerateX25519KeyPair()
+		assert.Equal(t, 200, upgradeKeyRequest(token, "123", pubHex, "EncX25519Priv"))
+
+		key, _, status, err := services.GetTrustedPublicKey("pinned_alice", "pinned_bob")
+		assert.NoError(t, err)
+		assert.Equal(t, services.PinUpgraded, status)
+		assert.Equal(t, pubHex, key.X25519Key())
+	})
+
+	t.Run("Khóa bị tráo thì bị từ chối", func(t *testing.T) {
+		// Mô phỏng: khóa đã ghi nhớ và xác minh khác khóa server đang trả về
+		_, fakePub, _ := crypto.GenerateX25519KeyPair()
+		fake := services.UserPublicKeyResponse{Username: "pinned_bob", PublicKey: fakePub, KeyType: crypto.KeyTypeX25519}
+		assert.NoError(t, services.TrustPublicKey("pinned_alice", "pinned_bob", fake))
+
+		key, pin, _, err := services.GetTrustedPublicKey("pinned_alice", "pinned_bob")
+		assert.ErrorIs(t, err, services.ErrPinnedKeyChanged)
+		assert.NotEqual(t, pin.Fingerprint, key.Fingerprint())
+
+		// Xác minh xong và trust khóa thật thì dùng lại được
+		assert.NoError(t, services.TrustPublicKey("pinned_alice", "pinned_bob", key))
+		_, pin, status, err := services.GetTrustedPublicKey("pinned_alice", "pinned_bob")
+		assert.NoError(t, err)
+		assert.Equal(t, services.PinMatched, status)
+		assert.True(t, pin.Verified)
+	})
+}
@@ -0,0 +1,251 @@
+package tests
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	clientmodels "note_sharing_application/client/models"
+	clientservices "note_sharing_application/client/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// GET không kèm token
+func getPublic(path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// Tạo link công khai cho note của SetupMockNote (mật khẩu "123"), trả về url_id và bí mật của link
+func createLink(t *testing.T, noteID, token string, maxAccess int) (string, string, int) {
+	var note clientmodels.Note
+	assert.NoError(t, json.Unmarshal(authedRequest("GET", "/notes/"+noteID, token, nil).Body.Bytes(), &note))
+	keyHex, err := crypto.DecryptByPassword(note.EncryptedAesKey, "123")
+	assert.NoError(t, err)
+	aesKey, _ := hex.DecodeString(keyHex)
+
+	secret, _ := crypto.GenerateLinkSecret()
+	linkKey, err := crypto.DeriveLinkKey(secret, noteID)
+	assert.NoError(t, err)
+	wrapped, _ := crypto.WrapAESKey(aesKey, linkKey)
+
+	w := authedRequest("POST", "/notes/"+noteID+"/links", token, clientmodels.CreateLinkRequest{
+		SharedEncryptedAESKey: wrapped, ExpiresIn: "1h", MaxAccess: maxAccess,
+	})
+	var res struct {
+		UrlID string `json:"url_id"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return res.UrlID, secret, w.Code
+}
+
+func TestPublicLink(t *testing.T) {
+	aliceToken := SetupMockUser(t, "link_alice", "123")
+	bobToken := SetupMockUser(t, "link_bob", "123")
+	noteID := SetupMockNote(t, "123", aliceToken)
+
+	t.Run("Create", func(t *testing.T) {
+		_, _, code := createLink(t, noteID, aliceToken, 0)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, http.StatusBadRequest, authedRequest("POST", "/notes/"+noteID+"/links", aliceToken, clientmodels.CreateLinkRequest{ExpiresIn: "1h", MaxAccess: 1}).Code)
+		assert.Equal(t, http.StatusForbidden, authedRequest("POST", "/notes/"+noteID+"/links", bobToken, clientmodels.CreateLinkRequest{SharedEncryptedAESKey: "k", ExpiresIn: "1h", MaxAccess: 1}).Code)
+	})
+
+	t.Run("Fetch without login and decrypt with the fragment secret", func(t *testing.T) {
+		urlID, secret, code := createLink(t, noteID, aliceToken, 1)
+		assert.Equal(t, http.StatusCreated, code)
+
+		w := getPublic("/links/" + urlID)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var meta clientmodels.NoteData
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &meta))
+		assert.Equal(t, crypto.KeySchemeLink, meta.KeyScheme)
+		assert.Equal(t, "link_alice", meta.Sender)
+		assert.Empty(t, meta.Receiver)
+
+		linkKey, _ := crypto.DeriveLinkKey(secret, meta.NoteID)
+		aesKey, err := crypto.UnwrapAESKey(meta.EncryptedKey, linkKey)
+		assert.NoError(t, err)
+		otherSecret, _ := crypto.GenerateLinkSecret()
+		otherKey, _ := crypto.DeriveLinkKey(otherSecret, meta.NoteID)
+		_, err = crypto.UnwrapAESKey(meta.EncryptedKey, otherKey)
+		assert.Error(t, err, "Sai bí mật thì không mở được khóa")
+
+		// Xem metadata không tính lượt
+		assert.Equal(t, http.StatusOK, getPublic("/links/"+urlID).Code)
+		content := getPublic("/links/" + urlID + "/content")
+		assert.Equal(t, http.StatusOK, content.Code)
+		out := filepath.Join(t.TempDir(), "out.txt")
+		assert.NoError(t, crypto.RestoreFileFromReader(content.Body, aesKey, meta.CipherDigest, out))
+		got, _ := os.ReadFile(out)
+		want, _ := os.ReadFile("text.txt")
+		assert.Equal(t, want, got)
+
+		assert.Equal(t, http.StatusNotFound, getPublic("/links/"+urlID+"/content").Code, "Hết lượt xem")
+	})
+
+	t.Run("Links and receiver shares stay separate", func(t *testing.T) {
+		urlID, _, _ := createLink(t, noteID, aliceToken, 5)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/note/"+urlID+"/meta", aliceToken, nil).Code)
+
+		shareURL := SetupMockURL(t, noteID, "link_alice", "link_bob", "1h", 1, aliceToken, bobToken)
+		assert.Equal(t, http.StatusNotFound, getPublic("/links/"+shareURL).Code)
+		assert.Equal(t, http.StatusNotFound, getPublic("/links/not-an-id").Code)
+
+		var public int
+		for _, s := range noteShares(t, noteID, aliceToken) {
+			if s.Public {
+				public++
+				assert.Empty(t, s.Receiver)
+			}
+		}
+		assert.Equal(t, 1, public)
+
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/shares/"+urlID, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, getPublic("/links/"+urlID).Code)
+	})
+
+	t.Run("Trashed note suspends the link", func(t *testing.T) {
+		urlID, _, _ := createLink(t, noteID, aliceToken, 5)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+noteID, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, getPublic("/links/"+urlID).Code)
+		assert.Equal(t, http.StatusNotFound, getPublic("/links/"+urlID+"/content").Code)
+	})
+}
+
+func TestParseLink(t *testing.T) {
+	link := clientservices.FormatLink("6571ab", "c2VjcmV0")
+	base, urlID, secret, err := clientservices.ParseLink(link)
+	assert.NoError(t, err)
+	assert.Equal(t, clientservices.BaseURL, base)
+	assert.Equal(t, "6571ab", urlID)
+	assert.Equal(t, "c2VjcmV0", secret)
+
+	base, _, _, err = clientservices.ParseLink("example.com:8443/api/links/abc#s")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com:8443/api", base)
+
+	_, _, _, err = clientservices.ParseLink("http://localhost:8080/links/abc")
+	assert.Error(t, err, "Thiếu bí mật sau dấu #")
+	_, _, _, err = clientservices.ParseLink("http://localhost:8080/note/abc#s")
+	assert.Error(t, err)
+
+	_, err = crypto.DeriveLinkKey("c2VjcmV0", "note")
+	assert.Error(t, err, "Bí mật quá ngắn")
+}
+
+func getLinkWithToken(path, token string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	req.Header.Set("X-Link-Token", token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestPasswordProtectedLink(t *testing.T) {
+	aliceToken := SetupMockUser(t, "plink_alice", "123")
+	noteID := SetupMockNote(t, "123", aliceToken)
+
+	var note clientmodels.Note
+	assert.NoError(t, json.Unmarshal(authedRequest("GET", "/notes/"+noteID, aliceToken, nil).Body.Bytes(), &note))
+	keyHex, _ := crypto.DecryptByPassword(note.EncryptedAesKey, "123")
+	aesKey, _ := hex.DecodeString(keyHex)
+
+	// Tạo link có mật khẩu, trả về url_id, bí mật trong fragment và access token đúng
+	createProtected := func(maxAttempts int) (string, string, string) {
+		secret, _ := crypto.GenerateLinkSecret()
+		keySecret, err := crypto.ProtectLinkSecret(secret, "correct horse")
+		assert.NoError(t, err)
+		token, _ := crypto.LinkAccessToken(keySecret)
+		verifier, _ := crypto.LinkAccessVerifier(token)
+		linkKey, _ := crypto.DeriveLinkKey(keySecret, noteID)
+		wrapped, _ := crypto.WrapAESKey(aesKey, linkKey)
+
+		w := authedRequest("POST", "/notes/"+noteID+"/links", aliceToken, clientmodels.CreateLinkRequest{
+			SharedEncryptedAESKey: wrapped, ExpiresIn: "1h", MaxAccess: 5, AccessVerifier: verifier, MaxAttempts: maxAttempts,
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var res struct {
+			UrlID string `json:"url_id"`
+		}
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		return res.UrlID, secret, token
+	}
+	wrongToken := func(secret string) string {
+		keySecret, _ := crypto.ProtectLinkSecret(secret, "wrong")
+		token, _ := crypto.LinkAccessToken(keySecret)
+		return token
+	}
+
+	t.Run("Invalid options", func(t *testing.T) {
+		post := func(req clientmodels.CreateLinkRequest) int {
+			req.SharedEncryptedAESKey, req.ExpiresIn, req.MaxAccess = "k", "1h", 1
+			return authedRequest("POST", "/notes/"+noteID+"/links", aliceToken, req).Code
+		}
+		assert.Equal(t, http.StatusBadRequest, post(clientmodels.CreateLinkRequest{AccessVerifier: "abcd"}))
+		assert.Equal(t, http.StatusBadRequest, post(clientmodels.CreateLinkRequest{MaxAttempts: 3}), "max_attempts cần mật khẩu")
+		verifier, _ := crypto.LinkAccessVerifier("00")
+		assert.Equal(t, http.StatusBadRequest, post(clientmodels.CreateLinkRequest{AccessVerifier: verifier, MaxAttempts: 1000}))
+	})
+
+	t.Run("Correct password opens the link", func(t *testing.T) {
+		urlID, secret, token := createProtected(0)
+
+		w := getPublic("/links/" + urlID)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "password_required")
+
+		w = getLinkWithToken("/links/"+urlID, token)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var meta clientmodels.NoteData
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &meta))
+		assert.Equal(t, crypto.KeySchemeLinkPassword, meta.KeyScheme)
+		assert.NotContains(t, w.Body.String(), "access_verifier")
+
+		// Có fragment mà không có mật khẩu thì không mở được khóa
+		plainKey, _ := crypto.DeriveLinkKey(secret, noteID)
+		_, err := crypto.UnwrapAESKey(meta.EncryptedKey, plainKey)
+		assert.Error(t, err)
+		keySecret, _ := crypto.ProtectLinkSecret(secret, "correct horse")
+		linkKey, _ := crypto.DeriveLinkKey(keySecret, meta.NoteID)
+		opened, err := crypto.UnwrapAESKey(meta.EncryptedKey, linkKey)
+		assert.NoError(t, err)
+		assert.Equal(t, aesKey, opened)
+
+		assert.Equal(t, http.StatusUnauthorized, getPublic("/links/"+urlID+"/content").Code)
+		assert.Equal(t, http.StatusOK, getLinkWithToken("/links/"+urlID+"/content", token).Code)
+	})
+
+	t.Run("Wrong passwords burn the link", func(t *testing.T) {
+		urlID, secret, token := createProtected(3)
+		bad := wrongToken(secret)
+
+		w := getLinkWithToken("/links/"+urlID, bad)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), `"attempts_left":2`)
+		assert.Equal(t, http.StatusUnauthorized, getLinkWithToken("/links/"+urlID+"/content", "not-hex").Code)
+
+		// Mật khẩu đúng không xóa các lần sai trước đó, cũng không tính là lần thử
+		assert.Equal(t, http.StatusOK, getLinkWithToken("/links/"+urlID, token).Code)
+		for _, s := range noteShares(t, noteID, aliceToken) {
+			if s.ID == urlID {
+				assert.True(t, s.Protected)
+				assert.Equal(t, 2, s.FailedAttempts)
+				assert.Equal(t, 3, s.MaxAttempts)
+			}
+		}
+
+		w = getLinkWithToken("/links/"+urlID, bad)
+		assert.Equal(t, http.StatusNotFound, w.Code, "Lần sai thứ 3 xóa link")
+		assert.Contains(t, w.Body.String(), "khóa")
+		assert.Equal(t, http.StatusNotFound, getLinkWithToken("/links/"+urlID, token).Code)
+	})
+}
@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Đăng nhập, trả về (access token, refresh token)
+func loginTokens(t *testing.T, username, password string) (string, string) {
+	body, _ := json.Marshal(map[string]string{
+		"username": username,
+		"password": encryptPasswordForTest(password),
+	})
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return res["token"], res["refresh_token"]
+}
+
+func listOwnedStatus(token string) int {
+	return authedRequest("GET", "/notes/owned", token, nil).Code
+}
+
+func TestLogout(t *testing.T) {
+	SetupMockUser(t, "logout_user", "123")
+
+	// 2 phiên trên 2 thiết bị
+	laptopToken, laptopRefresh := loginTokens(t, "logout_user", "123")
+	phoneToken, phoneRefresh := loginTokens(t, "logout_user", "123")
+
+	t.Run("Logout chỉ thu hồi phiên hiện tại", func(t *testing.T) {
+		code := authedRequest("POST", "/auth/logout", laptopToken, map[string]string{"refresh_token": laptopRefresh}).Code
+		assert.Equal(t, http.StatusOK, code)
+
+		assert.Equal(t, http.StatusUnauthorized, listOwnedStatus(laptopToken), "Token đã đăng xuất không được dùng nữa")
+		code, _ = refreshRequest(laptopRefresh)
+		assert.Equal(t, http.StatusUnauthorized, code, "Refresh token của phiên đã đăng xuất phải bị thu hồi")
+
+		assert.Equal(t, http.StatusOK, listOwnedStatus(phoneToken), "Phiên khác vẫn hoạt động")
+	})
+
+	t.Run("Logout-all thu hồi mọi phiên", func(t *testing.T) {
+		otherToken, _ := loginTokens(t, "logout_user", "123")
+
+		code := authedRequest("POST", "/auth/logout-all", otherToken, nil).Code
+		assert.Equal(t, http.StatusOK, code)
+
+		assert.Equal(t, http.StatusUnauthorized, listOwnedStatus(phoneToken))
+		assert.Equal(t, http.StatusUnauthorized, listOwnedStatus(otherToken))
+		code, _ = refreshRequest(phoneRefresh)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		// Đăng nhập lại thì dùng được bình thường
+		newToken, _ := loginTokens(t, "logout_user", "123")
+		assert.Equal(t, http.StatusOK, listOwnedStatus(newToken))
+	})
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"note_sharing_application/client/crypto"
+	clientmodels "note_sharing_application/client/models"
+	"note_sharing_application/client/services"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteMetadataEncryption(t *testing.T) {
+	key, _ := crypto.GenerateAESKey()
+	otherKey, _ := crypto.GenerateAESKey()
+	meta := clientmodels.NoteMetadata{
+		Filename:  "báo cáo.pdf",
+		Title:     "Báo cáo quý 3",
+		MimeType:  "application/pdf",
+		Size:      123456,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	enc, err := crypto.EncryptNoteMetadata(meta, key)
+	assert.NoError(t, err)
+	assert.NotContains(t, enc, "pdf")
+
+	dec, err := crypto.DecryptNoteMetadata(enc, key)
+	assert.NoError(t, err)
+	assert.Equal(t, meta, dec)
+
+	_, err = crypto.DecryptNoteMetadata(enc, otherKey)
+	assert.ErrorIs(t, err, crypto.ErrMetadataCorrupted)
+
+	// Metadata và nội dung dùng chung khóa nhưng không thay thế được cho nhau
+	raw, _ := base64.StdEncoding.DecodeString(enc)
+	_, err = crypto.DecryptBytes(raw, key)
+	assert.Error(t, err)
+	content, _ := crypto.EncryptBytes([]byte(`{"filename":"x"}`), key)
+	_, err = crypto.DecryptNoteMetadata(base64.StdEncoding.EncodeToString(content), key)
+	assert.ErrorIs(t, err, crypto.ErrMetadataCorrupted)
+}
+
+func TestNoteMetadataAPI(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+	oldBaseURL := services.BaseURL
+	services.BaseURL = server.URL
+	defer func() { services.BaseURL = oldBaseURL }()
+
+	aliceToken := SetupMockUser(t, "meta_alice", "123")
+	bobToken := SetupMockUser(t, "meta_bob", "123")
+
+	aesKey, encKey, err := crypto.NewNoteKey("123")
+	assert.NoError(t, err)
+	encMeta, err := crypto.EncryptNoteMetadata(clientmodels.NoteMetadata{Filename: "plan.txt", Title: "Kế hoạch"}, aesKey)
+	assert.NoError(t, err)
+
+	noteID, err := services.CreateNote(aliceToken, base64.StdEncoding.EncodeToString([]byte("ciphertext")), encKey, encMeta)
+	assert.NoError(t, err)
+
+	t.Run("Owner reads metadata", func(t *testing.T) {
+		note, err := services.GetNote(aliceToken, noteID)
+		assert.NoError(t, err)
+		assert.Equal(t, encMeta, note.EncryptedMetadata)
+
+		keyHex, err := crypto.DecryptByPassword(note.EncryptedAesKey, "123")
+		assert.NoError(t, err)
+		key, _ := hex.DecodeString(keyHex)
+		meta, err := crypto.DecryptNoteMetadata(note.EncryptedMetadata, key)
+		assert.NoError(t, err)
+		assert.Equal(t, "plan.txt", meta.Filename)
+
+		notes, err := services.GetOwnedNotes(aliceToken)
+		assert.NoError(t, err)
+		found := false
+		for _, n := range notes {
+			if n.ID == noteID {
+				found = n.EncryptedMetadata == encMeta
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("Rejects oversized metadata", func(t *testing.T) {
+		w := authedRequest("POST", "/notes", aliceToken, map[string]string{
+			"encrypted_aes_key_by_K": encKey,
+			"encrypted_metadata":     strings.Repeat("A", 64<<10),
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Receiver listing carries metadata and wrapped key", func(t *testing.T) {
+		SetupMockURL(t, noteID, "meta_alice", "meta_bob", "1h", 1, aliceToken, bobToken)
+
+		urls, err := services.GetReceivedURLs(bobToken)
+		assert.NoError(t, err)
+		if assert.Len(t, urls, 1) {
+			assert.Equal(t, encMeta, urls[0].EncryptedMetadata)
+			assert.Equal(t, "mock_shared_key", urls[0].SharedEncryptedAESKey)
+		}
+
+		// Liệt kê không tính lượt xem: share 1 lượt vẫn đọc được
+		meta := authedRequest("GET", "/note/"+strings.TrimPrefix(urls[0].ID, "localhost:8080/note/")+"/meta", bobToken, nil)
+		assert.Equal(t, http.StatusOK, meta.Code)
+	})
+}
@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	clientmodels "note_sharing_application/client/models"
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Đi hết các trang của path theo header X-Next-Cursor, trả về ID theo thứ tự nhận được và số trang
+func collectPages(t *testing.T, path, token string, query clientmodels.ListQuery, id func([]byte) []string) ([]string, int) {
+	var ids []string
+	pages := 0
+	for {
+		w := authedRequest("GET", path+query.Encode(), token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		if w.Code != http.StatusOK {
+			return ids, pages
+		}
+		pages++
+		page := id(w.Body.Bytes())
+		assert.LessOrEqual(t, len(page), query.Limit)
+		ids = append(ids, page...)
+
+		next := w.Header().Get("X-Next-Cursor")
+		if next == "" {
+			return ids, pages
+		}
+		query.After = next
+	}
+}
+
+func noteIDs(body []byte) []string {
+	var notes []clientmodels.Note
+	_ = json.Unmarshal(body, &notes)
+	ids := []string{}
+	for _, n := range notes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func shareNoteAndSender(body []byte) []string {
+	var urls []clientmodels.Url
+	_ = json.Unmarshal(body, &urls)
+	ids := []string{}
+	for _, u := range urls {
+		ids = append(ids, u.SenderID+":"+u.ExpiresAt.Format(time.RFC3339))
+	}
+	return ids
+}
+
+func TestListPagination(t *testing.T) {
+	ctx := t.Context()
+	aliceToken := SetupMockUser(t, "page_alice", "123")
+	bobToken := SetupMockUser(t, "page_bob", "123")
+
+	var notes []string
+	for range 5 {
+		notes = append(notes, SetupMockNote(t, "123", aliceToken))
+	}
+	trashed := SetupMockNote(t, "123", aliceToken)
+	assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+trashed, aliceToken, nil).Code)
+
+	t.Run("Owned notes", func(t *testing.T) {
+		// Không có limit: lấy hết như client cũ
+		w := authedRequest("GET", "/notes/owned", aliceToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("X-Next-Cursor"))
+		assert.Equal(t, notes, noteIDs(w.Body.Bytes()))
+
+		ids, pages := collectPages(t, "/notes/owned", aliceToken, clientmodels.ListQuery{Limit: 2}, noteIDs)
+		assert.Equal(t, notes, ids, "Note trong thùng rác không nằm trong danh sách")
+		assert.Equal(t, 3, pages)
+
+		ids, pages = collectPages(t, "/notes/owned", aliceToken, clientmodels.ListQuery{Limit: 5, Desc: true}, noteIDs)
+		assert.Equal(t, []string{notes[4], notes[3], notes[2], notes[1], notes[0]}, ids)
+		assert.Equal(t, 1, pages)
+	})
+
+	base := time.Now().Add(time.Hour).Truncate(time.Second)
+	create := func(sender string, expiresIn time.Duration, accessed int) {
+		_, err := stores.Shares.Create(ctx, models.Url{
+			NoteID: notes[0], Sender: sender, Receiver: "page_bob",
+			ExpiresAt: base.Add(expiresIn), MaxAccess: 2, Accessed: accessed,
+		})
+		assert.NoError(t, err)
+	}
+	create("page_alice", 3*time.Hour, 0)
+	create("page_carol", time.Hour, 0)
+	create("page_alice", 2*time.Hour, 2)
+	create("page_carol", 4*time.Hour, 1)
+	label := func(sender string, expiresIn time.Duration) string {
+		return sender + ":" + base.Add(expiresIn).Format(time.RFC3339)
+	}
+
+	t.Run("Received shares", func(t *testing.T) {
+		ids, pages := collectPages(t, "/notes/received", bobToken, clientmodels.ListQuery{Limit: 3}, shareNoteAndSender)
+		assert.Equal(t, []string{
+			label("page_alice", 3*time.Hour), label("page_carol", time.Hour),
+			label("page_alice", 2*time.Hour), label("page_carol", 4*time.Hour),
+		}, ids)
+		assert.Equal(t, 2, pages)
+
+		ids, _ = collectPages(t, "/notes/received", bobToken, clientmodels.ListQuery{Limit: 1, Sort: "expires"}, shareNoteAndSender)
+		assert.Equal(t, []string{
+			label("page_carol", time.Hour), label("page_alice", 2*time.Hour),
+			label("page_alice", 3*time.Hour), label("page_carol", 4*time.Hour),
+		}, ids)
+
+		ids, _ = collectPages(t, "/notes/received", bobToken, clientmodels.ListQuery{Limit: 10, Sort: "expires", Desc: true, Sender: "page_carol"}, shareNoteAndSender)
+		assert.Equal(t, []string{label("page_carol", 4*time.Hour), label("page_carol", time.Hour)}, ids)
+
+		ids, _ = collectPages(t, "/notes/received", bobToken, clientmodels.ListQuery{Limit: 10, State: "active", Sender: "page_alice"}, shareNoteAndSender)
+		assert.Equal(t, []string{label("page_alice", 3*time.Hour)}, ids)
+	})
+
+	t.Run("Shares of trashed notes do not shorten pages", func(t *testing.T) {
+		_, err := stores.Shares.Create(ctx, models.Url{
+			NoteID: trashed, Sender: "page_alice", Receiver: "page_bob",
+			ExpiresAt: base, MaxAccess: 1,
+		})
+		assert.NoError(t, err)
+
+		w := authedRequest("GET", "/notes/received?limit=2&sort=expires", bobToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{label("page_carol", time.Hour), label("page_alice", 2*time.Hour)}, shareNoteAndSender(w.Body.Bytes()))
+		assert.NotEmpty(t, w.Header().Get("X-Next-Cursor"))
+	})
+
+	t.Run("Invalid query", func(t *testing.T) {
+		for _, q := range []string{"limit=0", "limit=abc", "limit=101", "sort=name", "order=up", "after=xyz", "state=old", "state=expired"} {
+			assert.Equal(t, http.StatusBadRequest, authedRequest("GET", "/notes/received?"+q, bobToken, nil).Code, q)
+		}
+		assert.Equal(t, http.StatusBadRequest, authedRequest("GET", "/notes/owned?sort=expires", aliceToken, nil).Code)
+
+		// Cursor tạo theo cách sắp xếp khác
+		w := authedRequest("GET", "/notes/received?limit=1&sort=expires", bobToken, nil)
+		after := w.Header().Get("X-Next-Cursor")
+		assert.NotEmpty(t, after)
+		assert.Equal(t, http.StatusBadRequest, authedRequest("GET", "/notes/received?after="+after, bobToken, nil).Code)
+	})
+}
@@ -0,0 +1,107 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func ownedNotes(t *testing.T, token string) []models.Note {
+	w := authedRequest("GET", "/notes/owned", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var notes []models.Note
+	_ = json.Unmarshal(w.Body.Bytes(), &notes)
+	return notes
+}
+
+func changePasswordRequest(token, oldPass, newPass, encPrivKey string, noteKeys []models.NoteKeyUpdate) (int, models.LoginResponse) {
+	w := authedRequest("POST", "/auth/change-password", token, models.ChangePasswordRequest{
+		OldPassword:         encryptPasswordForTest(oldPass),
+		NewPassword:         encryptPasswordForTest(newPass),
+		EncryptedPrivateKey: encPrivKey,
+		NoteKeys:            noteKeys,
+	})
+
+	var res models.LoginResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+func TestChangePassword(t *testing.T) {
+	token := SetupMockUser(t, "change_pass_user", "old")
+	SetupMockNote(t, "old", token)
+	SetupMockNote(t, "old", token)
+
+	privKey, err := crypto.EncryptByPassword("abcdef", "new")
+	assert.NoError(t, err)
+
+	// Client bọc lại khóa của từng note bằng mật khẩu mới
+	var noteKeys []models.NoteKeyUpdate
+	for _, n := range ownedNotes(t, token) {
+		newKey, err := crypto.RewrapByPassword(n.EncryptedAesKey, "old", "new")
+		assert.NoError(t, err)
+		noteKeys = append(noteKeys, models.NoteKeyUpdate{NoteID: n.ID, EncryptedAesKey: newKey})
+	}
+	assert.Len(t, noteKeys, 2)
+
+	t.Run("Sai mật khẩu cũ", func(t *testing.T) {
+		code, _ := changePasswordRequest(token, "wrong", "new", privKey, noteKeys)
+		assert.Equal(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Thiếu khóa của 1 note thì không đổi gì cả", func(t *testing.T) {
+		code, _ := changePasswordRequest(token, "old", "new", privKey, noteKeys[:1])
+		assert.Equal(t, http.StatusConflict, code)
+
+		// Vẫn đăng nhập được bằng mật khẩu cũ, khóa note vẫn mở được bằng mật khẩu cũ
+		loginTokens(t, "change_pass_user", "old")
+		for _, n := range ownedNotes(t, token) {
+			_, err := crypto.DecryptByPassword(n.EncryptedAesKey, "old")
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("Đổi mật khẩu thành công", func(t *testing.T) {
+		code, res := changePasswordRequest(token, "old", "new", privKey, noteKeys)
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotEmpty(t, res.Token)
+		assert.NotEmpty(t, res.RefreshToken)
+
+		// Phiên cũ bị thu hồi, phiên mới dùng được
+		assert.Equal(t, http.StatusUnauthorized, listOwnedStatus(token))
+		for _, n := range ownedNotes(t, res.Token) {
+			_, err := crypto.DecryptByPassword(n.EncryptedAesKey, "new")
+			assert.NoError(t, err, "Khóa note phải mở được bằng mật khẩu mới")
+		}
+
+		// Mật khẩu cũ không đăng nhập được nữa
+		body, _ := json.Marshal(map[string]string{
+			"username": "change_pass_user",
+			"password": encryptPasswordForTest("old"),
+		})
+		req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		var login models.LoginResponse
+		body, _ = json.Marshal(map[string]string{
+			"username": "change_pass_user",
+			"password": encryptPasswordForTest("new"),
+		})
+		req, _ = http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		_ = json.Unmarshal(w.Body.Bytes(), &login)
+		assert.Equal(t, privKey, login.EncryptedPrivateKey)
+	})
+}
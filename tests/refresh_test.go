@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"note_sharing_application/client/services"
+	"note_sharing_application/server/models"
+	serverservices "note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Gọi /auth/refresh, trả về status code và body
+func refreshRequest(refreshToken string) (int, map[string]interface{}) {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	req, _ := http.NewRequest("POST", "/auth/refresh", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	return w.Code, res
+}
+
+func loginForRefresh(t *testing.T, username, password string) string {
+	SetupMockUser(t, username, password)
+
+	body, _ := json.Marshal(map[string]string{
+		"username": username,
+		"password": encryptPasswordForTest(password),
+	})
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var res map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	refreshToken, _ := res["refresh_token"].(string)
+	assert.NotEmpty(t, refreshToken, "Đăng nhập phải trả về refresh token")
+	return refreshToken
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	first := loginForRefresh(t, "refresh_user", "123")
+
+	// Làm mới lần 1: nhận cặp token mới
+	code, res := refreshRequest(first)
+	assert.Equal(t, http.StatusOK, code)
+	second, _ := res["refresh_token"].(string)
+	assert.NotEmpty(t, res["token"])
+	assert.NotEmpty(t, second)
+	assert.NotEqual(t, first, second, "Refresh token phải được xoay vòng")
+
+	// Access token mới dùng được
+	req, _ := http.NewRequest("GET", "/notes/owned", nil)
+	req.Header.Set("Authorization", "Bearer "+res["token"].(string))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Dùng lại token cũ -> bị phát hiện reuse
+	code, _ = refreshRequest(first)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Cả family bị thu hồi -> token mới nhất cũng không dùng được nữa
+	code, _ = refreshRequest(second)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// Token rác
+	code, _ = refreshRequest("not-a-token")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
+
+// Client services phải tự làm mới token khi nhận 401
+// Token store chạy beforeCreate (1 lần) trước khi lưu token mới, mô phỏng request chạy xen giữa
+type hookedTokenStore struct {
+	stores.TokenStore
+	beforeCreate func()
+}
+
+func (s *hookedTokenStore) Create(ctx context.Context, token models.RefreshToken) (string, error) {
+	if hook := s.beforeCreate; hook != nil {
+		s.beforeCreate = nil
+		hook()
+	}
+	return s.TokenStore.Create(ctx, token)
+}
+
+func TestRefreshRacingLogoutAll(t *testing.T) {
+	refreshToken := loginForRefresh(t, "refresh_race_user", "123")
+	user, err := stores.Users.FindByUsername(context.Background(), "refresh_race_user")
+	assert.NoError(t, err)
+
+	// LogoutAll chạy sau khi token cũ đã qua kiểm tra nhưng trước khi token mới được lưu
+	realTokens := stores.Tokens
+	defer func() { stores.Tokens = realTokens }()
+	stores.Tokens = &hookedTokenStore{TokenStore: realTokens, beforeCreate: func() {
+		assert.NoError(t, serverservices.LogoutAll(user.ID.Hex(), user.Username))
+	}}
+
+	code, res := refreshRequest(refreshToken)
+	assert.Equal(t, http.StatusUnauthorized, code, "Không được cấp phiên mới sau LogoutAll")
+	assert.Nil(t, res["refresh_token"])
+	assert.Nil(t, stores.Tokens.(*hookedTokenStore).beforeCreate, "Hook phải đã chạy")
+}
+
+func TestClientSilentRefresh(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	oldBaseURL := services.BaseURL
+	services.BaseURL = server.URL
+	defer func() { services.BaseURL = oldBaseURL }()
+
+	refreshToken := loginForRefresh(t, "silent_refresh_user", "123")
+
+	var savedAccess, savedRefresh string
+	expiredToken := "expired.access.token"
+	services.UseSession(expiredToken, refreshToken, func(accessToken, newRefresh string) {
+		savedAccess, savedRefresh = accessToken, newRefresh
+	})
+	defer services.UseSession("", "", nil)
+
+	// Token hết hạn nhưng request vẫn thành công nhờ refresh
+	_, err := services.GetOwnedNotes(expiredToken)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, savedAccess, "Token mới phải được báo lại để lưu session")
+	assert.NotEqual(t, refreshToken, savedRefresh)
+
+	// Gọi tiếp với token cũ: dùng luôn token mới, không refresh lần nữa
+	previous := savedRefresh
+	_, err = services.GetOwnedNotes(expiredToken)
+	assert.NoError(t, err)
+	assert.Equal(t, previous, savedRefresh)
+}
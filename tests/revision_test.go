@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"note_sharing_application/client/crypto"
+	clientmodels "note_sharing_application/client/models"
+	"note_sharing_application/client/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Cập nhật nội dung note (PUT /notes/:note_id), trả về phản hồi
+func updateNote(token, noteID string, baseRevision int, body []byte) *httptest.ResponseRecorder {
+	path := "/notes/" + noteID
+	if baseRevision > 0 {
+		path = fmt.Sprintf("%s?base_revision=%d", path, baseRevision)
+	}
+	req, _ := http.NewRequest("PUT", path, bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestNoteRevisions(t *testing.T) {
+	aliceToken := SetupMockUser(t, "rev_alice", "123")
+	bobToken := SetupMockUser(t, "rev_bob", "123")
+	carolToken := SetupMockUser(t, "rev_carol", "123")
+
+	signingPriv, signingPub, err := crypto.GenerateSigningKeyPair()
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, signingKeyRequest(aliceToken, "123", signingPub))
+
+	v1 := generateRandomBytes(1000)
+	v2 := generateRandomBytes(2000)
+	noteID, err := createMetadataNote(aliceToken)
+	assert.NoError(t, err)
+
+	t.Run("Update requires existing content", func(t *testing.T) {
+		assert.Equal(t, http.StatusConflict, updateNote(aliceToken, noteID, 0, v2).Code)
+		assert.Equal(t, http.StatusOK, putContent(aliceToken, noteID, v1, "application/octet-stream"))
+	})
+
+	t.Run("Update creates a new revision", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, updateNote(bobToken, noteID, 0, v2).Code)
+		assert.Equal(t, http.StatusBadRequest, updateNote(aliceToken, noteID, 0, nil).Code)
+		req, _ := http.NewRequest("PUT", "/notes/"+noteID+"?base_revision=x", bytes.NewReader(v2))
+		req.Header.Set("Authorization", "Bearer "+aliceToken)
+		req.Header.Set("Content-Type", "application/octet-stream")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = updateNote(aliceToken, noteID, 1, v2)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var note clientmodels.Note
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &note))
+		assert.Equal(t, 2, note.Revision)
+		assert.Equal(t, int64(len(v2)), note.Size)
+		assert.Equal(t, crypto.CipherTextDigest(base64.StdEncoding.EncodeToString(v2)), note.CipherDigest)
+
+		// Sửa dựa trên phiên bản đã cũ
+		assert.Equal(t, http.StatusConflict, updateNote(aliceToken, noteID, 1, v1).Code)
+	})
+
+	t.Run("List and download revisions", func(t *testing.T) {
+		w := authedRequest("GET", "/notes/"+noteID+"/revisions", aliceToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var revisions []clientmodels.NoteRevision
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &revisions))
+		assert.Len(t, revisions, 2)
+		assert.Equal(t, 1, revisions[0].Revision)
+		assert.Equal(t, crypto.CipherTextDigest(base64.StdEncoding.EncodeToString(v1)), revisions[0].CipherDigest)
+
+		w = authedRequest("GET", "/notes/"+noteID+"/revisions/1/content", aliceToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, bytes.Equal(v1, w.Body.Bytes()))
+		assert.True(t, bytes.Equal(v2, authedRequest("GET", "/notes/"+noteID+"/content", aliceToken, nil).Body.Bytes()))
+
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/notes/"+noteID+"/revisions/3/content", aliceToken, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, authedRequest("GET", "/notes/"+noteID+"/revisions/x/content", aliceToken, nil).Code)
+		assert.Equal(t, http.StatusForbidden, authedRequest("GET", "/notes/"+noteID+"/revisions", bobToken, nil).Code)
+	})
+
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	share := func(receiver, digest string, extra map[string]interface{}) map[string]interface{} {
+		msg := crypto.ShareSignatureMessage("rev_alice", receiver, noteID, digest, "wrapped_key", crypto.KeySchemeX25519, expiresAt)
+		signature, _ := crypto.SignMessage(signingPriv, msg)
+		body := map[string]interface{}{
+			"receiver":                 receiver,
+			"max_access":               5,
+			"expires_at":               expiresAt,
+			"shared_encrypted_aes_key": "wrapped_key",
+			"key_scheme":               crypto.KeySchemeX25519,
+			"signature":                signature,
+		}
+		for k, v := range extra {
+			body[k] = v
+		}
+		return body
+	}
+	v1Digest := crypto.CipherTextDigest(base64.StdEncoding.EncodeToString(v1))
+
+	t.Run("Shares pin a revision or follow the latest", func(t *testing.T) {
+		// Chữ ký phải khớp phiên bản được chia sẻ
+		assert.Equal(t, http.StatusBadRequest, createShareRequest(aliceToken, noteID, share("rev_bob", v1Digest, nil)))
+		assert.Equal(t, http.StatusBadRequest, createShareRequest(aliceToken, noteID, share("rev_carol", v1Digest, map[string]interface{}{"follow_latest": true})))
+		assert.Equal(t, http.StatusBadRequest, createShareRequest(aliceToken, noteID, share("rev_bob", v1Digest, map[string]interface{}{"revision": 1, "follow_latest": true})))
+		assert.Equal(t, http.StatusNotFound, createShareRequest(aliceToken, noteID, share("rev_bob", v1Digest, map[string]interface{}{"revision": 7})))
+
+		assert.Equal(t, http.StatusOK, createShareRequest(aliceToken, noteID, share("rev_bob", v1Digest, map[string]interface{}{"revision": 1})))
+		assert.Equal(t, http.StatusOK, createShareRequest(aliceToken, noteID, share("rev_carol", crypto.ShareDigestLatest, map[string]interface{}{"follow_latest": true})))
+
+		pinned := viewShare(t, noteID, bobToken)
+		assert.Equal(t, 1, pinned.Revision)
+		assert.False(t, pinned.FollowLatest)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(v1), pinned.EncryptedContent)
+		assert.Equal(t, v1Digest, pinned.CipherDigest)
+
+		latest := viewShare(t, noteID, carolToken)
+		assert.Equal(t, 2, latest.Revision)
+		assert.True(t, latest.FollowLatest)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(v2), latest.EncryptedContent)
+		msg := crypto.ShareSignatureMessage(latest.Sender, "rev_carol", latest.NoteID, crypto.ShareDigestLatest, latest.EncryptedKey, latest.KeyScheme, latest.ExpiresAt)
+		assert.NoError(t, crypto.VerifySignature(signingPub, latest.Signature, msg))
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		w := authedRequest("POST", "/notes/"+noteID+"/revisions/1/restore", aliceToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var note clientmodels.Note
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &note))
+		assert.Equal(t, 3, note.Revision)
+		assert.Equal(t, v1Digest, note.CipherDigest)
+		assert.True(t, bytes.Equal(v1, authedRequest("GET", "/notes/"+noteID+"/content", aliceToken, nil).Body.Bytes()))
+		assert.Equal(t, http.StatusNotFound, authedRequest("POST", "/notes/"+noteID+"/revisions/9/restore", aliceToken, nil).Code)
+
+		// Share theo phiên bản mới nhất thấy phiên bản vừa khôi phục
+		latest := viewShare(t, noteID, carolToken)
+		assert.Equal(t, 3, latest.Revision)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(v1), latest.EncryptedContent)
+	})
+
+	t.Run("Purge removes every revision", func(t *testing.T) {
+		stored, err := stores.Notes.FindByID(t.Context(), noteID)
+		assert.NoError(t, err)
+		assert.Len(t, stored.History, 2)
+		assert.Equal(t, stored.History[0].BlobRef, stored.BlobRef, "Khôi phục dùng lại blob cũ")
+
+		for _, path := range []string{"/notes/" + noteID, "/notes/trash/" + noteID} {
+			assert.Equal(t, http.StatusOK, authedRequest("DELETE", path, aliceToken, nil).Code)
+		}
+
+		for _, r := range stored.Revisions() {
+			_, err := stores.Blobs.Open(t.Context(), r.BlobRef)
+			assert.ErrorIs(t, err, stores.ErrNotFound)
+		}
+	})
+}
+
+func TestRevisionClient(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+	oldBaseURL := services.BaseURL
+	services.BaseURL = server.URL
+	defer func() { services.BaseURL = oldBaseURL }()
+
+	token := SetupMockUser(t, "rev_client", "123")
+
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "v1.bin"), filepath.Join(dir, "v2.bin")
+	plain1, plain2 := generateRandomBytes(crypto.StreamChunkSize+5), generateRandomBytes(100)
+	assert.NoError(t, os.WriteFile(first, plain1, 0644))
+	assert.NoError(t, os.WriteFile(second, plain2, 0644))
+
+	aesKey, encKey, err := crypto.NewNoteKey("123")
+	assert.NoError(t, err)
+	meta1, _ := crypto.EncryptNoteMetadata(clientmodels.NoteMetadata{Filename: "v1.bin"}, aesKey)
+	meta2, _ := crypto.EncryptNoteMetadata(clientmodels.NoteMetadata{Filename: "v2.bin"}, aesKey)
+
+	noteID, err := services.CreateNote(token, "", encKey, meta1)
+	assert.NoError(t, err)
+	assert.NoError(t, services.UploadNoteContent(token, noteID, func() (io.ReadCloser, error) {
+		return crypto.EncryptFileReader(first, aesKey)
+	}))
+
+	note, err := services.GetNote(token, noteID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, note.Revision)
+
+	digest := crypto.NewCipherDigest()
+	updated, err := services.UpdateNote(token, noteID, note.Revision, meta2, func() (io.ReadCloser, error) {
+		ciphertext, err := crypto.EncryptFileReader(second, aesKey)
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(ciphertext, digest), ciphertext}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, updated.Revision)
+	assert.Equal(t, digest.Hex(), updated.CipherDigest)
+	assert.Equal(t, meta2, updated.EncryptedMetadata)
+
+	_, err = services.UpdateNote(token, noteID, 1, "", func() (io.ReadCloser, error) {
+		return crypto.EncryptFileReader(second, aesKey)
+	})
+	assert.ErrorIs(t, err, services.ErrRevisionConflict)
+
+	revisions, err := services.ListRevisions(token, noteID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 2)
+	assert.Equal(t, meta1, revisions[0].EncryptedMetadata)
+
+	// Phiên bản cũ vẫn giải mã được bằng khóa của note
+	out := filepath.Join(dir, "out.bin")
+	body, err := services.OpenRevisionContent(token, noteID, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, crypto.RestoreFileFromReader(body, aesKey, revisions[0].CipherDigest, out))
+	body.Close()
+	restored, _ := os.ReadFile(out)
+	assert.True(t, bytes.Equal(plain1, restored))
+
+	note, err = services.RestoreRevision(token, noteID, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, note.Revision)
+	assert.Equal(t, meta1, note.EncryptedMetadata)
+}
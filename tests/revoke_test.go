@@ -0,0 +1,64 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	clientmodels "note_sharing_application/client/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noteShares(t *testing.T, noteID, token string) []clientmodels.SentShare {
+	w := authedRequest("GET", "/notes/"+noteID+"/shares", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var shares []clientmodels.SentShare
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &shares))
+	return shares
+}
+
+func TestRevokeShare(t *testing.T) {
+	aliceToken := SetupMockUser(t, "revoke_alice", "123")
+	bobToken := SetupMockUser(t, "revoke_bob", "123")
+	carolToken := SetupMockUser(t, "revoke_carol", "123")
+
+	noteID := SetupMockNote(t, "123", aliceToken)
+	bobURL := SetupMockURL(t, noteID, "revoke_alice", "revoke_bob", "1h", 3, aliceToken, bobToken)
+	carolURL := SetupMockURL(t, noteID, "revoke_alice", "revoke_carol", "2h", 1, aliceToken, carolToken)
+	assert.Equal(t, http.StatusOK, AccessURL(t, bobURL, bobToken))
+
+	t.Run("List recipients", func(t *testing.T) {
+		shares := noteShares(t, noteID, aliceToken)
+		assert.Len(t, shares, 2)
+		assert.Equal(t, bobURL, shares[0].ID)
+		assert.Equal(t, "revoke_bob", shares[0].Receiver)
+		assert.Equal(t, 1, shares[0].Accessed)
+		assert.Equal(t, 3, shares[0].MaxAccess)
+		assert.Equal(t, 1, shares[0].Revision)
+		assert.Equal(t, "revoke_carol", shares[1].Receiver)
+		assert.Equal(t, 0, shares[1].Accessed)
+		assert.True(t, shares[1].ExpiresAt.After(shares[0].ExpiresAt))
+		assert.False(t, shares[0].CreatedAt.IsZero())
+
+		assert.Equal(t, http.StatusForbidden, authedRequest("GET", "/notes/"+noteID+"/shares", bobToken, nil).Code)
+	})
+
+	t.Run("Revoke one recipient", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", "/shares/"+bobURL, bobToken, nil).Code, "Người nhận không thu hồi được")
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", "/shares/"+bobURL, carolToken, nil).Code)
+		assert.Equal(t, http.StatusOK, AccessURL(t, bobURL, bobToken))
+
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/shares/"+bobURL, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, AccessURL(t, bobURL, bobToken))
+		assert.Equal(t, http.StatusOK, AccessURL(t, carolURL, carolToken), "Share của người nhận khác giữ nguyên")
+
+		shares := noteShares(t, noteID, aliceToken)
+		assert.Len(t, shares, 0, "Share của carol hết lượt xem nên cũng bị xóa")
+	})
+
+	t.Run("Invalid share", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, authedRequest("DELETE", "/shares/"+bobURL, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, authedRequest("DELETE", "/shares/xyz", aliceToken, nil).Code)
+	})
+}
@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"note_sharing_application/server/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Mã hóa password bằng 1 public key cụ thể (mô phỏng client đang giữ khóa cũ)
+func encryptPasswordWithKey(t *testing.T, pub *rsa.PublicKey, rawPassword string) string {
+	enc, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, []byte(rawPassword), nil)
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(enc)
+}
+
+func loginWithKeyID(username, encryptedPassword, keyID string) int {
+	body, _ := json.Marshal(map[string]string{
+		"username": username,
+		"password": encryptedPassword,
+		"key_id":   keyID,
+	})
+	req, _ := http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestServerRSAKeyFile(t *testing.T) {
+	// Các test khác dùng khóa sinh trên RAM, trả lại khi xong
+	defer utils.GenerateServerRSAKeys()
+
+	path := filepath.Join(t.TempDir(), "server_rsa_key.pem")
+
+	t.Run("Khởi động lại vẫn giữ nguyên khóa", func(t *testing.T) {
+		assert.NoError(t, utils.LoadOrCreateServerRSAKeys(path, "passphrase"))
+		firstID := utils.ServerKeyID()
+		assert.NotEmpty(t, firstID)
+
+		assert.NoError(t, utils.LoadOrCreateServerRSAKeys(path, "passphrase"))
+		assert.Equal(t, firstID, utils.ServerKeyID())
+
+		req, _ := http.NewRequest("GET", "/auth/server-public-key-rsa", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var res map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &res)
+		assert.Equal(t, firstID, res["key_id"], "Public key trả về phải kèm key ID")
+	})
+
+	t.Run("Sai passphrase", func(t *testing.T) {
+		err := utils.LoadOrCreateServerRSAKeys(path, "wrong")
+		assert.ErrorIs(t, err, utils.ErrWrongKeyPassphrase)
+	})
+
+	t.Run("Passphrase rỗng bị từ chối, không tạo file", func(t *testing.T) {
+		emptyPath := filepath.Join(t.TempDir(), "empty_pass.pem")
+		err := utils.LoadOrCreateServerRSAKeys(emptyPath, "")
+		assert.ErrorIs(t, err, utils.ErrMissingKeyPassphrase)
+		_, statErr := os.Stat(emptyPath)
+		assert.True(t, os.IsNotExist(statErr))
+	})
+
+	t.Run("Xoay vòng: khóa cũ còn dùng được trong thời gian ân hạn", func(t *testing.T) {
+		assert.NoError(t, utils.LoadOrCreateServerRSAKeys(path, "passphrase"))
+		SetupMockUser(t, "rotate_key_user", "123")
+
+		oldID := utils.ServerKeyID()
+		oldPub := utils.ServerPublicKey
+		assert.NoError(t, utils.RotateServerRSAKeys(path, "passphrase", time.Hour))
+		assert.NotEqual(t, oldID, utils.ServerKeyID())
+
+		// Client đang giữ khóa cũ
+		assert.Equal(t, http.StatusOK, loginWithKeyID("rotate_key_user", encryptPasswordWithKey(t, oldPub, "123"), oldID))
+		// Client đã lấy khóa mới
+		assert.Equal(t, http.StatusOK, loginWithKeyID("rotate_key_user", encryptPasswordForTest("123"), utils.ServerKeyID()))
+
+		// Khởi động lại vẫn còn cả 2 khóa
+		assert.NoError(t, utils.LoadOrCreateServerRSAKeys(path, "passphrase"))
+		assert.Equal(t, http.StatusOK, loginWithKeyID("rotate_key_user", encryptPasswordWithKey(t, oldPub, "123"), oldID))
+	})
+
+	t.Run("Hết thời gian ân hạn thì khóa cũ bị từ chối", func(t *testing.T) {
+		oldID := utils.ServerKeyID()
+		oldPub := utils.ServerPublicKey
+		assert.NoError(t, utils.RotateServerRSAKeys(path, "passphrase", 0))
+
+		_, err := utils.DecryptOAEP(oldID, []byte("x"))
+		assert.ErrorIs(t, err, utils.ErrUnknownKeyID)
+		assert.Equal(t, http.StatusBadRequest, loginWithKeyID("rotate_key_user", encryptPasswordWithKey(t, oldPub, "123"), oldID))
+	})
+}
@@ -37,7 +37,7 @@ func TestRSA_EncryptionDecryption(t *testing.T) {
 	assert.NoError(t, err, "Client mã hóa thất bại")
 
 	// Server giải mã password
-	decryptedString, err := utils.DecryptOAEP(encryptedBytes)
+	decryptedString, err := utils.DecryptOAEP(utils.ServerKeyID(), encryptedBytes)
 
 	// Check
 	assert.NoError(t, err, "Server giải mã thất bại")
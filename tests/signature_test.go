@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"note_sharing_application/client/crypto"
+	"note_sharing_application/client/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Gửi khóa ký lên /auth/signing-key, trả về status code
+func signingKeyRequest(token, password, pubHex string) int {
+	return authedRequest("POST", "/auth/signing-key", token, map[string]string{
+		"password":                  encryptPasswordForTest(password),
+		"signing_public_key":        pubHex,
+		"encrypted_signing_privKey": "EncSigningPriv",
+	}).Code
+}
+
+// Tạo share, trả về status code
+func createShareRequest(token, noteID string, body map[string]interface{}) int {
+	return authedRequest("POST", "/notes/"+noteID+"/url", token, body).Code
+}
+
+func viewShare(t *testing.T, noteID, token string) models.NoteData {
+	w := authedRequest("GET", "/notes/"+noteID+"/url", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var res struct {
+		Url string `json:"url"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &res)
+	urlID := res.Url[len(res.Url)-24:]
+
+	w = authedRequest("GET", "/note/"+urlID, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var data models.NoteData
+	_ = json.Unmarshal(w.Body.Bytes(), &data)
+	return data
+}
+
+func TestSignedShare(t *testing.T) {
+	senderToken := SetupMockUser(t, "signer_alice", "123")
+	recvToken := SetupMockUser(t, "signer_bob", "123")
+
+	signingPriv, signingPub, err := crypto.GenerateSigningKeyPair()
+	assert.NoError(t, err)
+
+	t.Run("Thêm khóa ký cho tài khoản cũ", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, signingKeyRequest(senderToken, "123", "not-a-key"))
+		assert.Equal(t, http.StatusForbidden, signingKeyRequest(senderToken, "wrong", signingPub))
+
+		before := getPublicKeys("signer_alice")
+		assert.Equal(t, http.StatusOK, signingKeyRequest(senderToken, "123", signingPub))
+		assert.Equal(t, http.StatusConflict, signingKeyRequest(senderToken, "123", signingPub), "Chỉ thêm được 1 lần")
+
+		after := getPublicKeys("signer_alice")
+		assert.Equal(t, signingPub, after.SigningPublicKey)
+		assert.Greater(t, after.LogIndex, before.LogIndex, "Khóa ký phải được ghi vào key log")
+	})
+
+	noteID := SetupMockNote(t, "123", senderToken)
+	var cipherDigest string
+	for _, n := range ownedNotes(t, senderToken) {
+		if n.ID == noteID {
+			cipherDigest = n.CipherDigest
+		}
+	}
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	msg := crypto.ShareSignatureMessage("signer_alice", "signer_bob", noteID, cipherDigest, "wrapped_key", crypto.KeySchemeX25519, expiresAt)
+	signature, err := crypto.SignMessage(signingPriv, msg)
+	assert.NoError(t, err)
+
+	share := func(overrides map[string]interface{}) map[string]interface{} {
+		body := map[string]interface{}{
+			"receiver":                 "signer_bob",
+			"max_access":               5,
+			"expires_in":               "1h",
+			"expires_at":               expiresAt,
+			"shared_encrypted_aes_key": "wrapped_key",
+			"key_scheme":               crypto.KeySchemeX25519,
+			"signature":                signature,
+		}
+		for k, v := range overrides {
+			body[k] = v
+		}
+		return body
+	}
+
+	t.Run("Server từ chối share thiếu hoặc sai chữ ký", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, createShareRequest(senderToken, noteID, share(map[string]interface{}{"signature": ""})))
+		assert.Equal(t, http.StatusBadRequest, createShareRequest(senderToken, noteID, share(map[string]interface{}{"shared_encrypted_aes_key": "other_key"})))
+		assert.Equal(t, http.StatusBadRequest, createShareRequest(senderToken, noteID, share(map[string]interface{}{"expires_at": expiresAt + 60})))
+	})
+
+	t.Run("Người nhận kiểm tra được chữ ký", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, createShareRequest(senderToken, noteID, share(nil)))
+
+		data := viewShare(t, noteID, recvToken)
+		assert.Equal(t, "signer_alice", data.Sender)
+		assert.Equal(t, expiresAt, data.ExpiresAt)
+
+		senderKey := getPublicKeys(data.Sender).SigningPublicKey
+		assert.Equal(t, crypto.CipherTextDigest(data.EncryptedContent), data.CipherDigest)
+		got := crypto.ShareSignatureMessage(data.Sender, "signer_bob", data.NoteID, data.CipherDigest, data.EncryptedKey, data.KeyScheme, data.ExpiresAt)
+		assert.NoError(t, crypto.VerifySignature(senderKey, data.Signature, got))
+
+		// Server đổi người gửi hoặc khóa đã bọc -> chữ ký không còn đúng
+		forged := crypto.ShareSignatureMessage("signer_mallory", "signer_bob", data.NoteID, data.CipherDigest, data.EncryptedKey, data.KeyScheme, data.ExpiresAt)
+		assert.ErrorIs(t, crypto.VerifySignature(senderKey, data.Signature, forged), crypto.ErrShareSignature)
+		forged = crypto.ShareSignatureMessage(data.Sender, "signer_bob", data.NoteID, data.CipherDigest, "swapped_key", data.KeyScheme, data.ExpiresAt)
+		assert.ErrorIs(t, crypto.VerifySignature(senderKey, data.Signature, forged), crypto.ErrShareSignature)
+	})
+
+	t.Run("Đổi mật khẩu phải bọc lại khóa ký", func(t *testing.T) {
+		notes := ownedNotes(t, senderToken)
+		keys := make([]models.NoteKeyUpdate, 0, len(notes))
+		for _, n := range notes {
+			keys = append(keys, models.NoteKeyUpdate{NoteID: n.ID, EncryptedAesKey: "rewrapped"})
+		}
+		code, _ := changePasswordRequest(senderToken, "123", "456", "NewEncPriv", keys)
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+}
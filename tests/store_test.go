@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"note_sharing_application/server/models"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test bộ lưu trữ file: dữ liệu phải còn sau khi mở lại file
+func TestFileStorePersistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "data.json")
+
+	s, err := stores.NewFile(path)
+	assert.NoError(t, err)
+
+	_, err = s.Users.Create(ctx, models.User{Username: "file_user", PubKey: "abc"})
+	assert.NoError(t, err)
+	noteID, err := s.Notes.Create(ctx, models.Note{CipherText: "cipher", OwnerID: "owner"})
+	assert.NoError(t, err)
+
+	// Mở lại từ file
+	reopened, err := stores.NewFile(path)
+	assert.NoError(t, err)
+
+	user, err := reopened.Users.FindByUsername(ctx, "file_user")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", user.PubKey)
+
+	note, err := reopened.Notes.FindByID(ctx, noteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "cipher", note.CipherText)
+
+	// Xóa rồi mở lại thì không còn
+	assert.NoError(t, reopened.Notes.Delete(ctx, noteID))
+	again, err := stores.NewFile(path)
+	assert.NoError(t, err)
+	_, err = again.Notes.FindByID(ctx, noteID)
+	assert.ErrorIs(t, err, stores.ErrNotFound)
+}
+
+// Test blob store trên thư mục local
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	blobs, err := stores.NewLocalBlobStore(dir)
+	assert.NoError(t, err)
+
+	data := []byte("ciphertext binary")
+	ref, size, err := blobs.Put(ctx, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+
+	r, err := blobs.Open(ctx, ref)
+	assert.NoError(t, err)
+	got, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, data, got)
+
+	// Không có file tạm nào còn sót lại
+	entries, _ := os.ReadDir(dir)
+	assert.Len(t, entries, 1)
+
+	// Tham chiếu không hợp lệ không được thoát ra ngoài thư mục
+	_, err = blobs.Open(ctx, "../"+filepath.Base(dir))
+	assert.ErrorIs(t, err, stores.ErrNotFound)
+
+	assert.NoError(t, blobs.Delete(ctx, ref))
+	_, err = blobs.Open(ctx, ref)
+	assert.ErrorIs(t, err, stores.ErrNotFound)
+	assert.ErrorIs(t, blobs.Delete(ctx, ref), stores.ErrNotFound)
+
+	// Bộ store file lưu blob trong thư mục cạnh file dữ liệu
+	s, err := stores.NewFile(filepath.Join(dir, "data.json"))
+	assert.NoError(t, err)
+	ref, _, err = s.Blobs.Put(ctx, bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dir, "data_blobs", ref))
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	clientmodels "note_sharing_application/client/models"
+	"note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func trashNotes(t *testing.T, token string) []clientmodels.Note {
+	w := authedRequest("GET", "/notes/trash", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var notes []clientmodels.Note
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &notes))
+	return notes
+}
+
+func receivedShares(t *testing.T, token string) []clientmodels.Url {
+	w := authedRequest("GET", "/notes/received", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var urls []clientmodels.Url
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &urls))
+	return urls
+}
+
+func TestTrash(t *testing.T) {
+	aliceToken := SetupMockUser(t, "trash_alice", "123")
+	bobToken := SetupMockUser(t, "trash_bob", "123")
+
+	noteID := SetupMockNote(t, "123", aliceToken)
+	urlID := SetupMockURL(t, noteID, "trash_alice", "trash_bob", "1h", 2, aliceToken, bobToken)
+
+	t.Run("Delete moves the note to the trash", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", "/notes/"+noteID, bobToken, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+noteID, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("DELETE", "/notes/"+noteID, aliceToken, nil).Code)
+
+		for _, n := range ownedNotes(t, aliceToken) {
+			assert.NotEqual(t, noteID, n.ID)
+		}
+		trash := trashNotes(t, aliceToken)
+		assert.Len(t, trash, 1)
+		assert.Equal(t, noteID, trash[0].ID)
+		assert.WithinDuration(t, trash[0].DeletedAt.Add(services.TrashRetention), *trash[0].PurgeAt, time.Second)
+		assert.Empty(t, trashNotes(t, bobToken))
+
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/notes/"+noteID, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/notes/"+noteID+"/content", aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, createShareRequest(aliceToken, noteID, map[string]interface{}{
+			"receiver": "trash_bob", "max_access": 1, "expires_in": "1h",
+		}))
+	})
+
+	t.Run("Shares are suspended, not destroyed", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, AccessURL(t, urlID, bobToken))
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/note/"+urlID+"/meta", bobToken, nil).Code)
+		assert.Empty(t, receivedShares(t, bobToken))
+
+		url, err := stores.Shares.FindByID(t.Context(), urlID)
+		assert.NoError(t, err)
+		assert.Equal(t, 0, url.Accessed, "Share tạm ngưng không tính lượt xem")
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		assert.Equal(t, http.StatusForbidden, authedRequest("POST", "/notes/trash/"+noteID+"/restore", bobToken, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("POST", "/notes/trash/"+noteID+"/restore", aliceToken, nil).Code)
+		assert.Equal(t, http.StatusNotFound, authedRequest("POST", "/notes/trash/"+noteID+"/restore", aliceToken, nil).Code)
+
+		assert.Empty(t, trashNotes(t, aliceToken))
+		assert.Equal(t, http.StatusOK, authedRequest("GET", "/notes/"+noteID, aliceToken, nil).Code)
+		assert.Len(t, receivedShares(t, bobToken), 1)
+		assert.Equal(t, http.StatusOK, AccessURL(t, urlID, bobToken))
+	})
+
+	t.Run("Purge", func(t *testing.T) {
+		// Chỉ xóa hẳn được note trong thùng rác
+		assert.Equal(t, http.StatusNotFound, authedRequest("DELETE", "/notes/trash/"+noteID, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+noteID, aliceToken, nil).Code)
+		assert.Equal(t, http.StatusForbidden, authedRequest("DELETE", "/notes/trash/"+noteID, bobToken, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/trash/"+noteID, aliceToken, nil).Code)
+
+		assert.Empty(t, trashNotes(t, aliceToken))
+		_, err := stores.Shares.FindByID(t.Context(), urlID)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+	})
+
+	t.Run("Expired trash is purged", func(t *testing.T) {
+		oldRetention := services.TrashRetention
+		defer func() { services.TrashRetention = oldRetention }()
+
+		kept := SetupMockNote(t, "123", aliceToken)
+		expired := SetupMockNote(t, "123", aliceToken)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+expired, aliceToken, nil).Code)
+		services.TrashRetention = 0
+
+		purged, err := services.PurgeExpiredTrash()
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, purged, 1)
+		_, err = stores.Notes.FindByID(t.Context(), expired)
+		assert.ErrorIs(t, err, stores.ErrNotFound)
+		_, err = stores.Notes.FindByID(t.Context(), kept)
+		assert.NoError(t, err)
+	})
+}
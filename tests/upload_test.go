@@ -0,0 +1,315 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"note_sharing_application/client/crypto"
+	clientmodels "note_sharing_application/client/models"
+	"note_sharing_application/client/services"
+	"note_sharing_application/server/middlewares"
+	"note_sharing_application/server/models"
+	serverservices "note_sharing_application/server/services"
+	"note_sharing_application/server/stores"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func putChunk(token, uploadID string, index int, data []byte) int {
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/uploads/%s/chunks/%d", uploadID, index), bytes.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func uploadStatus(t *testing.T, token, uploadID string) clientmodels.UploadSession {
+	w := authedRequest("GET", "/uploads/"+uploadID, token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var session clientmodels.UploadSession
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	return session
+}
+
+func TestResumableUpload(t *testing.T) {
+	ownerToken := SetupMockUser(t, "upload_alice", "123")
+	otherToken := SetupMockUser(t, "upload_bob", "123")
+
+	noteID, err := createMetadataNote(ownerToken)
+	assert.NoError(t, err)
+
+	chunkSize := middlewares.MinUploadChunkSize
+	data := generateRandomBytes(int(2*chunkSize) + 100)
+	chunks := [][]byte{data[:chunkSize], data[chunkSize : 2*chunkSize], data[2*chunkSize:]}
+
+	t.Run("Validation", func(t *testing.T) {
+		w := authedRequest("POST", "/notes/"+noteID+"/uploads", ownerToken, map[string]int64{"total_size": 10, "chunk_size": 1024})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = authedRequest("POST", "/notes/"+noteID+"/uploads", ownerToken, map[string]int64{"total_size": 0, "chunk_size": chunkSize})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = authedRequest("POST", "/notes/"+noteID+"/uploads", ownerToken, map[string]int64{"total_size": middlewares.MaxNoteContentSize + 1, "chunk_size": chunkSize})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+		w = authedRequest("POST", "/notes/"+noteID+"/uploads", otherToken, map[string]int64{"total_size": 10, "chunk_size": chunkSize})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	w := authedRequest("POST", "/notes/"+noteID+"/uploads", ownerToken, map[string]int64{"total_size": int64(len(data)), "chunk_size": chunkSize})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var session clientmodels.UploadSession
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.Equal(t, 3, session.ChunkCount)
+	assert.Empty(t, session.Received)
+
+	t.Run("Out of order chunks and received ranges", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, putChunk(ownerToken, session.ID, 2, chunks[2]))
+		assert.Equal(t, http.StatusOK, putChunk(ownerToken, session.ID, 0, chunks[0]))
+		assert.Equal(t, [][2]int{{0, 0}, {2, 2}}, uploadStatus(t, ownerToken, session.ID).Received)
+
+		// Commit khi còn thiếu chunk 1
+		w := authedRequest("POST", "/uploads/"+session.ID+"/commit", ownerToken, nil)
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), `"missing":[1]`)
+	})
+
+	t.Run("Rejects bad chunks", func(t *testing.T) {
+		// Sai kích thước, sai số thứ tự, sai Content-Type
+		assert.Equal(t, http.StatusBadRequest, putChunk(ownerToken, session.ID, 1, chunks[2]))
+		assert.Equal(t, http.StatusBadRequest, putChunk(ownerToken, session.ID, 3, chunks[2]))
+		assert.Equal(t, http.StatusBadRequest, putChunk(ownerToken, session.ID, -1, chunks[2]))
+		w := authedRequest("PUT", fmt.Sprintf("/uploads/%s/chunks/1", session.ID), ownerToken, nil)
+		assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+		// Phiên của người khác coi như không tồn tại
+		assert.Equal(t, http.StatusNotFound, putChunk(otherToken, session.ID, 1, chunks[1]))
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/uploads/"+session.ID, otherToken, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, authedRequest("GET", "/uploads/not-an-id", ownerToken, nil).Code)
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, putChunk(ownerToken, session.ID, 1, chunks[1]))
+		// Gửi lại chunk đã có (client mất phản hồi) thì ghi đè
+		assert.Equal(t, http.StatusOK, putChunk(ownerToken, session.ID, 0, chunks[0]))
+		assert.Equal(t, [][2]int{{0, 2}}, uploadStatus(t, ownerToken, session.ID).Received)
+
+		w := authedRequest("POST", "/uploads/"+session.ID+"/commit", ownerToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var committed clientmodels.Note
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &committed))
+		assert.Equal(t, noteID, committed.ID)
+		assert.Equal(t, int64(len(data)), committed.Size)
+
+		content := authedRequest("GET", "/notes/"+noteID+"/content", ownerToken, nil)
+		assert.Equal(t, http.StatusOK, content.Code)
+		assert.True(t, bytes.Equal(data, content.Body.Bytes()))
+		assert.Equal(t, committed.CipherDigest, content.Header().Get("X-Cipher-Digest"))
+
+		// Phiên bị xóa sau khi commit, note đã có nội dung thì không mở phiên mới
+		assert.Equal(t, http.StatusNotFound, authedRequest("GET", "/uploads/"+session.ID, ownerToken, nil).Code)
+		w = authedRequest("POST", "/notes/"+noteID+"/uploads", ownerToken, map[string]int64{"total_size": 10, "chunk_size": chunkSize})
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+}
+
+func TestResumeUploadClient(t *testing.T) {
+	server := httptest.NewServer(router)
+	defer server.Close()
+	oldBaseURL, oldDir, oldDelay := services.BaseURL, services.KnownKeysDir, services.UploadRetryDelay
+	services.BaseURL = server.URL
+	services.KnownKeysDir = t.TempDir()
+	services.UploadRetryDelay = 0
+	defer func() {
+		services.BaseURL, services.KnownKeysDir, services.UploadRetryDelay = oldBaseURL, oldDir, oldDelay
+	}()
+
+	token := SetupMockUser(t, "resume_alice", "123")
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "big.bin")
+	plain := generateRandomBytes(5*crypto.StreamChunkSize + 3)
+	assert.NoError(t, os.WriteFile(src, plain, 0644))
+
+	aesKey, encKey, err := crypto.NewNoteKey("123")
+	assert.NoError(t, err)
+	prefix, err := crypto.NewStreamPrefix()
+	assert.NoError(t, err)
+
+	// Cùng khóa và prefix thì mã hóa lại ra đúng ciphertext, kích thước tính trước được
+	var first, second bytes.Buffer
+	assert.NoError(t, crypto.EncryptStreamWithPrefix(&first, bytes.NewReader(plain), aesKey, prefix))
+	assert.NoError(t, crypto.EncryptStreamWithPrefix(&second, bytes.NewReader(plain), aesKey, prefix))
+	assert.True(t, bytes.Equal(first.Bytes(), second.Bytes()))
+	assert.Equal(t, int64(first.Len()), crypto.EncryptedSize(int64(len(plain))))
+	for _, n := range []int{0, 1, crypto.StreamChunkSize, crypto.StreamChunkSize + 1} {
+		var buf bytes.Buffer
+		assert.NoError(t, crypto.EncryptStream(&buf, bytes.NewReader(make([]byte, n)), aesKey))
+		assert.Equal(t, int64(buf.Len()), crypto.EncryptedSize(int64(n)))
+	}
+
+	noteID, err := services.CreateNote(token, "", encKey, "")
+	assert.NoError(t, err)
+	session, err := services.CreateUploadSession(token, noteID, int64(first.Len()), middlewares.MinUploadChunkSize)
+	assert.NoError(t, err)
+
+	// Lần đầu chỉ gửi được chunk 0 và 2 rồi mất kết nối
+	ciphertext := first.Bytes()
+	for _, i := range []int{0, 2} {
+		start := int64(i) * session.ChunkSize
+		assert.NoError(t, services.UploadChunk(token, session.ID, i, ciphertext[start:start+session.ChunkLength(i)]))
+	}
+
+	// Ghi journal, đọc lại như lần chạy save sau
+	info, _ := os.Stat(src)
+	hash, err := services.HashUploadFile(src)
+	assert.NoError(t, err)
+	entry := services.UploadJournalEntry{NoteID: noteID, UploadID: session.ID, FileSize: info.Size(), ModTime: info.ModTime(), ContentHash: hash}
+	assert.NoError(t, services.SetUploadJournalEntry("resume_alice", src, &entry))
+	journal, err := services.LoadUploadJournal("resume_alice")
+	assert.NoError(t, err)
+	assert.True(t, journal[src].Matches(src, info))
+
+	// Cùng kích thước và mtime nhưng khác nội dung: không được gửi tiếp (sẽ dùng lại nonce)
+	tampered := filepath.Join(dir, "tampered.bin")
+	edited := append([]byte{}, plain...)
+	edited[0] ^= 0xff
+	assert.NoError(t, os.WriteFile(tampered, edited, 0644))
+	assert.NoError(t, os.Chtimes(tampered, time.Now(), info.ModTime()))
+	tamperedInfo, _ := os.Stat(tampered)
+	assert.Equal(t, info.Size(), tamperedInfo.Size())
+	assert.True(t, info.ModTime().Equal(tamperedInfo.ModTime()))
+	assert.False(t, journal[src].Matches(tampered, tamperedInfo))
+
+	assert.NoError(t, os.Chtimes(src, time.Now(), info.ModTime().Add(time.Second)))
+	changed, _ := os.Stat(src)
+	assert.False(t, journal[src].Matches(src, changed))
+
+	// Gửi tiếp: mã hóa lại từ đầu, chỉ các chunk còn thiếu được gửi
+	status, err := services.GetUploadStatus(token, journal[src].UploadID)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 0}, {2, 2}}, status.Received)
+
+	reader, err := crypto.EncryptFileReaderWithPrefix(src, aesKey, prefix)
+	assert.NoError(t, err)
+	digest := crypto.NewCipherDigest()
+	var sent []int
+	err = services.UploadChunks(token, status, io.TeeReader(reader, digest), func(done, total int) {
+		sent = append(sent, done)
+	})
+	reader.Close()
+	assert.NoError(t, err)
+	assert.Len(t, sent, status.ChunkCount)
+	status, err = services.GetUploadStatus(token, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, status.ChunkCount - 1}}, status.Received)
+
+	note, err := services.CommitUpload(token, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, digest.Hex(), note.CipherDigest)
+	assert.NoError(t, services.SetUploadJournalEntry("resume_alice", src, nil))
+	journal, _ = services.LoadUploadJournal("resume_alice")
+	assert.Empty(t, journal)
+
+	// Phiên đã commit không còn
+	_, err = services.GetUploadStatus(token, session.ID)
+	assert.ErrorIs(t, err, services.ErrUploadNotFound)
+
+	out := filepath.Join(dir, "out.bin")
+	body, err := services.OpenNoteContent(token, noteID)
+	assert.NoError(t, err)
+	assert.NoError(t, crypto.RestoreFileFromReader(body, aesKey, note.CipherDigest, out))
+	body.Close()
+	restored, _ := os.ReadFile(out)
+	assert.True(t, bytes.Equal(plain, restored))
+}
+
+// Phiên upload bỏ dở bị xóa cùng blob của các chunk đã nhận (hết hạn hoặc note bị xóa hẳn)
+func TestUploadCleanup(t *testing.T) {
+	ctx := t.Context()
+
+	putBlob := func(data string) string {
+		ref, _, err := stores.Blobs.Put(ctx, bytes.NewReader([]byte(data)))
+		assert.NoError(t, err)
+		return ref
+	}
+	blobExists := func(ref string) bool {
+		blob, err := stores.Blobs.Open(ctx, ref)
+		if err != nil {
+			return false
+		}
+		blob.Close()
+		return true
+	}
+
+	t.Run("Sweep expired sessions", func(t *testing.T) {
+		expiredChunks := []string{putBlob("chunk 0"), putBlob("chunk 1")}
+		expiredID, err := stores.Uploads.Create(ctx, models.UploadSession{
+			NoteID: primitive.NewObjectID().Hex(), TotalSize: 14, ChunkSize: 7,
+			Chunks:    map[string]string{"0": expiredChunks[0], "1": expiredChunks[1]},
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+		assert.NoError(t, err)
+
+		liveChunk := putBlob("live")
+		liveID, err := stores.Uploads.Create(ctx, models.UploadSession{
+			NoteID: primitive.NewObjectID().Hex(), TotalSize: 8, ChunkSize: 4,
+			Chunks:    map[string]string{"0": liveChunk},
+			ExpiresAt: time.Now().Add(time.Hour),
+		})
+		assert.NoError(t, err)
+
+		swept, err := serverservices.SweepExpiredUploads()
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, swept, 1)
+
+		for _, ref := range expiredChunks {
+			assert.False(t, blobExists(ref), "Blob của chunk trong phiên hết hạn phải bị xóa")
+		}
+		expired, err := stores.Uploads.ListExpired(ctx, time.Now())
+		assert.NoError(t, err)
+		for _, session := range expired {
+			assert.NotEqual(t, expiredID, session.ID.Hex())
+		}
+
+		_, err = stores.Uploads.FindByID(ctx, liveID)
+		assert.NoError(t, err)
+		assert.True(t, blobExists(liveChunk))
+	})
+
+	t.Run("Purging a note removes its open sessions", func(t *testing.T) {
+		token := SetupMockUser(t, "cleanup_alice", "123")
+		noteID, err := createMetadataNote(token)
+		assert.NoError(t, err)
+
+		chunkSize := middlewares.MinUploadChunkSize
+		w := authedRequest("POST", "/notes/"+noteID+"/uploads", token, map[string]int64{"total_size": 2 * chunkSize, "chunk_size": chunkSize})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var session clientmodels.UploadSession
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+		assert.Equal(t, http.StatusOK, putChunk(token, session.ID, 0, generateRandomBytes(int(chunkSize))))
+
+		stored, err := stores.Uploads.FindByID(ctx, session.ID)
+		assert.NoError(t, err)
+		chunkRef := stored.Chunks["0"]
+		assert.True(t, blobExists(chunkRef))
+
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/"+noteID, token, nil).Code)
+		assert.Equal(t, http.StatusOK, authedRequest("DELETE", "/notes/trash/"+noteID, token, nil).Code)
+
+		sessions, err := stores.Uploads.ListByNote(ctx, noteID)
+		assert.NoError(t, err)
+		assert.Empty(t, sessions)
+		assert.False(t, blobExists(chunkRef))
+	})
+}
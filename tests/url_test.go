@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,9 +18,15 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// Public key DH hợp lệ cho user giả (server kiểm tra khóa lúc đăng ký)
+func mockPublicKey() string {
+	_, pub, _ := crypto.GenerateKeyPair()
+	return pub.Text(16)
+}
+
 func SetupMockUser(t *testing.T, username, password string) string {
 	// Giả lập đăng ký & đăng nhập để lấy token
-	mockPubKey := "MockPublicKeyHexString"
+	mockPubKey := mockPublicKey()
 	mockEncPrivKey := "MockEncryptedPrivateKeyHex"
 	//Đăng ký
 	encryptedPass := encryptPasswordForTest(password)
@@ -59,6 +67,21 @@ func SetupMockUser(t *testing.T, username, password string) string {
 	return token
 }
 
+// Gửi request kèm access token tới router, body là JSON (nếu khác nil)
+func authedRequest(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewReader(jsonBody)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
 // Tạo Note test
 func SetupMockNote(t *testing.T, password, token string) string {
 	cipherTextBase64, encryptedAESKey, _ := crypto.PrepareFileForUpload("text.txt", password)
@@ -218,3 +241,41 @@ func TestURL(t *testing.T) {
 		assert.Equal(t, http.StatusNotFound, code2, "Trạng thái 404 khi link đã hết lượt xem")
 	})
 }
+
+// KIỂM TRA ĐẾM LƯỢT XEM KHI TRUY CẬP ĐỒNG THỜI
+// N request song song chỉ được thành công đúng MaxAccess lần
+func TestURLConcurrentAccess(t *testing.T) {
+	senderToken := SetupMockUser(t, "sender_race", "123")
+	recvToken := SetupMockUser(t, "receiver_race", "123")
+
+	const maxAccess = 3
+	const parallel = 50
+
+	noteId := SetupMockNote(t, "123", senderToken)
+	urlID := SetupMockURL(t, noteId, "sender_race", "receiver_race", "1h", maxAccess, senderToken, recvToken)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	success := 0
+
+	start := make(chan struct{})
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			if AccessURL(t, urlID, recvToken) == http.StatusOK {
+				mu.Lock()
+				success++
+				mu.Unlock()
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, maxAccess, success, "Số lượt xem thành công phải đúng bằng MaxAccess")
+
+	// Sau khi dùng hết lượt thì link không còn truy cập được
+	assert.Equal(t, http.StatusNotFound, AccessURL(t, urlID, recvToken))
+}